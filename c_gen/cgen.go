@@ -0,0 +1,537 @@
+package cgen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+// CGen lowers a TackyProgram to C99. Every value is a 32 or 64-bit integer
+// or a double: strings and arrays travel as 64-bit addresses like they do in the assembly
+// backend and only turn into pointers at loads, stores and calls into lib.c.
+type CGen struct {
+	writer      io.Writer
+	symbolTable *symbols.SymbolTable
+	// SourceFile is named in the #line directives written for -g.
+	SourceFile string
+
+	globals map[string]string
+	taken   map[string]bool
+	locals  map[string]string
+	fnTypes map[string]*mtypes.FnType
+	externs map[string]bool
+}
+
+func NewCGen(writer io.Writer, symbolTable *symbols.SymbolTable) CGen {
+	return CGen{
+		writer:      writer,
+		symbolTable: symbolTable,
+		globals:     make(map[string]string),
+		taken:       make(map[string]bool),
+		fnTypes:     make(map[string]*mtypes.FnType),
+		externs:     make(map[string]bool),
+	}
+}
+
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true,
+	"enum": true, "extern": true, "float": true, "for": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true,
+	"volatile": true, "while": true, "main": true, "malloc": true,
+}
+
+// cIdent spells name the way the assembly backend does, with anything a C
+// identifier can't hold replaced by an underscore.
+func cIdent(name string) string {
+	var buf strings.Builder
+	for _, r := range utfconvert.UtfConvert(name) {
+		if r == '_' || r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteRune('_')
+		}
+	}
+	ident := buf.String()
+	if ident == "" || ident[0] >= '0' && ident[0] <= '9' {
+		ident = "_" + ident
+	}
+	return ident
+}
+
+// unique picks a spelling for name no other name in scope has. Function names
+// are kept as fnIdent spells them, lib.c defines the externs under exactly
+// those names.
+func (c *CGen) unique(name string, taken map[string]bool) string {
+	ident := cIdent(name)
+	candidate := ident
+	for i := 1; taken[candidate] || cKeywords[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", ident, i)
+	}
+	taken[candidate] = true
+	return candidate
+}
+
+// fnIdent is the symbol the assembly backend gives fn, mangled with
+// utfconvert.Mangle unless it is an extern lib.c defines.
+func (c *CGen) fnIdent(fn tackygen.TackyFn) string {
+	if fn.IsExtern {
+		return cIdent(fn.Name)
+	}
+	return utfconvert.Mangle(fn.Name)
+}
+
+func (c *CGen) GenProgram(program tackygen.TackyProgram) {
+	for _, fn := range append(append([]tackygen.TackyFn{}, program.ExternDefs...), program.FnDefs...) {
+		if fn.IsExtern {
+			c.externs[fn.Name] = true
+		}
+		if entry := c.symbolTable.Get(fn.Name); entry != nil {
+			if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+				c.fnTypes[fn.Name] = fnType
+			}
+		}
+		c.globals[fn.Name] = c.fnIdent(fn)
+		c.taken[c.fnIdent(fn)] = true
+	}
+	for _, gv := range program.GlobalVars {
+		c.globals[gv.Name] = c.unique(gv.Name, c.taken)
+	}
+
+	c.Write("// mon компиляторын үүсгэсэн C99 код")
+	c.Write("#include <math.h>")
+	c.Write("#include <stdbool.h>")
+	c.Write("#include <stddef.h>")
+	c.Write("#include <stdint.h>")
+	c.Write("")
+	c.Write("void *malloc(size_t size);")
+	for _, fn := range program.ExternDefs {
+		if fnType, ok := c.fnTypes[fn.Name]; ok {
+			c.Write(c.externPrototype(fn, fnType) + ";")
+		}
+	}
+	c.Write("")
+
+	if len(program.GlobalVars) > 0 {
+		for _, gv := range program.GlobalVars {
+			init := fmt.Sprintf("%d", gv.InitValue)
+			if c.varType(gv.Name) == "double" {
+				init = cDouble(math.Float64frombits(uint64(gv.InitValue)))
+			}
+			c.Write(fmt.Sprintf("static %s %s = %s;", c.varType(gv.Name), c.globals[gv.Name], init))
+		}
+		c.Write("")
+	}
+
+	for _, fn := range program.FnDefs {
+		c.Write(c.prototype(fn) + ";")
+	}
+
+	hasMain := false
+	for _, fn := range program.FnDefs {
+		c.Write("")
+		c.GenFn(fn)
+		hasMain = hasMain || fn.Name == "үндсэн"
+	}
+
+	if hasMain {
+		// like the assembly entry, the runtime sees argc and argv first
+		// and аргс is argv
+		arg := ""
+		if len(c.fnTypes["үндсэн"].ParamTypes) == 1 {
+			arg = "(int64_t)(intptr_t)argv"
+		}
+		c.Write("")
+		c.Write("char **mon_rt_args(int argc, char **argv);")
+		c.Write("")
+		c.Write("int main(int argc, char **argv) {")
+		c.Write("    mon_rt_args(argc, argv);")
+		if _, void := c.fnTypes["үндсэн"].RetType.(*mtypes.VoidType); void {
+			c.Write(fmt.Sprintf("    %s(%s);", c.globals["үндсэн"], arg))
+			c.Write("    return 0;")
+		} else {
+			c.Write(fmt.Sprintf("    return (int)%s(%s);", c.globals["үндсэн"], arg))
+		}
+		c.Write("}")
+	}
+}
+
+func (c *CGen) prototype(fn tackygen.TackyFn) string {
+	fnType := c.fnTypes[fn.Name]
+	params := []string{}
+	for i, param := range fn.Params {
+		var paramType string
+		if fnType != nil && i < len(fnType.ParamTypes) {
+			paramType = cType(fnType.ParamTypes[i])
+		} else {
+			paramType = c.valType(param)
+		}
+		if c.locals != nil {
+			paramType += " " + c.locals[param.(tackygen.Var).Name]
+		}
+		params = append(params, paramType)
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+
+	storage := "static "
+	if fn.Global {
+		storage = ""
+	}
+	retType := "int32_t"
+	if fnType != nil {
+		retType = cType(fnType.RetType)
+	}
+	return fmt.Sprintf("%s%s %s(%s)", storage, retType, c.globals[fn.Name], strings.Join(params, ", "))
+}
+
+// externPrototype declares a lib.c function with the pointer types lib.c
+// uses for strings and arrays.
+func (c *CGen) externPrototype(fn tackygen.TackyFn, fnType *mtypes.FnType) string {
+	params := []string{}
+	for _, paramType := range fnType.ParamTypes {
+		params = append(params, externType(paramType))
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	return fmt.Sprintf("%s %s(%s)", externType(fnType.RetType), c.globals[fn.Name], strings.Join(params, ", "))
+}
+
+func cType(t mtypes.Type) string {
+	switch t.(type) {
+	case *mtypes.VoidType:
+		return "void"
+	case *mtypes.Int32Type, *mtypes.EnumType:
+		return "int32_t"
+	case *mtypes.BoolType:
+		return "bool"
+	case *mtypes.DoubleType:
+		return "double"
+	default:
+		return "int64_t"
+	}
+}
+
+func externType(t mtypes.Type) string {
+	switch t.(type) {
+	case *mtypes.StringType:
+		return "const char *"
+	case *mtypes.ArrayType, *mtypes.StructType:
+		return "void *"
+	default:
+		return cType(t)
+	}
+}
+
+func isPointer(t mtypes.Type) bool {
+	switch t.(type) {
+	case *mtypes.StringType, *mtypes.ArrayType, *mtypes.StructType:
+		return true
+	}
+	return false
+}
+
+func (c *CGen) varType(name string) string {
+	entry := c.symbolTable.Get(name)
+	if entry == nil {
+		return "int64_t"
+	}
+	return cType(entry.Type)
+}
+
+func (c *CGen) valType(val tackygen.TackyVal) string {
+	switch v := val.(type) {
+	case tackygen.Var:
+		return c.varType(v.Name)
+	case tackygen.Constant:
+		switch v.Value.(type) {
+		case *mconstant.Int32:
+			return "int32_t"
+		case *mconstant.Bool:
+			return "bool"
+		case *mconstant.Double:
+			return "double"
+		}
+	}
+	return "int64_t"
+}
+
+func unsignedType(t string) string {
+	return "u" + t
+}
+
+func (c *CGen) GenFn(fn tackygen.TackyFn) {
+	c.locals = make(map[string]string)
+	taken := make(map[string]bool)
+	for ident := range c.taken {
+		taken[ident] = true
+	}
+	order := []string{}
+	addLocal := func(val tackygen.TackyVal) {
+		v, ok := val.(tackygen.Var)
+		if !ok {
+			return
+		}
+		if _, seen := c.locals[v.Name]; seen {
+			return
+		}
+		if _, global := c.globals[v.Name]; global {
+			return
+		}
+		c.locals[v.Name] = c.unique(v.Name, taken)
+		order = append(order, v.Name)
+	}
+	for _, param := range fn.Params {
+		addLocal(param)
+	}
+	for _, instr := range fn.Instructions {
+		uses, def := tackygen.UsesAndDef(instr)
+		for _, use := range uses {
+			addLocal(use)
+		}
+		if def != nil {
+			addLocal(def)
+		}
+	}
+
+	c.Write(c.prototype(fn) + " {")
+	for _, name := range order[len(fn.Params):] {
+		if c.varType(name) == "void" {
+			continue
+		}
+		c.Write(fmt.Sprintf("    %s %s;", c.varType(name), c.locals[name]))
+	}
+	for _, instr := range fn.Instructions {
+		c.genInstr(fn, instr)
+	}
+	c.Write("}")
+	c.locals = nil
+}
+
+func (c *CGen) name(val tackygen.Var) string {
+	if ident, ok := c.locals[val.Name]; ok {
+		return ident
+	}
+	return c.globals[val.Name]
+}
+
+func (c *CGen) value(val tackygen.TackyVal) string {
+	switch v := val.(type) {
+	case tackygen.Var:
+		return c.name(v)
+	case tackygen.Constant:
+		if b, ok := v.Value.(*mconstant.Bool); ok {
+			return fmt.Sprintf("%t", b.Value)
+		}
+		if d, ok := v.Value.(*mconstant.Double); ok {
+			return cDouble(d.Value)
+		}
+		if _, ok := v.Value.(*mconstant.Int32); ok {
+			if v.Value.GetValue() == math.MinInt32 {
+				return "INT32_MIN"
+			}
+			return fmt.Sprintf("%d", v.Value.GetValue())
+		}
+		if v.Value.GetValue() == math.MinInt64 {
+			return "INT64_MIN"
+		}
+		return fmt.Sprintf("INT64_C(%d)", v.Value.GetValue())
+	case tackygen.StringConstant:
+		return fmt.Sprintf("(int64_t)(intptr_t)%s", quote(v.Value))
+	}
+	panic(fmt.Sprintf("unimplemented val: %T", val))
+}
+
+// cDouble writes f as a hexadecimal literal, which C reads back without
+// rounding.
+func cDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NAN"
+	case math.IsInf(f, 1):
+		return "INFINITY"
+	case math.IsInf(f, -1):
+		return "-INFINITY"
+	}
+	return strconv.FormatFloat(f, 'x', -1, 64)
+}
+
+// quote writes s as a C string literal. Everything outside printable ASCII
+// goes out as an octal escape so the file doesn't depend on the source
+// character set of the C compiler.
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b == '"' || b == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case b == '\n':
+			buf.WriteString("\\n")
+		case b == '\t':
+			buf.WriteString("\\t")
+		case b < 0x20 || b >= 0x7f || b == '?':
+			fmt.Fprintf(&buf, "\\%03o", b)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+var binaryOps = map[tackygen.TackyBinaryOp]string{
+	tackygen.Add:              "+",
+	tackygen.Sub:              "-",
+	tackygen.Mul:              "*",
+	tackygen.Div:              "/",
+	tackygen.Modulo:           "%",
+	tackygen.Equal:            "==",
+	tackygen.NotEqual:         "!=",
+	tackygen.LessThan:         "<",
+	tackygen.LessThanEqual:    "<=",
+	tackygen.GreaterThan:      ">",
+	tackygen.GreaterThanEqual: ">=",
+}
+
+func (c *CGen) genInstr(fn tackygen.TackyFn, instr tackygen.Instruction) {
+	switch ir := instr.(type) {
+	case tackygen.Copy:
+		c.stmt("%s = %s;", c.value(ir.Dst), c.value(ir.Src))
+	case tackygen.Truncate:
+		c.stmt("%s = (int32_t)%s;", c.value(ir.Dst), c.value(ir.Src))
+	case tackygen.SignExtend:
+		c.stmt("%s = (int64_t)%s;", c.value(ir.Dst), c.value(ir.Src))
+	case tackygen.IntToDouble:
+		c.stmt("%s = (double)%s;", c.value(ir.Dst), c.value(ir.Src))
+	case tackygen.DoubleToInt:
+		c.stmt("%s = (%s)%s;", c.value(ir.Dst), c.valType(ir.Dst), c.value(ir.Src))
+	case tackygen.Unary:
+		dstType := c.valType(ir.Dst)
+		switch {
+		case ir.Op == tackygen.Negate && dstType == "double":
+			c.stmt("%s = -%s;", c.value(ir.Dst), c.value(ir.Src))
+		case ir.Op == tackygen.Negate:
+			c.stmt("%s = (%s)(0 - (%s)%s);", c.value(ir.Dst), dstType, unsignedType(dstType), c.value(ir.Src))
+		case ir.Op == tackygen.Complement:
+			c.stmt("%s = ~%s;", c.value(ir.Dst), c.value(ir.Src))
+		case ir.Op == tackygen.Not:
+			c.stmt("%s = !%s;", c.value(ir.Dst), c.value(ir.Src))
+		default:
+			panic(fmt.Sprintf("unimplemented unary op: %s", ir.Op))
+		}
+	case tackygen.Binary:
+		op, ok := binaryOps[ir.Op]
+		if !ok {
+			panic(fmt.Sprintf("unimplemented binary op: %s", ir.Op))
+		}
+		switch ir.Op {
+		case tackygen.Add, tackygen.Sub, tackygen.Mul:
+			if c.valType(ir.Dst) == "double" {
+				c.stmt("%s = %s %s %s;", c.value(ir.Dst), c.value(ir.Src1), op, c.value(ir.Src2))
+				break
+			}
+			// wrap around on overflow like the machine instructions do,
+			// signed overflow is undefined in C
+			dstType := c.valType(ir.Dst)
+			unsigned := unsignedType(dstType)
+			c.stmt("%s = (%s)((%s)%s %s (%s)%s);", c.value(ir.Dst), dstType,
+				unsigned, c.value(ir.Src1), op, unsigned, c.value(ir.Src2))
+		default:
+			c.stmt("%s = %s %s %s;", c.value(ir.Dst), c.value(ir.Src1), op, c.value(ir.Src2))
+		}
+	case tackygen.Load:
+		c.stmt("%s = *(%s *)(intptr_t)%s;", c.value(ir.Dst), c.valType(ir.Dst), c.value(ir.Src))
+	case tackygen.Store:
+		c.stmt("*(%s *)(intptr_t)%s = %s;", c.valType(ir.Src), c.value(ir.Dst), c.value(ir.Src))
+	case tackygen.Jump:
+		c.stmt("goto %s;", cIdent(ir.Target))
+	case tackygen.JumpIfZero:
+		c.stmt("if (%s == 0) goto %s;", c.value(ir.Val), cIdent(ir.Ident))
+	case tackygen.JumpIfNotZero:
+		c.stmt("if (%s != 0) goto %s;", c.value(ir.Val), cIdent(ir.Ident))
+	case tackygen.JumpTable:
+		c.stmt("switch (%s) {", c.value(ir.Index))
+		for i, target := range ir.Targets {
+			c.stmt("case %d: goto %s;", i, cIdent(target))
+		}
+		c.stmt("}")
+	case tackygen.Label:
+		// C99 wants a statement after a label, even at the end of a block
+		c.Write(fmt.Sprintf("%s: ;", cIdent(ir.Ident)))
+	case tackygen.SourceLine:
+		file := fn.File
+		if file == "" {
+			file = c.SourceFile
+		}
+		c.Write(fmt.Sprintf("#line %d %s", ir.Line, quote(file)))
+	case tackygen.Return:
+		if fnType := c.fnTypes[fn.Name]; fnType != nil && cType(fnType.RetType) == "void" {
+			c.stmt("return;")
+		} else {
+			c.stmt("return %s;", c.value(ir.Value))
+		}
+	case tackygen.FnCall:
+		c.genCall(ir)
+	default:
+		panic(fmt.Sprintf("unimplemented instruction: %T", instr))
+	}
+}
+
+func (c *CGen) genCall(call tackygen.FnCall) {
+	fnType := c.fnTypes[call.Name]
+	args := []string{}
+	for i, arg := range call.Args {
+		var paramType mtypes.Type
+		if fnType != nil && i < len(fnType.ParamTypes) {
+			paramType = fnType.ParamTypes[i]
+		}
+		switch {
+		case call.Name == "malloc":
+			args = append(args, fmt.Sprintf("(size_t)%s", c.value(arg)))
+		case c.externs[call.Name] && isPointer(paramType):
+			if str, ok := arg.(tackygen.StringConstant); ok {
+				args = append(args, quote(str.Value))
+			} else {
+				args = append(args, fmt.Sprintf("(%s)(intptr_t)%s", externType(paramType), c.value(arg)))
+			}
+		default:
+			args = append(args, c.value(arg))
+		}
+	}
+
+	expr := fmt.Sprintf("%s(%s)", c.globals[call.Name], strings.Join(args, ", "))
+	if call.Name == "malloc" || c.externs[call.Name] && fnType != nil && isPointer(fnType.RetType) {
+		expr = "(int64_t)(intptr_t)" + expr
+	}
+
+	returnsVoid := fnType != nil && cType(fnType.RetType) == "void"
+	if call.Dst == nil || returnsVoid || c.valType(call.Dst) == "void" {
+		c.stmt("%s;", expr)
+		return
+	}
+	c.stmt("%s = %s;", c.value(call.Dst), expr)
+}
+
+func (c *CGen) stmt(format string, args ...interface{}) {
+	c.Write("    " + fmt.Sprintf(format, args...))
+}
+
+func (c *CGen) Write(line string) {
+	fmt.Fprintln(c.writer, line)
+}
@@ -0,0 +1,119 @@
+package cgen
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/parser"
+	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func compileAndRun(t *testing.T, srcFile string, input string) string {
+	t.Helper()
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("cc not found")
+	}
+
+	data, err := os.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	source := append([]int32(string(data)), 0)
+
+	uniqueGen := unique.NewUniqueGen()
+	p := parser.NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	table := symbols.NewSymbolTable()
+	resolver := semanticanalysis.NewSemanticAnalyzer(source, uniqueGen, table, filepath.Dir(srcFile), "../stdlib")
+	resolved, symbolTable, err := resolver.Analyze(program)
+	if err != nil {
+		t.Fatalf("semantic analysis failed: %v", err)
+	}
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolved)
+
+	var src bytes.Buffer
+	cGen := NewCGen(&src, symbolTable)
+	cGen.GenProgram(tackyProgram)
+
+	dir := t.TempDir()
+	cFile := filepath.Join(dir, "out.c")
+	if err := os.WriteFile(cFile, src.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "out")
+	if out, err := exec.Command(cc, "-std=c99", "-O2", "-Werror=implicit-function-declaration", "-c", "-o", exe+".o", cFile).CombinedOutput(); err != nil {
+		t.Fatalf("cc failed: %v\n%s\n%s", err, out, src.String())
+	}
+	if out, err := exec.Command(cc, "-o", exe, exe+".o", "../stdlib/lib.c").CombinedOutput(); err != nil {
+		t.Fatalf("link failed: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(exe)
+	cmd.Stdin = strings.NewReader(input)
+	output, _ := cmd.Output()
+	return string(output)
+}
+
+func TestControlFlow(t *testing.T) {
+	output := compileAndRun(t, "../test/features/control_flow.mn", "")
+	if output != "3 12 6 20 99\n" {
+		t.Errorf("expected %q, got %q", "3 12 6 20 99\n", output)
+	}
+}
+
+func TestTypeCoercion(t *testing.T) {
+	output := compileAndRun(t, "../test/features/types.mn", "")
+	if output != "300 30 42 100\n" {
+		t.Errorf("expected %q, got %q", "300 30 42 100\n", output)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	output := compileAndRun(t, "../test/features/tail_calls.mn", "")
+	if output != "50000005000000 21 20\n" {
+		t.Errorf("expected %q, got %q", "50000005000000 21 20\n", output)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	output := compileAndRun(t, "../test/examples/fibonacci.mn", "10\n")
+	if output != "5555" {
+		t.Errorf("expected %q, got %q", "5555", output)
+	}
+}
+
+func TestCIdent(t *testing.T) {
+	c := NewCGen(nil, symbols.NewSymbolTable())
+	taken := map[string]bool{}
+	if got := c.unique("tmp.3", taken); got != "tmp_3" {
+		t.Errorf("expected tmp_3, got %s", got)
+	}
+	// the user's tmp_3 must not land on the temporary
+	if got := c.unique("tmp_3", taken); got != "tmp_3_1" {
+		t.Errorf("expected tmp_3_1, got %s", got)
+	}
+	if got := c.unique("int", taken); got != "int_1" {
+		t.Errorf("expected int_1, got %s", got)
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	expected := "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+	output := compileAndRun(t, "../test/features/doubles.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
@@ -0,0 +1,168 @@
+package cgen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+// resolverSuffix is the _N the resolver appends to make local names unique.
+var resolverSuffix = regexp.MustCompile(`_[0-9]+$`)
+
+// GenHeader writes a C header for --emit-header that declares every тунх
+// function of the program under the symbol the backends give it, so C and
+// cgo can call into a library built with --shared. The symbol is mangled, a
+// static inline wrapper under the UtfConvert name is what callers use.
+// guard names the include guard.
+func GenHeader(writer io.Writer, program tackygen.TackyProgram, symbolTable *symbols.SymbolTable, guard string) {
+	write := func(format string, args ...interface{}) {
+		fmt.Fprintf(writer, format+"\n", args...)
+	}
+	write("/* Mon хөрвүүлэгчийн үүсгэсэн файл, гараар засахгүй. */")
+	write("#ifndef %s", guard)
+	write("#define %s", guard)
+	write("")
+	write("#include <stdbool.h>")
+	write("#include <stdint.h>")
+	write("")
+	write("#ifdef __cplusplus")
+	write("extern \"C\" {")
+	write("#endif")
+
+	fnTypes := map[string]*mtypes.FnType{}
+	signatures := []mtypes.Type{}
+	for _, fn := range program.FnDefs {
+		if !fn.Global {
+			continue
+		}
+		entry := symbolTable.Get(fn.Name)
+		if entry == nil {
+			continue
+		}
+		if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+			fnTypes[fn.Name] = fnType
+			signatures = append(append(signatures, fnType.RetType), fnType.ParamTypes...)
+		}
+	}
+	genHeaderStructs(write, headerStructs(signatures))
+
+	for _, fn := range program.FnDefs {
+		fnType, ok := fnTypes[fn.Name]
+		if !ok {
+			continue
+		}
+		params, args := []string{}, []string{}
+		for i, param := range fn.Params {
+			name := cIdent(resolverSuffix.ReplaceAllString(param.(tackygen.Var).Name, ""))
+			if cKeywords[name] {
+				name += "_"
+			}
+			params = append(params, headerType(fnType.ParamTypes[i])+name)
+			args = append(args, name)
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		retType := headerType(fnType.RetType)
+		call := fmt.Sprintf("%s(%s)", utfconvert.Mangle(fn.Name), strings.Join(args, ", "))
+		if _, void := fnType.RetType.(*mtypes.VoidType); !void {
+			call = "return " + call
+		}
+		write("")
+		write("/* %s */", fn.Name)
+		write("%s%s(%s);", retType, utfconvert.Mangle(fn.Name), strings.Join(params, ", "))
+		write("static inline %s%s(%s) { %s; }", retType, cIdent(fn.Name), strings.Join(params, ", "), call)
+	}
+	write("")
+	write("#ifdef __cplusplus")
+	write("}")
+	write("#endif")
+	write("")
+	write("#endif /* %s */", guard)
+}
+
+// headerStructs finds the бүтэц types among types, and the ones their
+// fields lead to, in the order they are met.
+func headerStructs(types []mtypes.Type) []*mtypes.StructType {
+	structs := []*mtypes.StructType{}
+	seen := map[*mtypes.StructType]bool{}
+	var visit func(t mtypes.Type)
+	visit = func(t mtypes.Type) {
+		switch t := t.(type) {
+		case *mtypes.ArrayType:
+			visit(t.ElementType)
+		case *mtypes.StructType:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+			structs = append(structs, t)
+			for _, field := range t.Fields {
+				visit(field.Type)
+			}
+		}
+	}
+	for _, t := range types {
+		visit(t)
+	}
+	return structs
+}
+
+// genHeaderStructs declares the structs with the layout the backends give
+// them, which is the one a C compiler picks for the same fields. They are
+// all named first so they can point to each other. A бүтэц read back from
+// TACKY has no fields and stays opaque.
+func genHeaderStructs(write func(format string, args ...interface{}), structs []*mtypes.StructType) {
+	if len(structs) == 0 {
+		return
+	}
+	write("")
+	for _, st := range structs {
+		write("typedef struct %s %s;", cIdent(st.Name), cIdent(st.Name))
+	}
+	for _, st := range structs {
+		if len(st.Fields) == 0 {
+			continue
+		}
+		write("")
+		write("/* %s */", st.Name)
+		write("struct %s {", cIdent(st.Name))
+		for _, field := range st.Fields {
+			name := cIdent(field.Name)
+			if cKeywords[name] {
+				name += "_"
+			}
+			write("    %s%s;", headerType(field.Type), name)
+		}
+		write("};")
+	}
+}
+
+// headerType spells t for a declaration, with the space before the name.
+// An array is a pointer to its first element, a бүтэц is a pointer to it.
+func headerType(t mtypes.Type) string {
+	switch t := t.(type) {
+	case *mtypes.StringType:
+		return "const char *"
+	case *mtypes.ArrayType:
+		return headerType(t.ElementType) + "*"
+	case *mtypes.StructType:
+		return cIdent(t.Name) + " *"
+	default:
+		return cType(t) + " "
+	}
+}
+
+// HeaderGuard turns the header's path into an include guard, MON_FIB_H for
+// out/fib.h.
+func HeaderGuard(headerFile string) string {
+	base := filepath.Base(headerFile)
+	return "MON_" + strings.ToUpper(cIdent(strings.TrimSuffix(base, filepath.Ext(base)))) + "_H"
+}
@@ -0,0 +1,235 @@
+package cfg
+
+import (
+	"fmt"
+
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// BasicBlock is a straight run of instructions entered only at the top and
+// left only at the bottom. A leading Label stays in Instructions so the block
+// can be flattened back unchanged.
+type BasicBlock struct {
+	ID           int
+	Label        string
+	Phis         []*Phi
+	Instructions []tackygen.Instruction
+	Succs        []*BasicBlock
+	Preds        []*BasicBlock
+}
+
+func (b *BasicBlock) Name() string {
+	return fmt.Sprintf("B%d", b.ID)
+}
+
+// Terminator returns the jump or return ending the block, or nil when the
+// block falls through into the next one.
+func (b *BasicBlock) Terminator() tackygen.Instruction {
+	if len(b.Instructions) == 0 {
+		return nil
+	}
+	switch last := b.Instructions[len(b.Instructions)-1].(type) {
+	case tackygen.Jump, tackygen.JumpIfZero, tackygen.JumpIfNotZero, tackygen.JumpTable, tackygen.Return:
+		return last
+	}
+	return nil
+}
+
+func (b *BasicBlock) predIndex(pred *BasicBlock) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+	return -1
+}
+
+// Graph is the control-flow graph of one function. Blocks are kept in layout
+// order, so falling off the end of a block continues in the next one. Exit is
+// a synthetic empty block every Return leads to, it is not part of Blocks.
+type Graph struct {
+	Fn     tackygen.TackyFn
+	Blocks []*BasicBlock
+	Entry  *BasicBlock
+	Exit   *BasicBlock
+	nextID int
+}
+
+// Build splits fn into basic blocks at labels and after every jump or return.
+func Build(fn tackygen.TackyFn) *Graph {
+	g := &Graph{Fn: fn}
+
+	var current *BasicBlock
+	for _, instr := range fn.Instructions {
+		if lbl, isLabel := instr.(tackygen.Label); isLabel || current == nil {
+			current = g.newBlock()
+			if isLabel {
+				current.Label = lbl.Ident
+			}
+			g.Blocks = append(g.Blocks, current)
+		}
+		current.Instructions = append(current.Instructions, instr)
+		if current.Terminator() != nil {
+			current = nil
+		}
+	}
+	if len(g.Blocks) == 0 {
+		g.Blocks = append(g.Blocks, g.newBlock())
+	}
+	g.Entry = g.Blocks[0]
+	g.Exit = g.newBlock()
+	g.linkEdges()
+
+	// a loop starting at the first instruction jumps back to the entry, give
+	// it an empty block in front so the entry never has predecessors
+	if len(g.Entry.Preds) > 0 {
+		g.Entry = g.newBlock()
+		g.Blocks = append([]*BasicBlock{g.Entry}, g.Blocks...)
+		g.linkEdges()
+	}
+	return g
+}
+
+func (g *Graph) newBlock() *BasicBlock {
+	b := &BasicBlock{ID: g.nextID}
+	g.nextID++
+	return b
+}
+
+func (g *Graph) blockByLabel() map[string]*BasicBlock {
+	labels := map[string]*BasicBlock{}
+	for _, b := range g.Blocks {
+		if b.Label != "" {
+			labels[b.Label] = b
+		}
+	}
+	return labels
+}
+
+// linkEdges recomputes Succs and Preds from the instructions and layout.
+func (g *Graph) linkEdges() {
+	g.Exit.Preds = nil
+	for _, b := range g.Blocks {
+		b.Succs = nil
+		b.Preds = nil
+	}
+
+	labels := g.blockByLabel()
+	for i, b := range g.Blocks {
+		next := g.Exit
+		if i+1 < len(g.Blocks) {
+			next = g.Blocks[i+1]
+		}
+
+		switch term := b.Terminator().(type) {
+		case tackygen.Return:
+			g.addEdge(b, g.Exit)
+		case tackygen.Jump:
+			g.addEdge(b, labels[term.Target])
+		case tackygen.JumpIfZero:
+			g.addEdge(b, labels[term.Ident])
+			g.addEdge(b, next)
+		case tackygen.JumpIfNotZero:
+			g.addEdge(b, labels[term.Ident])
+			g.addEdge(b, next)
+		case tackygen.JumpTable:
+			for _, target := range term.Targets {
+				g.addEdge(b, labels[target])
+			}
+		default:
+			g.addEdge(b, next)
+		}
+	}
+}
+
+func (g *Graph) addEdge(from, to *BasicBlock) {
+	if to == nil {
+		return
+	}
+	for _, succ := range from.Succs {
+		if succ == to {
+			return
+		}
+	}
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// Reachable reports every block control can reach from Entry.
+func (g *Graph) Reachable() map[*BasicBlock]bool {
+	seen := map[*BasicBlock]bool{g.Entry: true}
+	stack := []*BasicBlock{g.Entry}
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, succ := range b.Succs {
+			if !seen[succ] {
+				seen[succ] = true
+				stack = append(stack, succ)
+			}
+		}
+	}
+	return seen
+}
+
+// RemoveUnreachable drops blocks that can never run and returns them.
+func (g *Graph) RemoveUnreachable() []*BasicBlock {
+	reachable := g.Reachable()
+	kept := g.Blocks[:0]
+	var removed []*BasicBlock
+	for _, b := range g.Blocks {
+		if reachable[b] {
+			kept = append(kept, b)
+		} else {
+			removed = append(removed, b)
+		}
+	}
+	g.Blocks = kept
+	if len(removed) > 0 {
+		g.linkEdges()
+	}
+	return removed
+}
+
+// Instructions flattens the graph back into a TACKY instruction list. Phi
+// nodes have no flat form, call FromSSA first.
+func (g *Graph) Instructions() []tackygen.Instruction {
+	instrs := []tackygen.Instruction{}
+	for _, b := range g.Blocks {
+		if len(b.Phis) > 0 {
+			panic(fmt.Sprintf("cfg: %s блокт phi үлдсэн байна, эхлээд FromSSA дуудна уу", b.Name()))
+		}
+		instrs = append(instrs, b.Instructions...)
+	}
+	return instrs
+}
+
+// ToFn returns the function with its body replaced by the flattened graph.
+func (g *Graph) ToFn() tackygen.TackyFn {
+	fn := g.Fn
+	fn.Instructions = g.Instructions()
+	return fn
+}
+
+// ReversePostorder lists the reachable blocks so every block comes before its
+// successors, back edges aside.
+func (g *Graph) ReversePostorder() []*BasicBlock {
+	seen := map[*BasicBlock]bool{}
+	var post []*BasicBlock
+	var visit func(b *BasicBlock)
+	visit = func(b *BasicBlock) {
+		seen[b] = true
+		for _, succ := range b.Succs {
+			if !seen[succ] {
+				visit(succ)
+			}
+		}
+		post = append(post, b)
+	}
+	visit(g.Entry)
+
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
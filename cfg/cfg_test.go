@@ -0,0 +1,187 @@
+package cfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/interp"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+const diamondSource = `fn f(c_1: i32) -> i32 {
+    var x_2: i32
+    jz c_1, else.0
+    x_2 := 1
+    jump end.1
+  else.0:
+    x_2 := 2
+  end.1:
+    return x_2
+}
+`
+
+// fib swaps two variables around the loop, so leaving SSA needs the phi
+// copies ordered through temporaries.
+const loopSource = `fn fib(n_1: i32) -> i32 {
+    var a_2: i32
+    var b_3: i32
+    var i_4: i32
+    var tmp.0: i32
+    var tmp.1: i32
+    a_2 := 0
+    b_3 := 1
+    i_4 := 0
+  loop.0:
+    tmp.0 := lt i_4, n_1
+    jz tmp.0, break.0
+    tmp.1 := add a_2, b_3
+    a_2 := b_3
+    b_3 := tmp.1
+    i_4 := add i_4, 1
+    jump loop.0
+  break.0:
+    return a_2
+}
+`
+
+func parseFn(t *testing.T, src string) (tackygen.TackyProgram, *symbols.SymbolTable) {
+	t.Helper()
+	program, table, err := tackygen.ParseTacky(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	return program, table
+}
+
+func blockNames(blocks []*BasicBlock) string {
+	names := make([]string, len(blocks))
+	for i, b := range blocks {
+		names[i] = b.Name()
+	}
+	return strings.Join(names, " ")
+}
+
+func TestBuildDiamond(t *testing.T) {
+	program, _ := parseFn(t, diamondSource)
+	g := Build(program.FnDefs[0])
+	if len(g.Blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d", len(g.Blocks))
+	}
+	entry, then, els, join := g.Blocks[0], g.Blocks[1], g.Blocks[2], g.Blocks[3]
+
+	if got := blockNames(entry.Succs); got != "B2 B1" {
+		t.Errorf("entry succs = %s", got)
+	}
+	if got := blockNames(join.Preds); got != "B1 B2" {
+		t.Errorf("join preds = %s", got)
+	}
+	if len(join.Succs) != 1 || join.Succs[0] != g.Exit {
+		t.Errorf("join should lead to exit")
+	}
+
+	dom := ComputeDominators(g)
+	for _, b := range []*BasicBlock{then, els, join} {
+		if dom.IDom(b) != entry {
+			t.Errorf("idom(%s) = %v, want entry", b.Name(), dom.IDom(b))
+		}
+	}
+	if dom.Dominates(then, join) {
+		t.Errorf("then branch must not dominate the join")
+	}
+	if got := blockNames(dom.Frontier(then)); got != "B3" {
+		t.Errorf("frontier(then) = %s", got)
+	}
+	if len(dom.Frontier(entry)) != 0 {
+		t.Errorf("entry has frontier %s", blockNames(dom.Frontier(entry)))
+	}
+}
+
+func TestToSSAPlacesPhis(t *testing.T) {
+	program, table := parseFn(t, diamondSource)
+	g := Build(program.FnDefs[0])
+	ToSSA(g, table, map[string]bool{})
+
+	join := g.Blocks[3]
+	if len(join.Phis) != 1 {
+		t.Fatalf("expected one phi at the join, got %d", len(join.Phis))
+	}
+	if got := join.Phis[0].String(); got != "x_2.3 := phi(x_2.1, x_2.2)" {
+		t.Errorf("phi = %s", got)
+	}
+	if got := tackygen.FormatInstruction(join.Instructions[1]); got != "return x_2.3" {
+		t.Errorf("return reads %s", got)
+	}
+	if table.Get("x_2.3") == nil {
+		t.Errorf("new version missing from the symbol table")
+	}
+}
+
+func TestSSARoundTripKeepsBehaviour(t *testing.T) {
+	for _, src := range []string{diamondSource, loopSource} {
+		program, table := parseFn(t, src)
+		fn := program.FnDefs[0]
+
+		want := []int64{}
+		for _, arg := range []int64{0, 1, 2, 7, 10} {
+			got, err := interp.New(program, table, strings.NewReader(""), &bytes.Buffer{}).Call(fn.Name, []int64{arg})
+			if err != nil {
+				t.Fatalf("%s: %v", fn.Name, err)
+			}
+			want = append(want, got)
+		}
+
+		g := Build(fn)
+		ToSSA(g, table, map[string]bool{})
+		FromSSA(g, table)
+		program.FnDefs[0] = g.ToFn()
+
+		for i, arg := range []int64{0, 1, 2, 7, 10} {
+			got, err := interp.New(program, table, strings.NewReader(""), &bytes.Buffer{}).Call(fn.Name, []int64{arg})
+			if err != nil {
+				t.Fatalf("%s after SSA: %v", fn.Name, err)
+			}
+			if got != want[i] {
+				t.Errorf("%s(%d) = %d after SSA, want %d", fn.Name, arg, got, want[i])
+			}
+		}
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	program, _ := parseFn(t, diamondSource)
+	var out bytes.Buffer
+	if err := WriteDot(&out, Build(program.FnDefs[0])); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"digraph \"f\" {", "entry -> B0;", "B0 -> B2 [label=\"== 0\"];", "B0 -> B1 [label=\"!= 0\"];", "B3 -> B4;"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestFindLoopsAndPreheader(t *testing.T) {
+	program, _ := parseFn(t, loopSource)
+	g := Build(program.FnDefs[0])
+	loops := FindLoops(g, ComputeDominators(g))
+	if len(loops) != 1 {
+		t.Fatalf("expected one loop, got %d", len(loops))
+	}
+	loop := loops[0]
+	if loop.Header.Label != "loop.0" || len(loop.Blocks) != 2 || len(loop.Latches) != 1 {
+		t.Fatalf("unexpected loop: header %s, %d blocks", loop.Header.Label, len(loop.Blocks))
+	}
+
+	pre := g.InsertPreheader(loop, "pre.0")
+	if pre == nil {
+		t.Fatal("preheader not inserted")
+	}
+	if len(loop.Header.Preds) != 2 || loop.Header.Preds[0] != pre && loop.Header.Preds[1] != pre {
+		t.Errorf("header preds = %s", blockNames(loop.Header.Preds))
+	}
+	if len(pre.Preds) != 1 || pre.Preds[0] != g.Entry {
+		t.Errorf("preheader preds = %s", blockNames(pre.Preds))
+	}
+}
@@ -0,0 +1,126 @@
+package cfg
+
+// DomTree holds immediate dominators and dominance frontiers for the blocks
+// reachable from the entry, computed with the Cooper, Harvey and Kennedy
+// iterative algorithm.
+type DomTree struct {
+	idom     map[*BasicBlock]*BasicBlock
+	children map[*BasicBlock][]*BasicBlock
+	frontier map[*BasicBlock][]*BasicBlock
+	order    map[*BasicBlock]int
+}
+
+func ComputeDominators(g *Graph) *DomTree {
+	rpo := g.ReversePostorder()
+	d := &DomTree{
+		idom:     map[*BasicBlock]*BasicBlock{},
+		children: map[*BasicBlock][]*BasicBlock{},
+		frontier: map[*BasicBlock][]*BasicBlock{},
+		order:    map[*BasicBlock]int{},
+	}
+	for i, b := range rpo {
+		d.order[b] = i
+	}
+
+	d.idom[g.Entry] = g.Entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range rpo[1:] {
+			var newIdom *BasicBlock
+			for _, pred := range b.Preds {
+				if _, processed := d.idom[pred]; !processed {
+					continue
+				}
+				if newIdom == nil {
+					newIdom = pred
+				} else {
+					newIdom = d.intersect(pred, newIdom)
+				}
+			}
+			if newIdom != nil && d.idom[b] != newIdom {
+				d.idom[b] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	for _, b := range rpo[1:] {
+		parent := d.idom[b]
+		d.children[parent] = append(d.children[parent], b)
+	}
+
+	for _, b := range rpo {
+		if len(b.Preds) < 2 {
+			continue
+		}
+		for _, pred := range b.Preds {
+			if _, reachable := d.order[pred]; !reachable {
+				continue
+			}
+			for runner := pred; runner != d.idom[b]; runner = d.idom[runner] {
+				d.addFrontier(runner, b)
+				if runner == g.Entry {
+					break
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+func (d *DomTree) intersect(a, b *BasicBlock) *BasicBlock {
+	for a != b {
+		for d.order[a] > d.order[b] {
+			a = d.idom[a]
+		}
+		for d.order[b] > d.order[a] {
+			b = d.idom[b]
+		}
+	}
+	return a
+}
+
+func (d *DomTree) addFrontier(b, f *BasicBlock) {
+	for _, existing := range d.frontier[b] {
+		if existing == f {
+			return
+		}
+	}
+	d.frontier[b] = append(d.frontier[b], f)
+}
+
+// IDom returns the immediate dominator of b, nil for the entry and for
+// unreachable blocks.
+func (d *DomTree) IDom(b *BasicBlock) *BasicBlock {
+	idom, ok := d.idom[b]
+	if !ok || idom == b {
+		return nil
+	}
+	return idom
+}
+
+// Dominates reports whether every path from the entry to b goes through a.
+func (d *DomTree) Dominates(a, b *BasicBlock) bool {
+	if _, ok := d.idom[b]; !ok {
+		return false
+	}
+	for {
+		if a == b {
+			return true
+		}
+		parent := d.IDom(b)
+		if parent == nil {
+			return false
+		}
+		b = parent
+	}
+}
+
+func (d *DomTree) Children(b *BasicBlock) []*BasicBlock {
+	return d.children[b]
+}
+
+func (d *DomTree) Frontier(b *BasicBlock) []*BasicBlock {
+	return d.frontier[b]
+}
@@ -0,0 +1,113 @@
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// WriteDot renders the graph as a Graphviz digraph, one box per block with
+// its phis and instructions, and edges labelled by the branch taken.
+func WriteDot(w io.Writer, g *Graph) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote(g.Fn.Name))
+	sb.WriteString("    node [shape=box, fontname=\"monospace\"];\n")
+	sb.WriteString("    entry [shape=oval];\n")
+	fmt.Fprintf(&sb, "    %s [label=\"exit\", shape=oval];\n", g.Exit.Name())
+	fmt.Fprintf(&sb, "    entry -> %s;\n", g.Entry.Name())
+
+	for _, b := range g.Blocks {
+		lines := []string{b.Name()}
+		for _, phi := range b.Phis {
+			lines = append(lines, phi.String())
+		}
+		for _, instr := range b.Instructions {
+			lines = append(lines, tackygen.FormatInstruction(instr))
+		}
+		label := ""
+		for _, line := range lines {
+			label += dotEscape(line) + "\\l"
+		}
+		fmt.Fprintf(&sb, "    %s [label=\"%s\"];\n", b.Name(), label)
+	}
+
+	for _, b := range g.Blocks {
+		for _, succ := range b.Succs {
+			fmt.Fprintf(&sb, "    %s -> %s%s;\n", b.Name(), succ.Name(), edgeLabel(b, succ))
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func edgeLabel(from, to *BasicBlock) string {
+	if len(from.Succs) < 2 {
+		return ""
+	}
+	switch term := from.Terminator().(type) {
+	case tackygen.JumpIfZero:
+		if term.Ident == to.Label {
+			return " [label=\"== 0\"]"
+		}
+		return " [label=\"!= 0\"]"
+	case tackygen.JumpIfNotZero:
+		if term.Ident == to.Label {
+			return " [label=\"!= 0\"]"
+		}
+		return " [label=\"== 0\"]"
+	case tackygen.JumpTable:
+		var indexes []string
+		for i, target := range term.Targets {
+			if target == to.Label {
+				indexes = append(indexes, strconv.Itoa(i))
+			}
+		}
+		return fmt.Sprintf(" [label=\"%s\"]", strings.Join(indexes, ","))
+	}
+	return ""
+}
+
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return strings.ReplaceAll(s, "\"", "\\\"")
+}
+
+func dotQuote(s string) string {
+	return "\"" + dotEscape(s) + "\""
+}
+
+// WriteText lists every block with its dominator and successors, followed by
+// its phis and instructions.
+func WriteText(w io.Writer, g *Graph, dom *DomTree) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:\n", g.Fn.Name)
+	for _, b := range g.Blocks {
+		succs := make([]string, len(b.Succs))
+		for i, succ := range b.Succs {
+			if succ == g.Exit {
+				succs[i] = "exit"
+			} else {
+				succs[i] = succ.Name()
+			}
+		}
+		idom := "-"
+		if parent := dom.IDom(b); parent != nil {
+			idom = parent.Name()
+		}
+		fmt.Fprintf(&sb, "  %s (idom %s) -> %s\n", b.Name(), idom, strings.Join(succs, " "))
+		for _, phi := range b.Phis {
+			fmt.Fprintf(&sb, "      %s\n", phi.String())
+		}
+		for _, instr := range b.Instructions {
+			fmt.Fprintf(&sb, "      %s\n", tackygen.FormatInstruction(instr))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,121 @@
+package cfg
+
+import (
+	"sort"
+
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// Loop is a natural loop: the header plus every block that can reach one of
+// its back edges without passing through the header. Back edges sharing a
+// header make up one loop.
+type Loop struct {
+	Header  *BasicBlock
+	Blocks  map[*BasicBlock]bool
+	Latches []*BasicBlock
+}
+
+func (l *Loop) Contains(b *BasicBlock) bool {
+	return l.Blocks[b]
+}
+
+// FindLoops returns the natural loops of g, innermost first.
+func FindLoops(g *Graph, dom *DomTree) []*Loop {
+	byHeader := map[*BasicBlock]*Loop{}
+	loops := []*Loop{}
+	for _, b := range g.Blocks {
+		for _, succ := range b.Succs {
+			if !dom.Dominates(succ, b) {
+				continue
+			}
+			loop, ok := byHeader[succ]
+			if !ok {
+				loop = &Loop{Header: succ, Blocks: map[*BasicBlock]bool{succ: true}}
+				byHeader[succ] = loop
+				loops = append(loops, loop)
+			}
+			loop.Latches = append(loop.Latches, b)
+			loop.addBody(b)
+		}
+	}
+
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].Blocks) < len(loops[j].Blocks)
+	})
+	return loops
+}
+
+func (l *Loop) addBody(latch *BasicBlock) {
+	stack := []*BasicBlock{latch}
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if l.Blocks[b] {
+			continue
+		}
+		l.Blocks[b] = true
+		stack = append(stack, b.Preds...)
+	}
+}
+
+// InsertPreheader puts an empty block labelled label right in front of the
+// loop header and sends every edge entering the loop from outside through
+// it, so code placed there runs once before the loop starts. It returns nil
+// when the layout doesn't allow it: the header has no label to jump to, or a
+// block of the loop reaches the header by a conditional fallthrough.
+func (g *Graph) InsertPreheader(l *Loop, label string) *BasicBlock {
+	header := l.Header
+	if header.Label == "" || header == g.Entry {
+		return nil
+	}
+
+	idx := g.layoutIndex(header)
+	if idx > 0 {
+		prev := g.Blocks[idx-1]
+		if l.Contains(prev) {
+			switch prev.Terminator().(type) {
+			case nil:
+				prev.Instructions = append(prev.Instructions, tackygen.Jump{Target: header.Label})
+			case tackygen.JumpIfZero, tackygen.JumpIfNotZero:
+				return nil
+			}
+		}
+	}
+
+	pre := g.newBlock()
+	pre.Label = label
+	pre.Instructions = []tackygen.Instruction{tackygen.Label{Ident: label}}
+
+	for _, pred := range header.Preds {
+		if l.Contains(pred) {
+			continue
+		}
+		last := len(pred.Instructions) - 1
+		if last < 0 {
+			continue
+		}
+		switch term := pred.Instructions[last].(type) {
+		case tackygen.Jump:
+			if term.Target == header.Label {
+				term.Target = label
+				pred.Instructions[last] = term
+			}
+		case tackygen.JumpIfZero:
+			if term.Ident == header.Label {
+				term.Ident = label
+				pred.Instructions[last] = term
+			}
+		case tackygen.JumpIfNotZero:
+			if term.Ident == header.Label {
+				term.Ident = label
+				pred.Instructions[last] = term
+			}
+		case tackygen.JumpTable:
+			pred.Instructions[last] = retargetTable(term, header.Label, label)
+		}
+	}
+
+	g.Blocks = append(g.Blocks[:idx], append([]*BasicBlock{pre}, g.Blocks[idx:]...)...)
+	g.linkEdges()
+	return pre
+}
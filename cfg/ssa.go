@@ -0,0 +1,365 @@
+package cfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// Phi merges the versions of Var flowing in from each predecessor, Args[i]
+// comes from Block.Preds[i].
+type Phi struct {
+	Var  string
+	Dst  tackygen.Var
+	Args []tackygen.TackyVal
+}
+
+func (p *Phi) String() string {
+	args := make([]string, len(p.Args))
+	for i, arg := range p.Args {
+		args[i] = tackygen.FormatVal(arg)
+	}
+	return fmt.Sprintf("%s := phi(%s)", p.Dst.Name, strings.Join(args, ", "))
+}
+
+// ToSSA renames every local variable so it is assigned exactly once, placing
+// phi nodes on the dominance frontiers of its definitions. The form is
+// semi-pruned: names only ever read in the block that wrote them, like most
+// temporaries, get no phis. New versions are
+// named <var>.<n> and added to the symbol table with the original type. A
+// read with no definition on some path keeps the original name, which is how
+// parameters and uninitialized locals show up. Globals are left alone.
+func ToSSA(g *Graph, table *symbols.SymbolTable, globals map[string]bool) {
+	g.RemoveUnreachable()
+	dom := ComputeDominators(g)
+
+	defSites := map[string][]*BasicBlock{}
+	crossBlock := map[string]bool{}
+	for _, b := range g.Blocks {
+		definedHere := map[string]bool{}
+		for _, instr := range b.Instructions {
+			uses, def := tackygen.UsesAndDef(instr)
+			for _, use := range uses {
+				if v, ok := use.(tackygen.Var); ok && !definedHere[v.Name] {
+					crossBlock[v.Name] = true
+				}
+			}
+			if v, ok := def.(tackygen.Var); ok && !globals[v.Name] && table.Get(v.Name) != nil {
+				defSites[v.Name] = appendBlock(defSites[v.Name], b)
+				definedHere[v.Name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(defSites))
+	for name := range defSites {
+		if crossBlock[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sites := defSites[name]
+		hasPhi := map[*BasicBlock]bool{}
+		worklist := append([]*BasicBlock{}, sites...)
+		for len(worklist) > 0 {
+			b := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			for _, f := range dom.Frontier(b) {
+				if hasPhi[f] || f == g.Exit {
+					continue
+				}
+				hasPhi[f] = true
+				f.Phis = append(f.Phis, &Phi{
+					Var:  name,
+					Dst:  tackygen.Var{Name: name},
+					Args: make([]tackygen.TackyVal, len(f.Preds)),
+				})
+				worklist = append(worklist, f)
+			}
+		}
+	}
+
+	r := &renamer{
+		table:    table,
+		dom:      dom,
+		stacks:   map[string][]string{},
+		versions: map[string]int{},
+		renamed:  defSites,
+	}
+	r.rename(g.Entry)
+}
+
+func appendBlock(blocks []*BasicBlock, b *BasicBlock) []*BasicBlock {
+	for _, existing := range blocks {
+		if existing == b {
+			return blocks
+		}
+	}
+	return append(blocks, b)
+}
+
+type renamer struct {
+	table    *symbols.SymbolTable
+	dom      *DomTree
+	stacks   map[string][]string
+	versions map[string]int
+	renamed  map[string][]*BasicBlock
+}
+
+func (r *renamer) current(name string) string {
+	stack := r.stacks[name]
+	if len(stack) == 0 {
+		return name
+	}
+	return stack[len(stack)-1]
+}
+
+func (r *renamer) fresh(name string) string {
+	r.versions[name]++
+	version := fmt.Sprintf("%s.%d", name, r.versions[name])
+	r.table.AddVar(r.table.Get(name).Type, version)
+	r.stacks[name] = append(r.stacks[name], version)
+	return version
+}
+
+func (r *renamer) rename(b *BasicBlock) {
+	pushed := []string{}
+
+	for _, phi := range b.Phis {
+		phi.Dst = tackygen.Var{Name: r.fresh(phi.Var)}
+		pushed = append(pushed, phi.Var)
+	}
+
+	for i, instr := range b.Instructions {
+		instr = tackygen.MapUses(instr, func(val tackygen.TackyVal) tackygen.TackyVal {
+			if v, ok := val.(tackygen.Var); ok {
+				if _, tracked := r.renamed[v.Name]; tracked {
+					return tackygen.Var{Name: r.current(v.Name)}
+				}
+			}
+			return val
+		})
+		instr = tackygen.MapDef(instr, func(val tackygen.TackyVal) tackygen.TackyVal {
+			if v, ok := val.(tackygen.Var); ok {
+				if _, tracked := r.renamed[v.Name]; tracked {
+					pushed = append(pushed, v.Name)
+					return tackygen.Var{Name: r.fresh(v.Name)}
+				}
+			}
+			return val
+		})
+		b.Instructions[i] = instr
+	}
+
+	for _, succ := range b.Succs {
+		idx := succ.predIndex(b)
+		for _, phi := range succ.Phis {
+			phi.Args[idx] = tackygen.Var{Name: r.current(phi.Var)}
+		}
+	}
+
+	for _, child := range r.dom.Children(b) {
+		r.rename(child)
+	}
+
+	for _, name := range pushed {
+		r.stacks[name] = r.stacks[name][:len(r.stacks[name])-1]
+	}
+}
+
+// FromSSA replaces phi nodes with copies at the end of each predecessor.
+// Critical edges, and edges leaving a conditional jump, get a block of their
+// own first so the copies only run on the edge they belong to.
+func FromSSA(g *Graph, table *symbols.SymbolTable) {
+	type edgeCopies struct {
+		pred, succ *BasicBlock
+		copies     []tackygen.Copy
+	}
+
+	// collect everything first, splitting edges reorders Preds
+	edges := []edgeCopies{}
+	for _, b := range g.Blocks {
+		for i, pred := range b.Preds {
+			copies := []tackygen.Copy{}
+			for _, phi := range b.Phis {
+				if phi.Args[i] != tackygen.TackyVal(phi.Dst) {
+					copies = append(copies, tackygen.Copy{Src: phi.Args[i], Dst: phi.Dst})
+				}
+			}
+			if len(copies) > 0 {
+				edges = append(edges, edgeCopies{pred: pred, succ: b, copies: copies})
+			}
+		}
+		b.Phis = nil
+	}
+
+	labels := existingLabels(g)
+	for _, edge := range edges {
+		target := edge.pred
+		switch edge.pred.Terminator().(type) {
+		case tackygen.JumpIfZero, tackygen.JumpIfNotZero:
+			if len(edge.pred.Succs) == 1 {
+				// both ways lead to succ, the test does nothing
+				edge.pred.Instructions = edge.pred.Instructions[:len(edge.pred.Instructions)-1]
+			} else {
+				target = g.splitEdge(edge.pred, edge.succ, labels)
+			}
+		case tackygen.JumpTable:
+			// the copies can't go in front of the jump, they might
+			// overwrite the index
+			target = g.splitEdge(edge.pred, edge.succ, labels)
+		default:
+			if len(edge.pred.Succs) > 1 {
+				target = g.splitEdge(edge.pred, edge.succ, labels)
+			}
+		}
+		insertCopies(target, sequentialize(edge.copies, table))
+	}
+
+	g.linkEdges()
+}
+
+func existingLabels(g *Graph) map[string]bool {
+	labels := map[string]bool{}
+	for _, b := range g.Blocks {
+		if b.Label != "" {
+			labels[b.Label] = true
+		}
+	}
+	return labels
+}
+
+// splitEdge puts a new block on the edge pred -> succ and returns it. A jump
+// edge gets a labelled block at the end of the layout that jumps on to succ,
+// a fallthrough edge gets a block placed right after pred.
+func (g *Graph) splitEdge(pred, succ *BasicBlock, labels map[string]bool) *BasicBlock {
+	edge := g.newBlock()
+
+	predIdx := g.layoutIndex(pred)
+	fallsThrough := predIdx+1 < len(g.Blocks) && g.Blocks[predIdx+1] == succ
+	jumpsThere := false
+	switch term := pred.Terminator().(type) {
+	case tackygen.JumpIfZero:
+		jumpsThere = term.Ident == succ.Label
+	case tackygen.JumpIfNotZero:
+		jumpsThere = term.Ident == succ.Label
+	case tackygen.Jump:
+		jumpsThere = term.Target == succ.Label
+	case tackygen.JumpTable:
+		jumpsThere = true
+	}
+
+	if fallsThrough && !jumpsThere {
+		g.Blocks = append(g.Blocks[:predIdx+1], append([]*BasicBlock{edge}, g.Blocks[predIdx+1:]...)...)
+	} else {
+		name := freshLabel(labels)
+		edge.Label = name
+		edge.Instructions = []tackygen.Instruction{
+			tackygen.Label{Ident: name},
+			tackygen.Jump{Target: succ.Label},
+		}
+		last := len(pred.Instructions) - 1
+		switch term := pred.Instructions[last].(type) {
+		case tackygen.JumpIfZero:
+			term.Ident = name
+			pred.Instructions[last] = term
+		case tackygen.JumpIfNotZero:
+			term.Ident = name
+			pred.Instructions[last] = term
+		case tackygen.Jump:
+			term.Target = name
+			pred.Instructions[last] = term
+		case tackygen.JumpTable:
+			pred.Instructions[last] = retargetTable(term, succ.Label, name)
+		}
+		g.Blocks = append(g.Blocks, edge)
+	}
+
+	g.linkEdges()
+	return edge
+}
+
+// retargetTable sends the entries of a jump table that go to from to to
+// instead.
+func retargetTable(table tackygen.JumpTable, from, to string) tackygen.JumpTable {
+	targets := make([]string, len(table.Targets))
+	for i, target := range table.Targets {
+		if target == from {
+			target = to
+		}
+		targets[i] = target
+	}
+	table.Targets = targets
+	return table
+}
+
+func (g *Graph) layoutIndex(b *BasicBlock) int {
+	for i, block := range g.Blocks {
+		if block == b {
+			return i
+		}
+	}
+	return -1
+}
+
+func freshLabel(labels map[string]bool) string {
+	for n := 0; ; n++ {
+		name := fmt.Sprintf("ssa_edge.%d", n)
+		if !labels[name] {
+			labels[name] = true
+			return name
+		}
+	}
+}
+
+// insertCopies adds copies at the end of b, in front of a closing jump.
+func insertCopies(b *BasicBlock, copies []tackygen.Instruction) {
+	if _, isJump := b.Terminator().(tackygen.Jump); isJump {
+		last := len(b.Instructions) - 1
+		term := b.Instructions[last]
+		b.Instructions = append(append(b.Instructions[:last:last], copies...), term)
+		return
+	}
+	b.Instructions = append(b.Instructions, copies...)
+}
+
+// sequentialize orders the parallel phi copies of one edge. When a copy
+// would clobber a value another copy still needs, every source is saved in a
+// temporary first.
+func sequentialize(copies []tackygen.Copy, table *symbols.SymbolTable) []tackygen.Instruction {
+	dsts := map[string]bool{}
+	for _, cp := range copies {
+		dsts[cp.Dst.(tackygen.Var).Name] = true
+	}
+	conflict := false
+	for _, cp := range copies {
+		if v, ok := cp.Src.(tackygen.Var); ok && dsts[v.Name] {
+			conflict = true
+		}
+	}
+
+	out := []tackygen.Instruction{}
+	if !conflict {
+		for _, cp := range copies {
+			out = append(out, cp)
+		}
+		return out
+	}
+
+	temps := make([]tackygen.Var, len(copies))
+	for i, cp := range copies {
+		dst := cp.Dst.(tackygen.Var).Name
+		temps[i] = tackygen.Var{Name: dst + ".phi"}
+		table.AddVar(table.Get(dst).Type, temps[i].Name)
+		out = append(out, tackygen.Copy{Src: cp.Src, Dst: temps[i]})
+	}
+	for i, cp := range copies {
+		out = append(out, tackygen.Copy{Src: temps[i], Dst: cp.Dst})
+	}
+	return out
+}
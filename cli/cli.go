@@ -4,22 +4,32 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/your-moon/mon_lang/base"
+	cgen "github.com/your-moon/mon_lang/c_gen"
+	"github.com/your-moon/mon_lang/cfg"
 	codegen "github.com/your-moon/mon_lang/code_gen"
+	"github.com/your-moon/mon_lang/code_gen/aarch64"
 	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/interp"
 	"github.com/your-moon/mon_lang/lexer"
 	"github.com/your-moon/mon_lang/linker"
+	llvmgen "github.com/your-moon/mon_lang/llvm_gen"
+	"github.com/your-moon/mon_lang/optimizer"
 	"github.com/your-moon/mon_lang/parser"
 	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
 	"github.com/your-moon/mon_lang/symbols"
 	"github.com/your-moon/mon_lang/tackygen"
 	"github.com/your-moon/mon_lang/util"
 	"github.com/your-moon/mon_lang/util/unique"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+	wasmgen "github.com/your-moon/mon_lang/wasm_gen"
 )
 
 type Command struct {
@@ -36,6 +46,22 @@ type CLI struct {
 	genObj     bool
 	run        bool
 	outputFile string
+	opt0       bool
+	opt1       bool
+	opt2       bool
+	printAfter string
+	dot        bool
+	ssa        bool
+	noTailCall bool
+	debugInfo  bool
+	target     string
+	emit       string
+	noLibc     bool
+	asmSyntax  string
+	shared     bool
+	emitHeader bool
+	// progArgs come after -- and are passed on to үндсэн by --run and interp
+	progArgs []string
 }
 
 type Options struct {
@@ -91,6 +117,24 @@ func (c *CLI) registerCommands() {
 		Description: "Бүх алхмыг ажиллуулах, assembly үүсгэх",
 		Execute:     c.runGen,
 	}
+
+	c.commands["interp"] = Command{
+		Name:        "interp",
+		Description: "Tacky IR-ийг assembly үүсгэлгүйгээр шууд ажиллуулах",
+		Execute:     c.runInterp,
+	}
+
+	c.commands["cfg"] = Command{
+		Name:        "cfg",
+		Description: "Функц бүрийн удирдлагын урсгалын граф (CFG) харуулах",
+		Execute:     c.runCfg,
+	}
+
+	c.commands["demangle"] = Command{
+		Name:        "demangle",
+		Description: "Mangle хийсэн тэмдэгтийн нэрийг монгол нэр рүү буцаах",
+		Execute:     c.runDemangle,
+	}
 }
 
 func (c *CLI) Run(args []string) error {
@@ -104,6 +148,11 @@ func (c *CLI) Run(args []string) error {
 	command := args[0]
 	args = args[1:]
 
+	// demangle takes any number of symbols, or none and reads stdin
+	if command == "demangle" {
+		return c.runDemangle(args)
+	}
+
 	fs := flag.NewFlagSet(command, flag.ExitOnError)
 	fs.BoolVar(&c.debug, "debug", false, "debug mode асаах")
 	fs.BoolVar(&c.help, "help", false, "команд туслах харуулах")
@@ -111,6 +160,21 @@ func (c *CLI) Run(args []string) error {
 	fs.BoolVar(&c.genObj, "obj", false, "object файл үүсгэх")
 	fs.BoolVar(&c.run, "run", false, "компиляц хийгээд ажиллуулах")
 	fs.StringVar(&c.outputFile, "o", "", "гаралтын файлын нэр)")
+	fs.BoolVar(&c.opt0, "O0", false, "оновчлол хийхгүй (анхдагч)")
+	fs.BoolVar(&c.opt1, "O1", false, "тогтмол нугалах, хүрэхгүй код устгах")
+	fs.BoolVar(&c.opt2, "O2", false, "-O1 дээр жижиг функц шигтгэх, хуулбар тараах, үхсэн утга устгах, давталтын оновчлол нэмэх")
+	fs.StringVar(&c.printAfter, "print-after", "", "заасан pass-ын дараа Tacky IR хэвлэх")
+	fs.BoolVar(&c.dot, "dot", false, "CFG-г Graphviz dot хэлбэрээр гаргах")
+	fs.BoolVar(&c.ssa, "ssa", false, "CFG-г SSA хэлбэрт оруулж харуулах")
+	fs.BoolVar(&c.noTailCall, "no-tail-calls", false, "сүүлчийн дуудлагыг jmp болгохгүй")
+	fs.BoolVar(&c.debugInfo, "g", false, "gdb-д зориулсан DWARF мэдээлэл үүсгэх")
+	fs.StringVar(&c.target, "target", "x86_64", "код үүсгэх зорилт: x86_64, aarch64, c")
+	fs.BoolVar(&c.noLibc, "nolibc", false, "libc-гүй статик файл үүсгэх (linux x86_64)")
+	fs.BoolVar(&c.noLibc, "static", false, "--nolibc-тэй ижил")
+	fs.StringVar(&c.asmSyntax, "asm-syntax", "att", "assembly-ийн бичлэг: att, intel, nasm")
+	fs.BoolVar(&c.shared, "shared", false, "тунх функцуудыг гаргасан .so сан үүсгэх")
+	fs.BoolVar(&c.emitHeader, "emit-header", false, "тунх функцуудын C header (.h) үүсгэх")
+	fs.StringVar(&c.emit, "emit", "", "assembly-ийн оронд өөр гаралт үүсгэх: llvm, wasm, wat")
 
 	fileArg := ""
 	flagArgs := args
@@ -131,6 +195,7 @@ func (c *CLI) Run(args []string) error {
 	if err := fs.Parse(flagArgs); err != nil {
 		return fmt.Errorf("флаг парс хийхэд алдаа гарлаа: %v", err)
 	}
+	c.progArgs = fs.Args()
 
 	base.Debug = c.debug
 
@@ -165,6 +230,19 @@ func (c *CLI) printUsage() {
 	fmt.Println("  --obj      Object файл үүсгэх")
 	fmt.Println("  --run      Compile and run the program")
 	fmt.Println("  -o         Гаралтын файлын нэр")
+	fmt.Println("  --dot      CFG-г Graphviz dot хэлбэрээр гаргах")
+	fmt.Println("  --ssa      CFG-г SSA хэлбэрт оруулж харуулах")
+	fmt.Println("  -O0/-O1/-O2  Оновчлолын түвшин")
+	fmt.Println("  --print-after=<pass>  Pass-ын дараа Tacky IR хэвлэх")
+	fmt.Println("  --no-tail-calls  Сүүлчийн дуудлагын оновчлолыг унтраах")
+	fmt.Println("  -g         Debugger-т зориулсан мөрийн хүснэгт, DWARF мэдээлэл үүсгэх")
+	fmt.Println("  --target=<x86_64|aarch64|c>  Код үүсгэх зорилт")
+	fmt.Println("  --emit=llvm  LLVM IR (.ll) үүсгэх")
+	fmt.Println("  --emit=wasm|wat  WebAssembly модуль (.wasm, .wat) үүсгэх")
+	fmt.Println("  --nolibc, --static  libc, toolchain-гүй ажиллах статик файл үүсгэх")
+	fmt.Println("  --asm-syntax=<att|intel|nasm>  x86_64 assembly-ийн бичлэг")
+	fmt.Println("  --shared   тунх функцуудыг гаргасан .so сан үүсгэх")
+	fmt.Println("  --emit-header  тунх функцуудын C header (.h) үүсгэх")
 }
 
 func (c *CLI) printDetailedHelp() {
@@ -181,10 +259,19 @@ func (c *CLI) printDetailedHelp() {
 	fmt.Println("            Жишээ: compiler validate input.mn")
 	fmt.Println("\n  tacky     Лексер, парсер ажиллуулах, Tacky IR үүсгэх")
 	fmt.Println("            Жишээ: compiler tacky input.mn")
+	fmt.Println("            Жишээ: compiler tacky input.mn -o input.tacky")
 	fmt.Println("\n  compile   Лексер, парсер ажиллуулах, Tacky үүсгэх")
 	fmt.Println("            Жишээ: compiler compile input.mn")
 	fmt.Println("\n  gen       Бүх алхмыг ажиллуулах, assembly үүсгэх")
 	fmt.Println("            Жишээ: compiler gen input.mn")
+	fmt.Println("            Жишээ: compiler gen input.tacky")
+	fmt.Println("\n  interp    Tacky IR-ийг assembly үүсгэлгүйгээр шууд ажиллуулах")
+	fmt.Println("            Жишээ: compiler interp input.mn")
+	fmt.Println("\n  cfg       Функц бүрийн удирдлагын урсгалын граф (CFG) харуулах")
+	fmt.Println("            Жишээ: compiler cfg input.mn --dot | dot -Tsvg > cfg.svg")
+	fmt.Println("\n  demangle  Mangle хийсэн тэмдэгтийн нэрийг монгол нэр рүү буцаах, нэр өгөхгүй бол stdin-ийг шүүнэ")
+	fmt.Println("            Жишээ: compiler demangle _M_44_38_31_3e_3d_30_47_47_38")
+	fmt.Println("            Жишээ: nm out | compiler demangle")
 
 	fmt.Println("\nСонголтууд:")
 	fmt.Println("  --debug   Debug горим идэвхжүүлэх")
@@ -197,8 +284,54 @@ func (c *CLI) printDetailedHelp() {
 	fmt.Println("            Жишээ: compiler gen input.mn --obj")
 	fmt.Println("\n  --run     Компиляцын ард програм ажиллуулах")
 	fmt.Println("            Жишээ: compiler gen input.mn --run")
+	fmt.Println("            -- дараах аргументууд програмын аргс болно: compiler gen input.mn --run -- a b")
 	fmt.Println("\n  -o        Гаралтын файлын нэр")
 	fmt.Println("            Жишээ: compiler gen input.mn -o output")
+	fmt.Println("\n  --dot     cfg командын гаралтыг Graphviz dot болгох")
+	fmt.Println("            Жишээ: compiler cfg input.mn --dot")
+	fmt.Println("\n  --ssa     cfg командад SSA хэлбэр (phi) харуулах")
+	fmt.Println("            Жишээ: compiler cfg input.mn --ssa")
+	fmt.Println("\n  -O0/-O1/-O2  Оновчлолын түвшин (анхдагч -O0)")
+	fmt.Println("            -O1: тогтмол нугалах, хүрэхгүй код устгах")
+	fmt.Println("            -O2: -O1 дээр жижиг функц шигтгэх, хуулбар тараах, үхсэн утга устгах нэмэх,")
+	fmt.Println("                 давталтаас өөрчлөгдөхгүй тооцоог гаргах, массивын хаягийг нэмэгдүүлэлтээр солих")
+	fmt.Println("            'шигтгэхгүй функц ...' гэж зарласан функцийг шигтгэхгүй")
+	fmt.Println("            Жишээ: compiler gen input.mn -O2")
+	fmt.Println("\n  --print-after=<pass>  Заасан pass бүрийн дараа Tacky IR хэвлэх")
+	fmt.Printf("            Pass-ууд: %s\n", strings.Join(optimizer.PassNames(), ", "))
+	fmt.Println("            Жишээ: compiler tacky input.mn -O2 --print-after=constant-folding")
+	fmt.Println("\n  --no-tail-calls  Үр дүнгээ шууд буцаадаг дуудлагыг call хэвээр үлдээх")
+	fmt.Println("            Анхдагчаар өөрийгөө дуудах нь давталт, бусад нь jmp болно")
+	fmt.Println("            Жишээ: compiler gen input.mn --no-tail-calls")
+	fmt.Println("\n  -g        gdb, perf-д зориулсан мөрийн хүснэгт, функц, хувьсагчийн DWARF мэдээлэл үүсгэх")
+	fmt.Println("            Хувьсагчууд регистрт биш стект үлдэнэ")
+	fmt.Println("            Жишээ: compiler gen input.mn -g && gdb ./input")
+	fmt.Println("\n  --target=<x86_64|aarch64|c>  Код үүсгэх зорилт (анхдагч x86_64)")
+	fmt.Println("            aarch64: AAPCS64 дуудлагын дүрэмтэй ARM64 assembly, arm64 бус машин дээр")
+	fmt.Println("                     aarch64-linux-gnu-gcc-ээр хөрвүүлж qemu-aarch64-өөр ажиллуулна")
+	fmt.Println("            c: C99 код үүсгээд $CC (анхдагч cc)-ээр хөрвүүлнэ, .c файл гаралтын хажууд үлдэнэ")
+	fmt.Println("            Жишээ: compiler gen input.mn --target=c")
+	fmt.Println("\n  --emit=llvm  Assembly-ийн оронд LLVM IR (.ll) файл үүсгэх")
+	fmt.Println("            clang байвал түүгээр хөрвүүлж ажиллах файл болгоно")
+	fmt.Println("            Жишээ: compiler gen input.mn --emit=llvm")
+	fmt.Println("\n  --emit=wasm  WebAssembly модуль (.wasm) үүсгэх, --emit=wat бол текст хэлбэрээр")
+	fmt.Println("            Prelude-ийн функцууд \"env\" модулиас import хийгдэнэ, \"main\" export-ийг дуудна")
+	fmt.Println("            Жишээ: compiler gen input.mn --emit=wasm")
+	fmt.Println("\n  --nolibc, --static  libc-гүй, бүх зүйлээ агуулсан статик файл үүсгэх (linux x86_64)")
+	fmt.Println("            Prelude-ийн функцууд, malloc нь syscall ашигласан жижиг runtime-аар солигдоно")
+	fmt.Println("            Файлыг компилятор өөрөө бичнэ, --asm, -g үед ld -static ашиглана")
+	fmt.Println("            Жишээ: compiler gen input.mn --nolibc")
+	fmt.Println("\n  --asm-syntax=<att|intel|nasm>  x86_64 assembly-ийн бичлэг (анхдагч att)")
+	fmt.Println("            intel: .intel_syntax noprefix, GNU as-аар хөрвүүлнэ")
+	fmt.Println("            nasm: NASM-д зориулсан .asm файл, nasm-аар хөрвүүлнэ, -g-тэй ажиллахгүй")
+	fmt.Println("            Жишээ: compiler gen input.mn --asm --asm-syntax=intel")
+	fmt.Println("\n  --shared  Ажиллах файлын оронд .so (macOS дээр .dylib) сан үүсгэх (x86_64)")
+	fmt.Println("            тунх функцууд mangle хийсэн нэрээрээ гадагш гарна, үндсэн шаардлагагүй")
+	fmt.Println("            Жишээ: compiler gen mylib.mn --shared -o libmy")
+	fmt.Println("\n  --emit-header  тунх функц бүрийг C төрлөөр зарласан .h файл гаралтын хажууд бичих")
+	fmt.Println("            тоо: int32_t, тоо64: int64_t, мөр: const char *, массив: int32_t *")
+	fmt.Println("            Функц бүрийг utfconvert-ийн нэртэй static inline функцээр дуудна")
+	fmt.Println("            Жишээ: compiler gen mylib.mn --shared --emit-header -o libmy")
 
 	fmt.Println("\nЖишээ:")
 	fmt.Println("  compiler lex input.mn")
@@ -311,22 +444,28 @@ func (c *CLI) runTacky(args []string) error {
 		return fmt.Errorf("семантик шинжилгээний алдаа: %v", err)
 	}
 
-	fmt.Println("\n---- TACKY IR ҮҮСГЭЖ БАЙНА ----:")
 	compilerx := tackygen.NewTackyGen(uniqueGen, table)
+	compilerx.DebugInfo = c.debugInfo
 	tackyprogram := compilerx.EmitTacky(resolvedAst)
 
-	fmt.Println("---- TACKY IR ЖАГСААЛТ ----:")
-	for _, fn := range tackyprogram.ExternDefs {
-		fn.Ir()
+	tackyprogram, err = c.optimize(tackyprogram, table, &compilerx.UniqueGen)
+	if err != nil {
+		return err
 	}
 
-	for _, fn := range tackyprogram.FnDefs {
-		fmt.Println(fmt.Sprintf("%s:", fn.Name))
-		for _, ir := range fn.Instructions {
-			ir.Ir()
+	if c.outputFile != "" {
+		var out bytes.Buffer
+		if err := tackygen.NewTackyPrinter(&out, table).PrintProgram(tackyprogram); err != nil {
+			return err
 		}
+		if err := os.WriteFile(c.outputFile, out.Bytes(), 0644); err != nil {
+			return fmt.Errorf("tacky файл бичихэд алдаа гарлаа: %v", err)
+		}
+		return nil
 	}
-	return nil
+
+	fmt.Println("---- TACKY IR ЖАГСААЛТ ----:")
+	return tackygen.NewTackyPrinter(os.Stdout, table).PrintProgram(tackyprogram)
 }
 
 func (c *CLI) runCompiler(args []string) error {
@@ -397,6 +536,10 @@ func (c *CLI) runCompiler(args []string) error {
 }
 
 func (c *CLI) runGen(args []string) error {
+	if strings.HasSuffix(args[0], ".tacky") {
+		return c.runGenTacky(args)
+	}
+
 	uniqueGen := unique.NewUniqueGen()
 	runeString := readFile(args[0])
 	if err := c.runLexer(args); err != nil {
@@ -423,6 +566,7 @@ func (c *CLI) runGen(args []string) error {
 	table := symbols.NewSymbolTable()
 	baseDir := filepath.Dir(args[0])
 	resolver := semanticanalysis.NewSemanticAnalyzer(runeString, uniqueGen, table, baseDir, "stdlib")
+	resolver.RequireMain = !c.shared
 
 	resolvedAst, symbolTable, err := resolver.Analyze(node)
 	if err != nil {
@@ -435,6 +579,7 @@ func (c *CLI) runGen(args []string) error {
 	}
 
 	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyGen.DebugInfo = c.debugInfo
 	tackyProgram := tackyGen.EmitTacky(resolvedAst)
 
 	if base.Debug {
@@ -442,13 +587,149 @@ func (c *CLI) runGen(args []string) error {
 		tackyGen.PrettyPrint(tackyProgram)
 	}
 
+	return c.genBackend(args[0], tackyProgram, symbolTable, &tackyGen.UniqueGen)
+}
+
+// runGenTacky skips the frontend and feeds a textual TACKY file written by
+// `tacky -o` straight to the backend.
+func (c *CLI) runGenTacky(args []string) error {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("Файл уншихад алдаа гарлаа: %v", err)
+	}
+
+	tackyProgram, symbolTable, err := tackygen.ParseTacky(string(data))
+	if err != nil {
+		return err
+	}
+
+	uniqueGen := unique.NewUniqueGen()
+	return c.genBackend(args[0], tackyProgram, symbolTable, &uniqueGen)
+}
+
+func (c *CLI) genBackend(inputFile string, tackyProgram tackygen.TackyProgram, symbolTable *symbols.SymbolTable, uniqueGen *unique.UniqueGen) error {
+	tackyProgram, err := c.optimize(tackyProgram, symbolTable, uniqueGen)
+	if err != nil {
+		return err
+	}
+
+	if c.noLibc && (c.emit != "" || c.target != "x86_64" || util.GetOsType() != util.Linux) {
+		return fmt.Errorf("--nolibc зөвхөн linux x86_64 assembly-д ажиллана")
+	}
+	if c.shared && (c.emit != "" || c.target != "x86_64" || c.noLibc || c.run) {
+		return fmt.Errorf("--shared зөвхөн x86_64 assembly-д ажиллана, --nolibc, --run-тэй хамт хэрэглэхгүй")
+	}
+
+	if c.emitHeader {
+		headerLinker, err := c.newLinker(inputFile)
+		if err != nil {
+			return err
+		}
+		header := new(bytes.Buffer)
+		cgen.GenHeader(header, tackyProgram, symbolTable, cgen.HeaderGuard(headerLinker.HeaderFile()))
+		if err := headerLinker.WriteHeader(header.String()); err != nil {
+			return err
+		}
+	}
+
+	if c.emit == "llvm" {
+		return c.genLLVM(inputFile, tackyProgram, symbolTable)
+	}
+	if c.emit == "wasm" || c.emit == "wat" {
+		return c.genWasm(inputFile, tackyProgram, symbolTable)
+	}
+	if c.emit != "" {
+		return fmt.Errorf("тодорхойгүй гаралт: %s (llvm, wasm, wat)", c.emit)
+	}
+	if c.target == "c" {
+		return c.genC(inputFile, tackyProgram, symbolTable)
+	}
+	if c.target == "aarch64" {
+		return c.genAArch64(inputFile, tackyProgram, symbolTable)
+	}
+	if c.target != "x86_64" {
+		return fmt.Errorf("тодорхойгүй зорилт: %s (x86_64, aarch64, c)", c.target)
+	}
+
 	asmTable := asmsymbol.NewAsmSymbolTable()
 
-	asmGen := codegen.NewAsmGen(table)
+	syntax, err := codegen.ParseAsmSyntax(c.asmSyntax)
+	if err != nil {
+		return err
+	}
+	if syntax == codegen.NASM && c.debugInfo {
+		return fmt.Errorf("-g нь --asm-syntax=nasm-тай ажиллахгүй, att эсвэл intel ашиглана уу")
+	}
+
+	asmGen := codegen.NewAsmGen(symbolTable)
+	asmGen.TailCalls = !c.noTailCall
+	asmGen.DebugInfo = c.debugInfo
 	asmProgram := asmGen.GenASTAsm(tackyProgram, symbolTable, asmTable)
+	if c.noLibc {
+		asmProgram = codegen.AddRuntime(asmProgram)
+	}
 
 	asmBuffer := new(bytes.Buffer)
 	asmWriter := codegen.NewGenASM(asmBuffer, util.GetOsType())
+	asmWriter.NoLibc = c.noLibc
+	asmWriter.Syntax = syntax
+	asmWriter.Shared = c.shared
+	if c.debugInfo {
+		compDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		asmWriter.EnableDebugInfo(inputFile, compDir)
+	}
+	asmWriter.GenAsm(asmProgram)
+
+	if base.Debug {
+		fmt.Println("\n---- ASMAST ----:")
+		fmt.Println(asmBuffer.String())
+	}
+
+	linker, err := c.newLinker(inputFile)
+	if err != nil {
+		return err
+	}
+	linker.SetAssemblyContent(asmBuffer.String())
+	linker.SetNoLibc(c.noLibc)
+	linker.SetNasm(syntax == codegen.NASM)
+	linker.SetShared(c.shared)
+	// on Linux the object is encoded here and as isn't needed, -g still
+	// goes through the assembler for its DWARF directives
+	if util.GetOsType() == util.Linux && !c.debugInfo && !c.genAsm {
+		objBuffer := new(bytes.Buffer)
+		objWriter := codegen.NewGenObj(objBuffer, util.GetOsType())
+		objWriter.NoLibc = c.noLibc
+		objWriter.Shared = c.shared
+		if c.noLibc && !c.genObj {
+			// without libc nothing is left for a linker either
+			if err := objWriter.GenExec(asmProgram); err != nil {
+				return err
+			}
+			linker.SetExecutableContent(objBuffer.Bytes())
+			return c.link(linker)
+		}
+		if err := objWriter.GenObj(asmProgram); err != nil {
+			return err
+		}
+		linker.SetObjectContent(objBuffer.Bytes())
+	}
+	return c.link(linker)
+}
+
+// genAArch64 is --target=aarch64, the same pipeline as x86-64 without
+// register allocation and -g.
+func (c *CLI) genAArch64(inputFile string, tackyProgram tackygen.TackyProgram, symbolTable *symbols.SymbolTable) error {
+	asmTable := asmsymbol.NewAsmSymbolTable()
+
+	asmGen := aarch64.NewAsmGen(symbolTable)
+	asmGen.TailCalls = !c.noTailCall
+	asmProgram := asmGen.GenASTAsm(tackyProgram, symbolTable, asmTable)
+
+	asmBuffer := new(bytes.Buffer)
+	asmWriter := aarch64.NewGenASM(asmBuffer, util.GetOsType())
 	asmWriter.GenAsm(asmProgram)
 
 	if base.Debug {
@@ -456,19 +737,107 @@ func (c *CLI) runGen(args []string) error {
 		fmt.Println(asmBuffer.String())
 	}
 
+	linker, err := c.newLinker(inputFile)
+	if err != nil {
+		return err
+	}
+	linker.SetAssemblyContent(asmBuffer.String())
+	linker.SetTarget(c.target)
+	return c.link(linker)
+}
+
+// genC is the --target=c backend, the C compiler takes over from TACKY.
+func (c *CLI) genC(inputFile string, tackyProgram tackygen.TackyProgram, symbolTable *symbols.SymbolTable) error {
+	cBuffer := new(bytes.Buffer)
+	cGen := cgen.NewCGen(cBuffer, symbolTable)
+	cGen.SourceFile = inputFile
+	cGen.GenProgram(tackyProgram)
+
+	if base.Debug {
+		fmt.Println("\n---- C ----:")
+		fmt.Println(cBuffer.String())
+	}
+
+	linker, err := c.newLinker(inputFile)
+	if err != nil {
+		return err
+	}
+	cc := os.Getenv("CC")
+	if cc == "" {
+		cc = "cc"
+	}
+	linker.SetSourceContent(cBuffer.String(), ".c", cc)
+	return c.link(linker)
+}
+
+// genLLVM is --emit=llvm. Without clang only the .ll file is written.
+func (c *CLI) genLLVM(inputFile string, tackyProgram tackygen.TackyProgram, symbolTable *symbols.SymbolTable) error {
+	llBuffer := new(bytes.Buffer)
+	llvmGen := llvmgen.NewLLVMGen(llBuffer, symbolTable)
+	llvmGen.GenProgram(tackyProgram)
+
+	if base.Debug {
+		fmt.Println("\n---- LLVM IR ----:")
+		fmt.Println(llBuffer.String())
+	}
+
+	linker, err := c.newLinker(inputFile)
+	if err != nil {
+		return err
+	}
+	linker.SetSourceContent(llBuffer.String(), ".ll", "clang")
+	if _, err := exec.LookPath("clang"); err != nil {
+		llFile, err := linker.WriteSource()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("clang олдсонгүй, зөвхөн %s файл үүсгэлээ\n", llFile)
+		return nil
+	}
+	return c.link(linker)
+}
+
+// genWasm is --emit=wasm and --emit=wat, the module is only written, a
+// browser or another host runs it.
+func (c *CLI) genWasm(inputFile string, tackyProgram tackygen.TackyProgram, symbolTable *symbols.SymbolTable) error {
+	wasmBuffer := new(bytes.Buffer)
+	wasmGen := wasmgen.NewWasmGen(wasmBuffer, symbolTable)
+	wasmGen.TailCalls = !c.noTailCall
+	wasmGen.Text = c.emit == "wat"
+	if err := wasmGen.GenProgram(tackyProgram); err != nil {
+		return err
+	}
+
+	if base.Debug && wasmGen.Text {
+		fmt.Println("\n---- WAT ----:")
+		fmt.Println(wasmBuffer.String())
+	}
+
+	linker, err := c.newLinker(inputFile)
+	if err != nil {
+		return err
+	}
+	linker.SetSourceContent(wasmBuffer.String(), "."+c.emit, "")
+	_, err = linker.WriteSource()
+	return err
+}
+
+func (c *CLI) newLinker(inputFile string) (*linker.Linker, error) {
 	outputFile := c.outputFile
 	if outputFile == "" {
-		outputFile = filepath.Base(strings.TrimSuffix(args[0], ".mn"))
+		outputFile = filepath.Base(strings.TrimSuffix(inputFile, filepath.Ext(inputFile)))
 	}
 
 	if dir := filepath.Dir(outputFile); dir != "." {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %v", err)
+			return nil, fmt.Errorf("failed to create output directory: %v", err)
 		}
 	}
 
-	linker := linker.NewLinker(outputFile)
-	linker.SetAssemblyContent(asmBuffer.String())
+	return linker.NewLinker(outputFile), nil
+}
+
+func (c *CLI) link(linker *linker.Linker) error {
 	linker.SetGenerateAsm(c.genAsm)
 	linker.SetGenerateObj(c.genObj)
 
@@ -476,13 +845,17 @@ func (c *CLI) runGen(args []string) error {
 		return fmt.Errorf("Error linking: %v", err)
 	}
 
-	if !c.genAsm && !c.genObj {
+	if !c.genAsm && !c.genObj && !c.shared {
 		if err := linker.MakeExecutable(); err != nil {
 			return fmt.Errorf("Error making executable: %v", err)
 		}
 
 		if c.run {
-			if err := linker.Run(); err != nil {
+			if err := linker.Run(c.progArgs...); err != nil {
+				// the program's exit code is passed on, as interp does
+				if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 {
+					os.Exit(exitErr.ExitCode())
+				}
 				return fmt.Errorf("Error running program: %v", err)
 			}
 		}
@@ -491,6 +864,152 @@ func (c *CLI) runGen(args []string) error {
 	return nil
 }
 
+func (c *CLI) runInterp(args []string) error {
+	uniqueGen := unique.NewUniqueGen()
+	runeString := readFile(args[0])
+	parsed := parser.NewParser(runeString)
+	node, err := parsed.ParseProgram()
+	if err != nil {
+		return fmt.Errorf("парсингийн алдаа: %v", err)
+	}
+
+	if len(parsed.Errors()) > 0 {
+		return fmt.Errorf("парсерын алдаанууд: %v", parsed.Errors()[0].Error())
+	}
+
+	table := symbols.NewSymbolTable()
+	baseDir := filepath.Dir(args[0])
+	resolver := semanticanalysis.NewSemanticAnalyzer(runeString, uniqueGen, table, baseDir, "stdlib")
+	resolver.RequireMain = true
+
+	resolvedAst, symbolTable, err := resolver.Analyze(node)
+	if err != nil {
+		return fmt.Errorf("семантик шинжилгээний алдаа: %v", err)
+	}
+
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolvedAst)
+
+	if base.Debug {
+		fmt.Println("\n---- TACKY IR ----:")
+		tackyGen.PrettyPrint(tackyProgram)
+	}
+
+	interpreter := interp.New(tackyProgram, symbolTable, os.Stdin, os.Stdout)
+	interpreter.Args = append([]string{args[0]}, c.progArgs...)
+	exitCode, err := interpreter.Run()
+	if err != nil {
+		return err
+	}
+
+	// like a native binary, үндсэн's result becomes the process exit code
+	if exitCode != 0 {
+		os.Exit(int(uint8(exitCode)))
+	}
+	return nil
+}
+
+// runDemangle prints each symbol in args as its Mon name, with no args it
+// filters stdin like c++filt so linker errors and perf output can be piped
+// through it.
+func (c *CLI) runDemangle(args []string) error {
+	if len(args) > 0 {
+		for _, symbol := range args {
+			fmt.Println(utfconvert.DemangleText(symbol))
+		}
+		return nil
+	}
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("стандарт оролтыг уншихад алдаа гарлаа: %v", err)
+	}
+	fmt.Print(utfconvert.DemangleText(string(input)))
+	return nil
+}
+
+func (c *CLI) runCfg(args []string) error {
+	uniqueGen := unique.NewUniqueGen()
+	runeString := readFile(args[0])
+	parsed := parser.NewParser(runeString)
+	node, err := parsed.ParseProgram()
+	if err != nil {
+		return fmt.Errorf("парсингийн алдаа: %v", err)
+	}
+
+	if len(parsed.Errors()) > 0 {
+		return fmt.Errorf("парсерын алдаанууд: %v", parsed.Errors()[0].Error())
+	}
+
+	table := symbols.NewSymbolTable()
+	baseDir := filepath.Dir(args[0])
+	resolver := semanticanalysis.NewSemanticAnalyzer(runeString, uniqueGen, table, baseDir, "stdlib")
+
+	resolvedAst, symbolTable, err := resolver.Analyze(node)
+	if err != nil {
+		return fmt.Errorf("семантик шинжилгээний алдаа: %v", err)
+	}
+
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolvedAst)
+
+	tackyProgram, err = c.optimize(tackyProgram, symbolTable, &tackyGen.UniqueGen)
+	if err != nil {
+		return err
+	}
+
+	globals := map[string]bool{}
+	for _, gv := range tackyProgram.GlobalVars {
+		globals[gv.Name] = true
+	}
+
+	var out bytes.Buffer
+	for _, fn := range tackyProgram.FnDefs {
+		graph := cfg.Build(fn)
+		if c.ssa {
+			cfg.ToSSA(graph, symbolTable, globals)
+		}
+
+		if c.dot {
+			err = cfg.WriteDot(&out, graph)
+		} else {
+			err = cfg.WriteText(&out, graph, cfg.ComputeDominators(graph))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.outputFile != "" {
+		if err := os.WriteFile(c.outputFile, out.Bytes(), 0644); err != nil {
+			return fmt.Errorf("cfg файл бичихэд алдаа гарлаа: %v", err)
+		}
+		return nil
+	}
+	_, err = os.Stdout.Write(out.Bytes())
+	return err
+}
+
+func (c *CLI) optLevel() int {
+	switch {
+	case c.opt2:
+		return 2
+	case c.opt1:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (c *CLI) optimize(program tackygen.TackyProgram, symbolTable *symbols.SymbolTable, uniqueGen *unique.UniqueGen) (tackygen.TackyProgram, error) {
+	passManager := optimizer.NewPassManager(c.optLevel(), symbolTable, uniqueGen)
+	if c.printAfter != "" {
+		if err := passManager.SetPrintAfter(c.printAfter, os.Stdout); err != nil {
+			return program, err
+		}
+	}
+	return passManager.Run(program), nil
+}
+
 func readFile(filePath string) []int32 {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
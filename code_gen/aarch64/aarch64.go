@@ -0,0 +1,249 @@
+package aarch64
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/your-moon/mon_lang/util"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+type AsmGen struct {
+	writer      io.Writer
+	ostype      util.OsType
+	strings     map[string]int
+	stringCount int
+	externs     map[string]bool
+	tableCount  int
+}
+
+func NewGenASM(writer io.Writer, osType util.OsType) AsmGen {
+	return AsmGen{
+		writer:  writer,
+		ostype:  osType,
+		strings: make(map[string]int),
+		externs: make(map[string]bool),
+	}
+}
+
+func (a *AsmGen) AddString(value string) string {
+	if id, exists := a.strings[value]; exists {
+		return fmt.Sprintf(".LC%d", id)
+	}
+	id := a.stringCount
+	a.strings[value] = id
+	a.stringCount++
+	return fmt.Sprintf(".LC%d", id)
+}
+
+func escapeForAsm(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\n':
+			buf.WriteString("\\n")
+		case '\t':
+			buf.WriteString("\\t")
+		case '"':
+			buf.WriteString("\\\"")
+		case '\\':
+			buf.WriteString("\\\\")
+		case 0:
+			buf.WriteString("\\0")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// symbol is the assembler name of a function or global, mangled the same
+// way as on x86-64 unless it is an extern from lib.c.
+func (a *AsmGen) symbol(name string) string {
+	if a.externs[name] {
+		return a.cSymbol(utfconvert.UtfConvert(name))
+	}
+	return a.cSymbol(utfconvert.Mangle(name))
+}
+
+// cSymbol is name as C spells it, Mach-O prefixes C symbols with an
+// underscore.
+func (a *AsmGen) cSymbol(name string) string {
+	if a.ostype == util.Darwin {
+		return "_" + name
+	}
+	return name
+}
+
+func (a *AsmGen) label(name string) string {
+	return ".L" + utfconvert.UtfConvert(name)
+}
+
+func (a *AsmGen) GenStringData() {
+	if len(a.strings) == 0 {
+		return
+	}
+
+	if a.ostype == util.Darwin {
+		a.Write(".section __TEXT,__cstring,cstring_literals")
+	} else {
+		a.Write(".section .rodata")
+	}
+
+	type entry struct {
+		value string
+		id    int
+	}
+	entries := make([]entry, 0, len(a.strings))
+	for str, id := range a.strings {
+		entries = append(entries, entry{str, id})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+
+	for _, e := range entries {
+		a.Write(fmt.Sprintf(".LC%d:", e.id))
+		a.Write(fmt.Sprintf("    .asciz \"%s\"", escapeForAsm(e.value)))
+	}
+	a.Write("")
+}
+
+func (a *AsmGen) GenGlobalVarData(globalVars []GlobalVarAsm) {
+	if len(globalVars) == 0 {
+		return
+	}
+	a.Write(".data")
+	for _, gv := range globalVars {
+		switch gv.Size {
+		case 8:
+			a.Write(".p2align 3")
+		case 4:
+			a.Write(".p2align 2")
+		}
+		a.Write(fmt.Sprintf("%s:", a.symbol(gv.Label)))
+		switch gv.Size {
+		case 8:
+			a.Write(fmt.Sprintf("    .quad %d", gv.InitValue))
+		case 4:
+			a.Write(fmt.Sprintf("    .long %d", gv.InitValue))
+		default:
+			a.Write(fmt.Sprintf("    .byte %d", gv.InitValue))
+		}
+	}
+	a.Write("")
+}
+
+func (a *AsmGen) GenAsm(program AsmProgram) {
+	for _, fn := range program.AsmExternFn {
+		a.externs[fn.Name] = true
+	}
+	for _, fn := range program.AsmFnDef {
+		for _, instr := range fn.Irs {
+			if adr, isAdr := instr.(Adr); isAdr {
+				if str, isStr := adr.Src.(StringLiteral); isStr {
+					a.AddString(str.Value)
+				}
+			}
+		}
+	}
+
+	a.GenStringData()
+	a.GenGlobalVarData(program.GlobalVars)
+
+	a.Write(".text")
+	a.Write(".p2align 2")
+	a.Write(fmt.Sprintf(".globl %s", a.cSymbol("main")))
+	a.Write(fmt.Sprintf("%s:", a.cSymbol("main")))
+	// main returns what үндсэн returns, so exit flushes stdio for us. The
+	// runtime keeps argc and hands argv back in x0 for аргс.
+	a.Write("    stp x29, x30, [sp, #-16]!")
+	a.Write("    mov x29, sp")
+	a.Write(fmt.Sprintf("    bl %s", a.cSymbol("mon_rt_args")))
+	a.Write(fmt.Sprintf("    bl %s", a.symbol("үндсэн")))
+	a.Write("    ldp x29, x30, [sp], #16")
+	a.Write("    ret")
+
+	for _, fn := range program.AsmFnDef {
+		a.GenFn(fn)
+	}
+	if a.ostype == util.Linux {
+		a.Write(".section .note.GNU-stack,\"\",%progbits")
+	}
+}
+
+func (a *AsmGen) GenFn(fn AsmFnDef) {
+	a.Write(".p2align 2")
+	a.Write(fmt.Sprintf("%s:", a.symbol(fn.Ident)))
+	a.Write("    stp x29, x30, [sp, #-16]!")
+	a.Write("    mov x29, sp")
+	for _, instr := range fn.Irs {
+		a.GenInstr(instr)
+	}
+}
+
+func (a *AsmGen) epilogue() {
+	a.Write("    mov sp, x29")
+	a.Write("    ldp x29, x30, [sp], #16")
+}
+
+func (a *AsmGen) GenInstr(instr AsmInstruction) {
+	switch ast := instr.(type) {
+	case Adr:
+		var target string
+		switch src := ast.Src.(type) {
+		case StringLiteral:
+			target = a.AddString(src.Value)
+		case Global:
+			target = a.symbol(src.Label)
+		default:
+			panic("unimplemented adr operand")
+		}
+		reg := ast.Dst.Name(nil)
+		if a.ostype == util.Darwin {
+			a.Write(fmt.Sprintf("    adrp %s, %s@PAGE", reg, target))
+			a.Write(fmt.Sprintf("    add %s, %s, %s@PAGEOFF", reg, reg, target))
+		} else {
+			a.Write(fmt.Sprintf("    adrp %s, %s", reg, target))
+			a.Write(fmt.Sprintf("    add %s, %s, :lo12:%s", reg, reg, target))
+		}
+	case Label:
+		a.Write(fmt.Sprintf("%s:", a.label(ast.Ident)))
+	case B:
+		a.Write(fmt.Sprintf("    b %s", a.label(ast.Ident)))
+	case Cbz:
+		op := "cbz"
+		if ast.NonZero {
+			op = "cbnz"
+		}
+		a.Write(fmt.Sprintf("    %s %s, %s", op, ast.Reg.Name(ast.Type), a.label(ast.Ident)))
+	case BrTable:
+		table := fmt.Sprintf(".Ltable%d", a.tableCount)
+		a.tableCount++
+		reg := ast.Reg.Name(nil)
+		a.Write(fmt.Sprintf("    adr x10, %s", table))
+		a.Write(fmt.Sprintf("    ldrsw x11, [x10, %s, lsl #2]", reg))
+		a.Write("    add x10, x10, x11")
+		a.Write("    br x10")
+		a.Write(fmt.Sprintf("%s:", table))
+		for _, target := range ast.Targets {
+			a.Write(fmt.Sprintf("    .word %s - %s", a.label(target), table))
+		}
+	case Bl:
+		a.Write(fmt.Sprintf("    bl %s", a.symbol(ast.Ident)))
+	case TailCall:
+		a.epilogue()
+		a.Write(fmt.Sprintf("    b %s", a.symbol(ast.Ident)))
+	case Return:
+		a.epilogue()
+		a.Write("    ret")
+	default:
+		a.Write("    " + instr.Ir())
+	}
+}
+
+func (a *AsmGen) Write(line string) {
+	fmt.Fprintln(a.writer, line)
+}
@@ -0,0 +1,171 @@
+package aarch64
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+	"github.com/your-moon/mon_lang/parser"
+	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func genAsm(t *testing.T, srcFile string, osType util.OsType) string {
+	t.Helper()
+	data, err := os.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	source := append([]int32(string(data)), 0)
+
+	uniqueGen := unique.NewUniqueGen()
+	p := parser.NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	table := symbols.NewSymbolTable()
+	resolver := semanticanalysis.NewSemanticAnalyzer(source, uniqueGen, table, filepath.Dir(srcFile), "../../stdlib")
+	resolved, symbolTable, err := resolver.Analyze(program)
+	if err != nil {
+		t.Fatalf("semantic analysis failed: %v", err)
+	}
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolved)
+
+	asmGen := NewAsmGen(symbolTable)
+	asmProgram := asmGen.GenASTAsm(tackyProgram, symbolTable, asmsymbol.NewAsmSymbolTable())
+
+	var asm bytes.Buffer
+	asmWriter := NewGenASM(&asm, osType)
+	asmWriter.GenAsm(asmProgram)
+	return asm.String()
+}
+
+var features = []string{"conditionals", "control_flow", "doubles", "enums", "free", "functions", "globals", "strings", "structs", "switch", "tail_calls", "types"}
+
+// TestAssemble runs the output for both ELF and Mach-O through llvm-mc, so
+// the syntax is checked on any host.
+func TestAssemble(t *testing.T) {
+	llvmMc, err := exec.LookPath("llvm-mc")
+	if err != nil {
+		t.Skip("llvm-mc not found")
+	}
+	triples := map[util.OsType]string{
+		util.Linux:  "aarch64-linux-gnu",
+		util.Darwin: "arm64-apple-macos",
+	}
+	for osType, triple := range triples {
+		for _, name := range features {
+			file := "../../test/features/" + name + ".mn"
+			cmd := exec.Command(llvmMc, "-triple="+triple, "-filetype=obj", "-o", os.DevNull)
+			cmd.Stdin = strings.NewReader(genAsm(t, file, osType))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("%s (%s): %v\n%s", file, triple, err, out)
+			}
+		}
+	}
+}
+
+// compileAndRun builds natively on arm64 Linux and otherwise with the cross
+// toolchain under qemu-user.
+func compileAndRun(t *testing.T, srcFile string, input string) string {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("only linux runs the aarch64 output")
+	}
+	as, cc, run := "as", "cc", []string{}
+	if runtime.GOARCH != "arm64" {
+		as, cc = "aarch64-linux-gnu-as", "aarch64-linux-gnu-gcc"
+		run = []string{"qemu-aarch64", "-L", "/usr/aarch64-linux-gnu"}
+	}
+	tools := []string{as, cc}
+	if len(run) > 0 {
+		tools = append(tools, run[0])
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	asmFile := filepath.Join(dir, "out.s")
+	if err := os.WriteFile(asmFile, []byte(genAsm(t, srcFile, util.Linux)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "out")
+	if out, err := exec.Command(as, "-o", exe+".o", asmFile).CombinedOutput(); err != nil {
+		t.Fatalf("as failed: %v\n%s", err, out)
+	}
+	if out, err := exec.Command(cc, "-o", exe, exe+".o", "../../stdlib/lib.c").CombinedOutput(); err != nil {
+		t.Fatalf("link failed: %v\n%s", err, out)
+	}
+
+	var cmd *exec.Cmd
+	if len(run) > 0 {
+		cmd = exec.Command(run[0], append(run[1:], exe)...)
+	} else {
+		cmd = exec.Command(exe)
+	}
+	cmd.Stdin = strings.NewReader(input)
+	output, _ := cmd.Output()
+	return string(output)
+}
+
+func TestControlFlow(t *testing.T) {
+	output := compileAndRun(t, "../../test/features/control_flow.mn", "")
+	if output != "3 12 6 20 99\n" {
+		t.Errorf("expected %q, got %q", "3 12 6 20 99\n", output)
+	}
+}
+
+func TestTypeCoercion(t *testing.T) {
+	output := compileAndRun(t, "../../test/features/types.mn", "")
+	if output != "300 30 42 100\n" {
+		t.Errorf("expected %q, got %q", "300 30 42 100\n", output)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	output := compileAndRun(t, "../../test/features/tail_calls.mn", "")
+	if output != "50000005000000 21 20\n" {
+		t.Errorf("expected %q, got %q", "50000005000000 21 20\n", output)
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	expected := "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+	output := compileAndRun(t, "../../test/features/doubles.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	output := compileAndRun(t, "../../test/examples/fibonacci.mn", "10\n")
+	if output != "5555" {
+		t.Errorf("expected %q, got %q", "5555", output)
+	}
+}
+
+func TestMovImm(t *testing.T) {
+	// 0x12345678 needs a movk for the upper half
+	irs := movImm(&asmtype.LongWord{}, 0x12345678, X9)
+	if len(irs) != 2 || irs[0].Ir() != "mov w9, #22136" || irs[1].Ir() != "movk w9, #4660, lsl #16" {
+		t.Errorf("unexpected %v", irs)
+	}
+	if irs := movImm(&asmtype.QuadWord{}, -5, X9); len(irs) != 1 || irs[0].Ir() != "mov x9, #-5" {
+		t.Errorf("unexpected %v", irs)
+	}
+}
@@ -0,0 +1,437 @@
+package aarch64
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+)
+
+// cond_code = eq | ne | gt | ge | lt | le | mi | ls
+type CondCode string
+
+const (
+	EQ CondCode = "eq"
+	NE CondCode = "ne"
+	GT CondCode = "gt"
+	GE CondCode = "ge"
+	LT CondCode = "lt"
+	LE CondCode = "le"
+	// < and <= after fcmp, lt and le would also hold for a NaN
+	MI CondCode = "mi"
+	LS CondCode = "ls"
+)
+
+type BinaryOp string
+
+const (
+	Add  BinaryOp = "add"
+	Sub  BinaryOp = "sub"
+	Mul  BinaryOp = "mul"
+	Sdiv BinaryOp = "sdiv"
+	Fadd BinaryOp = "fadd"
+	Fsub BinaryOp = "fsub"
+	Fmul BinaryOp = "fmul"
+	Fdiv BinaryOp = "fdiv"
+)
+
+type UnaryOp string
+
+const (
+	Neg  UnaryOp = "neg"
+	Mvn  UnaryOp = "mvn"
+	Fneg UnaryOp = "fneg"
+)
+
+// AsmRegister is a register number. The same register is x<n> or w<n>
+// depending on the width of the instruction, and the floating point
+// register d<n> for a Double.
+type AsmRegister int
+
+const (
+	X0  AsmRegister = 0
+	X8  AsmRegister = 8
+	X9  AsmRegister = 9
+	X10 AsmRegister = 10
+	X11 AsmRegister = 11
+	// X16 and X17 are the intra-procedure-call scratch registers, used for
+	// addresses of globals and of stack slots out of load/store range
+	X16 AsmRegister = 16
+	X17 AsmRegister = 17
+	FP  AsmRegister = 29
+	LR  AsmRegister = 30
+	SP  AsmRegister = 31
+	// d16 and d17 hold the operands of бутархай arithmetic, d8-d15 are
+	// callee-saved
+	D16 AsmRegister = 16
+	D17 AsmRegister = 17
+)
+
+func (r AsmRegister) Name(asmType asmtype.AsmType) string {
+	if r == SP {
+		return "sp"
+	}
+	switch asmType.(type) {
+	case *asmtype.LongWord, *asmtype.Byte:
+		return fmt.Sprintf("w%d", r)
+	case *asmtype.Double:
+		return fmt.Sprintf("d%d", r)
+	}
+	return fmt.Sprintf("x%d", r)
+}
+
+type AsmOperand interface {
+	Op() string
+}
+
+type Imm struct {
+	Value int64
+}
+
+func (a Imm) Op() string {
+	return fmt.Sprintf("#%d", a.Value)
+}
+
+type Register struct {
+	Reg AsmRegister
+}
+
+func (a Register) Op() string {
+	return a.Reg.Name(&asmtype.QuadWord{})
+}
+
+type Pseudo struct {
+	Ident string
+}
+
+func (a Pseudo) Op() string {
+	return a.Ident
+}
+
+// Stack is a slot in the frame, Value bytes from the frame pointer.
+type Stack struct {
+	Value int
+}
+
+func (a Stack) Op() string {
+	return fmt.Sprintf("[x29, #%d]", a.Value)
+}
+
+// Memory is Offset bytes from the address in Base.
+type Memory struct {
+	Base   AsmRegister
+	Offset int
+}
+
+func (a Memory) Op() string {
+	return fmt.Sprintf("[%s, #%d]", a.Base.Name(&asmtype.QuadWord{}), a.Offset)
+}
+
+type Global struct {
+	Label string
+}
+
+func (a Global) Op() string {
+	return a.Label
+}
+
+type StringLiteral struct {
+	Value string
+}
+
+func (a StringLiteral) Op() string {
+	return fmt.Sprintf("%q", a.Value)
+}
+
+// operand prints op at the width of asmType, registers are the only
+// operands whose name depends on it.
+func operand(op AsmOperand, asmType asmtype.AsmType) string {
+	if reg, ok := op.(Register); ok {
+		return reg.Reg.Name(asmType)
+	}
+	return op.Op()
+}
+
+type AsmInstruction interface {
+	Ir() string
+}
+
+type AsmExternFn struct {
+	Name string
+}
+
+func (a AsmExternFn) Ir() string {
+	return fmt.Sprintf("extern %s", a.Name)
+}
+
+// Mov copies a register or an immediate of any size into Dst, the emitter
+// splits wide immediates into movz/movk.
+type Mov struct {
+	Type asmtype.AsmType
+	Src  AsmOperand
+	Dst  AsmRegister
+}
+
+func (a Mov) Ir() string {
+	return fmt.Sprintf("mov %s, %s", a.Dst.Name(a.Type), operand(a.Src, a.Type))
+}
+
+// Movk replaces the 16 bits of Dst at Shift with Value, keeping the rest.
+type Movk struct {
+	Type  asmtype.AsmType
+	Value uint16
+	Shift int
+	Dst   AsmRegister
+}
+
+func (a Movk) Ir() string {
+	return fmt.Sprintf("movk %s, #%d, lsl #%d", a.Dst.Name(a.Type), a.Value, a.Shift)
+}
+
+type Ldr struct {
+	Type asmtype.AsmType
+	Src  AsmOperand
+	Dst  AsmRegister
+}
+
+// Ir loads a Byte with ldrb, which clears the rest of the register.
+func (a Ldr) Ir() string {
+	if _, ok := a.Type.(*asmtype.Byte); ok {
+		return fmt.Sprintf("ldrb %s, %s", a.Dst.Name(a.Type), a.Src.Op())
+	}
+	return fmt.Sprintf("ldr %s, %s", a.Dst.Name(a.Type), a.Src.Op())
+}
+
+type Str struct {
+	Type asmtype.AsmType
+	Src  AsmRegister
+	Dst  AsmOperand
+}
+
+func (a Str) Ir() string {
+	if _, ok := a.Type.(*asmtype.Byte); ok {
+		return fmt.Sprintf("strb %s, %s", a.Src.Name(a.Type), a.Dst.Op())
+	}
+	return fmt.Sprintf("str %s, %s", a.Src.Name(a.Type), a.Dst.Op())
+}
+
+// Adr loads the address of a Global or a StringLiteral.
+type Adr struct {
+	Src AsmOperand
+	Dst AsmRegister
+}
+
+func (a Adr) Ir() string {
+	return fmt.Sprintf("adr %s, %s", a.Dst.Name(nil), a.Src.Op())
+}
+
+// Binary is Dst = Src1 op Src2.
+type Binary struct {
+	Op   BinaryOp
+	Type asmtype.AsmType
+	Src1 AsmRegister
+	Src2 AsmRegister
+	Dst  AsmRegister
+}
+
+func (a Binary) Ir() string {
+	return fmt.Sprintf("%s %s, %s, %s", a.Op, a.Dst.Name(a.Type), a.Src1.Name(a.Type), a.Src2.Name(a.Type))
+}
+
+// Msub is Dst = Minuend - Src1 * Src2, the remainder after sdiv.
+type Msub struct {
+	Type    asmtype.AsmType
+	Src1    AsmRegister
+	Src2    AsmRegister
+	Minuend AsmRegister
+	Dst     AsmRegister
+}
+
+func (a Msub) Ir() string {
+	return fmt.Sprintf("msub %s, %s, %s, %s", a.Dst.Name(a.Type), a.Src1.Name(a.Type), a.Src2.Name(a.Type), a.Minuend.Name(a.Type))
+}
+
+type Unary struct {
+	Op   UnaryOp
+	Type asmtype.AsmType
+	Src  AsmRegister
+	Dst  AsmRegister
+}
+
+func (a Unary) Ir() string {
+	return fmt.Sprintf("%s %s, %s", a.Op, a.Dst.Name(a.Type), a.Src.Name(a.Type))
+}
+
+type Sxtw struct {
+	Src AsmRegister
+	Dst AsmRegister
+}
+
+func (a Sxtw) Ir() string {
+	return fmt.Sprintf("sxtw %s, %s", a.Dst.Name(nil), a.Src.Name(&asmtype.LongWord{}))
+}
+
+// Cmp compares Src1 with a register or #0.
+type Cmp struct {
+	Type asmtype.AsmType
+	Src1 AsmRegister
+	Src2 AsmOperand
+}
+
+func (a Cmp) Ir() string {
+	return fmt.Sprintf("cmp %s, %s", a.Src1.Name(a.Type), operand(a.Src2, a.Type))
+}
+
+// Fcmp compares two Doubles, a NaN on either side leaves the flags
+// unordered.
+type Fcmp struct {
+	Src1 AsmRegister
+	Src2 AsmRegister
+}
+
+func (a Fcmp) Ir() string {
+	return fmt.Sprintf("fcmp %s, %s", a.Src1.Name(&asmtype.Double{}), a.Src2.Name(&asmtype.Double{}))
+}
+
+// Fmov copies the bits of the general register Src into the Double Dst.
+type Fmov struct {
+	Src AsmRegister
+	Dst AsmRegister
+}
+
+func (a Fmov) Ir() string {
+	return fmt.Sprintf("fmov %s, %s", a.Dst.Name(&asmtype.Double{}), a.Src.Name(nil))
+}
+
+// Scvtf converts the integer Src of Type to the Double Dst.
+type Scvtf struct {
+	Type asmtype.AsmType
+	Src  AsmRegister
+	Dst  AsmRegister
+}
+
+func (a Scvtf) Ir() string {
+	return fmt.Sprintf("scvtf %s, %s", a.Dst.Name(&asmtype.Double{}), a.Src.Name(a.Type))
+}
+
+// Fcvtzs converts the Double Src to an integer of Type, rounding toward
+// zero.
+type Fcvtzs struct {
+	Type asmtype.AsmType
+	Src  AsmRegister
+	Dst  AsmRegister
+}
+
+func (a Fcvtzs) Ir() string {
+	return fmt.Sprintf("fcvtzs %s, %s", a.Dst.Name(a.Type), a.Src.Name(&asmtype.Double{}))
+}
+
+type Cset struct {
+	Type asmtype.AsmType
+	CC   CondCode
+	Dst  AsmRegister
+}
+
+func (a Cset) Ir() string {
+	return fmt.Sprintf("cset %s, %s", a.Dst.Name(a.Type), a.CC)
+}
+
+type B struct {
+	Ident string
+}
+
+func (a B) Ir() string {
+	return fmt.Sprintf("b %s", a.Ident)
+}
+
+// Cbz branches when Reg is zero, Cbnz when it isn't.
+type Cbz struct {
+	Type    asmtype.AsmType
+	Reg     AsmRegister
+	Ident   string
+	NonZero bool
+}
+
+func (a Cbz) Ir() string {
+	if a.NonZero {
+		return fmt.Sprintf("cbnz %s, %s", a.Reg.Name(a.Type), a.Ident)
+	}
+	return fmt.Sprintf("cbz %s, %s", a.Reg.Name(a.Type), a.Ident)
+}
+
+// BrTable branches to Targets[Reg], through a table of offsets written
+// right after it.
+type BrTable struct {
+	Reg     AsmRegister
+	Targets []string
+}
+
+func (a BrTable) Ir() string {
+	return fmt.Sprintf("br %s, [%s]", a.Reg.Name(nil), strings.Join(a.Targets, ", "))
+}
+
+type Label struct {
+	Ident string
+}
+
+func (a Label) Ir() string {
+	return fmt.Sprintf("%s:", a.Ident)
+}
+
+type Bl struct {
+	Ident string
+}
+
+func (a Bl) Ir() string {
+	return fmt.Sprintf("bl %s", a.Ident)
+}
+
+// TailCall tears the frame down and branches to Ident, the callee returns
+// straight to our caller.
+type TailCall struct {
+	Ident string
+}
+
+func (a TailCall) Ir() string {
+	return fmt.Sprintf("tailcall %s", a.Ident)
+}
+
+type AllocateStack struct {
+	Value int
+}
+
+func (a AllocateStack) Ir() string {
+	return fmt.Sprintf("sub sp, sp, #%d", a.Value)
+}
+
+type DeallocateStack struct {
+	Value int
+}
+
+func (a DeallocateStack) Ir() string {
+	return fmt.Sprintf("add sp, sp, #%d", a.Value)
+}
+
+type Return struct{}
+
+func (a Return) Ir() string {
+	return "ret"
+}
+
+type AsmFnDef struct {
+	Ident     string
+	Irs       []AsmInstruction
+	StackSize int
+}
+
+type GlobalVarAsm struct {
+	Label     string
+	InitValue int64
+	Size      int
+}
+
+type AsmProgram struct {
+	AsmFnDef    []AsmFnDef
+	AsmExternFn []AsmExternFn
+	GlobalVars  []GlobalVarAsm
+}
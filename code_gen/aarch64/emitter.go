@@ -0,0 +1,539 @@
+package aarch64
+
+import (
+	"fmt"
+
+	"github.com/your-moon/mon_lang/base"
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/roundingutil"
+)
+
+// AsmASTGen lowers TACKY to AArch64 following AAPCS64: the first eight
+// integer arguments go in x0-x7 and the first eight бутархай in d0-d7, the
+// rest on the stack in 8-byte slots, and the result comes back in x0 or d0.
+// Every TACKY variable lives in a stack slot, an instruction loads its
+// operands into x9-x11 or d16-d17, computes, and stores back.
+type AsmASTGen struct {
+	Registers []AsmRegister
+	// DoubleRegisters carry бутархай arguments, the first also the result
+	DoubleRegisters []AsmRegister
+	SymbolTable     *symbols.SymbolTable
+	asmSymbols      *asmsymbol.SymbolTable
+	// TailCalls turns calls whose result is returned right away into jumps
+	TailCalls bool
+}
+
+func NewAsmGen(table *symbols.SymbolTable) AsmASTGen {
+	registers := []AsmRegister{}
+	for i := 0; i < 8; i++ {
+		registers = append(registers, X0+AsmRegister(i))
+	}
+	return AsmASTGen{
+		Registers:       registers,
+		DoubleRegisters: registers,
+		SymbolTable:     table,
+		TailCalls:       true,
+	}
+}
+
+func (a *AsmASTGen) GenASTAsm(program tackygen.TackyProgram, symbolTable *symbols.SymbolTable, asmSymbols *asmsymbol.SymbolTable) AsmProgram {
+	asmprogram := AsmProgram{}
+	a.asmSymbols = asmSymbols
+
+	globalNames := map[string]bool{}
+	for _, gv := range program.GlobalVars {
+		globalNames[gv.Name] = true
+		asmSymbols.AddGlobal(gv.Name, a.ConvType(symbolTable.Get(gv.Name).Type))
+		asmprogram.GlobalVars = append(asmprogram.GlobalVars, GlobalVarAsm{
+			Label:     gv.Name,
+			InitValue: gv.InitValue,
+			Size:      gv.Size,
+		})
+	}
+	for i, v := range symbolTable.Entries {
+		if globalNames[i] {
+			continue
+		}
+		switch v.Type.(type) {
+		case *mtypes.FnType:
+			asmSymbols.AddFun(i, true)
+		default:
+			asmSymbols.AddVar(i, a.ConvType(v.Type), false)
+		}
+	}
+
+	for _, fn := range program.ExternDefs {
+		asmprogram.AsmExternFn = append(asmprogram.AsmExternFn, AsmExternFn{Name: fn.Name})
+	}
+	for _, fn := range program.FnDefs {
+		asmprogram.AsmFnDef = append(asmprogram.AsmFnDef, a.GenASTFn(fn))
+	}
+
+	if base.Debug {
+		fmt.Println("---- AARCH64 ASMAST ----:")
+		for _, fn := range asmprogram.AsmFnDef {
+			fmt.Println(fn.Ident + ":")
+			for i, instr := range fn.Irs {
+				fmt.Println(fmt.Sprintf("%d:", i) + instr.Ir())
+			}
+		}
+	}
+
+	pass1 := NewReplacementPassGen(asmSymbols)
+	asmprogram = pass1.ReplacePseudosInProgram(asmprogram)
+
+	pass2 := NewFixUpPassGen()
+	asmprogram = pass2.FixUpProgram(asmprogram)
+
+	if base.Debug {
+		fmt.Println("---- AARCH64 ASMAST AFTER FIXUP ----:")
+		for _, fn := range asmprogram.AsmFnDef {
+			fmt.Println(fn.Ident + ":")
+			for _, instr := range fn.Irs {
+				fmt.Println(instr.Ir())
+			}
+		}
+	}
+
+	return asmprogram
+}
+
+func (a *AsmASTGen) GenASTFn(fn tackygen.TackyFn) AsmFnDef {
+	asmfn := AsmFnDef{Ident: fn.Name}
+
+	tailCalls := map[int]bool{}
+	selfRecursive := false
+	if a.TailCalls {
+		for i := range fn.Instructions {
+			if call, ok := a.tailCall(fn.Instructions, i); ok {
+				tailCalls[i] = true
+				selfRecursive = selfRecursive || call.Name == fn.Name
+			}
+		}
+	}
+
+	// as on x86-64 a self tail call jumps back above the stores of the
+	// parameter registers
+	startLabel := fn.Name + ".tail"
+	if selfRecursive {
+		asmfn.Irs = append(asmfn.Irs, Label{Ident: startLabel})
+	}
+
+	stackParams := 0
+	for i, reg := range a.argRegisters(fn.Params) {
+		param := fn.Params[i]
+		if reg != noRegister {
+			asmfn.Irs = append(asmfn.Irs, a.store(reg, param)...)
+			continue
+		}
+		// above the saved x29 and x30 sit the caller's outgoing arguments
+		offset := 16 + 8*stackParams
+		stackParams++
+		paramType := bitsType(a.AsmType(param))
+		asmfn.Irs = append(asmfn.Irs, Ldr{Type: paramType, Src: Memory{Base: FP, Offset: offset}, Dst: X9})
+		asmfn.Irs = append(asmfn.Irs, a.storeAs(X9, param, paramType)...)
+	}
+
+	for i := 0; i < len(fn.Instructions); i++ {
+		instr := fn.Instructions[i]
+		if !tailCalls[i] {
+			asmfn.Irs = append(asmfn.Irs, a.GenASTInstr(instr)...)
+			continue
+		}
+		call := instr.(tackygen.FnCall)
+		for j, reg := range a.argRegisters(call.Args) {
+			asmfn.Irs = append(asmfn.Irs, a.load(call.Args[j], reg, a.AsmType(call.Args[j]))...)
+		}
+		if call.Name == fn.Name {
+			asmfn.Irs = append(asmfn.Irs, B{Ident: startLabel})
+		} else {
+			asmfn.Irs = append(asmfn.Irs, TailCall{Ident: call.Name})
+		}
+		// the callee returns to our caller
+		i++
+	}
+	return asmfn
+}
+
+// noRegister marks an argument passed on the stack.
+const noRegister AsmRegister = -1
+
+// argRegisters gives each of vals the register it is passed in, or
+// noRegister. Integers and бутархай take their registers in turn, each
+// until its own eight run out.
+func (a *AsmASTGen) argRegisters(vals []tackygen.TackyVal) []AsmRegister {
+	regs := []AsmRegister{}
+	ints, doubles := 0, 0
+	for _, val := range vals {
+		switch {
+		case isDouble(a.AsmType(val)):
+			if doubles < len(a.DoubleRegisters) {
+				regs = append(regs, a.DoubleRegisters[doubles])
+				doubles++
+				continue
+			}
+		case ints < len(a.Registers):
+			regs = append(regs, a.Registers[ints])
+			ints++
+			continue
+		}
+		regs = append(regs, noRegister)
+	}
+	return regs
+}
+
+// tailCall reports whether instrs[i] is a call whose result the next
+// instruction returns. Calls with stack arguments stay calls, those would
+// have to be written over our caller's frame.
+func (a *AsmASTGen) tailCall(instrs []tackygen.Instruction, i int) (tackygen.FnCall, bool) {
+	call, ok := instrs[i].(tackygen.FnCall)
+	if !ok || call.Dst == nil || i+1 >= len(instrs) {
+		return call, false
+	}
+	for _, reg := range a.argRegisters(call.Args) {
+		if reg == noRegister {
+			return call, false
+		}
+	}
+	ret, ok := instrs[i+1].(tackygen.Return)
+	if !ok {
+		return call, false
+	}
+	dst, isVar := call.Dst.(tackygen.Var)
+	val, isVarVal := ret.Value.(tackygen.Var)
+	return call, isVar && isVarVal && dst.Name == val.Name
+}
+
+// load puts val into reg at the width of asmType, a Double goes into d<reg>.
+func (a *AsmASTGen) load(val tackygen.TackyVal, reg AsmRegister, asmType asmtype.AsmType) []AsmInstruction {
+	switch ast := val.(type) {
+	case tackygen.Constant:
+		if isDouble(asmType) {
+			// there is no move of a 64-bit immediate into a d register
+			return []AsmInstruction{
+				Mov{Type: &asmtype.QuadWord{}, Src: Imm{Value: ast.Value.GetValue()}, Dst: X16},
+				Fmov{Src: X16, Dst: reg},
+			}
+		}
+		return []AsmInstruction{Mov{Type: asmType, Src: Imm{Value: ast.Value.GetValue()}, Dst: reg}}
+	case tackygen.StringConstant:
+		return []AsmInstruction{Adr{Src: StringLiteral{Value: ast.Value}, Dst: reg}}
+	case tackygen.Var:
+		if a.asmSymbols.IsGlobalVar(ast.Name) {
+			return []AsmInstruction{
+				Adr{Src: Global{Label: ast.Name}, Dst: X16},
+				Ldr{Type: asmType, Src: Memory{Base: X16}, Dst: reg},
+			}
+		}
+		return []AsmInstruction{Ldr{Type: asmType, Src: Pseudo{Ident: ast.Name}, Dst: reg}}
+	default:
+		panic("unimplemented val")
+	}
+}
+
+// store writes reg into the variable val at its own width.
+func (a *AsmASTGen) store(reg AsmRegister, val tackygen.TackyVal) []AsmInstruction {
+	return a.storeAs(reg, val, a.AsmType(val))
+}
+
+// storeAs writes reg into the variable val as asmType, a бутархай held in
+// a general register is stored as its bits.
+func (a *AsmASTGen) storeAs(reg AsmRegister, val tackygen.TackyVal, asmType asmtype.AsmType) []AsmInstruction {
+	v, ok := val.(tackygen.Var)
+	if !ok {
+		panic("store to a non-variable")
+	}
+	if a.asmSymbols.IsGlobalVar(v.Name) {
+		return []AsmInstruction{
+			Adr{Src: Global{Label: v.Name}, Dst: X16},
+			Str{Type: asmType, Src: reg, Dst: Memory{Base: X16}},
+		}
+	}
+	return []AsmInstruction{Str{Type: asmType, Src: reg, Dst: Pseudo{Ident: v.Name}}}
+}
+
+func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
+	irs := []AsmInstruction{}
+
+	// stack arguments first, loading them only touches x9 and x16
+	regs := a.argRegisters(fn.Args)
+	stackArgs := []tackygen.TackyVal{}
+	for i, reg := range regs {
+		if reg == noRegister {
+			stackArgs = append(stackArgs, fn.Args[i])
+		}
+	}
+	stackBytes := roundingutil.RoundAwayFromZero(16, 8*len(stackArgs))
+	if stackBytes != 0 {
+		irs = append(irs, AllocateStack{Value: stackBytes})
+	}
+	for i, arg := range stackArgs {
+		argType := bitsType(a.AsmType(arg))
+		irs = append(irs, a.load(arg, X9, argType)...)
+		irs = append(irs, Str{Type: argType, Src: X9, Dst: Memory{Base: SP, Offset: 8 * i}})
+	}
+
+	for i, reg := range regs {
+		if reg != noRegister {
+			irs = append(irs, a.load(fn.Args[i], reg, a.AsmType(fn.Args[i]))...)
+		}
+	}
+
+	irs = append(irs, Bl{Ident: fn.Name})
+	if stackBytes != 0 {
+		irs = append(irs, DeallocateStack{Value: stackBytes})
+	}
+	if fn.Dst != nil {
+		irs = append(irs, a.store(X0, fn.Dst)...)
+	}
+	return irs
+}
+
+func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
+	switch ast := instr.(type) {
+	case tackygen.FnCall:
+		return a.convertFnCall(ast)
+	case tackygen.Jump:
+		return []AsmInstruction{B{Ident: ast.Target}}
+	case tackygen.Label:
+		return []AsmInstruction{Label{Ident: ast.Ident}}
+	case tackygen.SourceLine:
+		// -g is x86-64 only for now
+		return []AsmInstruction{}
+	case tackygen.Copy:
+		dstType := bitsType(a.AsmType(ast.Dst))
+		srcType := dstType
+		if _, isConst := ast.Src.(tackygen.Constant); !isConst {
+			srcType = bitsType(a.AsmType(ast.Src))
+		}
+		irs := a.load(ast.Src, X9, srcType)
+		return append(irs, a.storeAs(X9, ast.Dst, dstType)...)
+	case tackygen.JumpIfZero:
+		irs := a.load(ast.Val, X9, a.AsmType(ast.Val))
+		return append(irs, Cbz{Type: a.AsmType(ast.Val), Reg: X9, Ident: ast.Ident})
+	case tackygen.JumpIfNotZero:
+		irs := a.load(ast.Val, X9, a.AsmType(ast.Val))
+		return append(irs, Cbz{Type: a.AsmType(ast.Val), Reg: X9, Ident: ast.Ident, NonZero: true})
+	case tackygen.JumpTable:
+		// the index is never negative, so loading a тоо's w9 leaves x9
+		// right too
+		irs := a.load(ast.Index, X9, a.AsmType(ast.Index))
+		return append(irs, BrTable{Reg: X9, Targets: ast.Targets})
+	case tackygen.Return:
+		irs := a.load(ast.Value, X0, a.AsmType(ast.Value))
+		return append(irs, Return{})
+	case tackygen.SignExtend:
+		irs := a.load(ast.Src, X9, &asmtype.LongWord{})
+		irs = append(irs, Sxtw{Src: X9, Dst: X9})
+		return append(irs, a.store(X9, ast.Dst)...)
+	case tackygen.Truncate:
+		// the low half of x9 is w9, the store only writes that
+		irs := a.load(ast.Src, X9, &asmtype.QuadWord{})
+		return append(irs, a.store(X9, ast.Dst)...)
+	case tackygen.IntToDouble:
+		irs := a.load(ast.Src, X9, a.AsmType(ast.Src))
+		irs = append(irs, Scvtf{Type: a.AsmType(ast.Src), Src: X9, Dst: D16})
+		return append(irs, a.store(D16, ast.Dst)...)
+	case tackygen.DoubleToInt:
+		irs := a.load(ast.Src, D16, &asmtype.Double{})
+		irs = append(irs, Fcvtzs{Type: a.AsmType(ast.Dst), Src: D16, Dst: X9})
+		return append(irs, a.store(X9, ast.Dst)...)
+	case tackygen.Load:
+		dstType := bitsType(a.AsmType(ast.Dst))
+		irs := a.load(ast.Src, X10, &asmtype.QuadWord{})
+		irs = append(irs, Ldr{Type: dstType, Src: Memory{Base: X10}, Dst: X9})
+		return append(irs, a.storeAs(X9, ast.Dst, dstType)...)
+	case tackygen.Store:
+		srcType := bitsType(a.AsmType(ast.Src))
+		irs := a.load(ast.Dst, X10, &asmtype.QuadWord{})
+		irs = append(irs, a.load(ast.Src, X9, srcType)...)
+		return append(irs, Str{Type: srcType, Src: X9, Dst: Memory{Base: X10}})
+	case tackygen.Binary:
+		return a.GenASTBinary(ast)
+	case tackygen.Unary:
+		srcType := a.AsmType(ast.Src)
+		if isDouble(srcType) && ast.Op == tackygen.Negate {
+			irs := a.load(ast.Src, D16, srcType)
+			irs = append(irs, Unary{Op: Fneg, Type: srcType, Src: D16, Dst: D16})
+			return append(irs, a.store(D16, ast.Dst)...)
+		}
+		irs := a.load(ast.Src, X9, srcType)
+		switch ast.Op {
+		case tackygen.Not:
+			irs = append(irs,
+				Cmp{Type: srcType, Src1: X9, Src2: Imm{Value: 0}},
+				Cset{Type: a.AsmType(ast.Dst), CC: EQ, Dst: X9},
+			)
+		case tackygen.Negate:
+			irs = append(irs, Unary{Op: Neg, Type: srcType, Src: X9, Dst: X9})
+		case tackygen.Complement:
+			irs = append(irs, Unary{Op: Mvn, Type: srcType, Src: X9, Dst: X9})
+		default:
+			panic("unimplemented tacky op on asm gen")
+		}
+		return append(irs, a.store(X9, ast.Dst)...)
+	default:
+		panic("unimplemented tacky instruction on asm gen")
+	}
+}
+
+func (a *AsmASTGen) ConvOpToCond(op tackygen.TackyBinaryOp) (CondCode, bool) {
+	switch op {
+	case tackygen.GreaterThan:
+		return GT, true
+	case tackygen.GreaterThanEqual:
+		return GE, true
+	case tackygen.LessThan:
+		return LT, true
+	case tackygen.LessThanEqual:
+		return LE, true
+	case tackygen.Equal:
+		return EQ, true
+	case tackygen.NotEqual:
+		return NE, true
+	}
+	return "", false
+}
+
+// isDouble reports whether asmType is a бутархай.
+func isDouble(asmType asmtype.AsmType) bool {
+	_, ok := asmType.(*asmtype.Double)
+	return ok
+}
+
+// bitsType is the type a value is copied through memory and general
+// registers with, a бутархай goes as its 8 bytes.
+func bitsType(asmType asmtype.AsmType) asmtype.AsmType {
+	if isDouble(asmType) {
+		return &asmtype.QuadWord{}
+	}
+	return asmType
+}
+
+// doubleCondCodes are the conditions after fcmp that a NaN makes false,
+// except for != which it makes true.
+var doubleCondCodes = map[tackygen.TackyBinaryOp]CondCode{
+	tackygen.GreaterThan:      GT,
+	tackygen.GreaterThanEqual: GE,
+	tackygen.LessThan:         MI,
+	tackygen.LessThanEqual:    LS,
+	tackygen.Equal:            EQ,
+	tackygen.NotEqual:         NE,
+}
+
+var doubleOps = map[tackygen.TackyBinaryOp]BinaryOp{
+	tackygen.Add: Fadd,
+	tackygen.Sub: Fsub,
+	tackygen.Mul: Fmul,
+	tackygen.Div: Fdiv,
+}
+
+// genDoubleBinary is GenASTBinary for бутархай operands, they are loaded
+// into d16 and d17.
+func (a *AsmASTGen) genDoubleBinary(instr tackygen.Binary) []AsmInstruction {
+	double := &asmtype.Double{}
+	irs := a.load(instr.Src1, D16, double)
+	irs = append(irs, a.load(instr.Src2, D17, double)...)
+	if cc, ok := doubleCondCodes[instr.Op]; ok {
+		irs = append(irs,
+			Fcmp{Src1: D16, Src2: D17},
+			Cset{Type: a.AsmType(instr.Dst), CC: cc, Dst: X9},
+		)
+		return append(irs, a.store(X9, instr.Dst)...)
+	}
+	op, ok := doubleOps[instr.Op]
+	if !ok {
+		panic("unimplemented tacky op on asm gen")
+	}
+	irs = append(irs, Binary{Op: op, Type: double, Src1: D16, Src2: D17, Dst: D16})
+	return append(irs, a.store(D16, instr.Dst)...)
+}
+
+func (a *AsmASTGen) GenASTBinary(instr tackygen.Binary) []AsmInstruction {
+	srcType := a.AsmType(instr.Src1)
+	if isDouble(srcType) {
+		return a.genDoubleBinary(instr)
+	}
+	irs := a.load(instr.Src1, X9, srcType)
+	irs = append(irs, a.load(instr.Src2, X10, srcType)...)
+
+	if cc, ok := a.ConvOpToCond(instr.Op); ok {
+		irs = append(irs,
+			Cmp{Type: srcType, Src1: X9, Src2: Register{Reg: X10}},
+			Cset{Type: a.AsmType(instr.Dst), CC: cc, Dst: X9},
+		)
+		return append(irs, a.store(X9, instr.Dst)...)
+	}
+
+	switch instr.Op {
+	case tackygen.Add:
+		irs = append(irs, Binary{Op: Add, Type: srcType, Src1: X9, Src2: X10, Dst: X9})
+	case tackygen.Sub:
+		irs = append(irs, Binary{Op: Sub, Type: srcType, Src1: X9, Src2: X10, Dst: X9})
+	case tackygen.Mul:
+		irs = append(irs, Binary{Op: Mul, Type: srcType, Src1: X9, Src2: X10, Dst: X9})
+	case tackygen.Div:
+		irs = append(irs, Binary{Op: Sdiv, Type: srcType, Src1: X9, Src2: X10, Dst: X9})
+	case tackygen.Modulo:
+		// there is no remainder instruction: x9 - (x9 / x10) * x10
+		irs = append(irs,
+			Binary{Op: Sdiv, Type: srcType, Src1: X9, Src2: X10, Dst: X11},
+			Msub{Type: srcType, Src1: X11, Src2: X10, Minuend: X9, Dst: X9},
+		)
+	default:
+		panic("unimplemented tacky op on asm gen")
+	}
+	return append(irs, a.store(X9, instr.Dst)...)
+}
+
+func (a *AsmASTGen) AsmType(val tackygen.TackyVal) asmtype.AsmType {
+	switch valtype := val.(type) {
+	case tackygen.Constant:
+		switch valtype.Value.(type) {
+		case *mconstant.Int64:
+			return &asmtype.QuadWord{}
+		case *mconstant.Int32:
+			return &asmtype.LongWord{}
+		case *mconstant.Bool:
+			return &asmtype.Byte{}
+		case *mconstant.Double:
+			return &asmtype.Double{}
+		default:
+			panic("unimplemented const")
+		}
+	case tackygen.Var:
+		return a.ConvType(a.SymbolTable.Get(valtype.Name).Type)
+	case tackygen.StringConstant:
+		return &asmtype.StringType{}
+	default:
+		panic("unimplemented val")
+	}
+}
+
+func (a *AsmASTGen) ConvType(val mtypes.Type) asmtype.AsmType {
+	switch val.(type) {
+	case *mtypes.Int32Type, *mtypes.EnumType:
+		return &asmtype.LongWord{}
+	case *mtypes.Int64Type:
+		return &asmtype.QuadWord{}
+	case *mtypes.BoolType:
+		return &asmtype.Byte{}
+	case *mtypes.DoubleType:
+		return &asmtype.Double{}
+	case *mtypes.VoidType:
+		return &asmtype.LongWord{}
+	case *mtypes.StringType:
+		return &asmtype.StringType{}
+	case *mtypes.ArrayType, *mtypes.StructType:
+		return &asmtype.QuadWord{}
+	case *mtypes.FnType:
+		panic("fn type should not be here")
+	default:
+		panic(fmt.Sprintf("unimplemented type: %v", val))
+	}
+}
@@ -0,0 +1,107 @@
+package aarch64
+
+import (
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+)
+
+type FixUpPassGen struct{}
+
+func NewFixUpPassGen() FixUpPassGen {
+	return FixUpPassGen{}
+}
+
+// fitsMov reports whether mov can load i in one instruction, as a movz or a
+// movn of a single 16-bit chunk.
+func fitsMov(i int64) bool {
+	return i >= -0x10000 && i <= 0xffff
+}
+
+// movImm loads any constant into reg, the low 16 bits with mov and every
+// other non-zero chunk with movk.
+func movImm(asmType asmtype.AsmType, value int64, reg AsmRegister) []AsmInstruction {
+	bits := uint64(value)
+	chunks := 4
+	if _, isLongWord := asmType.(*asmtype.LongWord); isLongWord {
+		bits &= 0xffffffff
+		chunks = 2
+		if fitsMov(int64(int32(bits))) {
+			return []AsmInstruction{Mov{Type: asmType, Src: Imm{Value: int64(int32(bits))}, Dst: reg}}
+		}
+	} else if fitsMov(value) {
+		return []AsmInstruction{Mov{Type: asmType, Src: Imm{Value: value}, Dst: reg}}
+	}
+
+	irs := []AsmInstruction{Mov{Type: asmType, Src: Imm{Value: int64(bits & 0xffff)}, Dst: reg}}
+	for i := 1; i < chunks; i++ {
+		chunk := uint16(bits >> (16 * i))
+		if chunk != 0 {
+			irs = append(irs, Movk{Type: asmType, Value: chunk, Shift: 16 * i, Dst: reg})
+		}
+	}
+	return irs
+}
+
+// fixAddress turns a stack slot further than ldur/stur reach from x29 into
+// an address computed in x17.
+func fixAddress(op AsmOperand) ([]AsmInstruction, AsmOperand) {
+	stack, isStack := op.(Stack)
+	if !isStack || stack.Value >= -256 {
+		return nil, op
+	}
+	irs := movImm(&asmtype.QuadWord{}, int64(stack.Value), X17)
+	irs = append(irs, Binary{Op: Add, Type: &asmtype.QuadWord{}, Src1: FP, Src2: X17, Dst: X17})
+	return irs, Memory{Base: X17}
+}
+
+// fixStack adjusts sp by value, add and sub take 12-bit immediates.
+func fixStack(op BinaryOp, value int, instr AsmInstruction) []AsmInstruction {
+	if value <= 0xfff {
+		return []AsmInstruction{instr}
+	}
+	irs := movImm(&asmtype.QuadWord{}, int64(value), X17)
+	return append(irs, Binary{Op: op, Type: &asmtype.QuadWord{}, Src1: SP, Src2: X17, Dst: SP})
+}
+
+func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction {
+	switch ast := instr.(type) {
+	case Mov:
+		if imm, isImm := ast.Src.(Imm); isImm {
+			return movImm(ast.Type, imm.Value, ast.Dst)
+		}
+		return []AsmInstruction{ast}
+	case Ldr:
+		irs, src := fixAddress(ast.Src)
+		ast.Src = src
+		return append(irs, ast)
+	case Str:
+		irs, dst := fixAddress(ast.Dst)
+		ast.Dst = dst
+		return append(irs, ast)
+	case AllocateStack:
+		return fixStack(Sub, ast.Value, ast)
+	case DeallocateStack:
+		return fixStack(Add, ast.Value, ast)
+	default:
+		return []AsmInstruction{instr}
+	}
+}
+
+func (f *FixUpPassGen) FixUpInFn(fn AsmFnDef) AsmFnDef {
+	fixedInstructions := []AsmInstruction{}
+	if fn.StackSize != 0 {
+		fixedInstructions = append(fixedInstructions, f.FixUpInInstruction(AllocateStack{Value: fn.StackSize})...)
+	}
+	for _, instr := range fn.Irs {
+		fixedInstructions = append(fixedInstructions, f.FixUpInInstruction(instr)...)
+	}
+	fn.Irs = fixedInstructions
+	return fn
+}
+
+func (f *FixUpPassGen) FixUpProgram(program AsmProgram) AsmProgram {
+	asmFnDefs := []AsmFnDef{}
+	for _, fn := range program.AsmFnDef {
+		asmFnDefs = append(asmFnDefs, f.FixUpInFn(fn))
+	}
+	return AsmProgram{AsmFnDef: asmFnDefs, AsmExternFn: program.AsmExternFn, GlobalVars: program.GlobalVars}
+}
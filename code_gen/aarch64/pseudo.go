@@ -0,0 +1,78 @@
+package aarch64
+
+import (
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/util"
+	"github.com/your-moon/mon_lang/util/roundingutil"
+)
+
+type ReplacementState struct {
+	CurrentOffset int
+	OffsetMap     map[string]int
+}
+
+type ReplacementPassGen struct {
+	asmSymbol *asmsymbol.SymbolTable
+}
+
+func NewReplacementPassGen(table *asmsymbol.SymbolTable) ReplacementPassGen {
+	return ReplacementPassGen{
+		asmSymbol: table,
+	}
+}
+
+// ReplaceOperand gives each pseudo a slot below x29, aligned to its size.
+func (r *ReplacementPassGen) ReplaceOperand(operand AsmOperand, state ReplacementState) (ReplacementState, AsmOperand) {
+	pseudo, isPseudo := operand.(Pseudo)
+	if !isPseudo {
+		return state, operand
+	}
+	if value, exists := state.OffsetMap[pseudo.Ident]; exists {
+		return state, Stack{value}
+	}
+	size, err := r.asmSymbol.GetSize(pseudo.Ident)
+	if err != nil {
+		panic(err)
+	}
+	alignment, err := r.asmSymbol.GetAlignment(pseudo.Ident)
+	if err != nil {
+		panic(err)
+	}
+	state.CurrentOffset = roundingutil.RoundAwayFromZero(alignment, state.CurrentOffset-size)
+	state.OffsetMap[pseudo.Ident] = state.CurrentOffset
+	return state, Stack{state.CurrentOffset}
+}
+
+func (r *ReplacementPassGen) ReplacePseudosInInstruction(instr AsmInstruction, state ReplacementState) (ReplacementState, AsmInstruction) {
+	switch ast := instr.(type) {
+	case Ldr:
+		state, ast.Src = r.ReplaceOperand(ast.Src, state)
+		return state, ast
+	case Str:
+		state, ast.Dst = r.ReplaceOperand(ast.Dst, state)
+		return state, ast
+	default:
+		return state, instr
+	}
+}
+
+func (r *ReplacementPassGen) ReplacePseudosInFn(fn AsmFnDef) AsmFnDef {
+	state := ReplacementState{
+		CurrentOffset: 0,
+		OffsetMap:     make(map[string]int),
+	}
+	for i, instr := range fn.Irs {
+		state, fn.Irs[i] = r.ReplacePseudosInInstruction(instr, state)
+	}
+	// sp has to stay 16-byte aligned
+	fn.StackSize = roundingutil.RoundAwayFromZero(16, util.Abs(state.CurrentOffset))
+	return fn
+}
+
+func (r *ReplacementPassGen) ReplacePseudosInProgram(program AsmProgram) AsmProgram {
+	asmFnDefs := []AsmFnDef{}
+	for _, fn := range program.AsmFnDef {
+		asmFnDefs = append(asmFnDefs, r.ReplacePseudosInFn(fn))
+	}
+	return AsmProgram{AsmFnDef: asmFnDefs, AsmExternFn: program.AsmExternFn, GlobalVars: program.GlobalVars}
+}
@@ -2,11 +2,12 @@ package codegen
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/your-moon/mon_lang/code_gen/asmtype"
 )
 
-// cond_code = E | NE | G | GE | L | LE
+// cond_code = E | NE | G | GE | L | LE | A | AE | B | BE | P
 type CondCode string
 
 const (
@@ -16,6 +17,13 @@ const (
 	GE CondCode = "ge"
 	L  CondCode = "l"
 	LE CondCode = "le"
+	// comisd sets the flags of an unsigned comparison
+	A  CondCode = "a"
+	AE CondCode = "ae"
+	B  CondCode = "b"
+	BE CondCode = "be"
+	// and the parity flag when a NaN made the comparison unordered
+	P CondCode = "p"
 )
 
 type AsmAstBinaryOp string
@@ -24,6 +32,13 @@ const (
 	Add  AsmAstBinaryOp = "addl"
 	Sub  AsmAstBinaryOp = "subl"
 	Mult AsmAstBinaryOp = "imull"
+	Xor  AsmAstBinaryOp = "xorl"
+
+	// the SSE2 arithmetic on бутархай, the destination is an XMM register
+	AddSD AsmAstBinaryOp = "addsd"
+	SubSD AsmAstBinaryOp = "subsd"
+	MulSD AsmAstBinaryOp = "mulsd"
+	DivSD AsmAstBinaryOp = "divsd"
 )
 
 type AsmUnaryOperator string
@@ -38,6 +53,7 @@ type AsmRegister string
 const (
 	AL AsmRegister = "al"
 	AX AsmRegister = "ax"
+	BX AsmRegister = "bx"
 
 	CX  AsmRegister = "cx"
 	DX  AsmRegister = "dx"
@@ -47,9 +63,31 @@ const (
 	R9  AsmRegister = "r9"
 	R10 AsmRegister = "r10"
 	R11 AsmRegister = "r11"
+	R12 AsmRegister = "r12"
+	R13 AsmRegister = "r13"
+	R14 AsmRegister = "r14"
+	R15 AsmRegister = "r15"
 	SP  AsmRegister = "sp"
+
+	XMM0  AsmRegister = "xmm0"
+	XMM1  AsmRegister = "xmm1"
+	XMM2  AsmRegister = "xmm2"
+	XMM3  AsmRegister = "xmm3"
+	XMM4  AsmRegister = "xmm4"
+	XMM5  AsmRegister = "xmm5"
+	XMM6  AsmRegister = "xmm6"
+	XMM7  AsmRegister = "xmm7"
+	XMM14 AsmRegister = "xmm14"
+	XMM15 AsmRegister = "xmm15"
 )
 
+// isXMM reports whether reg is one of the SSE registers. Doubles are never
+// given one by the allocator, xmm0-xmm7 carry arguments and results and the
+// fixup pass uses xmm14 and xmm15 as scratch.
+func isXMM(reg AsmRegister) bool {
+	return strings.HasPrefix(string(reg), "xmm")
+}
+
 func (a AsmRegister) String() string {
 	return string(a)
 }
@@ -78,6 +116,8 @@ func (a AsmRegister) Asm32() string {
 	switch a {
 	case AX:
 		return "ax"
+	case BX:
+		return "bx"
 	case CX:
 		return "cx"
 	case DX:
@@ -94,9 +134,20 @@ func (a AsmRegister) Asm32() string {
 		return "r10"
 	case R11:
 		return "r11"
+	case R12:
+		return "r12"
+	case R13:
+		return "r13"
+	case R14:
+		return "r14"
+	case R15:
+		return "r15"
 	case SP:
 		return "%rsp" //rsp must be 64bit
 	default:
+		if isXMM(a) {
+			return string(a)
+		}
 		panic(fmt.Sprintf("unimplemented register %s", a))
 	}
 }
@@ -153,6 +204,14 @@ func (a Push) Ir() string {
 	return fmt.Sprintf("push %s", a.Op.Op())
 }
 
+type Pop struct {
+	Reg AsmRegister
+}
+
+func (a Pop) Ir() string {
+	return fmt.Sprintf("pop %s", a.Reg)
+}
+
 type Call struct {
 	Ident string
 }
@@ -161,6 +220,16 @@ func (a Call) Ir() string {
 	return fmt.Sprintf("call %s", a.Ident)
 }
 
+// TailCall leaves the current frame and jumps to Ident, which returns
+// straight to our caller. The arguments are already in their registers.
+type TailCall struct {
+	Ident string
+}
+
+func (a TailCall) Ir() string {
+	return fmt.Sprintf("tailcall %s", a.Ident)
+}
+
 type Cmp struct {
 	Type asmtype.AsmType
 	Src  AsmOperand
@@ -183,6 +252,17 @@ func (a Jmp) Ir() string {
 	return fmt.Sprintf("jmp %s", a.Ident)
 }
 
+// JmpTable jumps to Targets[%r11]. The table after it holds the offset of
+// every target from the table, so it needs no relocations. The index is
+// moved into %r11 first, which register allocation never hands out.
+type JmpTable struct {
+	Targets []string
+}
+
+func (a JmpTable) Ir() string {
+	return fmt.Sprintf("jmptable %s, [%s]", R11, strings.Join(a.Targets, ", "))
+}
+
 type JmpCC struct {
 	CC    CondCode
 	Ident string
@@ -272,6 +352,30 @@ func (a AsmMovZb) Ir() string {
 	return fmt.Sprintf("movzb %s, %s, %s", a.Src.Op(), a.Dst.Op(), typeStr)
 }
 
+// Cvtsi2sd converts the integer Src of Type to the бутархай in the XMM
+// register Dst.
+type Cvtsi2sd struct {
+	Type asmtype.AsmType
+	Src  AsmOperand
+	Dst  AsmOperand
+}
+
+func (a Cvtsi2sd) Ir() string {
+	return fmt.Sprintf("cvtsi2sd %s, %s", a.Src.Op(), a.Dst.Op())
+}
+
+// Cvttsd2si converts the бутархай Src to an integer of Type in the general
+// register Dst, rounding toward zero.
+type Cvttsd2si struct {
+	Type asmtype.AsmType
+	Src  AsmOperand
+	Dst  AsmOperand
+}
+
+func (a Cvttsd2si) Ir() string {
+	return fmt.Sprintf("cvttsd2si %s, %s", a.Src.Op(), a.Dst.Op())
+}
+
 type AsmMov struct {
 	Type asmtype.AsmType
 	Src  AsmOperand
@@ -309,6 +413,24 @@ func (a AllocateStack) Ir() string {
 	return fmt.Sprintf("subq $%d, %s", a.Value, R10)
 }
 
+// Loc marks the start of the code for a source line, it becomes a .loc
+// directive.
+type Loc struct {
+	Line int
+}
+
+func (a Loc) Ir() string {
+	return fmt.Sprintf("loc %d", a.Line)
+}
+
+// Syscall is only emitted by the runtime for --nolibc, the number is in
+// rax and the arguments in rdi, rsi, rdx, r10, r8 and r9.
+type Syscall struct{}
+
+func (a Syscall) Ir() string {
+	return "syscall"
+}
+
 type Return struct{}
 
 func (a Return) Ir() string {
@@ -318,6 +440,12 @@ func (a Return) Ir() string {
 type AsmFnDef struct {
 	Ident string
 	Irs   []AsmInstruction
+	// callee-saved registers the allocator handed out, pushed in the prologue
+	CalleeSaved []AsmRegister
+	// Debug is set when compiling with -g
+	Debug *FnDebugInfo
+	// Global is set for тунх functions, a shared library exports them
+	Global bool
 }
 
 type StringLiteral struct {
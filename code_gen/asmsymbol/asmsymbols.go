@@ -109,10 +109,12 @@ func (s *SymbolTable) GetSize(name string) (int, error) {
 	switch obj.Type.(type) {
 	case *asmtype.LongWord:
 		return 4, nil
-	case *asmtype.QuadWord:
+	case *asmtype.QuadWord, *asmtype.Double:
 		return 8, nil
 	case *asmtype.StringType:
 		return 8, nil // Strings are pointers, so they're 8 bytes on 64-bit systems
+	case *asmtype.Byte:
+		return 1, nil
 	default:
 		return 0, fmt.Errorf("internal error: unknown asm type for %q", name)
 	}
@@ -130,10 +132,12 @@ func (s *SymbolTable) GetAlignment(name string) (int, error) {
 	switch obj.Type.(type) {
 	case *asmtype.LongWord:
 		return 4, nil
-	case *asmtype.QuadWord:
+	case *asmtype.QuadWord, *asmtype.Double:
 		return 8, nil
 	case *asmtype.StringType:
 		return 8, nil // Strings are pointers, so they're 8 bytes on 64-bit systems
+	case *asmtype.Byte:
+		return 1, nil
 	default:
 		return 0, fmt.Errorf("internal error: unknown asm type for %q", name)
 	}
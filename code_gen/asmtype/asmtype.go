@@ -15,3 +15,15 @@ func (l *QuadWord) asmtype() {}
 type StringType struct{}
 
 func (s *StringType) asmtype() {}
+
+// Byte is a логик, and the single bytes the runtime that replaces libc
+// loads and stores through a pointer.
+type Byte struct{}
+
+func (b *Byte) asmtype() {}
+
+// Double is a бутархай. It lives in an XMM register or an 8 byte slot, and
+// moves between memory and general registers as its bits.
+type Double struct{}
+
+func (d *Double) asmtype() {}
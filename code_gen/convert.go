@@ -4,15 +4,27 @@ import (
 	"github.com/your-moon/mon_lang/util/utfconvert"
 )
 
-type TranslatePass struct{}
+// TranslatePass gives every name an ASCII spelling. Functions and globals
+// get utfconvert.Mangle, externs keep UtfConvert as lib.c and libc define
+// them under that name, local labels only need to be ASCII.
+type TranslatePass struct {
+	externs map[string]bool
+}
 
 func NewTranslatePass() TranslatePass {
-	return TranslatePass{}
+	return TranslatePass{externs: map[string]bool{}}
+}
+
+func (f *TranslatePass) symbol(name string) string {
+	if f.externs[name] {
+		return utfconvert.UtfConvert(name)
+	}
+	return utfconvert.Mangle(name)
 }
 
 func (f *TranslatePass) translateOperand(op AsmOperand) AsmOperand {
 	if rip, ok := op.(RipRelative); ok {
-		rip.Label = utfconvert.UtfConvert(rip.Label)
+		rip.Label = f.symbol(rip.Label)
 		return rip
 	}
 	return op
@@ -23,9 +35,25 @@ func (f *TranslatePass) TranslateInInstr(instr AsmInstruction) AsmInstruction {
 	case Label:
 		ast.Ident = utfconvert.UtfConvert(ast.Ident)
 		return ast
-	case Call:
+	case Jmp:
+		ast.Ident = utfconvert.UtfConvert(ast.Ident)
+		return ast
+	case JmpCC:
 		ast.Ident = utfconvert.UtfConvert(ast.Ident)
 		return ast
+	case JmpTable:
+		targets := make([]string, len(ast.Targets))
+		for i, target := range ast.Targets {
+			targets[i] = utfconvert.UtfConvert(target)
+		}
+		ast.Targets = targets
+		return ast
+	case Call:
+		ast.Ident = f.symbol(ast.Ident)
+		return ast
+	case TailCall:
+		ast.Ident = f.symbol(ast.Ident)
+		return ast
 	case AsmMov:
 		ast.Src = f.translateOperand(ast.Src)
 		ast.Dst = f.translateOperand(ast.Dst)
@@ -42,6 +70,24 @@ func (f *TranslatePass) TranslateInInstr(instr AsmInstruction) AsmInstruction {
 		ast.Src = f.translateOperand(ast.Src)
 		ast.Dst = f.translateOperand(ast.Dst)
 		return ast
+	case AsmMovZb:
+		ast.Src = f.translateOperand(ast.Src)
+		ast.Dst = f.translateOperand(ast.Dst)
+		return ast
+	case Cvtsi2sd:
+		ast.Src = f.translateOperand(ast.Src)
+		ast.Dst = f.translateOperand(ast.Dst)
+		return ast
+	case Cvttsd2si:
+		ast.Src = f.translateOperand(ast.Src)
+		ast.Dst = f.translateOperand(ast.Dst)
+		return ast
+	case AsmLoadFromMem:
+		ast.Dst = f.translateOperand(ast.Dst)
+		return ast
+	case AsmStoreToMem:
+		ast.Src = f.translateOperand(ast.Src)
+		return ast
 	case SetCC:
 		ast.Op = f.translateOperand(ast.Op)
 		return ast
@@ -60,7 +106,7 @@ func (f *TranslatePass) TranslateInInstr(instr AsmInstruction) AsmInstruction {
 }
 
 func (f *TranslatePass) TranslateInFn(fn AsmFnDef) AsmFnDef {
-	fn.Ident = utfconvert.UtfConvert(fn.Ident)
+	fn.Ident = f.symbol(fn.Ident)
 
 	for i, instr := range fn.Irs {
 		fn.Irs[i] = f.TranslateInInstr(instr)
@@ -70,6 +116,9 @@ func (f *TranslatePass) TranslateInFn(fn AsmFnDef) AsmFnDef {
 }
 
 func (f *TranslatePass) TranslateProgram(program AsmProgram) AsmProgram {
+	for _, fn := range program.AsmExternFn {
+		f.externs[fn.Name] = true
+	}
 	asmFnDefs := []AsmFnDef{}
 	for _, fn := range program.AsmFnDef {
 		asmFnDefs = append(asmFnDefs, f.TranslateInFn(fn))
@@ -80,7 +129,7 @@ func (f *TranslatePass) TranslateProgram(program AsmProgram) AsmProgram {
 		program.AsmExternFn[i] = fn
 	}
 	for i, gv := range program.GlobalVars {
-		program.GlobalVars[i].Label = utfconvert.UtfConvert(gv.Label)
+		program.GlobalVars[i].Label = f.symbol(gv.Label)
 	}
 	return AsmProgram{AsmFnDef: asmFnDefs, AsmExternFn: program.AsmExternFn, GlobalVars: program.GlobalVars}
 }
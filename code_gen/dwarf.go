@@ -0,0 +1,395 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// FnDebugInfo describes a function for the DWARF debug info written with -g.
+type FnDebugInfo struct {
+	// Name is the function's name in the source, Ident gets transliterated
+	Name string
+	// File is the source file of an imported function, empty for the file
+	// being compiled
+	File    string
+	Line    int
+	Public  bool
+	RetType mtypes.Type
+	Params  []DebugVar
+	Locals  []DebugVar
+}
+
+// DebugVar is a parameter or local variable. Variables described to the
+// debugger are kept out of registers, so one stack slot holds them for the
+// whole function.
+type DebugVar struct {
+	Name   string
+	Pseudo string
+	Type   mtypes.Type
+	// Offset from %rbp, 0 until the pseudo gets a stack slot
+	Offset int
+}
+
+// resolverSuffix is the _N the resolver appends to make local names unique.
+var resolverSuffix = regexp.MustCompile(`_[0-9]+$`)
+
+func (a *AsmASTGen) fnDebugInfo(fn tackygen.TackyFn) *FnDebugInfo {
+	info := &FnDebugInfo{Name: fn.Name, File: fn.File, Line: fn.Line, Public: fn.Global}
+	if entry := a.SymbolTable.Get(fn.Name); entry != nil {
+		if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+			info.RetType = fnType.RetType
+		}
+	}
+
+	seen := map[string]bool{}
+	debugVar := func(val tackygen.TackyVal) (DebugVar, bool) {
+		v, ok := val.(tackygen.Var)
+		if !ok || seen[v.Name] || strings.HasPrefix(v.Name, "tmp.") || a.asmSymbols.IsGlobalVar(v.Name) {
+			return DebugVar{}, false
+		}
+		entry := a.SymbolTable.Get(v.Name)
+		if entry == nil {
+			return DebugVar{}, false
+		}
+		seen[v.Name] = true
+		return DebugVar{Name: resolverSuffix.ReplaceAllString(v.Name, ""), Pseudo: v.Name, Type: entry.Type}, true
+	}
+
+	for _, param := range fn.Params {
+		if dv, ok := debugVar(param); ok {
+			info.Params = append(info.Params, dv)
+		}
+	}
+	for _, instr := range fn.Instructions {
+		uses, def := tackygen.UsesAndDef(instr)
+		for _, val := range append(uses, def) {
+			if dv, ok := debugVar(val); ok {
+				info.Locals = append(info.Locals, dv)
+			}
+		}
+	}
+	return info
+}
+
+// pseudos lists the pseudos of the function's variables.
+func (d *FnDebugInfo) pseudos() []string {
+	names := []string{}
+	for _, v := range append(append([]DebugVar{}, d.Params...), d.Locals...) {
+		names = append(names, v.Pseudo)
+	}
+	return names
+}
+
+func (d *FnDebugInfo) assignOffsets(offsets map[string]int) {
+	for _, vars := range [][]DebugVar{d.Params, d.Locals} {
+		for i := range vars {
+			vars[i].Offset = offsets[vars[i].Pseudo]
+		}
+	}
+}
+
+// The DWARF 4 codes the writer uses.
+const (
+	dwTagCompileUnit     = 0x11
+	dwTagSubprogram      = 0x2e
+	dwTagFormalParameter = 0x05
+	dwTagVariable        = 0x34
+	dwTagBaseType        = 0x24
+	dwTagPointerType     = 0x0f
+	dwTagStructureType   = 0x13
+	dwTagMember          = 0x0d
+
+	dwAtName      = 0x03
+	dwAtProducer  = 0x25
+	dwAtLanguage  = 0x13
+	dwAtCompDir   = 0x1b
+	dwAtLowPc     = 0x11
+	dwAtHighPc    = 0x12
+	dwAtStmtList  = 0x10
+	dwAtDeclFile  = 0x3a
+	dwAtDeclLine  = 0x3b
+	dwAtType      = 0x49
+	dwAtFrameBase = 0x40
+	dwAtExternal  = 0x3f
+	dwAtLocation  = 0x02
+	dwAtEncoding  = 0x3e
+	dwAtByteSize  = 0x0b
+	dwAtMemberLoc = 0x38
+
+	dwFormAddr      = 0x01
+	dwFormData1     = 0x0b
+	dwFormData2     = 0x05
+	dwFormData4     = 0x06
+	dwFormString    = 0x08
+	dwFormRef4      = 0x13
+	dwFormSecOffset = 0x17
+	dwFormExprloc   = 0x18
+	dwFormFlag      = 0x0c
+
+	dwLangC99         = 0x0c
+	dwAteBoolean      = 0x02
+	dwAteFloat        = 0x04
+	dwAteSigned       = 0x05
+	dwAteSignedChar   = 0x06
+	dwOpBreg6         = 0x76
+	dwOpFbreg         = 0x91
+	dwChildrenNo      = 0
+	dwChildrenYes     = 1
+	abbrevCompileUnit = 1
+	abbrevFn          = 2
+	abbrevVoidFn      = 3
+	abbrevParam       = 4
+	abbrevVariable    = 5
+	abbrevBaseType    = 6
+	abbrevPointerType = 7
+	abbrevStructType  = 8
+	abbrevMember      = 9
+)
+
+type dwarfAbbrev struct {
+	code     int
+	tag      int
+	children int
+	attrs    [][2]int
+}
+
+var dwarfAbbrevs = []dwarfAbbrev{
+	{abbrevCompileUnit, dwTagCompileUnit, dwChildrenYes, [][2]int{
+		{dwAtProducer, dwFormString}, {dwAtLanguage, dwFormData2}, {dwAtName, dwFormString}, {dwAtCompDir, dwFormString},
+		{dwAtLowPc, dwFormAddr}, {dwAtHighPc, dwFormAddr}, {dwAtStmtList, dwFormSecOffset},
+	}},
+	{abbrevFn, dwTagSubprogram, dwChildrenYes, [][2]int{
+		{dwAtName, dwFormString}, {dwAtDeclFile, dwFormData1}, {dwAtDeclLine, dwFormData4}, {dwAtType, dwFormRef4},
+		{dwAtLowPc, dwFormAddr}, {dwAtHighPc, dwFormAddr}, {dwAtFrameBase, dwFormExprloc}, {dwAtExternal, dwFormFlag},
+	}},
+	{abbrevVoidFn, dwTagSubprogram, dwChildrenYes, [][2]int{
+		{dwAtName, dwFormString}, {dwAtDeclFile, dwFormData1}, {dwAtDeclLine, dwFormData4},
+		{dwAtLowPc, dwFormAddr}, {dwAtHighPc, dwFormAddr}, {dwAtFrameBase, dwFormExprloc}, {dwAtExternal, dwFormFlag},
+	}},
+	{abbrevParam, dwTagFormalParameter, dwChildrenNo, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4}, {dwAtLocation, dwFormExprloc},
+	}},
+	{abbrevVariable, dwTagVariable, dwChildrenNo, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4}, {dwAtLocation, dwFormExprloc},
+	}},
+	{abbrevBaseType, dwTagBaseType, dwChildrenNo, [][2]int{
+		{dwAtName, dwFormString}, {dwAtEncoding, dwFormData1}, {dwAtByteSize, dwFormData1},
+	}},
+	{abbrevPointerType, dwTagPointerType, dwChildrenNo, [][2]int{
+		{dwAtByteSize, dwFormData1}, {dwAtType, dwFormRef4},
+	}},
+	{abbrevStructType, dwTagStructureType, dwChildrenYes, [][2]int{
+		{dwAtName, dwFormString}, {dwAtByteSize, dwFormData4},
+	}},
+	{abbrevMember, dwTagMember, dwChildrenNo, [][2]int{
+		{dwAtName, dwFormString}, {dwAtType, dwFormRef4}, {dwAtMemberLoc, dwFormData4},
+	}},
+}
+
+func sleb128(v int64) []byte {
+	out := []byte{}
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func byteList(bs []byte) string {
+	parts := make([]string, len(bs))
+	for i, b := range bs {
+		parts[i] = fmt.Sprintf("0x%x", b)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// debugTypes hands out a label for the DIE of every type the variables use
+// and remembers which DIEs have to be written.
+type debugTypes struct {
+	labels map[string]string
+	order  []mtypes.Type
+}
+
+func (t *debugTypes) label(mtype mtypes.Type) string {
+	key := tackygen.TypeName(mtype)
+	if label, ok := t.labels[key]; ok {
+		return label
+	}
+	label := fmt.Sprintf(".Ldebug_type%d", len(t.order))
+	t.labels[key] = label
+	t.order = append(t.order, mtype)
+	return label
+}
+
+// fileNumbers numbers the source files for .file and DW_AT_decl_file, the
+// file being compiled is 1.
+func (a *AsmGen) debugFileNumbers(fns []AsmFnDef) map[string]int {
+	numbers := map[string]int{"": 1}
+	for _, fn := range fns {
+		if fn.Debug != nil {
+			if _, ok := numbers[fn.Debug.File]; !ok {
+				numbers[fn.Debug.File] = len(numbers) + 1
+			}
+		}
+	}
+	return numbers
+}
+
+// GenDebugSections writes .debug_abbrev and .debug_info for the program.
+// The line table comes from the .loc directives, the assembler builds
+// .debug_line out of them.
+func (a *AsmGen) GenDebugSections(fns []AsmFnDef) {
+	a.Write(`.section .debug_abbrev,"",@progbits`)
+	a.Write(".Ldebug_abbrev0:")
+	for _, abbrev := range dwarfAbbrevs {
+		a.Write(fmt.Sprintf("    .uleb128 %d", abbrev.code))
+		a.Write(fmt.Sprintf("    .uleb128 0x%x", abbrev.tag))
+		a.Write(fmt.Sprintf("    .byte %d", abbrev.children))
+		for _, attr := range abbrev.attrs {
+			a.Write(fmt.Sprintf("    .uleb128 0x%x", attr[0]))
+			a.Write(fmt.Sprintf("    .uleb128 0x%x", attr[1]))
+		}
+		a.Write("    .byte 0")
+		a.Write("    .byte 0")
+	}
+	a.Write("    .byte 0")
+
+	types := &debugTypes{labels: map[string]string{}}
+	ref := func(mtype mtypes.Type) string {
+		return fmt.Sprintf("    .long %s - .Ldebug_info0", types.label(mtype))
+	}
+
+	a.Write(`.section .debug_info,"",@progbits`)
+	a.Write(".Ldebug_info0:")
+	a.Write("    .long .Ldebug_info_end - .Ldebug_info_start")
+	a.Write(".Ldebug_info_start:")
+	a.Write("    .value 4")
+	a.Write("    .long .Ldebug_abbrev0")
+	a.Write("    .byte 8")
+
+	a.Write(fmt.Sprintf("    .uleb128 %d", abbrevCompileUnit))
+	a.Write(`    .string "mon"`)
+	a.Write(fmt.Sprintf("    .value 0x%x", dwLangC99))
+	a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(a.debugFile)))
+	a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(a.debugCompDir)))
+	a.Write("    .quad .Ltext0")
+	a.Write("    .quad .Letext0")
+	a.Write("    .long .Ldebug_line0")
+
+	for _, fn := range fns {
+		info := fn.Debug
+		if info == nil {
+			continue
+		}
+		_, isVoid := info.RetType.(*mtypes.VoidType)
+		if info.RetType == nil || isVoid {
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevVoidFn))
+		} else {
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevFn))
+		}
+		a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(info.Name)))
+		a.Write(fmt.Sprintf("    .byte %d", a.fileNumbers[info.File]))
+		a.Write(fmt.Sprintf("    .long %d", info.Line))
+		if info.RetType != nil && !isVoid {
+			a.Write(ref(info.RetType))
+		}
+		a.Write(fmt.Sprintf("    .quad %s", fn.Ident))
+		a.Write(fmt.Sprintf("    .quad .Lfunc_end.%s", fn.Ident))
+		a.Write("    .uleb128 2")
+		a.Write(fmt.Sprintf("    .byte 0x%x, 0", dwOpBreg6))
+		if info.Public {
+			a.Write("    .byte 1")
+		} else {
+			a.Write("    .byte 0")
+		}
+
+		for _, group := range []struct {
+			abbrev int
+			vars   []DebugVar
+		}{{abbrevParam, info.Params}, {abbrevVariable, info.Locals}} {
+			for _, v := range group.vars {
+				if v.Offset == 0 {
+					continue
+				}
+				loc := append([]byte{dwOpFbreg}, sleb128(int64(v.Offset))...)
+				a.Write(fmt.Sprintf("    .uleb128 %d", group.abbrev))
+				a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(v.Name)))
+				a.Write(ref(v.Type))
+				a.Write(fmt.Sprintf("    .uleb128 %d", len(loc)))
+				a.Write(fmt.Sprintf("    .byte %s", byteList(loc)))
+			}
+		}
+		a.Write("    .byte 0")
+	}
+
+	// writing a pointer can ask for the type it points to, so the list may
+	// grow while it is walked
+	for i := 0; i < len(types.order); i++ {
+		mtype := types.order[i]
+		a.Write(fmt.Sprintf("%s:", types.label(mtype)))
+		switch ty := mtype.(type) {
+		case *mtypes.Int32Type:
+			a.genBaseType("тоо", dwAteSigned, 4)
+		case *mtypes.EnumType:
+			// a төрөл is stored as a тоо, its name is enough for the debugger
+			a.genBaseType(ty.Name, dwAteSigned, 4)
+		case *mtypes.Int64Type:
+			a.genBaseType("тоо64", dwAteSigned, 8)
+		case *mtypes.BoolType:
+			a.genBaseType("логик", dwAteBoolean, 1)
+		case *mtypes.DoubleType:
+			a.genBaseType("бутархай", dwAteFloat, 8)
+		case *mtypes.StringType:
+			// there is only one string type, so only one char DIE
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevPointerType))
+			a.Write("    .byte 8")
+			a.Write("    .long .Ldebug_char - .Ldebug_info0")
+			a.Write(".Ldebug_char:")
+			a.genBaseType("тэмдэгт", dwAteSignedChar, 1)
+		case *mtypes.ArrayType:
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevPointerType))
+			a.Write("    .byte 8")
+			a.Write(ref(ty.ElementType))
+		case *mtypes.StructType:
+			// a бүтэц is a pointer to the block with its fields, written
+			// right after the pointer
+			structLabel := types.label(mtype) + ".struct"
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevPointerType))
+			a.Write("    .byte 8")
+			a.Write(fmt.Sprintf("    .long %s - .Ldebug_info0", structLabel))
+			a.Write(fmt.Sprintf("%s:", structLabel))
+			a.Write(fmt.Sprintf("    .uleb128 %d", abbrevStructType))
+			a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(ty.Name)))
+			a.Write(fmt.Sprintf("    .long %d", ty.Size))
+			for _, field := range ty.Fields {
+				a.Write(fmt.Sprintf("    .uleb128 %d", abbrevMember))
+				a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(field.Name)))
+				a.Write(ref(field.Type))
+				a.Write(fmt.Sprintf("    .long %d", field.Offset))
+			}
+			a.Write("    .byte 0")
+		default:
+			a.genBaseType(tackygen.TypeName(mtype), dwAteSigned, 8)
+		}
+	}
+
+	a.Write("    .byte 0")
+	a.Write(".Ldebug_info_end:")
+
+	a.Write(`.section .debug_line,"",@progbits`)
+	a.Write(".Ldebug_line0:")
+}
+
+func (a *AsmGen) genBaseType(name string, encoding int, size int) {
+	a.Write(fmt.Sprintf("    .uleb128 %d", abbrevBaseType))
+	a.Write(fmt.Sprintf("    .string \"%s\"", escapeForAsm(name)))
+	a.Write(fmt.Sprintf("    .byte 0x%x", encoding))
+	a.Write(fmt.Sprintf("    .byte %d", size))
+}
@@ -0,0 +1,429 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/your-moon/mon_lang/util"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+// ObjGen writes the program as a relocatable ELF64 object without going
+// through an assembler, the machine code for each instruction is in
+// encoder.go. Calls to externs and addresses in .data and .rodata are left
+// to the linker as relocations, jumps and calls within .text are resolved
+// here.
+//
+// It produces the same code as GenAsm but has no -g and no Mach-O, those
+// still need the assembly and as. With NoLibc and the runtime from
+// AddRuntime, GenExec writes a static executable instead of an object.
+type ObjGen struct {
+	// NoLibc names the entry _start as for ld -static
+	NoLibc bool
+	// Shared leaves out the entry and makes the тунх functions global
+	Shared    bool
+	writer    io.Writer
+	ostype    util.OsType
+	text      []byte
+	fixups    []fixup
+	labels    map[string]int
+	funcs     map[string]int
+	funcSizes map[string]int
+	strings   map[string]int
+	rodata    []byte
+	// numbers the tables of JmpTable
+	tableCount int
+}
+
+func NewGenObj(writer io.Writer, osType util.OsType) ObjGen {
+	return ObjGen{
+		writer:    writer,
+		ostype:    osType,
+		labels:    make(map[string]int),
+		funcs:     make(map[string]int),
+		funcSizes: make(map[string]int),
+		strings:   make(map[string]int),
+	}
+}
+
+// addString places value in .rodata the first time it is used.
+func (o *ObjGen) addString(value string) {
+	if _, exists := o.strings[value]; exists {
+		return
+	}
+	o.strings[value] = len(o.rodata)
+	o.rodata = append(o.rodata, value...)
+	o.rodata = append(o.rodata, 0)
+}
+
+const (
+	elfSectionText = iota + 1
+	elfSectionData
+	elfSectionRodata
+	elfSectionRela
+	elfSectionSymtab
+	elfSectionStrtab
+	elfSectionShstrtab
+	elfSectionNote
+	elfSectionCount
+)
+
+const (
+	rX8664PC32  = 2
+	rX8664PLT32 = 4
+)
+
+type elfSymbol struct {
+	name    string
+	info    byte
+	section uint16
+	value   uint64
+	size    uint64
+}
+
+type elfRela struct {
+	offset uint64
+	symbol int
+	kind   uint32
+	addend int64
+}
+
+func (o *ObjGen) entry() string {
+	if o.NoLibc {
+		return "_start"
+	}
+	return "main"
+}
+
+// encode fills .text and .rodata and returns .data with the offset of each
+// global in it.
+func (o *ObjGen) encode(program AsmProgram) ([]byte, map[string]int) {
+	// the entry is the same stub GenAsm writes
+	if !o.Shared {
+		o.funcs[o.entry()] = 0
+		if o.NoLibc {
+			o.text = append(o.text,
+				0x48, 0x8b, 0x3c, 0x24, // movq (%rsp), %rdi
+				0x48, 0x8d, 0x74, 0x24, 0x08, // leaq 8(%rsp), %rsi
+			)
+		} else {
+			o.text = append(o.text,
+				0x55,             // pushq %rbp
+				0x48, 0x89, 0xe5, // movq %rsp, %rbp
+			)
+		}
+		o.emitRel32([]byte{0xe8}, fixFunc, "mon_rt_args")
+		o.text = append(o.text, 0x48, 0x89, 0xc7) // movq %rax, %rdi
+		o.emitRel32([]byte{0xe8}, fixFunc, utfconvert.Mangle("үндсэн"))
+		o.text = append(o.text, 0x89, 0xc7) // movl %eax, %edi
+		if o.NoLibc {
+			o.text = append(o.text,
+				0x48, 0xc7, 0xc0, 60, 0, 0, 0, // movq $60, %rax
+				0x0f, 0x05, // syscall
+			)
+		} else {
+			o.emitRel32([]byte{0xe8}, fixFunc, "exit")
+		}
+		o.funcSizes[o.entry()] = len(o.text)
+	}
+	for _, fn := range program.AsmFnDef {
+		o.genFn(fn)
+	}
+
+	data := []byte{}
+	globals := map[string]int{}
+	for _, gv := range program.GlobalVars {
+		for len(data)%gv.Size != 0 {
+			data = append(data, 0)
+		}
+		globals[gv.Label] = len(data)
+		switch gv.Size {
+		case 8:
+			data = binary.LittleEndian.AppendUint64(data, uint64(gv.InitValue))
+		case 1:
+			data = append(data, byte(gv.InitValue))
+		default:
+			data = binary.LittleEndian.AppendUint32(data, uint32(gv.InitValue))
+		}
+	}
+	return data, globals
+}
+
+func (o *ObjGen) GenObj(program AsmProgram) error {
+	if o.ostype != util.Linux {
+		return fmt.Errorf("объект файлыг зөвхөн linux дээр шууд бичнэ, %s дээр as хэрэгтэй", o.ostype)
+	}
+	data, globals := o.encode(program)
+
+	// the section symbols, then the functions and globals, which stay local
+	// as in the assembly, then the entry or the exported functions and the
+	// externs
+	exported := func(fn AsmFnDef) bool {
+		return o.Shared && fn.Global
+	}
+	fnSymbol := func(fn AsmFnDef, bind byte) elfSymbol {
+		return elfSymbol{name: fn.Ident, info: bind<<4 | 2, section: elfSectionText, value: uint64(o.funcs[fn.Ident]), size: uint64(o.funcSizes[fn.Ident])}
+	}
+	symbols := []elfSymbol{{}}
+	for _, section := range []uint16{elfSectionText, elfSectionData, elfSectionRodata} {
+		symbols = append(symbols, elfSymbol{info: 3, section: section})
+	}
+	for _, fn := range program.AsmFnDef {
+		if !exported(fn) {
+			symbols = append(symbols, fnSymbol(fn, 0))
+		}
+	}
+	for _, gv := range program.GlobalVars {
+		symbols = append(symbols, elfSymbol{name: gv.Label, info: 1, section: elfSectionData, value: uint64(globals[gv.Label]), size: uint64(gv.Size)})
+	}
+	firstGlobal := len(symbols)
+	if !o.Shared {
+		symbols = append(symbols, elfSymbol{name: o.entry(), info: 1<<4 | 2, section: elfSectionText, size: uint64(o.funcSizes[o.entry()])})
+	}
+	for _, fn := range program.AsmFnDef {
+		if exported(fn) {
+			symbols = append(symbols, fnSymbol(fn, 1))
+		}
+	}
+	externs := map[string]int{}
+	extern := func(name string) int {
+		if idx, ok := externs[name]; ok {
+			return idx
+		}
+		externs[name] = len(symbols)
+		symbols = append(symbols, elfSymbol{name: name, info: 1 << 4})
+		return externs[name]
+	}
+	for _, fn := range program.AsmExternFn {
+		// the runtime for --nolibc defines the prelude itself
+		if _, defined := o.funcs[fn.Name]; !defined {
+			extern(fn.Name)
+		}
+	}
+
+	relas := []elfRela{}
+	for _, f := range o.fixups {
+		// rel32 counts from the end of the instruction
+		end := f.Offset + 4 + f.Tail
+		patch := func(target int) {
+			binary.LittleEndian.PutUint32(o.text[f.Offset:], uint32(int32(target-end)))
+		}
+		switch f.Kind {
+		case fixLabel:
+			target, ok := o.labels[f.Symbol]
+			if !ok {
+				panic(fmt.Sprintf("undefined label %s", f.Symbol))
+			}
+			patch(target)
+		case fixFunc:
+			if target, ok := o.funcs[f.Symbol]; ok {
+				patch(target)
+				continue
+			}
+			relas = append(relas, elfRela{uint64(f.Offset), extern(f.Symbol), rX8664PLT32, int64(f.Offset - end)})
+		case fixGlobal:
+			offset, ok := globals[f.Symbol]
+			if !ok {
+				panic(fmt.Sprintf("undefined global %s", f.Symbol))
+			}
+			relas = append(relas, elfRela{uint64(f.Offset), elfSectionData, rX8664PC32, int64(offset + f.Offset - end)})
+		case fixString:
+			relas = append(relas, elfRela{uint64(f.Offset), elfSectionRodata, rX8664PC32, int64(o.strings[f.Symbol] + f.Offset - end)})
+		}
+	}
+
+	strtab := []byte{0}
+	symtab := []byte{}
+	for _, sym := range symbols {
+		name := 0
+		if sym.name != "" {
+			name = len(strtab)
+			strtab = append(append(strtab, sym.name...), 0)
+		}
+		symtab = binary.LittleEndian.AppendUint32(symtab, uint32(name))
+		symtab = append(symtab, sym.info, 0)
+		symtab = binary.LittleEndian.AppendUint16(symtab, sym.section)
+		symtab = binary.LittleEndian.AppendUint64(symtab, sym.value)
+		symtab = binary.LittleEndian.AppendUint64(symtab, sym.size)
+	}
+
+	rela := []byte{}
+	for _, r := range relas {
+		rela = binary.LittleEndian.AppendUint64(rela, r.offset)
+		rela = binary.LittleEndian.AppendUint64(rela, uint64(r.symbol)<<32|uint64(r.kind))
+		rela = binary.LittleEndian.AppendUint64(rela, uint64(r.addend))
+	}
+
+	type section struct {
+		name      string
+		kind      uint32
+		flags     uint64
+		content   []byte
+		link      uint32
+		info      uint32
+		align     uint64
+		entrySize uint64
+	}
+	sections := [elfSectionCount]section{
+		elfSectionText:     {".text", 1, 0x6, o.text, 0, 0, 16, 0},
+		elfSectionData:     {".data", 1, 0x3, data, 0, 0, 8, 0},
+		elfSectionRodata:   {".rodata", 1, 0x2, o.rodata, 0, 0, 1, 0},
+		elfSectionRela:     {".rela.text", 4, 0x40, rela, elfSectionSymtab, elfSectionText, 8, 24},
+		elfSectionSymtab:   {".symtab", 2, 0, symtab, elfSectionStrtab, uint32(firstGlobal), 8, 24},
+		elfSectionStrtab:   {".strtab", 3, 0, strtab, 0, 0, 1, 0},
+		elfSectionShstrtab: {".shstrtab", 3, 0, nil, 0, 0, 1, 0},
+		elfSectionNote:     {".note.GNU-stack", 1, 0, nil, 0, 0, 1, 0},
+	}
+	shstrtab := []byte{0}
+	names := [elfSectionCount]int{}
+	for i := 1; i < elfSectionCount; i++ {
+		names[i] = len(shstrtab)
+		shstrtab = append(append(shstrtab, sections[i].name...), 0)
+	}
+	sections[elfSectionShstrtab].content = shstrtab
+
+	out := &bytes.Buffer{}
+	out.Write(make([]byte, 64))
+	offsets := [elfSectionCount]int{}
+	for i := 1; i < elfSectionCount; i++ {
+		for out.Len()%int(sections[i].align) != 0 {
+			out.WriteByte(0)
+		}
+		offsets[i] = out.Len()
+		out.Write(sections[i].content)
+	}
+	for out.Len()%8 != 0 {
+		out.WriteByte(0)
+	}
+	sectionHeaders := out.Len()
+	out.Write(make([]byte, 64))
+	for i := 1; i < elfSectionCount; i++ {
+		s := sections[i]
+		header := binary.LittleEndian.AppendUint32(nil, uint32(names[i]))
+		header = binary.LittleEndian.AppendUint32(header, s.kind)
+		header = binary.LittleEndian.AppendUint64(header, s.flags)
+		header = binary.LittleEndian.AppendUint64(header, 0)
+		header = binary.LittleEndian.AppendUint64(header, uint64(offsets[i]))
+		header = binary.LittleEndian.AppendUint64(header, uint64(len(s.content)))
+		header = binary.LittleEndian.AppendUint32(header, s.link)
+		header = binary.LittleEndian.AppendUint32(header, s.info)
+		header = binary.LittleEndian.AppendUint64(header, s.align)
+		header = binary.LittleEndian.AppendUint64(header, s.entrySize)
+		out.Write(header)
+	}
+
+	elf := out.Bytes()
+	copy(elf, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1})
+	binary.LittleEndian.PutUint16(elf[16:], 1)  // ET_REL
+	binary.LittleEndian.PutUint16(elf[18:], 62) // EM_X86_64
+	binary.LittleEndian.PutUint32(elf[20:], 1)
+	binary.LittleEndian.PutUint64(elf[40:], uint64(sectionHeaders))
+	binary.LittleEndian.PutUint16(elf[52:], 64)
+	binary.LittleEndian.PutUint16(elf[58:], 64)
+	binary.LittleEndian.PutUint16(elf[60:], elfSectionCount)
+	binary.LittleEndian.PutUint16(elf[62:], elfSectionShstrtab)
+
+	_, err := o.writer.Write(elf)
+	return err
+}
+
+// execBase is where GenExec maps the file, the usual address for non-PIE
+// executables.
+const execBase = 0x400000
+
+// GenExec writes a static ELF64 executable with every call and address
+// resolved, for --nolibc. Nothing is left to a linker so a call to an
+// extern the runtime does not define is an error.
+func (o *ObjGen) GenExec(program AsmProgram) error {
+	if o.ostype != util.Linux {
+		return fmt.Errorf("статик файлыг зөвхөн linux дээр бичнэ, %s дэмжигдээгүй", o.ostype)
+	}
+	data, globals := o.encode(program)
+
+	// the headers, .text and .rodata share one read-only segment and .data
+	// starts on a page of its own
+	const headerSize = 64 + 3*56
+	textOffset := headerSize
+	for textOffset%16 != 0 {
+		textOffset++
+	}
+	rodataOffset := textOffset + len(o.text)
+	dataOffset := rodataOffset + len(o.rodata)
+	for dataOffset%0x1000 != 0 {
+		dataOffset++
+	}
+
+	for _, f := range o.fixups {
+		var target int
+		switch f.Kind {
+		case fixLabel:
+			offset, ok := o.labels[f.Symbol]
+			if !ok {
+				panic(fmt.Sprintf("undefined label %s", f.Symbol))
+			}
+			target = textOffset + offset
+		case fixFunc:
+			offset, ok := o.funcs[f.Symbol]
+			if !ok {
+				return fmt.Errorf("'%s' функц --nolibc горимд байхгүй", utfconvert.DemangleText(f.Symbol))
+			}
+			target = textOffset + offset
+		case fixGlobal:
+			offset, ok := globals[f.Symbol]
+			if !ok {
+				panic(fmt.Sprintf("undefined global %s", f.Symbol))
+			}
+			target = dataOffset + offset
+		case fixString:
+			target = rodataOffset + o.strings[f.Symbol]
+		}
+		end := textOffset + f.Offset + 4 + f.Tail
+		binary.LittleEndian.PutUint32(o.text[f.Offset:], uint32(int32(target-end)))
+	}
+
+	exe := make([]byte, dataOffset+len(data))
+	copy(exe[textOffset:], o.text)
+	copy(exe[rodataOffset:], o.rodata)
+	copy(exe[dataOffset:], data)
+
+	copy(exe, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1})
+	binary.LittleEndian.PutUint16(exe[16:], 2)  // ET_EXEC
+	binary.LittleEndian.PutUint16(exe[18:], 62) // EM_X86_64
+	binary.LittleEndian.PutUint32(exe[20:], 1)
+	binary.LittleEndian.PutUint64(exe[24:], uint64(execBase+textOffset+o.funcs[o.entry()]))
+	binary.LittleEndian.PutUint64(exe[32:], 64)
+	binary.LittleEndian.PutUint16(exe[52:], 64)
+	binary.LittleEndian.PutUint16(exe[54:], 56)
+	binary.LittleEndian.PutUint16(exe[56:], 3)
+
+	type segment struct {
+		kind, flags  uint32
+		offset, size int
+		align        uint64
+	}
+	segments := []segment{
+		{1, 0x5, 0, rodataOffset + len(o.rodata), 0x1000}, // PT_LOAD r-x
+		{1, 0x6, dataOffset, len(data), 0x1000},           // PT_LOAD rw-
+		{0x6474e551, 0x6, 0, 0, 16},                       // PT_GNU_STACK
+	}
+	header := exe[64:64]
+	for _, seg := range segments {
+		vaddr := uint64(0)
+		if seg.kind == 1 {
+			vaddr = uint64(execBase + seg.offset)
+		}
+		header = binary.LittleEndian.AppendUint32(header, seg.kind)
+		header = binary.LittleEndian.AppendUint32(header, seg.flags)
+		header = binary.LittleEndian.AppendUint64(header, uint64(seg.offset))
+		header = binary.LittleEndian.AppendUint64(header, vaddr)
+		header = binary.LittleEndian.AppendUint64(header, vaddr)
+		header = binary.LittleEndian.AppendUint64(header, uint64(seg.size))
+		header = binary.LittleEndian.AppendUint64(header, uint64(seg.size))
+		header = binary.LittleEndian.AppendUint64(header, seg.align)
+	}
+
+	_, err := o.writer.Write(exe)
+	return err
+}
@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/your-moon/mon_lang/base"
 	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
@@ -21,15 +22,26 @@ type Emitter interface {
 }
 
 type AsmASTGen struct {
-	Registers   []AsmRegister
-	SymbolTable *symbols.SymbolTable
-	asmSymbols  *asmsymbol.SymbolTable
+	Registers []AsmRegister
+	// DoubleRegisters carry бутархай arguments, the first also the result
+	DoubleRegisters []AsmRegister
+	SymbolTable     *symbols.SymbolTable
+	asmSymbols      *asmsymbol.SymbolTable
+	// TailCalls turns calls whose result is returned right away into jumps
+	TailCalls bool
+	// DebugInfo describes functions and their variables for -g
+	DebugInfo bool
+
+	// unordered numbers the labels == and != on бутархай jump to
+	unordered int
 }
 
 func NewAsmGen(table *symbols.SymbolTable) AsmASTGen {
 	return AsmASTGen{
-		Registers:   []AsmRegister{DI, SI, DX, CX, R8, R9},
-		SymbolTable: table,
+		Registers:       []AsmRegister{DI, SI, DX, CX, R8, R9},
+		DoubleRegisters: []AsmRegister{XMM0, XMM1, XMM2, XMM3, XMM4, XMM5, XMM6, XMM7},
+		SymbolTable:     table,
+		TailCalls:       true,
 	}
 }
 
@@ -87,6 +99,24 @@ func (a *AsmASTGen) GenASTAsm(program tackygen.TackyProgram, symbolTable *symbol
 		}
 	}
 
+	regAlloc := NewRegAllocPass(asmSymbols, symbolTable)
+	for _, fn := range asmprogram.AsmFnDef {
+		if fn.Debug != nil {
+			regAlloc.KeepInMemory(fn.Debug.pseudos())
+		}
+	}
+	asmprogram = regAlloc.AllocateProgram(asmprogram)
+
+	if base.Debug {
+		fmt.Println("---- ASMAST AFTER REGISTER ALLOCATION ----:")
+		for _, fn := range asmprogram.AsmFnDef {
+			fmt.Println(fn.Ident + ":")
+			for _, instr := range fn.Irs {
+				fmt.Println(instr.Ir())
+			}
+		}
+	}
+
 	pass1 := NewReplacementPassGen(asmSymbols)
 	asmprogram = pass1.ReplacePseudosInProgram(asmprogram, symbolTable)
 
@@ -114,6 +144,18 @@ func (a *AsmASTGen) GenASTAsm(program tackygen.TackyProgram, symbolTable *symbol
 		}
 	}
 
+	pass4 := NewPeepholePass(asmSymbols, symbolTable)
+	asmprogram = pass4.OptimizeProgram(asmprogram)
+
+	if base.Debug {
+		fmt.Println("---- ASMAST AFTER PEEPHOLE ----:")
+		for _, fn := range asmprogram.AsmFnDef {
+			for _, instr := range fn.Irs {
+				fmt.Println(instr.Ir())
+			}
+		}
+	}
+
 	return asmprogram
 }
 
@@ -124,31 +166,15 @@ func (a *AsmASTGen) GenASTExternFn(fn tackygen.TackyFn) AsmExternFn {
 	return asmfn
 }
 
-func (a *AsmASTGen) passInStack(param tackygen.TackyVal) []AsmInstruction {
-	switch valtype := param.(type) {
-	case tackygen.Var:
-		asmArg := a.GenASTVal(valtype)
-		switch asmArg.(type) {
-		case Register:
-		case Imm:
-			push := Push{
-				Op: asmArg,
-			}
-			return []AsmInstruction{push}
-		default:
-			pType := a.AsmType(param)
-			mov := AsmMov{
-				Type: pType,
-				Src:  asmArg,
-				Dst:  Register{Reg: AX},
-			}
-			push := Push{
-				Op: Register{Reg: AX},
-			}
-			return []AsmInstruction{mov, push}
-		}
+// passInStack copies the param the caller pushed as its k-th stack argument
+// out of the caller's frame, above our saved rbp and return address.
+func (a *AsmASTGen) passInStack(k int, param tackygen.TackyVal) []AsmInstruction {
+	mov := AsmMov{
+		Type: a.AsmType(param),
+		Src:  Stack{Value: 16 + 8*k},
+		Dst:  a.GenASTVal(param),
 	}
-	return []AsmInstruction{}
+	return []AsmInstruction{mov}
 }
 
 func (a *AsmASTGen) AsmType(val tackygen.TackyVal) asmtype.AsmType {
@@ -159,6 +185,10 @@ func (a *AsmASTGen) AsmType(val tackygen.TackyVal) asmtype.AsmType {
 			return &asmtype.QuadWord{}
 		case *mconstant.Int32:
 			return &asmtype.LongWord{}
+		case *mconstant.Bool:
+			return &asmtype.Byte{}
+		case *mconstant.Double:
+			return &asmtype.Double{}
 		default:
 			panic("unimplemented const")
 		}
@@ -173,23 +203,11 @@ func (a *AsmASTGen) AsmType(val tackygen.TackyVal) asmtype.AsmType {
 	}
 }
 
-func (a *AsmASTGen) passInRegisters(paramIdx int, param tackygen.TackyVal) []AsmInstruction {
-	passRegister := ""
-	for _, register := range a.Registers {
-		if register.String() == a.Registers[paramIdx].String() {
-			passRegister = register.String()
-			break
-		}
-	}
-
-	if passRegister == "" {
-		return []AsmInstruction{}
-	}
-
+func (a *AsmASTGen) passInRegisters(reg AsmRegister, param tackygen.TackyVal) []AsmInstruction {
 	pType := a.AsmType(param)
 	mov := AsmMov{
 		Type: pType,
-		Src:  Register{Reg: AsmRegister(passRegister)},
+		Src:  Register{Reg: reg},
 		Dst:  a.GenASTVal(param),
 	}
 	return []AsmInstruction{mov}
@@ -197,46 +215,55 @@ func (a *AsmASTGen) passInRegisters(paramIdx int, param tackygen.TackyVal) []Asm
 
 func (a *AsmASTGen) passParams(fn tackygen.TackyFn) (tackygen.TackyFn, []AsmInstruction) {
 	ir := []AsmInstruction{}
-	registerParams := []tackygen.TackyVal{}
-	stackParams := []tackygen.TackyVal{}
+	registerParams, stackParams := a.splitArgs(fn.Params)
 
-	for _, param := range fn.Params {
-		if len(registerParams) < 6 {
-			registerParams = append(registerParams, param)
-		} else {
-			stackParams = append(stackParams, param)
-		}
-	}
-
-	for i, param := range registerParams {
-		ir = append(ir, a.passInRegisters(i, param)...)
+	for i, param := range registerParams.vals {
+		ir = append(ir, a.passInRegisters(registerParams.regs[i], param)...)
 	}
 
-	for _, param := range stackParams {
-		ir = append(ir, a.passInStack(param)...)
+	for k, param := range stackParams {
+		ir = append(ir, a.passInStack(k, param)...)
 	}
 
 	return fn, ir
 }
 
-func (a *AsmASTGen) splitArgs(args []tackygen.TackyVal) ([]tackygen.TackyVal, []tackygen.TackyVal) {
-	registerArgs := []tackygen.TackyVal{}
+// registerArgs are the arguments that travel in registers, with the
+// register each one goes in.
+type registerArgs struct {
+	vals []tackygen.TackyVal
+	regs []AsmRegister
+}
+
+// splitArgs follows System V: integers take the next of rdi, rsi, rdx, rcx,
+// r8, r9, a бутархай the next of xmm0-xmm7, and whatever finds its class
+// used up goes on the stack.
+func (a *AsmASTGen) splitArgs(args []tackygen.TackyVal) (registerArgs, []tackygen.TackyVal) {
+	regArgs := registerArgs{}
 	stackArgs := []tackygen.TackyVal{}
+	ints, doubles := 0, 0
 
 	for _, arg := range args {
-		if len(registerArgs) < 6 {
-			registerArgs = append(registerArgs, arg)
-		} else {
+		_, isDouble := a.AsmType(arg).(*asmtype.Double)
+		switch {
+		case isDouble && doubles < len(a.DoubleRegisters):
+			regArgs.vals = append(regArgs.vals, arg)
+			regArgs.regs = append(regArgs.regs, a.DoubleRegisters[doubles])
+			doubles++
+		case !isDouble && ints < len(a.Registers):
+			regArgs.vals = append(regArgs.vals, arg)
+			regArgs.regs = append(regArgs.regs, a.Registers[ints])
+			ints++
+		default:
 			stackArgs = append(stackArgs, arg)
 		}
 	}
 
-	return registerArgs, stackArgs
+	return regArgs, stackArgs
 }
 
 func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
 	irs := []AsmInstruction{}
-	argRegisters := []AsmRegister{DI, SI, DX, CX, R8, R9}
 	stackPadding := 0
 
 	registerArgs, stackArgs := a.splitArgs(fn.Args)
@@ -245,14 +272,16 @@ func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
 		stackPadding = 8
 	}
 
-	for i, arg := range registerArgs {
-		r := argRegisters[i]
-		mov := AsmMov{
-			Type: a.AsmType(arg),
-			Src:  a.GenASTVal(arg),
-			Dst:  Register{Reg: r},
-		}
-		irs = append(irs, mov)
+	irs = append(irs, a.loadArgs(registerArgs)...)
+
+	// keeps rsp 16 byte aligned at the call once the arguments are pushed
+	if stackPadding != 0 {
+		irs = append(irs, AsmBinary{
+			Op:   Sub,
+			Type: &asmtype.QuadWord{},
+			Src:  Imm{int64(stackPadding)},
+			Dst:  Register{Reg: SP},
+		})
 	}
 
 	reversedArgs := make([]tackygen.TackyVal, len(stackArgs))
@@ -269,12 +298,7 @@ func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
 			}
 			irs = append(irs, push)
 		default:
-			mov := AsmMov{
-				Type: a.AsmType(arg),
-				Src:  asmArg,
-				Dst:  Register{Reg: AX},
-			}
-			irs = append(irs, mov)
+			irs = append(irs, a.movToRegister(arg, AX))
 			push := Push{
 				Op: Register{Reg: AX},
 			}
@@ -299,9 +323,13 @@ func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
 	}
 
 	asmDst := a.GenASTVal(fn.Dst)
+	result := AX
+	if _, isDouble := a.AsmType(fn.Dst).(*asmtype.Double); isDouble {
+		result = XMM0
+	}
 	mov := AsmMov{
 		Type: a.AsmType(fn.Dst),
-		Src:  Register{Reg: AX},
+		Src:  Register{Reg: result},
 		Dst:  asmDst,
 	}
 	irs = append(irs, mov)
@@ -312,16 +340,91 @@ func (a *AsmASTGen) convertFnCall(fn tackygen.FnCall) []AsmInstruction {
 func (a *AsmASTGen) GenASTFn(fn tackygen.TackyFn) AsmFnDef {
 	asmfn := AsmFnDef{}
 
+	tailCalls := map[int]bool{}
+	selfRecursive := false
+	if a.TailCalls {
+		for i := range fn.Instructions {
+			if call, ok := a.tailCall(fn.Instructions, i); ok {
+				tailCalls[i] = true
+				selfRecursive = selfRecursive || call.Name == fn.Name
+			}
+		}
+	}
+
+	// a self tail call jumps back above the moves out of the parameter
+	// registers, so it only has to load the registers like any other call
+	startLabel := fn.Name + ".tail"
+	if selfRecursive {
+		asmfn.Irs = append(asmfn.Irs, Label{Ident: startLabel})
+	}
+
 	fn, paramIrs := a.passParams(fn)
 	asmfn.Irs = append(asmfn.Irs, paramIrs...)
 
-	for _, instr := range fn.Instructions {
-		asmfn.Irs = append(asmfn.Irs, a.GenASTInstr(instr)...)
+	for i := 0; i < len(fn.Instructions); i++ {
+		instr := fn.Instructions[i]
+		if !tailCalls[i] {
+			asmfn.Irs = append(asmfn.Irs, a.GenASTInstr(instr)...)
+			continue
+		}
+		call := instr.(tackygen.FnCall)
+		regArgs, _ := a.splitArgs(call.Args)
+		asmfn.Irs = append(asmfn.Irs, a.loadArgs(regArgs)...)
+		if call.Name == fn.Name {
+			asmfn.Irs = append(asmfn.Irs, Jmp{Ident: startLabel})
+		} else {
+			asmfn.Irs = append(asmfn.Irs, TailCall{Ident: call.Name})
+		}
+		// the return of the call's result is taken care of by the callee
+		i++
 	}
 	asmfn.Ident = fn.Name
+	asmfn.Global = fn.Global
+	if a.DebugInfo {
+		asmfn.Debug = a.fnDebugInfo(fn)
+	}
 	return asmfn
 }
 
+// tailCall reports whether instrs[i] is a call whose result the next
+// instruction returns. Arguments passed on the stack would have to be
+// written over our own caller's frame, those calls stay calls.
+func (a *AsmASTGen) tailCall(instrs []tackygen.Instruction, i int) (tackygen.FnCall, bool) {
+	call, ok := instrs[i].(tackygen.FnCall)
+	if !ok || call.Dst == nil || i+1 >= len(instrs) {
+		return call, false
+	}
+	if _, stackArgs := a.splitArgs(call.Args); len(stackArgs) > 0 {
+		return call, false
+	}
+	ret, ok := instrs[i+1].(tackygen.Return)
+	if !ok {
+		return call, false
+	}
+	dst, isVar := call.Dst.(tackygen.Var)
+	val, isVarVal := ret.Value.(tackygen.Var)
+	return call, isVar && isVarVal && dst.Name == val.Name
+}
+
+// loadArgs moves register arguments into their registers.
+func (a *AsmASTGen) loadArgs(args registerArgs) []AsmInstruction {
+	irs := []AsmInstruction{}
+	for i, arg := range args.vals {
+		irs = append(irs, a.movToRegister(arg, args.regs[i]))
+	}
+	return irs
+}
+
+// movToRegister loads val into reg. A логик is zero extended, as C expects
+// of a bool in an argument or return register.
+func (a *AsmASTGen) movToRegister(val tackygen.TackyVal, reg AsmRegister) AsmInstruction {
+	valType := a.AsmType(val)
+	if _, isByte := valType.(*asmtype.Byte); isByte {
+		return AsmMovZb{Type: &asmtype.LongWord{}, Src: a.GenASTVal(val), Dst: Register{Reg: reg}}
+	}
+	return AsmMov{Type: valType, Src: a.GenASTVal(val), Dst: Register{Reg: reg}}
+}
+
 func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
 	switch ast := instr.(type) {
 	case tackygen.FnCall:
@@ -336,6 +439,8 @@ func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
 			Ident: ast.Ident,
 		}
 		return []AsmInstruction{lbl}
+	case tackygen.SourceLine:
+		return []AsmInstruction{Loc{Line: ast.Line}}
 	case tackygen.Copy:
 		Type := a.AsmType(ast.Src)
 		mov := AsmMov{
@@ -368,26 +473,35 @@ func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
 			Ident: ast.Ident,
 		}
 		return []AsmInstruction{cmp, jmpcc}
+	case tackygen.JumpTable:
+		// the index is never negative, so movl leaves all of %r11 right
+		return []AsmInstruction{a.movToRegister(ast.Index, R11), JmpTable{Targets: ast.Targets}}
 	case tackygen.Return:
-		Type := a.AsmType(ast.Value)
-		mov := AsmMov{
-			Type: Type,
-			Src:  a.GenASTVal(ast.Value),
-			Dst: Register{
-				Reg: AX,
-			},
+		if _, isDouble := a.AsmType(ast.Value).(*asmtype.Double); isDouble {
+			return []AsmInstruction{a.movToRegister(ast.Value, XMM0), Return{}}
 		}
-		ret := Return{}
-		return []AsmInstruction{mov, ret}
+		return []AsmInstruction{a.movToRegister(ast.Value, AX), Return{}}
 	case tackygen.SignExtend:
 		movsx := AsmMovSx{
 			Src: a.GenASTVal(ast.Src),
 			Dst: a.GenASTVal(ast.Dst),
 		}
 		return []AsmInstruction{movsx}
+	case tackygen.IntToDouble:
+		return []AsmInstruction{Cvtsi2sd{
+			Type: a.AsmType(ast.Src),
+			Src:  a.GenASTVal(ast.Src),
+			Dst:  a.GenASTVal(ast.Dst),
+		}}
+	case tackygen.DoubleToInt:
+		return []AsmInstruction{Cvttsd2si{
+			Type: a.AsmType(ast.Dst),
+			Src:  a.GenASTVal(ast.Src),
+			Dst:  a.GenASTVal(ast.Dst),
+		}}
 	case tackygen.Load:
 		// Move pointer to R10, load from memory to R11, then move to dst
-		dstType := a.AsmType(ast.Dst)
+		dstType := bitsType(a.AsmType(ast.Dst))
 		mov := AsmMov{
 			Type: &asmtype.QuadWord{},
 			Src:  a.GenASTVal(ast.Src),
@@ -412,13 +526,14 @@ func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
 			Dst:  Register{Reg: R10},
 		}
 		// Move value to R11 first, then store
+		srcType := bitsType(a.AsmType(ast.Src))
 		movVal := AsmMov{
-			Type: a.AsmType(ast.Src),
+			Type: srcType,
 			Src:  a.GenASTVal(ast.Src),
 			Dst:  Register{Reg: R11},
 		}
 		store := AsmStoreToMem{
-			Type: a.AsmType(ast.Src),
+			Type: srcType,
 			Src:  Register{Reg: R11},
 			Base: R10,
 		}
@@ -447,6 +562,14 @@ func (a *AsmASTGen) GenASTInstr(instr tackygen.Instruction) []AsmInstruction {
 		}
 
 		dst := a.GenASTVal(ast.Dst)
+		if _, isDouble := SrcT.(*asmtype.Double); isDouble {
+			// negating a double flips its sign bit
+			quad := &asmtype.QuadWord{}
+			return []AsmInstruction{
+				AsmMov{Type: quad, Src: a.GenASTVal(ast.Src), Dst: dst},
+				AsmBinary{Op: Xor, Type: quad, Src: Imm{Value: math.MinInt64}, Dst: dst},
+			}
+		}
 		mov := AsmMov{
 			Type: SrcT,
 			Src:  a.GenASTVal(ast.Src),
@@ -483,9 +606,81 @@ func (a *AsmASTGen) ConvOpToCond(op tackygen.TackyBinaryOp) CondCode {
 	}
 }
 
+// bitsType is the type a value is copied through memory and general
+// registers with, a бутархай goes as its 8 bytes.
+func bitsType(t asmtype.AsmType) asmtype.AsmType {
+	if _, isDouble := t.(*asmtype.Double); isDouble {
+		return &asmtype.QuadWord{}
+	}
+	return t
+}
+
+// doubleCondCodes are the flags comisd leaves for a comparison. It sets
+// them like an unsigned compare, and an unordered result, a NaN on either
+// side, looks like below and equal. < and <= swap their operands so a NaN
+// makes them false as it does > and >=. == and != also set the parity flag
+// on a NaN, genDoubleBinary jumps over the setCC then.
+var doubleCondCodes = map[tackygen.TackyBinaryOp]CondCode{
+	tackygen.GreaterThan:      A,
+	tackygen.GreaterThanEqual: AE,
+	tackygen.LessThan:         A,
+	tackygen.LessThanEqual:    AE,
+	tackygen.Equal:            E,
+	tackygen.NotEqual:         NE,
+}
+
+// genDoubleBinary is GenASTBinary for бутархай operands.
+func (a *AsmASTGen) genDoubleBinary(instr tackygen.Binary) []AsmInstruction {
+	double := &asmtype.Double{}
+	src1, src2 := a.GenASTVal(instr.Src1), a.GenASTVal(instr.Src2)
+	dst := a.GenASTVal(instr.Dst)
+	if cc, isCmp := doubleCondCodes[instr.Op]; isCmp {
+		if instr.Op == tackygen.LessThan || instr.Op == tackygen.LessThanEqual {
+			src1, src2 = src2, src1
+		}
+		if instr.Op == tackygen.Equal || instr.Op == tackygen.NotEqual {
+			unordered := Imm{Value: 0}
+			if instr.Op == tackygen.NotEqual {
+				unordered = Imm{Value: 1}
+			}
+			label := fmt.Sprintf("unordered.%d", a.unordered)
+			a.unordered++
+			return []AsmInstruction{
+				AsmMov{Type: a.AsmType(instr.Dst), Src: unordered, Dst: dst},
+				Cmp{Type: double, Src: src2, Dst: src1},
+				JmpCC{CC: P, Ident: label},
+				SetCC{CC: cc, Op: dst},
+				Label{Ident: label},
+			}
+		}
+		return []AsmInstruction{
+			Cmp{Type: double, Src: src2, Dst: src1},
+			AsmMov{Type: a.AsmType(instr.Dst), Src: Imm{Value: 0}, Dst: dst},
+			SetCC{CC: cc, Op: dst},
+		}
+	}
+	ops := map[tackygen.TackyBinaryOp]AsmAstBinaryOp{
+		tackygen.Add: AddSD,
+		tackygen.Sub: SubSD,
+		tackygen.Mul: MulSD,
+		tackygen.Div: DivSD,
+	}
+	op, ok := ops[instr.Op]
+	if !ok {
+		panic(fmt.Sprintf("unimplemented double op %s", instr.Op))
+	}
+	return []AsmInstruction{
+		AsmMov{Type: double, Src: src1, Dst: dst},
+		AsmBinary{Op: op, Type: double, Src: src2, Dst: dst},
+	}
+}
+
 func (a *AsmASTGen) GenASTBinary(instr tackygen.Binary) []AsmInstruction {
 	Src1T := a.AsmType(instr.Src1)
 	DstT := a.AsmType(instr.Dst)
+	if _, isDouble := Src1T.(*asmtype.Double); isDouble {
+		return a.genDoubleBinary(instr)
+	}
 	//is relational op
 	if instr.Op == tackygen.GreaterThan || instr.Op == tackygen.GreaterThanEqual ||
 		instr.Op == tackygen.LessThan || instr.Op == tackygen.LessThanEqual ||
@@ -608,16 +803,20 @@ func (a *AsmASTGen) GenASTVal(val tackygen.TackyVal) AsmOperand {
 
 func (a *AsmASTGen) ConvType(val mtypes.Type) asmtype.AsmType {
 	switch val.(type) {
-	case *mtypes.Int32Type:
+	case *mtypes.Int32Type, *mtypes.EnumType:
 		return &asmtype.LongWord{}
 	case *mtypes.Int64Type:
 		return &asmtype.QuadWord{}
+	case *mtypes.BoolType:
+		return &asmtype.Byte{}
+	case *mtypes.DoubleType:
+		return &asmtype.Double{}
 	case *mtypes.VoidType:
 		return &asmtype.LongWord{}
 	case *mtypes.StringType:
 		return &asmtype.StringType{}
-	case *mtypes.ArrayType:
-		return &asmtype.QuadWord{} // arrays are pointers
+	case *mtypes.ArrayType, *mtypes.StructType:
+		return &asmtype.QuadWord{} // arrays and structs are pointers
 	case *mtypes.FnType:
 		panic("fn type should not be here")
 	default:
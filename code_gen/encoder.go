@@ -0,0 +1,501 @@
+package codegen
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+)
+
+// registerNumbers are the hardware numbers that go into ModRM and REX.
+var registerNumbers = map[AsmRegister]byte{
+	AX: 0, AL: 0, CX: 1, DX: 2, BX: 3, SP: 4, SI: 6, DI: 7,
+	R8: 8, R9: 9, R10: 10, R11: 11, R12: 12, R13: 13, R14: 14, R15: 15,
+	XMM0: 0, XMM1: 1, XMM2: 2, XMM3: 3, XMM4: 4, XMM5: 5, XMM6: 6, XMM7: 7,
+	XMM14: 14, XMM15: 15,
+}
+
+const (
+	regRBP = 5
+	regR10 = 10
+	regR11 = 11
+)
+
+var condCodes = map[CondCode]byte{
+	E: 0x4, NE: 0x5, L: 0xc, GE: 0xd, LE: 0xe, G: 0xf,
+	B: 0x2, AE: 0x3, BE: 0x6, A: 0x7, P: 0xa,
+}
+
+type fixupKind int
+
+const (
+	// a .L label in .text, always resolved here
+	fixLabel fixupKind = iota
+	// a function, resolved here unless it is an extern
+	fixFunc
+	// a global variable in .data
+	fixGlobal
+	// a string literal in .rodata
+	fixString
+)
+
+// fixup is a rel32 field at Offset in .text, relative to the end of the
+// instruction, which is Tail bytes after the field.
+type fixup struct {
+	Offset int
+	Tail   int
+	Kind   fixupKind
+	Symbol string
+}
+
+// memOperand is the r/m side of an instruction, a register or one of the
+// three addressing forms the backend produces: n(%rbp), (%r10) and
+// label(%rip).
+type memOperand struct {
+	reg    int
+	base   int
+	disp   int32
+	kind   fixupKind
+	symbol string
+}
+
+func regOperand(reg AsmRegister) memOperand {
+	return memOperand{reg: int(regNumber(reg))}
+}
+
+func regNumber(reg AsmRegister) byte {
+	n, ok := registerNumbers[reg]
+	if !ok {
+		panic(fmt.Sprintf("unimplemented register %s", reg))
+	}
+	return n
+}
+
+func (o *ObjGen) rmOperand(op AsmOperand) memOperand {
+	switch ast := op.(type) {
+	case Register:
+		return regOperand(ast.Reg)
+	case Stack:
+		return memOperand{reg: -1, base: regRBP, disp: int32(ast.Value)}
+	case RipRelative:
+		return memOperand{reg: -1, base: -1, kind: fixGlobal, symbol: ast.Label}
+	case StringLiteral:
+		o.addString(ast.Value)
+		return memOperand{reg: -1, base: -1, kind: fixString, symbol: ast.Value}
+	default:
+		panic(fmt.Sprintf("unimplemented operand %T", op))
+	}
+}
+
+func isQuad(t asmtype.AsmType) bool {
+	switch t.(type) {
+	case *asmtype.QuadWord, *asmtype.StringType:
+		return true
+	case *asmtype.LongWord, nil:
+		return false
+	default:
+		panic(fmt.Sprintf("unimplemented asm type: %v", t))
+	}
+}
+
+func isByte(t asmtype.AsmType) bool {
+	_, ok := t.(*asmtype.Byte)
+	return ok
+}
+
+// lowByteReg reports whether rm is spl, bpl, sil or dil, which only exist
+// with a REX prefix. ModRM extensions in the reg field are not registers,
+// so the immediate forms ask this instead of setting byteOp.
+func lowByteReg(rm memOperand) bool {
+	return rm.reg >= 4 && rm.reg <= 7
+}
+
+func fitsInt8(v int64) bool {
+	return v >= -128 && v <= 127
+}
+
+func imm32(v int64) []byte {
+	return binary.LittleEndian.AppendUint32(nil, uint32(int32(v)))
+}
+
+// emitRM writes [REX] opcode ModRM [disp] [imm]. reg is the ModRM reg field,
+// a register or an opcode extension. byteOp asks for the REX prefix that
+// turns registers 4-7 into spl, bpl, sil and dil, in either field.
+func (o *ObjGen) emitRM(quad bool, opcode []byte, reg byte, rm memOperand, byteOp bool, imm []byte) {
+	rex := byte(0x40)
+	if quad {
+		rex |= 0x08
+	}
+	if reg >= 8 {
+		rex |= 0x04
+	}
+	if rm.reg >= 8 || rm.base >= 8 {
+		rex |= 0x01
+	}
+	if rex != 0x40 || (byteOp && (rm.reg >= 4 && rm.reg <= 7 || reg >= 4 && reg <= 7)) {
+		o.text = append(o.text, rex)
+	}
+	o.text = append(o.text, opcode...)
+
+	switch {
+	case rm.reg >= 0:
+		o.text = append(o.text, 0xc0|(reg&7)<<3|byte(rm.reg)&7)
+	case rm.base < 0:
+		// rip-relative, the linker or GenObj fills in the displacement
+		o.text = append(o.text, (reg&7)<<3|0x05)
+		o.fixups = append(o.fixups, fixup{Offset: len(o.text), Tail: len(imm), Kind: rm.kind, Symbol: rm.symbol})
+		o.text = append(o.text, 0, 0, 0, 0)
+	case rm.disp == 0 && rm.base&7 != regRBP:
+		o.text = append(o.text, (reg&7)<<3|byte(rm.base)&7)
+	case fitsInt8(int64(rm.disp)):
+		o.text = append(o.text, 0x40|(reg&7)<<3|byte(rm.base)&7, byte(rm.disp))
+	default:
+		o.text = append(o.text, 0x80|(reg&7)<<3|byte(rm.base)&7)
+		o.text = binary.LittleEndian.AppendUint32(o.text, uint32(rm.disp))
+	}
+	o.text = append(o.text, imm...)
+}
+
+// emitSSE writes an SSE instruction, whose mandatory prefix comes before
+// the REX prefix emitRM writes.
+func (o *ObjGen) emitSSE(prefix byte, quad bool, opcode []byte, reg byte, rm memOperand) {
+	o.text = append(o.text, prefix)
+	o.emitRM(quad, opcode, reg, rm, false, nil)
+}
+
+var sseOps = map[AsmAstBinaryOp]byte{
+	AddSD: 0x58, MulSD: 0x59, SubSD: 0x5c, DivSD: 0x5e,
+}
+
+// emitDoubleMov is movsd between an XMM register and memory or another XMM
+// register, or movq between an XMM register and a general register.
+func (o *ObjGen) emitDoubleMov(src AsmOperand, dst AsmOperand) {
+	switch {
+	case isGeneralRegister(src):
+		o.emitSSE(0x66, true, []byte{0x0f, 0x6e}, regNumber(dst.(Register).Reg), o.rmOperand(src))
+	case isGeneralRegister(dst):
+		o.emitSSE(0x66, true, []byte{0x0f, 0x7e}, regNumber(src.(Register).Reg), o.rmOperand(dst))
+	case isXMMOperand(dst):
+		o.emitSSE(0xf2, false, []byte{0x0f, 0x10}, regNumber(dst.(Register).Reg), o.rmOperand(src))
+	default:
+		o.emitSSE(0xf2, false, []byte{0x0f, 0x11}, regNumber(src.(Register).Reg), o.rmOperand(dst))
+	}
+}
+
+// emitRel32 writes opcode and a rel32 to symbol.
+func (o *ObjGen) emitRel32(opcode []byte, kind fixupKind, symbol string) {
+	o.text = append(o.text, opcode...)
+	o.fixups = append(o.fixups, fixup{Offset: len(o.text), Kind: kind, Symbol: symbol})
+	o.text = append(o.text, 0, 0, 0, 0)
+}
+
+// jumpTableLabel names the table of the nth JmpTable, no TACKY label goes
+// without a dot.
+func jumpTableLabel(n int) string {
+	return fmt.Sprintf("table%d", n)
+}
+
+// emitJmpTable writes
+//
+//	leaq table(%rip), %r10
+//	movslq (%r10,%r11,4), %r11
+//	addq %r10, %r11
+//	jmp *%r11
+//
+// followed by the table. An entry is a fixup whose end is the table's
+// start, so it holds the offset of its target from there.
+func (o *ObjGen) emitJmpTable(targets []string) {
+	table := jumpTableLabel(o.tableCount)
+	o.tableCount++
+	o.emitRM(true, []byte{0x8d}, regNumber(R10), memOperand{reg: -1, base: -1, kind: fixLabel, symbol: table}, false, nil)
+	o.text = append(o.text, 0x4f, 0x63, 0x1c, 0x9a)
+	o.text = append(o.text, 0x4d, 0x01, 0xd3)
+	o.text = append(o.text, 0x41, 0xff, 0xe3)
+	o.labels[table] = len(o.text)
+	for i, target := range targets {
+		o.fixups = append(o.fixups, fixup{Offset: len(o.text), Tail: -4 * (i + 1), Kind: fixLabel, Symbol: target})
+		o.text = append(o.text, 0, 0, 0, 0)
+	}
+}
+
+// emitShortReg writes the opcodes that carry the register in their low three
+// bits, push, pop and movabs.
+func (o *ObjGen) emitShortReg(quad bool, opcode byte, reg byte) {
+	rex := byte(0x40)
+	if quad {
+		rex |= 0x08
+	}
+	if reg >= 8 {
+		rex |= 0x01
+	}
+	if rex != 0x40 {
+		o.text = append(o.text, rex)
+	}
+	o.text = append(o.text, opcode+reg&7)
+}
+
+// aluOps are the opcodes of the two operand arithmetic instructions: r/m op=
+// reg, reg op= r/m and the ModRM extension of the immediate forms.
+type aluOp struct {
+	rmReg, regRm, ext byte
+}
+
+var aluOps = map[AsmAstBinaryOp]aluOp{
+	Add: {0x01, 0x03, 0},
+	Sub: {0x29, 0x2b, 5},
+	Xor: {0x31, 0x33, 6},
+}
+
+var cmpOp = aluOp{0x39, 0x3b, 7}
+
+func (o *ObjGen) emitALU(op aluOp, quad bool, src AsmOperand, dst AsmOperand) {
+	dstRM := o.rmOperand(dst)
+	switch ast := src.(type) {
+	case Imm:
+		if fitsInt8(ast.Value) {
+			o.emitRM(quad, []byte{0x83}, op.ext, dstRM, false, []byte{byte(ast.Value)})
+		} else {
+			o.emitRM(quad, []byte{0x81}, op.ext, dstRM, false, imm32(ast.Value))
+		}
+	case Register:
+		o.emitRM(quad, []byte{op.rmReg}, regNumber(ast.Reg), dstRM, false, nil)
+	default:
+		reg, ok := dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented memory to memory operands %s, %s", src.Op(), dst.Op()))
+		}
+		o.emitRM(quad, []byte{op.regRm}, regNumber(reg.Reg), o.rmOperand(src), false, nil)
+	}
+}
+
+// emitMov is mov src, dst for everything but string addresses.
+func (o *ObjGen) emitMov(quad bool, src AsmOperand, dst AsmOperand) {
+	switch ast := src.(type) {
+	case Imm:
+		if reg, isReg := dst.(Register); isReg && quad && isLarge(ast.Value) {
+			o.emitShortReg(true, 0xb8, regNumber(reg.Reg))
+			o.text = binary.LittleEndian.AppendUint64(o.text, uint64(ast.Value))
+			return
+		}
+		o.emitRM(quad, []byte{0xc7}, 0, o.rmOperand(dst), false, imm32(ast.Value))
+	case Register:
+		o.emitRM(quad, []byte{0x89}, regNumber(ast.Reg), o.rmOperand(dst), false, nil)
+	default:
+		reg, ok := dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented memory to memory operands %s, %s", src.Op(), dst.Op()))
+		}
+		o.emitRM(quad, []byte{0x8b}, regNumber(reg.Reg), o.rmOperand(src), false, nil)
+	}
+}
+
+// emitByteMov is movb src, dst, for a логик.
+func (o *ObjGen) emitByteMov(src AsmOperand, dst AsmOperand) {
+	switch ast := src.(type) {
+	case Imm:
+		dstRM := o.rmOperand(dst)
+		o.emitRM(false, []byte{0xc6}, 0, dstRM, lowByteReg(dstRM), []byte{byte(ast.Value)})
+	case Register:
+		o.emitRM(false, []byte{0x88}, regNumber(ast.Reg), o.rmOperand(dst), true, nil)
+	default:
+		reg, ok := dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented memory to memory operands %s, %s", src.Op(), dst.Op()))
+		}
+		o.emitRM(false, []byte{0x8a}, regNumber(reg.Reg), o.rmOperand(src), true, nil)
+	}
+}
+
+// emitByteCmp is cmpb src, dst.
+func (o *ObjGen) emitByteCmp(src AsmOperand, dst AsmOperand) {
+	switch ast := src.(type) {
+	case Imm:
+		dstRM := o.rmOperand(dst)
+		o.emitRM(false, []byte{0x80}, cmpOp.ext, dstRM, lowByteReg(dstRM), []byte{byte(ast.Value)})
+	case Register:
+		o.emitRM(false, []byte{0x38}, regNumber(ast.Reg), o.rmOperand(dst), true, nil)
+	default:
+		reg, ok := dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented memory to memory operands %s, %s", src.Op(), dst.Op()))
+		}
+		o.emitRM(false, []byte{0x3a}, regNumber(reg.Reg), o.rmOperand(src), true, nil)
+	}
+}
+
+// emitLeaString is leaq label(%rip), reg for a string literal.
+func (o *ObjGen) emitLeaString(value string, reg byte) {
+	o.addString(value)
+	o.emitRM(true, []byte{0x8d}, reg, memOperand{reg: -1, base: -1, kind: fixString, symbol: value}, false, nil)
+}
+
+// emitLeave is movq %rbp, %rsp; popq %rbp.
+func (o *ObjGen) emitLeave() {
+	o.text = append(o.text, 0x48, 0x89, 0xec, 0x5d)
+}
+
+func (o *ObjGen) genFn(fn AsmFnDef) {
+	o.funcs[fn.Ident] = len(o.text)
+	// pushq %rbp; movq %rsp, %rbp
+	o.text = append(o.text, 0x55, 0x48, 0x89, 0xe5)
+	for _, instr := range fn.Irs {
+		o.genInstr(instr)
+	}
+	o.funcSizes[fn.Ident] = len(o.text) - o.funcs[fn.Ident]
+}
+
+// genInstr encodes what GenInstr in x86x64.go writes as text.
+func (o *ObjGen) genInstr(instr AsmInstruction) {
+	switch ast := instr.(type) {
+	case StringLiteral:
+		o.emitLeaString(ast.Value, 0)
+	case Push:
+		switch op := ast.Op.(type) {
+		case Register:
+			o.emitShortReg(false, 0x50, regNumber(op.Reg))
+		case Imm:
+			if fitsInt8(op.Value) {
+				o.text = append(o.text, 0x6a, byte(op.Value))
+			} else {
+				o.text = append(o.text, 0x68)
+				o.text = append(o.text, imm32(op.Value)...)
+			}
+		default:
+			o.emitRM(false, []byte{0xff}, 6, o.rmOperand(op), false, nil)
+		}
+	case Pop:
+		o.emitShortReg(false, 0x58, regNumber(ast.Reg))
+	case Call:
+		o.emitRel32([]byte{0xe8}, fixFunc, ast.Ident)
+	case TailCall:
+		o.emitLeave()
+		o.emitRel32([]byte{0xe9}, fixFunc, ast.Ident)
+	case Label:
+		o.labels[ast.Ident] = len(o.text)
+	case SetCC:
+		o.emitRM(false, []byte{0x0f, 0x90 | condCodes[ast.CC]}, 0, o.rmOperand(ast.Op), true, nil)
+	case JmpCC:
+		o.emitRel32([]byte{0x0f, 0x80 | condCodes[ast.CC]}, fixLabel, ast.Ident)
+	case Jmp:
+		o.emitRel32([]byte{0xe9}, fixLabel, ast.Ident)
+	case JmpTable:
+		o.emitJmpTable(ast.Targets)
+	case Cmp:
+		if isDoubleType(ast.Type) {
+			// comisd
+			o.emitSSE(0x66, false, []byte{0x0f, 0x2f}, regNumber(ast.Dst.(Register).Reg), o.rmOperand(ast.Src))
+			return
+		}
+		if isByte(ast.Type) {
+			o.emitByteCmp(ast.Src, ast.Dst)
+			return
+		}
+		o.emitALU(cmpOp, isQuad(ast.Type), ast.Src, ast.Dst)
+	case AsmBinary:
+		if isDoubleType(ast.Type) {
+			o.emitSSE(0xf2, false, []byte{0x0f, sseOps[ast.Op]}, regNumber(ast.Dst.(Register).Reg), o.rmOperand(ast.Src))
+			return
+		}
+		quad := isQuad(ast.Type)
+		if ast.Op != Mult {
+			o.emitALU(aluOps[ast.Op], quad, ast.Src, ast.Dst)
+			return
+		}
+		dst, ok := ast.Dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented imul destination %s", ast.Dst.Op()))
+		}
+		reg := regNumber(dst.Reg)
+		if imm, isImm := ast.Src.(Imm); isImm {
+			if fitsInt8(imm.Value) {
+				o.emitRM(quad, []byte{0x6b}, reg, regOperand(dst.Reg), false, []byte{byte(imm.Value)})
+			} else {
+				o.emitRM(quad, []byte{0x69}, reg, regOperand(dst.Reg), false, imm32(imm.Value))
+			}
+			return
+		}
+		o.emitRM(quad, []byte{0x0f, 0xaf}, reg, o.rmOperand(ast.Src), false, nil)
+	case Cdq:
+		if isQuad(ast.Type) {
+			o.text = append(o.text, 0x48)
+		}
+		o.text = append(o.text, 0x99)
+	case Idiv:
+		o.emitRM(isQuad(ast.Type), []byte{0xf7}, 7, o.rmOperand(ast.Src), false, nil)
+	case AsmMov:
+		if isByte(ast.Type) {
+			o.emitByteMov(ast.Src, ast.Dst)
+			return
+		}
+		if isDoubleType(ast.Type) {
+			o.emitDoubleMov(ast.Src, ast.Dst)
+			return
+		}
+		quad := isQuad(ast.Type)
+		if strLit, isStrLit := ast.Src.(StringLiteral); isStrLit {
+			if reg, isReg := ast.Dst.(Register); isReg {
+				o.emitLeaString(strLit.Value, regNumber(reg.Reg))
+			} else {
+				o.emitLeaString(strLit.Value, regR11)
+				o.emitMov(quad, Register{Reg: R11}, ast.Dst)
+			}
+			return
+		}
+		o.emitMov(quad, ast.Src, ast.Dst)
+	case Cvtsi2sd:
+		o.emitSSE(0xf2, isQuad(ast.Type), []byte{0x0f, 0x2a}, regNumber(ast.Dst.(Register).Reg), o.rmOperand(ast.Src))
+	case Cvttsd2si:
+		o.emitSSE(0xf2, isQuad(ast.Type), []byte{0x0f, 0x2c}, regNumber(ast.Dst.(Register).Reg), o.rmOperand(ast.Src))
+	case AsmMovSx:
+		dst, ok := ast.Dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented movslq destination %s", ast.Dst.Op()))
+		}
+		o.emitRM(true, []byte{0x63}, regNumber(dst.Reg), o.rmOperand(ast.Src), false, nil)
+	case AsmMovZb:
+		dst, ok := ast.Dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented movzb destination %s", ast.Dst.Op()))
+		}
+		srcRM := o.rmOperand(ast.Src)
+		o.emitRM(isQuad(ast.Type), []byte{0x0f, 0xb6}, regNumber(dst.Reg), srcRM, lowByteReg(srcRM), nil)
+	case AsmLoadFromMem:
+		dst, ok := ast.Dst.(Register)
+		if !ok {
+			panic(fmt.Sprintf("unimplemented load destination %s", ast.Dst.Op()))
+		}
+		if _, isByte := ast.Type.(*asmtype.Byte); isByte {
+			// movzbl (%r10), dst
+			o.emitRM(false, []byte{0x0f, 0xb6}, regNumber(dst.Reg), memOperand{reg: -1, base: regR10}, false, nil)
+			return
+		}
+		o.emitRM(isQuad(ast.Type), []byte{0x8b}, regNumber(dst.Reg), memOperand{reg: -1, base: regR10}, false, nil)
+	case AsmStoreToMem:
+		r10 := memOperand{reg: -1, base: regR10}
+		switch src := ast.Src.(type) {
+		case Register:
+			if _, isByte := ast.Type.(*asmtype.Byte); isByte {
+				o.emitRM(false, []byte{0x88}, regNumber(src.Reg), r10, true, nil)
+				return
+			}
+			o.emitRM(isQuad(ast.Type), []byte{0x89}, regNumber(src.Reg), r10, false, nil)
+		case Imm:
+			o.emitRM(isQuad(ast.Type), []byte{0xc7}, 0, r10, false, imm32(src.Value))
+		default:
+			panic(fmt.Sprintf("unimplemented store source %s", ast.Src.Op()))
+		}
+	case Syscall:
+		o.text = append(o.text, 0x0f, 0x05)
+	case Return:
+		o.emitLeave()
+		o.text = append(o.text, 0xc3)
+	case Unary:
+		ext := byte(2)
+		if ast.Op == Neg {
+			ext = 3
+		}
+		o.emitRM(isQuad(ast.Type), []byte{0xf7}, ext, o.rmOperand(ast.Dst), false, nil)
+	case AllocateStack:
+		o.emitRM(true, []byte{0x81}, 5, regOperand(SP), false, imm32(int64(ast.Value)))
+	}
+}
@@ -30,16 +30,110 @@ func isMemoryOperand(op AsmOperand) bool {
 	return false
 }
 
+func isXMMOperand(op AsmOperand) bool {
+	reg, ok := op.(Register)
+	return ok && isXMM(reg.Reg)
+}
+
+func isDoubleType(t asmtype.AsmType) bool {
+	_, ok := t.(*asmtype.Double)
+	return ok
+}
+
+// toXMM loads op into the scratch XMM register reg unless it is in an XMM
+// register already. A constant goes through r10 as its bits.
+func toXMM(op AsmOperand, reg AsmRegister) ([]AsmInstruction, AsmOperand) {
+	switch op.(type) {
+	case Register:
+		if isXMMOperand(op) {
+			return nil, op
+		}
+	case Imm:
+		return []AsmInstruction{
+			AsmMov{Type: &asmtype.QuadWord{}, Src: op, Dst: Register{Reg: R10}},
+			AsmMov{Type: &asmtype.Double{}, Src: Register{Reg: R10}, Dst: Register{Reg: reg}},
+		}, Register{Reg: reg}
+	}
+	return []AsmInstruction{AsmMov{Type: &asmtype.Double{}, Src: op, Dst: Register{Reg: reg}}}, Register{Reg: reg}
+}
+
+// fixUpDouble is FixUpInInstruction for the SSE instructions. Their
+// destination has to be an XMM register, xmm15 stands in for memory, and
+// a constant source goes through xmm14. A move with no XMM register on
+// either side copies the bits through the general registers.
+func (f *FixUpPassGen) fixUpDouble(instr AsmInstruction) []AsmInstruction {
+	switch ast := instr.(type) {
+	case AsmMov:
+		if !isXMMOperand(ast.Src) && !isXMMOperand(ast.Dst) {
+			return f.FixUpInInstruction(AsmMov{Type: &asmtype.QuadWord{}, Src: ast.Src, Dst: ast.Dst})
+		}
+		if _, isImm := ast.Src.(Imm); isImm {
+			irs, _ := toXMM(ast.Src, ast.Dst.(Register).Reg)
+			return irs
+		}
+		return []AsmInstruction{ast}
+	case AsmBinary:
+		irs, src := []AsmInstruction{}, ast.Src
+		if _, isImm := ast.Src.(Imm); isImm {
+			irs, src = toXMM(ast.Src, XMM14)
+		}
+		if isXMMOperand(ast.Dst) {
+			return append(irs, AsmBinary{Op: ast.Op, Type: ast.Type, Src: src, Dst: ast.Dst})
+		}
+		dstIrs, dst := toXMM(ast.Dst, XMM15)
+		irs = append(irs, dstIrs...)
+		irs = append(irs, AsmBinary{Op: ast.Op, Type: ast.Type, Src: src, Dst: dst})
+		return append(irs, AsmMov{Type: ast.Type, Src: dst, Dst: ast.Dst})
+	case Cmp:
+		irs, dst := toXMM(ast.Dst, XMM15)
+		src := ast.Src
+		if _, isImm := ast.Src.(Imm); isImm {
+			srcIrs, xmm := toXMM(ast.Src, XMM14)
+			irs, src = append(irs, srcIrs...), xmm
+		}
+		return append(irs, Cmp{Type: ast.Type, Src: src, Dst: dst})
+	case Cvtsi2sd:
+		irs := []AsmInstruction{}
+		src := ast.Src
+		if _, isImm := ast.Src.(Imm); isImm {
+			irs = append(irs, AsmMov{Type: ast.Type, Src: src, Dst: Register{Reg: R10}})
+			src = Register{Reg: R10}
+		}
+		if isXMMOperand(ast.Dst) {
+			return append(irs, Cvtsi2sd{Type: ast.Type, Src: src, Dst: ast.Dst})
+		}
+		irs = append(irs, Cvtsi2sd{Type: ast.Type, Src: src, Dst: Register{Reg: XMM15}})
+		return append(irs, AsmMov{Type: &asmtype.Double{}, Src: Register{Reg: XMM15}, Dst: ast.Dst})
+	case Cvttsd2si:
+		irs := []AsmInstruction{}
+		src := ast.Src
+		if _, isImm := ast.Src.(Imm); isImm {
+			irs, src = toXMM(ast.Src, XMM14)
+		}
+		if _, isReg := ast.Dst.(Register); isReg {
+			return append(irs, Cvttsd2si{Type: ast.Type, Src: src, Dst: ast.Dst})
+		}
+		irs = append(irs, Cvttsd2si{Type: ast.Type, Src: src, Dst: Register{Reg: R11}})
+		return append(irs, AsmMov{Type: ast.Type, Src: Register{Reg: R11}, Dst: ast.Dst})
+	}
+	return []AsmInstruction{instr}
+}
+
 func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction {
 	switch ast := instr.(type) {
 	case StringLiteral:
 		// StringLiteral is already properly handled
 		return []AsmInstruction{ast}
+	case Cvtsi2sd, Cvttsd2si:
+		return f.fixUpDouble(instr)
 	case AsmMov:
-		// Handle quadword immediate to register
+		if isDoubleType(ast.Type) {
+			return f.fixUpDouble(ast)
+		}
+		// Handle quadword immediate to memory, a register takes movabs
 		if _, isQuadWord := ast.Type.(*asmtype.QuadWord); isQuadWord {
 			if imm, isImm := ast.Src.(Imm); isImm {
-				if isLarge(imm.Value) {
+				if _, isReg := ast.Dst.(Register); isLarge(imm.Value) && !isReg {
 					return []AsmInstruction{
 						AsmMov{
 							Type: &asmtype.QuadWord{},
@@ -202,6 +296,28 @@ func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction
 		}
 		return []AsmInstruction{ast}
 
+	case AsmMovZb:
+		// movzx takes no immediate, and a constant is already extended
+		if imm, isImm := ast.Src.(Imm); isImm {
+			return []AsmInstruction{AsmMov{Type: ast.Type, Src: imm, Dst: ast.Dst}}
+		}
+		// and its destination has to be a register
+		if _, isReg := ast.Dst.(Register); !isReg {
+			return []AsmInstruction{
+				AsmMovZb{
+					Type: ast.Type,
+					Src:  ast.Src,
+					Dst:  Register{Reg: R11},
+				},
+				AsmMov{
+					Type: ast.Type,
+					Src:  Register{Reg: R11},
+					Dst:  ast.Dst,
+				},
+			}
+		}
+		return []AsmInstruction{ast}
+
 	case Idiv:
 		// Handle immediate source
 		if imm, isImm := ast.Src.(Imm); isImm {
@@ -220,8 +336,11 @@ func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction
 		return []AsmInstruction{ast}
 
 	case AsmBinary:
-		// Handle large immediate source for Add/Sub
-		if ast.Op == Add || ast.Op == Sub {
+		if isDoubleType(ast.Type) {
+			return f.fixUpDouble(ast)
+		}
+		// Handle large immediate source for Add/Sub/Xor
+		if ast.Op == Add || ast.Op == Sub || ast.Op == Xor {
 			_, isQuadWord := ast.Type.(*asmtype.QuadWord)
 			if isQuadWord {
 				if imm, isImm := ast.Src.(Imm); isImm && isLarge(imm.Value) {
@@ -287,6 +406,9 @@ func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction
 		return []AsmInstruction{ast}
 
 	case Cmp:
+		if isDoubleType(ast.Type) {
+			return f.fixUpDouble(ast)
+		}
 		// Handle memory-to-memory operands (Stack or RipRelative)
 		if isMemoryOperand(ast.Src) && isMemoryOperand(ast.Dst) {
 			return []AsmInstruction{
@@ -382,7 +504,9 @@ func (f *FixUpPassGen) FixUpInInstruction(instr AsmInstruction) []AsmInstruction
 
 func (f *FixUpPassGen) FixUpInFn(fn AsmFnDef) AsmFnDef {
 	stackFrameSize := f.symbolTable.Get(fn.Ident).StackFrameSize
-	stackBytes := roundingutil.RoundAwayFromZero(16, stackFrameSize)
+	// callee-saved pushes sit below the frame, keep rsp 16-byte aligned with them
+	savedBytes := 8 * len(fn.CalleeSaved)
+	stackBytes := roundingutil.RoundAwayFromZero(16, stackFrameSize+savedBytes) - savedBytes
 	stkByteOp := Imm{Value: int64(stackBytes)}
 	allocStack := AsmBinary{
 		Op:   Sub,
@@ -393,8 +517,17 @@ func (f *FixUpPassGen) FixUpInFn(fn AsmFnDef) AsmFnDef {
 
 	fixedInstructions := []AsmInstruction{}
 	fixedInstructions = append(fixedInstructions, allocStack)
+	for _, reg := range fn.CalleeSaved {
+		fixedInstructions = append(fixedInstructions, Push{Op: Register{Reg: reg}})
+	}
 
 	for _, instr := range fn.Irs {
+		switch instr.(type) {
+		case Return, TailCall:
+			for i := len(fn.CalleeSaved) - 1; i >= 0; i-- {
+				fixedInstructions = append(fixedInstructions, Pop{Reg: fn.CalleeSaved[i]})
+			}
+		}
 		fixedInstructions = append(fixedInstructions, f.FixUpInInstruction(instr)...)
 	}
 
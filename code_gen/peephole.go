@@ -0,0 +1,221 @@
+package codegen
+
+import (
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+// PeepholePass cleans up the instruction sequences the earlier passes leave
+// behind once everything has its final register or stack slot: copies that
+// undo each other, jumps to the next instruction and comparisons whose 0/1
+// result only feeds a conditional jump.
+type PeepholePass struct {
+	regAlloc RegAllocPass
+}
+
+func NewPeepholePass(asmSymbols *asmsymbol.SymbolTable, symbolTable *symbols.SymbolTable) PeepholePass {
+	return PeepholePass{regAlloc: NewRegAllocPass(asmSymbols, symbolTable)}
+}
+
+func (p *PeepholePass) OptimizeProgram(program AsmProgram) AsmProgram {
+	for i, fn := range program.AsmFnDef {
+		program.AsmFnDef[i] = p.OptimizeFn(fn)
+	}
+	return program
+}
+
+func (p *PeepholePass) OptimizeFn(fn AsmFnDef) AsmFnDef {
+	irs := fn.Irs
+	for changed := true; changed; {
+		changed = false
+		var c bool
+		irs, c = p.removeRedundantMoves(irs)
+		changed = changed || c
+		irs, c = p.removeJumpsToNext(irs)
+		changed = changed || c
+		irs, c = p.fuseCompareJumps(irs)
+		changed = changed || c
+	}
+	fn.Irs = p.zeroWithXor(irs)
+	return fn
+}
+
+func isScratch(op AsmOperand) bool {
+	reg, ok := op.(Register)
+	return ok && (reg.Reg == R10 || reg.Reg == R11)
+}
+
+// removeRedundantMoves drops moves of an operand onto itself and the second
+// half of mov a, b; mov b, a. When b is a scratch register the pair is a
+// fixed up copy of a onto itself and the first half goes too, scratch values
+// never outlive the instruction they were fixed up for.
+func (p *PeepholePass) removeRedundantMoves(irs []AsmInstruction) ([]AsmInstruction, bool) {
+	out := []AsmInstruction{}
+	changed := false
+	for i := 0; i < len(irs); i++ {
+		mov, isMov := irs[i].(AsmMov)
+		if !isMov {
+			out = append(out, irs[i])
+			continue
+		}
+		if mov.Src == mov.Dst {
+			changed = true
+			continue
+		}
+		if i+1 < len(irs) {
+			next, nextIsMov := irs[i+1].(AsmMov)
+			if nextIsMov && next.Src == mov.Dst && next.Dst == mov.Src && sameAsmType(next.Type, mov.Type) {
+				if !isScratch(mov.Dst) {
+					out = append(out, mov)
+				}
+				i++
+				changed = true
+				continue
+			}
+		}
+		out = append(out, mov)
+	}
+	return out, changed
+}
+
+func sameAsmType(a, b asmtype.AsmType) bool {
+	switch a.(type) {
+	case *asmtype.QuadWord:
+		_, ok := b.(*asmtype.QuadWord)
+		return ok
+	case *asmtype.LongWord:
+		_, ok := b.(*asmtype.LongWord)
+		return ok
+	}
+	return false
+}
+
+// removeJumpsToNext drops jumps whose target is one of the labels right
+// after them.
+func (p *PeepholePass) removeJumpsToNext(irs []AsmInstruction) ([]AsmInstruction, bool) {
+	out := []AsmInstruction{}
+	changed := false
+	for i, instr := range irs {
+		target := ""
+		switch ast := instr.(type) {
+		case Jmp:
+			target = ast.Ident
+		case JmpCC:
+			target = ast.Ident
+		}
+		if target != "" && labelFollows(irs[i+1:], target) {
+			changed = true
+			continue
+		}
+		out = append(out, instr)
+	}
+	return out, changed
+}
+
+func labelFollows(irs []AsmInstruction, target string) bool {
+	for _, instr := range irs {
+		lbl, ok := instr.(Label)
+		if !ok {
+			return false
+		}
+		if lbl.Ident == target {
+			return true
+		}
+	}
+	return false
+}
+
+var invertedCondCodes = map[CondCode]CondCode{
+	E:  NE,
+	NE: E,
+	G:  LE,
+	GE: L,
+	L:  GE,
+	LE: G,
+	// an unordered comisd sets CF and ZF, so the inverse of a double
+	// comparison jumps on a NaN as it should
+	A:  BE,
+	AE: B,
+}
+
+// fuseCompareJumps rewrites
+//
+//	cmp a, b; mov $0, r; setCC r; cmp $0, r; je/jne label
+//
+// into cmp a, b; jCC label when r is dead after the jump, which is how every
+// if and while over a comparison comes out of the backend.
+func (p *PeepholePass) fuseCompareJumps(irs []AsmInstruction) ([]AsmInstruction, bool) {
+	var liveOut []operandSet
+	out := []AsmInstruction{}
+	changed := false
+	for i := 0; i < len(irs); i++ {
+		out = append(out, irs[i])
+		if _, isCmp := irs[i].(Cmp); !isCmp || i+4 >= len(irs) {
+			continue
+		}
+		zero, ok1 := irs[i+1].(AsmMov)
+		setcc, ok2 := irs[i+2].(SetCC)
+		test, ok3 := irs[i+3].(Cmp)
+		jmpcc, ok4 := irs[i+4].(JmpCC)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			continue
+		}
+		reg, isReg := setcc.Op.(Register)
+		if !isReg || !p.regAlloc.isNode(reg) || zero.Dst != setcc.Op || zero.Src != (Imm{Value: 0}) ||
+			test.Dst != setcc.Op || test.Src != (Imm{Value: 0}) {
+			continue
+		}
+		cc, invertible := invertedCondCodes[setcc.CC]
+		if !invertible || (jmpcc.CC != E && jmpcc.CC != NE) {
+			continue
+		}
+		if liveOut == nil {
+			liveOut = p.regAlloc.liveness(irs)
+		}
+		if liveOut[i+4][reg] {
+			continue
+		}
+		// je jumps when the comparison was false
+		if jmpcc.CC == NE {
+			cc = setcc.CC
+		}
+		out = append(out, JmpCC{CC: cc, Ident: jmpcc.Ident})
+		i += 4
+		changed = true
+	}
+	return out, changed
+}
+
+// zeroWithXor replaces mov $0, reg with the shorter xor reg, reg where
+// nothing reads the flags the xor clobbers before they are set again.
+func (p *PeepholePass) zeroWithXor(irs []AsmInstruction) []AsmInstruction {
+	for i, instr := range irs {
+		mov, isMov := instr.(AsmMov)
+		if !isMov || mov.Src != (Imm{Value: 0}) {
+			continue
+		}
+		reg, isReg := mov.Dst.(Register)
+		if !isReg || !flagsDeadAfter(irs[i+1:]) {
+			continue
+		}
+		// writing the low 32 bits clears the upper half as well
+		irs[i] = AsmBinary{Op: Xor, Type: &asmtype.LongWord{}, Src: reg, Dst: reg}
+	}
+	return irs
+}
+
+// flagsDeadAfter reports whether the flags are set again before anything in
+// irs reads them. The backend only reads flags right after the comparison
+// that set them, never across a label or a jump.
+func flagsDeadAfter(irs []AsmInstruction) bool {
+	for _, instr := range irs {
+		switch instr.(type) {
+		case SetCC, JmpCC:
+			return false
+		case Cmp, AsmBinary, Idiv, Call, TailCall, Return, Jmp, JmpTable, Label:
+			return true
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package codegen
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+func newPeephole() PeepholePass {
+	return NewPeepholePass(asmsymbol.NewAsmSymbolTable(), symbols.NewSymbolTable())
+}
+
+func reg(r AsmRegister) Register {
+	return Register{Reg: r}
+}
+
+func movl(src, dst AsmOperand) AsmMov {
+	return AsmMov{Type: &asmtype.LongWord{}, Src: src, Dst: dst}
+}
+
+// compareJump is what an if over a comparison comes out of the backend as,
+// with the 0/1 result of the comparison in cx.
+func compareJump(cc CondCode, jcc CondCode) []AsmInstruction {
+	return []AsmInstruction{
+		Cmp{Type: &asmtype.LongWord{}, Src: reg(SI), Dst: reg(DI)},
+		movl(Imm{Value: 0}, reg(CX)),
+		SetCC{CC: cc, Op: reg(CX)},
+		Cmp{Type: &asmtype.LongWord{}, Src: Imm{Value: 0}, Dst: reg(CX)},
+		JmpCC{CC: jcc, Ident: "else"},
+	}
+}
+
+func TestFuseCompareJumps(t *testing.T) {
+	ret := []AsmInstruction{Label{Ident: "else"}, movl(Imm{Value: 1}, reg(AX)), Return{}}
+	tests := []struct {
+		name     string
+		cc, jcc  CondCode
+		after    []AsmInstruction
+		expected CondCode
+	}{
+		{"je jumps when false", L, E, ret, GE},
+		{"jne jumps when true", L, NE, ret, L},
+		{"double above", A, E, ret, BE},
+		{"double above or equal", AE, E, ret, B},
+		{"double jne", A, NE, ret, A},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPeephole()
+			irs := append(compareJump(tt.cc, tt.jcc), tt.after...)
+			out, changed := p.fuseCompareJumps(irs)
+			expected := append([]AsmInstruction{irs[0], JmpCC{CC: tt.expected, Ident: "else"}}, tt.after...)
+			if !changed || !reflect.DeepEqual(out, expected) {
+				t.Errorf("expected %v, got %v", expected, out)
+			}
+		})
+	}
+
+	unchanged := []struct {
+		name string
+		irs  []AsmInstruction
+	}{
+		// the 0/1 value in cx is returned on both paths
+		{"setcc result live", append(compareJump(L, E), Label{Ident: "else"}, movl(reg(CX), reg(AX)), Return{})},
+		// setb gives 0 on a NaN but jae wouldn't jump on one, b has no
+		// single inverse for a double comparison
+		{"no inverse", append(compareJump(B, E), ret...)},
+		{"not a test of the result", append(compareJump(L, G), ret...)},
+	}
+	for _, tt := range unchanged {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPeephole()
+			out, changed := p.fuseCompareJumps(tt.irs)
+			if changed || !reflect.DeepEqual(out, tt.irs) {
+				t.Errorf("expected no change, got %v", out)
+			}
+		})
+	}
+}
+
+func TestRemoveRedundantMoves(t *testing.T) {
+	a := Stack{Value: -8}
+	tests := []struct {
+		name     string
+		irs      []AsmInstruction
+		expected []AsmInstruction
+	}{
+		{"onto itself", []AsmInstruction{movl(reg(CX), reg(CX))}, []AsmInstruction{}},
+		// the copy into cx is still needed, the copy back isn't
+		{"copied back", []AsmInstruction{movl(a, reg(CX)), movl(reg(CX), a)}, []AsmInstruction{movl(a, reg(CX))}},
+		// a fixed up mov -8(%rbp), -8(%rbp) through a scratch register
+		{"through r10", []AsmInstruction{movl(a, reg(R10)), movl(reg(R10), a)}, []AsmInstruction{}},
+		{"through r11", []AsmInstruction{movl(a, reg(R11)), movl(reg(R11), a)}, []AsmInstruction{}},
+		// a different width isn't an inverse of the first move
+		{"other width", []AsmInstruction{
+			movl(a, reg(R10)),
+			AsmMov{Type: &asmtype.QuadWord{}, Src: reg(R10), Dst: a},
+		}, []AsmInstruction{
+			movl(a, reg(R10)),
+			AsmMov{Type: &asmtype.QuadWord{}, Src: reg(R10), Dst: a},
+		}},
+		{"not the inverse", []AsmInstruction{movl(a, reg(R10)), movl(reg(R10), Stack{Value: -16})}, []AsmInstruction{
+			movl(a, reg(R10)), movl(reg(R10), Stack{Value: -16}),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPeephole()
+			out, _ := p.removeRedundantMoves(tt.irs)
+			if !reflect.DeepEqual(out, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestRemoveJumpsToNext(t *testing.T) {
+	p := newPeephole()
+	irs := []AsmInstruction{
+		Jmp{Ident: "b"},
+		Label{Ident: "a"},
+		Label{Ident: "b"},
+		JmpCC{CC: E, Ident: "a"},
+		movl(Imm{Value: 1}, reg(AX)),
+		Label{Ident: "a"},
+		Return{},
+	}
+	out, changed := p.removeJumpsToNext(irs)
+	expected := []AsmInstruction{irs[1], irs[2], irs[3], irs[4], irs[5], irs[6]}
+	if !changed || !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+}
+
+func TestZeroWithXor(t *testing.T) {
+	xor := AsmBinary{Op: Xor, Type: &asmtype.LongWord{}, Src: reg(AX), Dst: reg(AX)}
+	tests := []struct {
+		name     string
+		irs      []AsmInstruction
+		expected []AsmInstruction
+	}{
+		{"flags set again", []AsmInstruction{movl(Imm{Value: 0}, reg(AX)), Return{}}, []AsmInstruction{xor, Return{}}},
+		// the mov $0 between a cmp and its setcc must not touch the flags
+		{"setcc reads the flags", []AsmInstruction{
+			Cmp{Type: &asmtype.LongWord{}, Src: reg(SI), Dst: reg(DI)},
+			movl(Imm{Value: 0}, reg(AX)),
+			SetCC{CC: L, Op: reg(AX)},
+		}, nil},
+		{"jcc reads the flags", []AsmInstruction{
+			Cmp{Type: &asmtype.LongWord{}, Src: reg(SI), Dst: reg(DI)},
+			movl(Imm{Value: 0}, reg(AX)),
+			JmpCC{CC: E, Ident: "a"},
+		}, nil},
+		{"memory", []AsmInstruction{movl(Imm{Value: 0}, Stack{Value: -8}), Return{}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPeephole()
+			expected := tt.expected
+			if expected == nil {
+				expected = append([]AsmInstruction{}, tt.irs...)
+			}
+			out := p.zeroWithXor(tt.irs)
+			if !reflect.DeepEqual(out, expected) {
+				t.Errorf("expected %v, got %v", expected, out)
+			}
+		})
+	}
+}
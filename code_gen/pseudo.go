@@ -107,6 +107,30 @@ func (r *ReplacementPassGen) ReplacePseudosInInstruction(instr AsmInstruction, s
 			Src: src,
 			Dst: dst,
 		}
+	case AsmMovZb:
+		replacedState, src := r.ReplaceOperand(ast.Src, state)
+		replacedState, dst := r.ReplaceOperand(ast.Dst, replacedState)
+		return replacedState, AsmMovZb{
+			Type: ast.Type,
+			Src:  src,
+			Dst:  dst,
+		}
+	case Cvtsi2sd:
+		replacedState, src := r.ReplaceOperand(ast.Src, state)
+		replacedState, dst := r.ReplaceOperand(ast.Dst, replacedState)
+		return replacedState, Cvtsi2sd{
+			Type: ast.Type,
+			Src:  src,
+			Dst:  dst,
+		}
+	case Cvttsd2si:
+		replacedState, src := r.ReplaceOperand(ast.Src, state)
+		replacedState, dst := r.ReplaceOperand(ast.Dst, replacedState)
+		return replacedState, Cvttsd2si{
+			Type: ast.Type,
+			Src:  src,
+			Dst:  dst,
+		}
 	case AsmLoadFromMem:
 		replacedState, dst := r.ReplaceOperand(ast.Dst, state)
 		return replacedState, AsmLoadFromMem{
@@ -153,6 +177,9 @@ func (r *ReplacementPassGen) ReplacePseudosInProgram(program AsmProgram, symbolT
 	asmFnDefs := []AsmFnDef{}
 	for _, fn := range program.AsmFnDef {
 		finalState, asmFnDef := r.ReplacePseudosInFn(fn, initState)
+		if asmFnDef.Debug != nil {
+			asmFnDef.Debug.assignOffsets(finalState.OffsetMap)
+		}
 		asmFnDefs = append(asmFnDefs, asmFnDef)
 		symbolTable.SetBytesRequired(fn.Ident, util.Abs(finalState.CurrentOffset))
 	}
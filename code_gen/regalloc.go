@@ -0,0 +1,506 @@
+package codegen
+
+import (
+	"sort"
+
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+// allocatableRegisters are handed out in this order, caller-saved first so a
+// pseudo only takes a callee-saved register when it lives across a call.
+// R10 and R11 stay reserved as scratch registers for the fixup pass.
+var allocatableRegisters = []AsmRegister{AX, CX, DX, DI, SI, R8, R9, BX, R12, R13, R14, R15}
+
+var callerSavedRegisters = []AsmRegister{AX, CX, DX, DI, SI, R8, R9}
+
+var argRegisters = []AsmRegister{DI, SI, DX, CX, R8, R9}
+
+func isCalleeSaved(reg AsmRegister) bool {
+	switch reg {
+	case BX, R12, R13, R14, R15:
+		return true
+	}
+	return false
+}
+
+func isAllocatable(reg AsmRegister) bool {
+	for _, r := range allocatableRegisters {
+		if r == reg {
+			return true
+		}
+	}
+	return false
+}
+
+type operandSet map[AsmOperand]bool
+
+// RegAllocPass colors the interference graph of every function and rewrites
+// the pseudos it could fit into hard registers. Whatever is left over stays a
+// Pseudo and gets a stack slot in ReplacementPassGen.
+type RegAllocPass struct {
+	asmSymbols  *asmsymbol.SymbolTable
+	symbolTable *symbols.SymbolTable
+	inMemory    map[string]bool
+}
+
+func NewRegAllocPass(asmSymbols *asmsymbol.SymbolTable, symbolTable *symbols.SymbolTable) RegAllocPass {
+	return RegAllocPass{
+		asmSymbols:  asmSymbols,
+		symbolTable: symbolTable,
+		inMemory:    map[string]bool{},
+	}
+}
+
+// KeepInMemory leaves the given pseudos on the stack, where the debug info
+// can point at them for the whole function.
+func (r *RegAllocPass) KeepInMemory(pseudos []string) {
+	for _, name := range pseudos {
+		r.inMemory[name] = true
+	}
+}
+
+func (r *RegAllocPass) AllocateProgram(program AsmProgram) AsmProgram {
+	asmFnDefs := []AsmFnDef{}
+	for _, fn := range program.AsmFnDef {
+		asmFnDefs = append(asmFnDefs, r.AllocateFn(fn))
+	}
+	program.AsmFnDef = asmFnDefs
+	return program
+}
+
+func (r *RegAllocPass) AllocateFn(fn AsmFnDef) AsmFnDef {
+	liveOut := r.liveness(fn.Irs)
+	graph := r.buildInterference(fn.Irs, liveOut)
+	colors := r.colorGraph(graph, r.spillCosts(fn.Irs))
+
+	calleeSaved := map[AsmRegister]bool{}
+	for _, reg := range colors {
+		if isCalleeSaved(reg) {
+			calleeSaved[reg] = true
+		}
+	}
+
+	irs := []AsmInstruction{}
+	for _, instr := range fn.Irs {
+		replaced := mapOperands(instr, func(op AsmOperand) AsmOperand {
+			if pseudo, isPseudo := op.(Pseudo); isPseudo {
+				if reg, ok := colors[pseudo.Ident]; ok {
+					return Register{Reg: reg}
+				}
+			}
+			return op
+		})
+		// a copy between the same register is a no-op once both sides are colored
+		if mov, isMov := replaced.(AsmMov); isMov {
+			src, srcIsReg := mov.Src.(Register)
+			dst, dstIsReg := mov.Dst.(Register)
+			if srcIsReg && dstIsReg && src.Reg == dst.Reg {
+				continue
+			}
+		}
+		irs = append(irs, replaced)
+	}
+
+	fn.Irs = irs
+	fn.CalleeSaved = []AsmRegister{}
+	for _, reg := range allocatableRegisters {
+		if calleeSaved[reg] {
+			fn.CalleeSaved = append(fn.CalleeSaved, reg)
+		}
+	}
+	return fn
+}
+
+// isNode reports whether op takes part in register allocation: allocatable
+// hard registers and pseudos that are not globals. A бутархай always gets a
+// stack slot, the general registers can't do arithmetic on it.
+func (r *RegAllocPass) isNode(op AsmOperand) bool {
+	switch ast := op.(type) {
+	case Register:
+		return isAllocatable(ast.Reg)
+	case Pseudo:
+		return !r.asmSymbols.IsGlobalVar(ast.Ident) && !r.inMemory[ast.Ident] && !r.isDouble(ast.Ident)
+	}
+	return false
+}
+
+func (r *RegAllocPass) isDouble(name string) bool {
+	entry := r.symbolTable.Get(name)
+	if entry == nil {
+		return false
+	}
+	_, ok := entry.Type.(*mtypes.DoubleType)
+	return ok
+}
+
+// callArgCount is how many of the integer argument registers a call reads,
+// бутархай arguments go in XMM registers.
+func (r *RegAllocPass) callArgCount(name string) int {
+	entry := r.symbolTable.Get(name)
+	if entry != nil {
+		if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+			count := 0
+			for _, param := range fnType.ParamTypes {
+				if _, isDouble := param.(*mtypes.DoubleType); !isDouble {
+					count++
+				}
+			}
+			return count
+		}
+	}
+	// functions we know nothing about (malloc) may read any of them
+	return len(argRegisters)
+}
+
+func (r *RegAllocPass) usesAndDefs(instr AsmInstruction) ([]AsmOperand, []AsmOperand) {
+	uses := []AsmOperand{}
+	defs := []AsmOperand{}
+	switch ast := instr.(type) {
+	case AsmMov:
+		uses = append(uses, ast.Src)
+		defs = append(defs, ast.Dst)
+	case AsmMovSx:
+		uses = append(uses, ast.Src)
+		defs = append(defs, ast.Dst)
+	case AsmMovZb:
+		uses = append(uses, ast.Src)
+		defs = append(defs, ast.Dst)
+	case Cvtsi2sd:
+		uses = append(uses, ast.Src)
+		defs = append(defs, ast.Dst)
+	case Cvttsd2si:
+		uses = append(uses, ast.Src)
+		defs = append(defs, ast.Dst)
+	case AsmBinary:
+		uses = append(uses, ast.Src, ast.Dst)
+		defs = append(defs, ast.Dst)
+	case Unary:
+		uses = append(uses, ast.Dst)
+		defs = append(defs, ast.Dst)
+	case Cmp:
+		uses = append(uses, ast.Src, ast.Dst)
+	case SetCC:
+		// setcc only writes the low byte, the rest comes from the mov $0 before it
+		uses = append(uses, ast.Op)
+		defs = append(defs, ast.Op)
+	case Push:
+		uses = append(uses, ast.Op)
+	case Idiv:
+		uses = append(uses, ast.Src, Register{Reg: AX}, Register{Reg: DX})
+		defs = append(defs, Register{Reg: AX}, Register{Reg: DX})
+	case Cdq:
+		uses = append(uses, Register{Reg: AX})
+		defs = append(defs, Register{Reg: DX})
+	case Call:
+		count := r.callArgCount(ast.Ident)
+		for i := 0; i < count && i < len(argRegisters); i++ {
+			uses = append(uses, Register{Reg: argRegisters[i]})
+		}
+		for _, reg := range callerSavedRegisters {
+			defs = append(defs, Register{Reg: reg})
+		}
+	case TailCall:
+		count := r.callArgCount(ast.Ident)
+		for i := 0; i < count && i < len(argRegisters); i++ {
+			uses = append(uses, Register{Reg: argRegisters[i]})
+		}
+	case Return:
+		uses = append(uses, Register{Reg: AX})
+	case AsmLoadFromMem:
+		uses = append(uses, Register{Reg: ast.Base})
+		defs = append(defs, ast.Dst)
+	case AsmStoreToMem:
+		uses = append(uses, ast.Src, Register{Reg: ast.Base})
+	}
+
+	filteredUses := []AsmOperand{}
+	for _, op := range uses {
+		if r.isNode(op) {
+			filteredUses = append(filteredUses, op)
+		}
+	}
+	filteredDefs := []AsmOperand{}
+	for _, op := range defs {
+		if r.isNode(op) {
+			filteredDefs = append(filteredDefs, op)
+		}
+	}
+	return filteredUses, filteredDefs
+}
+
+func successors(irs []AsmInstruction) [][]int {
+	labels := map[string]int{}
+	for i, instr := range irs {
+		if lbl, ok := instr.(Label); ok {
+			labels[lbl.Ident] = i
+		}
+	}
+
+	succs := make([][]int, len(irs))
+	for i, instr := range irs {
+		switch ast := instr.(type) {
+		case Jmp:
+			if target, ok := labels[ast.Ident]; ok {
+				succs[i] = []int{target}
+			}
+		case JmpCC:
+			if target, ok := labels[ast.Ident]; ok {
+				succs[i] = append(succs[i], target)
+			}
+			if i+1 < len(irs) {
+				succs[i] = append(succs[i], i+1)
+			}
+		case JmpTable:
+			for _, ident := range ast.Targets {
+				if target, ok := labels[ident]; ok {
+					succs[i] = append(succs[i], target)
+				}
+			}
+		case Return, TailCall:
+		default:
+			if i+1 < len(irs) {
+				succs[i] = []int{i + 1}
+			}
+		}
+	}
+	return succs
+}
+
+// liveness runs the usual backwards dataflow until it stops changing and
+// returns the live-out set of every instruction.
+func (r *RegAllocPass) liveness(irs []AsmInstruction) []operandSet {
+	succs := successors(irs)
+	uses := make([][]AsmOperand, len(irs))
+	defs := make([][]AsmOperand, len(irs))
+	for i, instr := range irs {
+		uses[i], defs[i] = r.usesAndDefs(instr)
+	}
+
+	liveIn := make([]operandSet, len(irs))
+	liveOut := make([]operandSet, len(irs))
+	for i := range irs {
+		liveIn[i] = operandSet{}
+		liveOut[i] = operandSet{}
+	}
+
+	changed := true
+	for changed {
+		changed = false
+		for i := len(irs) - 1; i >= 0; i-- {
+			out := operandSet{}
+			for _, s := range succs[i] {
+				for op := range liveIn[s] {
+					out[op] = true
+				}
+			}
+
+			in := operandSet{}
+			for op := range out {
+				in[op] = true
+			}
+			for _, op := range defs[i] {
+				delete(in, op)
+			}
+			for _, op := range uses[i] {
+				in[op] = true
+			}
+
+			if len(in) != len(liveIn[i]) || len(out) != len(liveOut[i]) {
+				changed = true
+			}
+			liveIn[i] = in
+			liveOut[i] = out
+		}
+	}
+	return liveOut
+}
+
+type interferenceGraph map[AsmOperand]operandSet
+
+func (g interferenceGraph) addNode(op AsmOperand) {
+	if _, ok := g[op]; !ok {
+		g[op] = operandSet{}
+	}
+}
+
+func (g interferenceGraph) addEdge(a, b AsmOperand) {
+	if a == b {
+		return
+	}
+	g.addNode(a)
+	g.addNode(b)
+	g[a][b] = true
+	g[b][a] = true
+}
+
+func (r *RegAllocPass) buildInterference(irs []AsmInstruction, liveOut []operandSet) interferenceGraph {
+	graph := interferenceGraph{}
+	for _, a := range allocatableRegisters {
+		for _, b := range allocatableRegisters {
+			graph.addEdge(Register{Reg: a}, Register{Reg: b})
+		}
+	}
+
+	for i, instr := range irs {
+		uses, defs := r.usesAndDefs(instr)
+		for _, op := range uses {
+			graph.addNode(op)
+		}
+		for _, d := range defs {
+			graph.addNode(d)
+			for l := range liveOut[i] {
+				// the source of a move can share a register with its destination
+				if mov, isMov := instr.(AsmMov); isMov && l == mov.Src {
+					continue
+				}
+				graph.addEdge(d, l)
+			}
+		}
+	}
+	return graph
+}
+
+func (r *RegAllocPass) spillCosts(irs []AsmInstruction) map[string]int {
+	costs := map[string]int{}
+	for _, instr := range irs {
+		mapOperands(instr, func(op AsmOperand) AsmOperand {
+			if pseudo, isPseudo := op.(Pseudo); isPseudo {
+				costs[pseudo.Ident]++
+			}
+			return op
+		})
+	}
+	return costs
+}
+
+// colorGraph does Chaitin-Briggs style simplify/select. Hard registers are
+// precolored; a pseudo that finds no free color on the way back is spilled.
+func (r *RegAllocPass) colorGraph(graph interferenceGraph, costs map[string]int) map[string]AsmRegister {
+	k := len(allocatableRegisters)
+
+	pseudos := []string{}
+	for node := range graph {
+		if pseudo, ok := node.(Pseudo); ok {
+			pseudos = append(pseudos, pseudo.Ident)
+		}
+	}
+	sort.Strings(pseudos)
+
+	removed := map[string]bool{}
+	degree := func(name string) int {
+		d := 0
+		for n := range graph[Pseudo{Ident: name}] {
+			if p, isPseudo := n.(Pseudo); isPseudo && removed[p.Ident] {
+				continue
+			}
+			d++
+		}
+		return d
+	}
+
+	stack := []string{}
+	for len(stack) < len(pseudos) {
+		chosen := ""
+		for _, name := range pseudos {
+			if !removed[name] && degree(name) < k {
+				chosen = name
+				break
+			}
+		}
+		if chosen == "" {
+			// optimistic spill candidate: cheapest per unit of degree
+			best := -1.0
+			for _, name := range pseudos {
+				if removed[name] {
+					continue
+				}
+				metric := float64(costs[name]) / float64(degree(name)+1)
+				if best < 0 || metric < best {
+					best = metric
+					chosen = name
+				}
+			}
+		}
+		removed[chosen] = true
+		stack = append(stack, chosen)
+	}
+
+	colors := map[string]AsmRegister{}
+	for i := len(stack) - 1; i >= 0; i-- {
+		name := stack[i]
+		taken := map[AsmRegister]bool{}
+		for n := range graph[Pseudo{Ident: name}] {
+			switch neighbor := n.(type) {
+			case Register:
+				taken[neighbor.Reg] = true
+			case Pseudo:
+				if reg, ok := colors[neighbor.Ident]; ok {
+					taken[reg] = true
+				}
+			}
+		}
+		for _, reg := range allocatableRegisters {
+			if !taken[reg] {
+				colors[name] = reg
+				break
+			}
+		}
+	}
+	return colors
+}
+
+// mapOperands rebuilds instr with f applied to each of its operands.
+func mapOperands(instr AsmInstruction, f func(AsmOperand) AsmOperand) AsmInstruction {
+	switch ast := instr.(type) {
+	case AsmMov:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case AsmMovSx:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case AsmMovZb:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case Cvtsi2sd:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case Cvttsd2si:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case AsmBinary:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case Unary:
+		ast.Dst = f(ast.Dst)
+		return ast
+	case Cmp:
+		ast.Src = f(ast.Src)
+		ast.Dst = f(ast.Dst)
+		return ast
+	case SetCC:
+		ast.Op = f(ast.Op)
+		return ast
+	case Push:
+		ast.Op = f(ast.Op)
+		return ast
+	case Idiv:
+		ast.Src = f(ast.Src)
+		return ast
+	case AsmLoadFromMem:
+		ast.Dst = f(ast.Dst)
+		return ast
+	case AsmStoreToMem:
+		ast.Src = f(ast.Src)
+		return ast
+	default:
+		return instr
+	}
+}
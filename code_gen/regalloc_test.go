@@ -0,0 +1,163 @@
+package codegen
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/your-moon/mon_lang/code_gen/asmsymbol"
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+func newRegAlloc() (RegAllocPass, *symbols.SymbolTable) {
+	table := symbols.NewSymbolTable()
+	return NewRegAllocPass(asmsymbol.NewAsmSymbolTable(), table), table
+}
+
+func movImm(value int64, dst string) AsmInstruction {
+	return AsmMov{Type: &asmtype.LongWord{}, Src: Imm{Value: value}, Dst: Pseudo{Ident: dst}}
+}
+
+func addPseudo(src, dst string) AsmInstruction {
+	return AsmBinary{Op: Add, Type: &asmtype.LongWord{}, Src: Pseudo{Ident: src}, Dst: Pseudo{Ident: dst}}
+}
+
+func retPseudo(src string) []AsmInstruction {
+	return []AsmInstruction{
+		AsmMov{Type: &asmtype.LongWord{}, Src: Pseudo{Ident: src}, Dst: Register{Reg: AX}},
+		Return{},
+	}
+}
+
+func TestInterference(t *testing.T) {
+	r, table := newRegAlloc()
+	table.AddFn(&mtypes.FnType{RetType: &mtypes.Int32Type{}}, "f", true)
+	table.AddVar(&mtypes.DoubleType{}, "d")
+
+	irs := []AsmInstruction{
+		movImm(1, "a"),
+		movImm(2, "b"),
+		// a is dead after the copy, so c may share its register
+		AsmMov{Type: &asmtype.LongWord{}, Src: Pseudo{Ident: "a"}, Dst: Pseudo{Ident: "c"}},
+		addPseudo("b", "c"),
+		// b lives across the call
+		Call{Ident: "f"},
+		AsmMov{Type: &asmtype.Double{}, Src: Pseudo{Ident: "d"}, Dst: Pseudo{Ident: "d"}},
+		addPseudo("b", "c"),
+	}
+	irs = append(irs, retPseudo("c")...)
+	graph := r.buildInterference(irs, r.liveness(irs))
+
+	a, b, c := Pseudo{Ident: "a"}, Pseudo{Ident: "b"}, Pseudo{Ident: "c"}
+	if !graph[a][b] || !graph[b][c] {
+		t.Errorf("expected a-b and b-c to interfere, got %v", graph)
+	}
+	if graph[a][c] {
+		t.Errorf("a move's source and destination shouldn't interfere")
+	}
+	for _, reg := range callerSavedRegisters {
+		if !graph[b][Register{Reg: reg}] {
+			t.Errorf("b lives across the call, expected it to interfere with %s", reg)
+		}
+	}
+	if graph[a][Register{Reg: BX}] {
+		t.Errorf("a callee-saved register survives the call, a shouldn't interfere with it")
+	}
+	if _, ok := graph[Pseudo{Ident: "d"}]; ok {
+		t.Errorf("a бутархай always lives on the stack, it isn't a node")
+	}
+}
+
+// TestSpillChoice keeps one more pseudo live than there are registers, sum
+// and a value for every register, the one used least is the one left on the
+// stack.
+func TestSpillChoice(t *testing.T) {
+	r, _ := newRegAlloc()
+
+	names := []string{}
+	for i := 0; i < len(allocatableRegisters); i++ {
+		names = append(names, fmt.Sprintf("v%d", i))
+	}
+	cold := names[len(names)/2]
+
+	irs := []AsmInstruction{}
+	for i, name := range names {
+		irs = append(irs, movImm(int64(i), name))
+	}
+	// every one is still needed here, the hot ones are used again and again
+	for round := 0; round < 3; round++ {
+		for _, name := range names {
+			if name != cold {
+				irs = append(irs, addPseudo(name, "sum"))
+			}
+		}
+	}
+	irs = append(irs, addPseudo(cold, "sum"))
+	for _, name := range names {
+		if name != cold {
+			irs = append(irs, addPseudo(name, "sum"))
+		}
+	}
+	irs = append(irs, retPseudo("sum")...)
+
+	graph := r.buildInterference(irs, r.liveness(irs))
+	colors := r.colorGraph(graph, r.spillCosts(irs))
+	if reg, ok := colors[cold]; ok {
+		t.Errorf("expected %s to be spilled, it got %s", cold, reg)
+	}
+	for _, name := range append(names, "sum") {
+		if _, ok := colors[name]; !ok && name != cold {
+			t.Errorf("expected %s to get a register", name)
+		}
+	}
+
+	// no two interfering pseudos share a register
+	for node, neighbors := range graph {
+		p, ok := node.(Pseudo)
+		if !ok {
+			continue
+		}
+		for n := range neighbors {
+			if q, ok := n.(Pseudo); ok {
+				if colors[p.Ident] != "" && colors[p.Ident] == colors[q.Ident] {
+					t.Errorf("%s and %s interfere but both got %s", p.Ident, q.Ident, colors[p.Ident])
+				}
+			} else if reg := n.(Register); colors[p.Ident] == reg.Reg {
+				t.Errorf("%s got %s which it interferes with", p.Ident, reg.Reg)
+			}
+		}
+	}
+}
+
+// TestCalleeSaved checks a value live across a call lands in a callee-saved
+// register, and that FixUpInFn saves it after the frame and restores it
+// before every return.
+func TestCalleeSaved(t *testing.T) {
+	r, table := newRegAlloc()
+	table.AddFn(&mtypes.FnType{RetType: &mtypes.Int32Type{}}, "f", true)
+	table.AddFn(&mtypes.FnType{RetType: &mtypes.Int32Type{}}, "g", true)
+	table.SetBytesRequired("g", 8)
+
+	irs := []AsmInstruction{movImm(7, "x"), Call{Ident: "f"}}
+	irs = append(irs, retPseudo("x")...)
+	fn := r.AllocateFn(AsmFnDef{Ident: "g", Irs: irs})
+	if !reflect.DeepEqual(fn.CalleeSaved, []AsmRegister{BX}) {
+		t.Fatalf("expected x in bx, saved %v", fn.CalleeSaved)
+	}
+
+	fixup := NewFixUpPassGen(table)
+	fixed := fixup.FixUpInFn(fn).Irs
+	// 8 bytes of frame and 8 of bx keep rsp 16-byte aligned
+	if alloc, ok := fixed[0].(AsmBinary); !ok || alloc.Op != Sub || alloc.Src != (Imm{Value: 8}) {
+		t.Errorf("expected the frame first, got %v", fixed[0])
+	}
+	if fixed[1] != (Push{Op: Register{Reg: BX}}) {
+		t.Errorf("expected bx pushed after the frame, got %v", fixed[1])
+	}
+	last := len(fixed) - 1
+	if _, ok := fixed[last].(Return); !ok || fixed[last-1] != (Pop{Reg: BX}) {
+		t.Errorf("expected bx popped right before the return, got %v", fixed[last-1:])
+	}
+}
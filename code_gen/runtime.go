@@ -0,0 +1,792 @@
+package codegen
+
+import (
+	"math"
+
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+)
+
+// The runtime for --nolibc. It stands in for stdlib/lib.c and malloc with
+// raw Linux syscalls, so the program links with ld alone or is written out
+// as an executable by GenExec. The functions are plain AsmFnDefs and go
+// through the same emitters as the program, they only use caller-saved
+// registers and follow the same calling convention as the compiled code.
+
+const (
+	sysRead      = 0
+	sysWrite     = 1
+	sysMmap      = 9
+	sysNanosleep = 35
+	sysExit      = 60
+	sysTime      = 201
+)
+
+// heapChunk is the smallest mapping malloc asks the kernel for.
+const heapChunk = 1 << 20
+
+var (
+	rtQuad = &asmtype.QuadWord{}
+	rtLong = &asmtype.LongWord{}
+	rtByte = &asmtype.Byte{}
+	rtF64  = &asmtype.Double{}
+)
+
+func rtReg(reg AsmRegister) Register {
+	return Register{Reg: reg}
+}
+
+func rtMovq(src AsmOperand, dst AsmOperand) AsmInstruction {
+	return AsmMov{Type: rtQuad, Src: src, Dst: dst}
+}
+
+func rtBinq(op AsmAstBinaryOp, src AsmOperand, dst AsmOperand) AsmInstruction {
+	return AsmBinary{Op: op, Type: rtQuad, Src: src, Dst: dst}
+}
+
+func rtCmpq(src AsmOperand, dst AsmOperand) AsmInstruction {
+	return Cmp{Type: rtQuad, Src: src, Dst: dst}
+}
+
+func rtCmpl(src AsmOperand, dst AsmOperand) AsmInstruction {
+	return Cmp{Type: rtLong, Src: src, Dst: dst}
+}
+
+// rtSyscall loads the syscall number and traps, the arguments are already
+// in place.
+func rtSyscall(number int64) []AsmInstruction {
+	return []AsmInstruction{rtMovq(Imm{Value: number}, rtReg(AX)), Syscall{}}
+}
+
+// rtWrite writes rdx bytes from rsi to stdout.
+func rtWrite() []AsmInstruction {
+	return append([]AsmInstruction{rtMovq(Imm{Value: 1}, rtReg(DI))}, rtSyscall(sysWrite)...)
+}
+
+func rtFn(name string, parts ...[]AsmInstruction) AsmFnDef {
+	irs := []AsmInstruction{}
+	for _, part := range parts {
+		irs = append(irs, part...)
+	}
+	return AsmFnDef{Ident: name, Irs: irs}
+}
+
+// runtimeGlobals keep the heap and the random number state.
+var runtimeGlobals = []GlobalVarAsm{
+	{Label: "mon_rt_heap_cur", Size: 8},
+	{Label: "mon_rt_heap_end", Size: 8},
+	{Label: "mon_rt_rand_state", Size: 8},
+	{Label: "mon_rt_argc", Size: 4},
+}
+
+// AddRuntime appends the runtime to the program, it replaces every
+// function of the prelude and malloc.
+func AddRuntime(program AsmProgram) AsmProgram {
+	program.AsmFnDef = append(program.AsmFnDef, runtimeFns()...)
+	program.GlobalVars = append(program.GlobalVars, runtimeGlobals...)
+	return program
+}
+
+func runtimeFns() []AsmFnDef {
+	return []AsmFnDef{
+		rtKhevle(),
+		rtMqrKhevlekh(),
+		rtGetc(),
+		rtUnsh(),
+		rtFn("unsh32", []AsmInstruction{Call{Ident: "unsh"}, Return{}}),
+		rtButarkhayKhevlekh(),
+		rtButarkhayUnsh(),
+		rtRandom(),
+		rtFn("odoo", []AsmInstruction{rtMovq(Imm{Value: 0}, rtReg(DI))}, rtSyscall(sysTime), []AsmInstruction{Return{}}),
+		// the heap is a bump allocator, memory is only given back on exit
+		rtFn("chqlqqlqkh", []AsmInstruction{Return{}}),
+		rtSleep(),
+		rtFn("delgetsTseverlekh",
+			[]AsmInstruction{
+				StringLiteral{Value: "\x1b[H\x1b[2J"},
+				rtMovq(rtReg(AX), rtReg(SI)),
+				rtMovq(Imm{Value: 7}, rtReg(DX)),
+			},
+			rtWrite(),
+			[]AsmInstruction{Return{}},
+		),
+		rtMalloc(),
+		// _start hands argc and argv over before it calls үндсэн
+		rtFn("mon_rt_args", []AsmInstruction{
+			AsmMov{Type: rtLong, Src: rtReg(DI), Dst: RipRelative{Label: "mon_rt_argc"}},
+			rtMovq(rtReg(SI), rtReg(AX)),
+			Return{},
+		}),
+		rtFn("argyin_too", []AsmInstruction{
+			AsmMov{Type: rtLong, Src: RipRelative{Label: "mon_rt_argc"}, Dst: rtReg(AX)},
+			Return{},
+		}),
+	}
+}
+
+// хэвлэ: the digits are written backwards into a buffer on the stack. The
+// number is made negative first so the smallest long needs no special case.
+func rtKhevle() AsmFnDef {
+	return rtFn("khevle",
+		[]AsmInstruction{
+			AllocateStack{Value: 32},
+			rtMovq(rtReg(DI), rtReg(AX)),
+			rtMovq(Imm{Value: 0}, rtReg(R8)),
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: L, Ident: "mon_rt_khevle_negative"},
+			Unary{Type: rtQuad, Op: Neg, Dst: rtReg(AX)},
+			Jmp{Ident: "mon_rt_khevle_digits"},
+			Label{Ident: "mon_rt_khevle_negative"},
+			rtMovq(Imm{Value: 1}, rtReg(R8)),
+			Label{Ident: "mon_rt_khevle_digits"},
+			rtMovq(rtReg(SP), rtReg(R10)),
+			rtBinq(Add, Imm{Value: 32}, rtReg(R10)),
+			Label{Ident: "mon_rt_khevle_loop"},
+			rtBinq(Sub, Imm{Value: 1}, rtReg(R10)),
+			rtMovq(Imm{Value: 10}, rtReg(CX)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(CX)},
+			// the remainder is zero or negative
+			rtMovq(Imm{Value: '0'}, rtReg(R9)),
+			rtBinq(Sub, rtReg(DX), rtReg(R9)),
+			AsmStoreToMem{Type: rtByte, Src: rtReg(R9), Base: R10},
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_khevle_loop"},
+			rtCmpq(Imm{Value: 0}, rtReg(R8)),
+			JmpCC{CC: E, Ident: "mon_rt_khevle_write"},
+			rtBinq(Sub, Imm{Value: 1}, rtReg(R10)),
+			rtMovq(Imm{Value: '-'}, rtReg(R9)),
+			AsmStoreToMem{Type: rtByte, Src: rtReg(R9), Base: R10},
+			Label{Ident: "mon_rt_khevle_write"},
+			rtMovq(rtReg(R10), rtReg(SI)),
+			rtMovq(rtReg(SP), rtReg(DX)),
+			rtBinq(Add, Imm{Value: 32}, rtReg(DX)),
+			rtBinq(Sub, rtReg(R10), rtReg(DX)),
+		},
+		rtWrite(),
+		[]AsmInstruction{Return{}},
+	)
+}
+
+// мөр_хэвлэх
+func rtMqrKhevlekh() AsmFnDef {
+	return rtFn("mqr_khevlekh",
+		[]AsmInstruction{
+			rtMovq(rtReg(DI), rtReg(R10)),
+			Label{Ident: "mon_rt_mqr_loop"},
+			AsmLoadFromMem{Type: rtByte, Base: R10, Dst: rtReg(AX)},
+			rtCmpl(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: E, Ident: "mon_rt_mqr_write"},
+			rtBinq(Add, Imm{Value: 1}, rtReg(R10)),
+			Jmp{Ident: "mon_rt_mqr_loop"},
+			Label{Ident: "mon_rt_mqr_write"},
+			rtMovq(rtReg(R10), rtReg(DX)),
+			rtBinq(Sub, rtReg(DI), rtReg(DX)),
+			rtMovq(rtReg(DI), rtReg(SI)),
+		},
+		rtWrite(),
+		[]AsmInstruction{Return{}},
+	)
+}
+
+// mon_rt_getc reads one byte of stdin, -1 at the end of input. Reading a
+// byte at a time leaves nothing buffered between calls to унш.
+func rtGetc() AsmFnDef {
+	return rtFn("mon_rt_getc",
+		[]AsmInstruction{
+			AllocateStack{Value: 16},
+			rtMovq(Imm{Value: 0}, rtReg(DI)),
+			rtMovq(rtReg(SP), rtReg(SI)),
+			rtMovq(Imm{Value: 1}, rtReg(DX)),
+		},
+		rtSyscall(sysRead),
+		[]AsmInstruction{
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: LE, Ident: "mon_rt_getc_eof"},
+			rtMovq(rtReg(SP), rtReg(R10)),
+			AsmLoadFromMem{Type: rtByte, Base: R10, Dst: rtReg(AX)},
+			Return{},
+			Label{Ident: "mon_rt_getc_eof"},
+			AsmMov{Type: rtLong, Src: Imm{Value: -1}, Dst: rtReg(AX)},
+			Return{},
+		},
+	)
+}
+
+// унш reads like scanf("%ld"): leading white space, a sign, then digits.
+// The value lives in -8(%rbp) and the sign in -16(%rbp) across the calls.
+func rtUnsh() AsmFnDef {
+	value, negative := Stack{Value: -8}, Stack{Value: -16}
+	irs := []AsmInstruction{
+		AllocateStack{Value: 16},
+		Label{Ident: "mon_rt_unsh_space"},
+		Call{Ident: "mon_rt_getc"},
+		rtCmpl(Imm{Value: -1}, rtReg(AX)),
+		JmpCC{CC: E, Ident: "mon_rt_unsh_eof"},
+		rtCmpl(Imm{Value: ' '}, rtReg(AX)),
+		JmpCC{CC: E, Ident: "mon_rt_unsh_space"},
+		// \t \n \v \f \r
+		rtCmpl(Imm{Value: '\t'}, rtReg(AX)),
+		JmpCC{CC: L, Ident: "mon_rt_unsh_sign"},
+		rtCmpl(Imm{Value: '\r'}, rtReg(AX)),
+		JmpCC{CC: LE, Ident: "mon_rt_unsh_space"},
+		Label{Ident: "mon_rt_unsh_sign"},
+		rtMovq(Imm{Value: 0}, negative),
+		rtMovq(Imm{Value: 0}, value),
+		rtCmpl(Imm{Value: '-'}, rtReg(AX)),
+		JmpCC{CC: NE, Ident: "mon_rt_unsh_plus"},
+		rtMovq(Imm{Value: 1}, negative),
+		Call{Ident: "mon_rt_getc"},
+		Jmp{Ident: "mon_rt_unsh_digits"},
+		Label{Ident: "mon_rt_unsh_plus"},
+		rtCmpl(Imm{Value: '+'}, rtReg(AX)),
+		JmpCC{CC: NE, Ident: "mon_rt_unsh_digits"},
+		Call{Ident: "mon_rt_getc"},
+		Label{Ident: "mon_rt_unsh_digits"},
+		rtCmpl(Imm{Value: '0'}, rtReg(AX)),
+		JmpCC{CC: L, Ident: "mon_rt_unsh_done"},
+		rtCmpl(Imm{Value: '9'}, rtReg(AX)),
+		JmpCC{CC: G, Ident: "mon_rt_unsh_done"},
+		// writing eax clears the upper half of rax
+		AsmBinary{Op: Sub, Type: rtLong, Src: Imm{Value: '0'}, Dst: rtReg(AX)},
+		rtMovq(value, rtReg(CX)),
+		rtBinq(Mult, Imm{Value: 10}, rtReg(CX)),
+		rtBinq(Add, rtReg(AX), rtReg(CX)),
+		rtMovq(rtReg(CX), value),
+		Call{Ident: "mon_rt_getc"},
+		Jmp{Ident: "mon_rt_unsh_digits"},
+		Label{Ident: "mon_rt_unsh_done"},
+		rtMovq(value, rtReg(AX)),
+		rtCmpq(Imm{Value: 0}, negative),
+		JmpCC{CC: E, Ident: "mon_rt_unsh_return"},
+		Unary{Type: rtQuad, Op: Neg, Dst: rtReg(AX)},
+		Label{Ident: "mon_rt_unsh_return"},
+		Return{},
+		Label{Ident: "mon_rt_unsh_eof"},
+		rtMovq(Imm{Value: 0}, rtReg(AX)),
+		Return{},
+	}
+	return rtFn("unsh", irs)
+}
+
+// rtLoadDouble puts the constant f into an XMM register through r11.
+func rtLoadDouble(f float64, dst AsmRegister) []AsmInstruction {
+	return []AsmInstruction{
+		rtMovq(Imm{Value: int64(math.Float64bits(f))}, rtReg(R11)),
+		AsmMov{Type: rtF64, Src: rtReg(R11), Dst: rtReg(dst)},
+	}
+}
+
+// rtPutChar stores c at r10 and moves r10 past it.
+func rtPutChar(c byte) []AsmInstruction {
+	return []AsmInstruction{
+		rtMovq(Imm{Value: int64(c)}, rtReg(R11)),
+		AsmStoreToMem{Type: rtByte, Src: rtReg(R11), Base: R10},
+		rtBinq(Add, Imm{Value: 1}, rtReg(R10)),
+	}
+}
+
+// rtPutDigit stores the digit in reg at r10 and moves r10 past it.
+func rtPutDigit(reg AsmRegister) []AsmInstruction {
+	return []AsmInstruction{
+		rtBinq(Add, Imm{Value: '0'}, rtReg(reg)),
+		AsmStoreToMem{Type: rtByte, Src: rtReg(reg), Base: R10},
+		rtBinq(Add, Imm{Value: 1}, rtReg(R10)),
+	}
+}
+
+// бутархай_хэвлэх prints like printf("%g"). The number is scaled into
+// [1, 10) while the decimal exponent is counted, then rounded to six
+// digits whose trailing zeros are dropped. Exponents below -4 or above 5
+// are written as 1.5e+07, the rest as plain decimals. r8 holds the
+// digits, r9 the place value of the next digit, rcx the digit index, rsi
+// the index the point goes before and rdi the number of digits. The
+// exponent is kept in -8(%rbp) and the text is built from the bottom of
+// the stack.
+func rtButarkhayKhevlekh() AsmFnDef {
+	exponent := Stack{Value: -8}
+	return rtFn("butarkhay_khevlekh",
+		[]AsmInstruction{
+			AllocateStack{Value: 48},
+			rtMovq(rtReg(SP), rtReg(R10)),
+			AsmMov{Type: rtF64, Src: rtReg(XMM0), Dst: rtReg(AX)},
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_positive"},
+		},
+		rtPutChar('-'),
+		[]AsmInstruction{
+			rtMovq(Imm{Value: math.MinInt64}, rtReg(R11)),
+			rtBinq(Xor, rtReg(R11), rtReg(AX)),
+			AsmMov{Type: rtF64, Src: rtReg(AX), Dst: rtReg(XMM0)},
+			Label{Ident: "mon_rt_dbl_positive"},
+			// with the sign cleared the bits order like the values, all
+			// exponent bits set is infinity or nan
+			rtMovq(Imm{Value: 0x7ff0000000000000}, rtReg(R11)),
+			rtCmpq(rtReg(R11), rtReg(AX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_finite"},
+			JmpCC{CC: E, Ident: "mon_rt_dbl_inf"},
+		},
+		rtPutChar('n'), rtPutChar('a'), rtPutChar('n'),
+		[]AsmInstruction{
+			Jmp{Ident: "mon_rt_dbl_write"},
+			Label{Ident: "mon_rt_dbl_inf"},
+		},
+		rtPutChar('i'), rtPutChar('n'), rtPutChar('f'),
+		[]AsmInstruction{
+			Jmp{Ident: "mon_rt_dbl_write"},
+			Label{Ident: "mon_rt_dbl_finite"},
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dbl_nonzero"},
+		},
+		rtPutChar('0'),
+		[]AsmInstruction{
+			Jmp{Ident: "mon_rt_dbl_write"},
+			Label{Ident: "mon_rt_dbl_nonzero"},
+			rtMovq(Imm{Value: 0}, rtReg(CX)),
+		},
+		rtLoadDouble(10, XMM1),
+		rtLoadDouble(1, XMM2),
+		[]AsmInstruction{
+			AsmMov{Type: rtF64, Src: rtReg(XMM0), Dst: rtReg(XMM4)},
+			Label{Ident: "mon_rt_dbl_down"},
+			Cmp{Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+			JmpCC{CC: B, Ident: "mon_rt_dbl_up"},
+			AsmBinary{Op: DivSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dbl_down"},
+			Label{Ident: "mon_rt_dbl_up"},
+			Cmp{Type: rtF64, Src: rtReg(XMM2), Dst: rtReg(XMM0)},
+			JmpCC{CC: AE, Ident: "mon_rt_dbl_scaled"},
+			AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+			rtBinq(Sub, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dbl_up"},
+			Label{Ident: "mon_rt_dbl_scaled"},
+			// every step above rounds, so the six digits are taken from the
+			// number itself while the power of ten is still exact
+			rtMovq(rtReg(CX), rtReg(DX)),
+			rtBinq(Sub, Imm{Value: 5}, rtReg(DX)),
+			rtCmpq(Imm{Value: 0}, rtReg(DX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_power"},
+			Unary{Type: rtQuad, Op: Neg, Dst: rtReg(DX)},
+			Label{Ident: "mon_rt_dbl_power"},
+			rtCmpq(Imm{Value: 22}, rtReg(DX)),
+			JmpCC{CC: G, Ident: "mon_rt_dbl_inexact"},
+			AsmMov{Type: rtF64, Src: rtReg(XMM2), Dst: rtReg(XMM3)},
+			Label{Ident: "mon_rt_dbl_power_loop"},
+			rtCmpq(Imm{Value: 0}, rtReg(DX)),
+			JmpCC{CC: E, Ident: "mon_rt_dbl_power_done"},
+			AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM3)},
+			rtBinq(Sub, Imm{Value: 1}, rtReg(DX)),
+			Jmp{Ident: "mon_rt_dbl_power_loop"},
+			Label{Ident: "mon_rt_dbl_power_done"},
+			AsmMov{Type: rtF64, Src: rtReg(XMM4), Dst: rtReg(XMM0)},
+			rtCmpq(Imm{Value: 5}, rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_small"},
+			AsmBinary{Op: DivSD, Type: rtF64, Src: rtReg(XMM3), Dst: rtReg(XMM0)},
+			Jmp{Ident: "mon_rt_dbl_round"},
+			Label{Ident: "mon_rt_dbl_small"},
+			AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM3), Dst: rtReg(XMM0)},
+			Jmp{Ident: "mon_rt_dbl_round"},
+			Label{Ident: "mon_rt_dbl_inexact"},
+		},
+		rtLoadDouble(1e5, XMM3),
+		[]AsmInstruction{
+			AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM3), Dst: rtReg(XMM0)},
+			Label{Ident: "mon_rt_dbl_round"},
+		},
+		rtLoadDouble(0.5, XMM3),
+		[]AsmInstruction{
+			AsmBinary{Op: AddSD, Type: rtF64, Src: rtReg(XMM3), Dst: rtReg(XMM0)},
+			Cvttsd2si{Type: rtQuad, Src: rtReg(XMM0), Dst: rtReg(R8)},
+			// 9.999995 rounds up to the next power of ten
+			rtCmpq(Imm{Value: 1000000}, rtReg(R8)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_rounded"},
+			rtMovq(Imm{Value: 100000}, rtReg(R8)),
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Label{Ident: "mon_rt_dbl_rounded"},
+			rtMovq(rtReg(CX), exponent),
+			rtMovq(Imm{Value: 6}, rtReg(DI)),
+			Label{Ident: "mon_rt_dbl_strip"},
+			rtCmpq(Imm{Value: 1}, rtReg(DI)),
+			JmpCC{CC: E, Ident: "mon_rt_dbl_form"},
+			rtMovq(rtReg(R8), rtReg(AX)),
+			rtMovq(Imm{Value: 10}, rtReg(R11)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R11)},
+			rtCmpq(Imm{Value: 0}, rtReg(DX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dbl_form"},
+			rtMovq(rtReg(AX), rtReg(R8)),
+			rtBinq(Sub, Imm{Value: 1}, rtReg(DI)),
+			Jmp{Ident: "mon_rt_dbl_strip"},
+			Label{Ident: "mon_rt_dbl_form"},
+			rtMovq(Imm{Value: 1}, rtReg(SI)),
+			rtCmpq(Imm{Value: -4}, rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_digits"},
+			rtCmpq(Imm{Value: 6}, rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_digits"},
+			rtMovq(rtReg(CX), rtReg(SI)),
+			rtBinq(Add, Imm{Value: 1}, rtReg(SI)),
+			rtCmpq(Imm{Value: 0}, rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_digits"},
+		},
+		// 0.00ddd has no point among the digits
+		rtPutChar('0'), rtPutChar('.'),
+		[]AsmInstruction{
+			rtMovq(Imm{Value: -1}, rtReg(SI)),
+			Label{Ident: "mon_rt_dbl_zeros"},
+			rtCmpq(Imm{Value: -1}, rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_digits"},
+		},
+		rtPutChar('0'),
+		[]AsmInstruction{
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dbl_zeros"},
+			Label{Ident: "mon_rt_dbl_digits"},
+			rtMovq(Imm{Value: 1}, rtReg(R9)),
+			rtMovq(Imm{Value: 1}, rtReg(CX)),
+			Label{Ident: "mon_rt_dbl_place"},
+			rtCmpq(rtReg(DI), rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_placed"},
+			rtBinq(Mult, Imm{Value: 10}, rtReg(R9)),
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dbl_place"},
+			Label{Ident: "mon_rt_dbl_placed"},
+			rtMovq(Imm{Value: 0}, rtReg(CX)),
+			// digits run to the last significant one or to the point,
+			// whichever comes later, 1500 pads with zeros
+			Label{Ident: "mon_rt_dbl_loop"},
+			rtCmpq(rtReg(DI), rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_body"},
+			rtCmpq(rtReg(SI), rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dbl_exp"},
+			Label{Ident: "mon_rt_dbl_body"},
+			rtCmpq(rtReg(SI), rtReg(CX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dbl_nopoint"},
+		},
+		rtPutChar('.'),
+		[]AsmInstruction{
+			Label{Ident: "mon_rt_dbl_nopoint"},
+			rtCmpq(rtReg(DI), rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_digit"},
+		},
+		rtPutChar('0'),
+		[]AsmInstruction{
+			Jmp{Ident: "mon_rt_dbl_next"},
+			Label{Ident: "mon_rt_dbl_digit"},
+			rtMovq(rtReg(R8), rtReg(AX)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R9)},
+			rtMovq(rtReg(DX), rtReg(R8)),
+		},
+		rtPutDigit(AX),
+		[]AsmInstruction{
+			rtMovq(rtReg(R9), rtReg(AX)),
+			rtMovq(Imm{Value: 10}, rtReg(R11)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R11)},
+			rtMovq(rtReg(AX), rtReg(R9)),
+			Label{Ident: "mon_rt_dbl_next"},
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dbl_loop"},
+			Label{Ident: "mon_rt_dbl_exp"},
+			rtMovq(exponent, rtReg(CX)),
+			rtCmpq(Imm{Value: -4}, rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_e"},
+			rtCmpq(Imm{Value: 6}, rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_write"},
+			Label{Ident: "mon_rt_dbl_e"},
+		},
+		rtPutChar('e'),
+		[]AsmInstruction{
+			rtCmpq(Imm{Value: 0}, rtReg(CX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_eneg"},
+		},
+		rtPutChar('+'),
+		[]AsmInstruction{
+			Jmp{Ident: "mon_rt_dbl_edigits"},
+			Label{Ident: "mon_rt_dbl_eneg"},
+		},
+		rtPutChar('-'),
+		[]AsmInstruction{
+			Unary{Type: rtQuad, Op: Neg, Dst: rtReg(CX)},
+			// the exponent has at least two digits
+			Label{Ident: "mon_rt_dbl_edigits"},
+			rtMovq(rtReg(CX), rtReg(AX)),
+			rtCmpq(Imm{Value: 100}, rtReg(AX)),
+			JmpCC{CC: L, Ident: "mon_rt_dbl_etwo"},
+			rtMovq(Imm{Value: 100}, rtReg(R11)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R11)},
+		},
+		rtPutDigit(AX),
+		[]AsmInstruction{
+			rtMovq(rtReg(DX), rtReg(AX)),
+			Label{Ident: "mon_rt_dbl_etwo"},
+			rtMovq(Imm{Value: 10}, rtReg(R11)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R11)},
+		},
+		rtPutDigit(AX),
+		rtPutDigit(DX),
+		[]AsmInstruction{
+			Label{Ident: "mon_rt_dbl_write"},
+			rtMovq(rtReg(SP), rtReg(SI)),
+			rtMovq(rtReg(R10), rtReg(DX)),
+			rtBinq(Sub, rtReg(SP), rtReg(DX)),
+		},
+		rtWrite(),
+		[]AsmInstruction{Return{}},
+	)
+}
+
+// бутархай_унш reads like scanf("%lf"): white space, a sign, digits with
+// an optional fraction and an optional exponent. The digits are summed as
+// a бутархай in -8(%rbp), -24(%rbp) counts the digits after the point and
+// -32(%rbp) holds the exponent, the scaling by ten happens once at the end.
+func rtButarkhayUnsh() AsmFnDef {
+	value, negative := Stack{Value: -8}, Stack{Value: -16}
+	fraction, exponent, expNegative := Stack{Value: -24}, Stack{Value: -32}, Stack{Value: -40}
+	// addDigit folds the digit in eax into value
+	addDigit := []AsmInstruction{
+		AsmBinary{Op: Sub, Type: rtLong, Src: Imm{Value: '0'}, Dst: rtReg(AX)},
+		AsmMov{Type: rtF64, Src: value, Dst: rtReg(XMM0)},
+	}
+	addDigit = append(addDigit, rtLoadDouble(10, XMM1)...)
+	addDigit = append(addDigit,
+		AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+		Cvtsi2sd{Type: rtLong, Src: rtReg(AX), Dst: rtReg(XMM1)},
+		AsmBinary{Op: AddSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+		AsmMov{Type: rtF64, Src: rtReg(XMM0), Dst: value},
+	)
+	isDigit := func(done string) []AsmInstruction {
+		return []AsmInstruction{
+			rtCmpl(Imm{Value: '0'}, rtReg(AX)),
+			JmpCC{CC: L, Ident: done},
+			rtCmpl(Imm{Value: '9'}, rtReg(AX)),
+			JmpCC{CC: G, Ident: done},
+		}
+	}
+	return rtFn("butarkhay_unsh",
+		[]AsmInstruction{
+			AllocateStack{Value: 48},
+			Label{Ident: "mon_rt_dunsh_space"},
+			Call{Ident: "mon_rt_getc"},
+			rtCmpl(Imm{Value: -1}, rtReg(AX)),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_eof"},
+			rtCmpl(Imm{Value: ' '}, rtReg(AX)),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_space"},
+			rtCmpl(Imm{Value: '\t'}, rtReg(AX)),
+			JmpCC{CC: L, Ident: "mon_rt_dunsh_sign"},
+			rtCmpl(Imm{Value: '\r'}, rtReg(AX)),
+			JmpCC{CC: LE, Ident: "mon_rt_dunsh_space"},
+			Label{Ident: "mon_rt_dunsh_sign"},
+			rtMovq(Imm{Value: 0}, negative),
+			rtMovq(Imm{Value: 0}, value),
+			rtMovq(Imm{Value: 0}, fraction),
+			rtMovq(Imm{Value: 0}, exponent),
+			rtMovq(Imm{Value: 0}, expNegative),
+			rtCmpl(Imm{Value: '-'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_plus"},
+			rtMovq(Imm{Value: 1}, negative),
+			Call{Ident: "mon_rt_getc"},
+			Jmp{Ident: "mon_rt_dunsh_int"},
+			Label{Ident: "mon_rt_dunsh_plus"},
+			rtCmpl(Imm{Value: '+'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_int"},
+			Call{Ident: "mon_rt_getc"},
+			Label{Ident: "mon_rt_dunsh_int"},
+		},
+		isDigit("mon_rt_dunsh_point"),
+		addDigit,
+		[]AsmInstruction{
+			Call{Ident: "mon_rt_getc"},
+			Jmp{Ident: "mon_rt_dunsh_int"},
+			Label{Ident: "mon_rt_dunsh_point"},
+			rtCmpl(Imm{Value: '.'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_e"},
+			Call{Ident: "mon_rt_getc"},
+			Label{Ident: "mon_rt_dunsh_fraction"},
+		},
+		isDigit("mon_rt_dunsh_e"),
+		addDigit,
+		[]AsmInstruction{
+			rtBinq(Add, Imm{Value: 1}, fraction),
+			Call{Ident: "mon_rt_getc"},
+			Jmp{Ident: "mon_rt_dunsh_fraction"},
+			Label{Ident: "mon_rt_dunsh_e"},
+			rtCmpl(Imm{Value: 'e'}, rtReg(AX)),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_esign"},
+			rtCmpl(Imm{Value: 'E'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_done"},
+			Label{Ident: "mon_rt_dunsh_esign"},
+			Call{Ident: "mon_rt_getc"},
+			rtCmpl(Imm{Value: '-'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_eplus"},
+			rtMovq(Imm{Value: 1}, expNegative),
+			Call{Ident: "mon_rt_getc"},
+			Jmp{Ident: "mon_rt_dunsh_edigits"},
+			Label{Ident: "mon_rt_dunsh_eplus"},
+			rtCmpl(Imm{Value: '+'}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_dunsh_edigits"},
+			Call{Ident: "mon_rt_getc"},
+			Label{Ident: "mon_rt_dunsh_edigits"},
+		},
+		isDigit("mon_rt_dunsh_done"),
+		[]AsmInstruction{
+			AsmBinary{Op: Sub, Type: rtLong, Src: Imm{Value: '0'}, Dst: rtReg(AX)},
+			rtMovq(exponent, rtReg(CX)),
+			rtBinq(Mult, Imm{Value: 10}, rtReg(CX)),
+			rtBinq(Add, rtReg(AX), rtReg(CX)),
+			rtMovq(rtReg(CX), exponent),
+			Call{Ident: "mon_rt_getc"},
+			Jmp{Ident: "mon_rt_dunsh_edigits"},
+			Label{Ident: "mon_rt_dunsh_done"},
+			rtMovq(exponent, rtReg(CX)),
+			rtCmpq(Imm{Value: 0}, expNegative),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_scale"},
+			Unary{Type: rtQuad, Op: Neg, Dst: rtReg(CX)},
+			Label{Ident: "mon_rt_dunsh_scale"},
+			rtBinq(Sub, fraction, rtReg(CX)),
+			AsmMov{Type: rtF64, Src: value, Dst: rtReg(XMM0)},
+		},
+		rtLoadDouble(10, XMM1),
+		[]AsmInstruction{
+			Label{Ident: "mon_rt_dunsh_down"},
+			rtCmpq(Imm{Value: 0}, rtReg(CX)),
+			JmpCC{CC: GE, Ident: "mon_rt_dunsh_up"},
+			AsmBinary{Op: DivSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+			rtBinq(Add, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dunsh_down"},
+			Label{Ident: "mon_rt_dunsh_up"},
+			rtCmpq(Imm{Value: 0}, rtReg(CX)),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_sign_out"},
+			AsmBinary{Op: MulSD, Type: rtF64, Src: rtReg(XMM1), Dst: rtReg(XMM0)},
+			rtBinq(Sub, Imm{Value: 1}, rtReg(CX)),
+			Jmp{Ident: "mon_rt_dunsh_up"},
+			Label{Ident: "mon_rt_dunsh_sign_out"},
+			rtCmpq(Imm{Value: 0}, negative),
+			JmpCC{CC: E, Ident: "mon_rt_dunsh_return"},
+			AsmMov{Type: rtF64, Src: rtReg(XMM0), Dst: rtReg(AX)},
+			rtMovq(Imm{Value: math.MinInt64}, rtReg(R11)),
+			rtBinq(Xor, rtReg(R11), rtReg(AX)),
+			AsmMov{Type: rtF64, Src: rtReg(AX), Dst: rtReg(XMM0)},
+			Label{Ident: "mon_rt_dunsh_return"},
+			Return{},
+			Label{Ident: "mon_rt_dunsh_eof"},
+			rtMovq(Imm{Value: 0}, rtReg(AX)),
+			AsmMov{Type: rtF64, Src: rtReg(AX), Dst: rtReg(XMM0)},
+			Return{},
+		},
+	)
+}
+
+// санамсаргүйТоо: a 64-bit LCG seeded from the clock on the first call, the
+// upper half of the state is taken modulo n.
+func rtRandom() AsmFnDef {
+	state := RipRelative{Label: "mon_rt_rand_state"}
+	return rtFn("sanamsargwyToo",
+		[]AsmInstruction{
+			AsmMovSx{Src: rtReg(DI), Dst: rtReg(R8)},
+			rtMovq(state, rtReg(AX)),
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: NE, Ident: "mon_rt_random_step"},
+			rtMovq(Imm{Value: 0}, rtReg(DI)),
+		},
+		rtSyscall(sysTime),
+		[]AsmInstruction{
+			Label{Ident: "mon_rt_random_step"},
+			rtMovq(Imm{Value: 6364136223846793005}, rtReg(CX)),
+			rtBinq(Mult, rtReg(CX), rtReg(AX)),
+			rtMovq(Imm{Value: 1442695040888963407}, rtReg(CX)),
+			rtBinq(Add, rtReg(CX), rtReg(AX)),
+			rtMovq(rtReg(AX), state),
+			rtMovq(Imm{Value: 1 << 32}, rtReg(CX)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(CX)},
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(R8)},
+			rtCmpq(Imm{Value: 0}, rtReg(DX)),
+			JmpCC{CC: GE, Ident: "mon_rt_random_positive"},
+			rtBinq(Add, rtReg(R8), rtReg(DX)),
+			Label{Ident: "mon_rt_random_positive"},
+			rtMovq(rtReg(DX), rtReg(AX)),
+			rtBinq(Add, Imm{Value: 1}, rtReg(AX)),
+			Return{},
+		},
+	)
+}
+
+// хүлээх: nanosleep with the timespec on the stack.
+func rtSleep() AsmFnDef {
+	return rtFn("khwleekh",
+		[]AsmInstruction{
+			AllocateStack{Value: 16},
+			AsmMovSx{Src: rtReg(DI), Dst: rtReg(AX)},
+			rtMovq(Imm{Value: 1000}, rtReg(CX)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(CX)},
+			rtMovq(rtReg(AX), Stack{Value: -16}),
+			rtBinq(Mult, Imm{Value: 1000000}, rtReg(DX)),
+			rtMovq(rtReg(DX), Stack{Value: -8}),
+			rtMovq(rtReg(SP), rtReg(DI)),
+			rtMovq(Imm{Value: 0}, rtReg(SI)),
+		},
+		rtSyscall(sysNanosleep),
+		[]AsmInstruction{Return{}},
+	)
+}
+
+// malloc hands out 16-byte aligned blocks from the current mapping and maps
+// a new one when it does not fit. mmap memory starts out zeroed.
+func rtMalloc() AsmFnDef {
+	cur, end := RipRelative{Label: "mon_rt_heap_cur"}, RipRelative{Label: "mon_rt_heap_end"}
+	size, length := Stack{Value: -8}, Stack{Value: -16}
+	return rtFn("malloc",
+		[]AsmInstruction{
+			AllocateStack{Value: 16},
+			rtMovq(rtReg(DI), rtReg(AX)),
+			rtBinq(Add, Imm{Value: 15}, rtReg(AX)),
+			rtMovq(Imm{Value: 16}, rtReg(CX)),
+			Cdq{Type: rtQuad},
+			Idiv{Type: rtQuad, Src: rtReg(CX)},
+			rtBinq(Mult, Imm{Value: 16}, rtReg(AX)),
+			rtMovq(rtReg(AX), rtReg(DI)),
+			rtMovq(cur, rtReg(AX)),
+			rtMovq(rtReg(AX), rtReg(CX)),
+			rtBinq(Add, rtReg(DI), rtReg(CX)),
+			rtCmpq(end, rtReg(CX)),
+			JmpCC{CC: G, Ident: "mon_rt_malloc_grow"},
+			rtMovq(rtReg(CX), cur),
+			Return{},
+			Label{Ident: "mon_rt_malloc_grow"},
+			rtMovq(Imm{Value: heapChunk}, rtReg(SI)),
+			rtCmpq(rtReg(SI), rtReg(DI)),
+			JmpCC{CC: LE, Ident: "mon_rt_malloc_map"},
+			rtMovq(rtReg(DI), rtReg(SI)),
+			Label{Ident: "mon_rt_malloc_map"},
+			rtMovq(rtReg(DI), size),
+			rtMovq(rtReg(SI), length),
+			// mmap(NULL, length, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS, -1, 0)
+			rtMovq(Imm{Value: 0}, rtReg(DI)),
+			rtMovq(Imm{Value: 3}, rtReg(DX)),
+			rtMovq(Imm{Value: 0x22}, rtReg(R10)),
+			rtMovq(Imm{Value: -1}, rtReg(R8)),
+			rtMovq(Imm{Value: 0}, rtReg(R9)),
+		},
+		rtSyscall(sysMmap),
+		[]AsmInstruction{
+			rtCmpq(Imm{Value: 0}, rtReg(AX)),
+			JmpCC{CC: L, Ident: "mon_rt_malloc_fail"},
+			rtMovq(rtReg(AX), rtReg(CX)),
+			rtBinq(Add, length, rtReg(CX)),
+			rtMovq(rtReg(CX), end),
+			rtMovq(rtReg(AX), rtReg(CX)),
+			rtBinq(Add, size, rtReg(CX)),
+			rtMovq(rtReg(CX), cur),
+			Return{},
+			// out of memory, exit with ENOMEM
+			Label{Ident: "mon_rt_malloc_fail"},
+			rtMovq(Imm{Value: 12}, rtReg(DI)),
+		},
+		rtSyscall(sysExit),
+	)
+}
@@ -0,0 +1,188 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/your-moon/mon_lang/code_gen/asmtype"
+)
+
+// AsmSyntax is the assembler dialect GenAsm writes, chosen with
+// --asm-syntax. The instructions are the same in all of them, only the
+// spelling differs:
+//
+//	att:   movl -4(%rbp), %eax            GNU as, the default
+//	intel: mov eax, dword ptr [rbp - 4]   GNU as after .intel_syntax noprefix
+//	nasm:  mov eax, dword [rbp - 4]       NASM, with its own directives
+type AsmSyntax string
+
+const (
+	ATT   AsmSyntax = "att"
+	Intel AsmSyntax = "intel"
+	NASM  AsmSyntax = "nasm"
+)
+
+func ParseAsmSyntax(name string) (AsmSyntax, error) {
+	switch AsmSyntax(name) {
+	case ATT, Intel, NASM:
+		return AsmSyntax(name), nil
+	}
+	return "", fmt.Errorf("тодорхойгүй assembly бичлэг: %s (att, intel, nasm)", name)
+}
+
+// intelOrder reports whether the destination comes first and registers go
+// without %, as in both Intel dialects.
+func (a *AsmGen) intelOrder() bool {
+	return a.Syntax == Intel || a.Syntax == NASM
+}
+
+// instr writes one instruction. operands are in AT&T order, source first,
+// and t gives AT&T its size suffix, nil for none.
+func (a *AsmGen) instr(mnemonic string, t asmtype.AsmType, operands ...string) {
+	if a.intelOrder() {
+		for i, j := 0, len(operands)-1; i < j; i, j = i+1, j-1 {
+			operands[i], operands[j] = operands[j], operands[i]
+		}
+	} else if t != nil {
+		mnemonic += a.GenType(t)
+	}
+	if len(operands) == 0 {
+		a.Write("    " + mnemonic)
+		return
+	}
+	a.Write(fmt.Sprintf("    %s %s", mnemonic, strings.Join(operands, ", ")))
+}
+
+// pick returns the AT&T or the Intel spelling of a mnemonic, for the few
+// that differ by more than the suffix.
+func (a *AsmGen) pick(att string, intel string) string {
+	if a.intelOrder() {
+		return intel
+	}
+	return att
+}
+
+func (a *AsmGen) reg(name string) string {
+	if a.intelOrder() {
+		return name
+	}
+	return "%" + name
+}
+
+func (a *AsmGen) imm(value int64) string {
+	if a.intelOrder() {
+		return fmt.Sprintf("%d", value)
+	}
+	return fmt.Sprintf("$%d", value)
+}
+
+// sizeKeyword is what Intel syntax puts before a memory operand, AT&T gets
+// the size from the suffix instead.
+func (a *AsmGen) sizeKeyword(t asmtype.AsmType) string {
+	var size string
+	switch t.(type) {
+	case *asmtype.Byte:
+		size = "byte"
+	case *asmtype.LongWord:
+		size = "dword"
+	default:
+		size = "qword"
+	}
+	if a.Syntax == Intel {
+		size += " ptr"
+	}
+	return size + " "
+}
+
+// mem is disp(%base), base a 64-bit register name.
+func (a *AsmGen) mem(base string, disp int, t asmtype.AsmType) string {
+	if !a.intelOrder() {
+		if disp == 0 {
+			return fmt.Sprintf("(%%%s)", base)
+		}
+		return fmt.Sprintf("%d(%%%s)", disp, base)
+	}
+	switch {
+	case disp < 0:
+		return fmt.Sprintf("%s[%s - %d]", a.sizeKeyword(t), base, -disp)
+	case disp > 0:
+		return fmt.Sprintf("%s[%s + %d]", a.sizeKeyword(t), base, disp)
+	}
+	return fmt.Sprintf("%s[%s]", a.sizeKeyword(t), base)
+}
+
+// indexed is the memory at base + index*scale, both 64-bit register names.
+func (a *AsmGen) indexed(base string, index string, scale int, t asmtype.AsmType) string {
+	if !a.intelOrder() {
+		return fmt.Sprintf("(%%%s,%%%s,%d)", base, index, scale)
+	}
+	return fmt.Sprintf("%s[%s + %s*%d]", a.sizeKeyword(t), base, index, scale)
+}
+
+// rip is the memory at label, relative to rip. A nil t leaves out the size,
+// as lea takes only the address.
+func (a *AsmGen) rip(label string, t asmtype.AsmType) string {
+	size := ""
+	if t != nil && a.intelOrder() {
+		size = a.sizeKeyword(t)
+	}
+	switch a.Syntax {
+	case Intel:
+		return fmt.Sprintf("%s[rip + %s]", size, label)
+	case NASM:
+		return fmt.Sprintf("%s[rel %s]", size, label)
+	}
+	return label + "(%rip)"
+}
+
+// directive spells the GNU directive name the way the syntax wants it, NASM
+// has its own names for the ones the code generator uses.
+func (a *AsmGen) directive(name string, args string) {
+	if a.Syntax == NASM {
+		nasmNames := map[string]string{
+			".globl":  "global",
+			".extern": "extern",
+			".align":  "align",
+			".quad":   "dq",
+			".long":   "dd",
+			".byte":   "db",
+			".text":   "section .text",
+			".data":   "section .data",
+		}
+		trimmed := strings.TrimLeft(name, " ")
+		name = name[:len(name)-len(trimmed)] + nasmNames[trimmed]
+	}
+	if args == "" {
+		a.Write(name)
+		return
+	}
+	a.Write(name + " " + args)
+}
+
+// nasmString is a NASM backquoted string, which takes C escapes.
+func nasmString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('`')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			buf.WriteString("\\n")
+		case '\t':
+			buf.WriteString("\\t")
+		case '`':
+			buf.WriteString("\\`")
+		case '\\':
+			buf.WriteString("\\\\")
+		case 0:
+			buf.WriteString("\\0")
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&buf, "\\x%02x", r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('`')
+	return buf.String()
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/your-moon/mon_lang/base"
 	"github.com/your-moon/mon_lang/code_gen/asmtype"
 	"github.com/your-moon/mon_lang/util"
+	"github.com/your-moon/mon_lang/util/utfconvert"
 )
 
 type OsType string
@@ -33,6 +34,21 @@ type AsmGen struct {
 	currentFn       string
 	strings         map[string]int
 	stringCount     int
+	// set by EnableDebugInfo for -g
+	debugFile    string
+	debugCompDir string
+	fileNumbers  map[string]int
+	currentFile  int
+	// NoLibc names the entry _start for a static link with ld, the program
+	// must already carry the runtime from AddRuntime
+	NoLibc bool
+	// Syntax is the assembler dialect, AT&T when empty
+	Syntax AsmSyntax
+	// Shared leaves out main and exports the тунх functions for a shared
+	// library
+	Shared bool
+	// numbers the tables of JmpTable
+	tableCount int
 }
 
 func NewGenASM(writer io.Writer, osType util.OsType) AsmGen {
@@ -43,6 +59,13 @@ func NewGenASM(writer io.Writer, osType util.OsType) AsmGen {
 	}
 }
 
+// EnableDebugInfo makes GenAsm write line tables and DWARF debug info for
+// functions that carry FnDebugInfo. sourceFile is the file being compiled.
+func (a *AsmGen) EnableDebugInfo(sourceFile string, compDir string) {
+	a.debugFile = sourceFile
+	a.debugCompDir = compDir
+}
+
 func (a *AsmGen) AddString(value string) string {
 	if base.Debug {
 		fmt.Printf("[DEBUG] AddString: '%s'\n", value)
@@ -54,11 +77,20 @@ func (a *AsmGen) AddString(value string) string {
 	}
 
 	if id, exists := a.strings[value]; exists {
-		return fmt.Sprintf(".LC%d", id)
+		return a.stringLabel(id)
 	}
 	id := a.stringCount
 	a.strings[value] = id
 	a.stringCount++
+	return a.stringLabel(id)
+}
+
+// stringLabel names a string constant. A NASM label starting with a single
+// dot belongs to the function before it, ..@ keeps it out of that scheme.
+func (a *AsmGen) stringLabel(id int) string {
+	if a.Syntax == NASM {
+		return fmt.Sprintf("..@LC%d", id)
+	}
 	return fmt.Sprintf(".LC%d", id)
 }
 
@@ -89,7 +121,9 @@ func (a *AsmGen) GenStringData() {
 	}
 
 	// Use .section .rodata for read-only data
-	if a.ostype == util.Darwin {
+	if a.Syntax == NASM {
+		a.Write("section .rodata")
+	} else if a.ostype == util.Darwin {
 		a.Write(".section __TEXT,__cstring,cstring_literals")
 	} else {
 		a.Write(".section .rodata")
@@ -109,9 +143,12 @@ func (a *AsmGen) GenStringData() {
 	})
 
 	for _, e := range entries {
-		label := fmt.Sprintf(".LC%d", e.id)
-		a.Write(fmt.Sprintf("%s:", label))
-		a.Write(fmt.Sprintf("    .asciz \"%s\"", escapeForAsm(e.value)))
+		a.Write(fmt.Sprintf("%s:", a.stringLabel(e.id)))
+		if a.Syntax == NASM {
+			a.Write(fmt.Sprintf("    db %s, 0", nasmString(e.value)))
+		} else {
+			a.Write(fmt.Sprintf("    .asciz \"%s\"", escapeForAsm(e.value)))
+		}
 	}
 	a.Write("")
 }
@@ -120,7 +157,7 @@ func (a *AsmGen) GenGlobalVarData(globalVars []GlobalVarAsm) {
 	if len(globalVars) == 0 {
 		return
 	}
-	a.Write(".data")
+	a.directive(".data", "")
 	for _, gv := range globalVars {
 		var label string
 		if a.ostype == util.Darwin {
@@ -128,16 +165,15 @@ func (a *AsmGen) GenGlobalVarData(globalVars []GlobalVarAsm) {
 		} else {
 			label = gv.Label
 		}
-		if gv.Size == 8 {
-			a.Write(fmt.Sprintf(".align 8"))
-		} else {
-			a.Write(fmt.Sprintf(".align 4"))
-		}
+		a.directive(".align", fmt.Sprintf("%d", gv.Size))
 		a.Write(fmt.Sprintf("%s:", label))
-		if gv.Size == 8 {
-			a.Write(fmt.Sprintf("    .quad %d", gv.InitValue))
-		} else {
-			a.Write(fmt.Sprintf("    .long %d", gv.InitValue))
+		switch gv.Size {
+		case 8:
+			a.directive("    .quad", fmt.Sprintf("%d", gv.InitValue))
+		case 1:
+			a.directive("    .byte", fmt.Sprintf("%d", gv.InitValue))
+		default:
+			a.directive("    .long", fmt.Sprintf("%d", gv.InitValue))
 		}
 	}
 	a.Write("")
@@ -157,131 +193,278 @@ func (a *AsmGen) GenAsm(program AsmProgram) {
 		}
 	}
 
+	if a.Syntax == Intel {
+		a.Write(".intel_syntax noprefix")
+	}
 	a.GenStringData()
 	a.GenGlobalVarData(program.GlobalVars)
 
-	a.Write(".text")
+	a.directive(".text", "")
+	if a.debugFile != "" {
+		a.Write(".Ltext0:")
+		a.fileNumbers = a.debugFileNumbers(program.AsmFnDef)
+		files := make([]string, len(a.fileNumbers))
+		for file, number := range a.fileNumbers {
+			files[number-1] = file
+		}
+		files[0] = a.debugFile
+		for i, file := range files {
+			a.Write(fmt.Sprintf(".file %d \"%s\"", i+1, escapeForAsm(file)))
+		}
+	}
 
+	defined := map[string]bool{}
+	for _, fn := range program.AsmFnDef {
+		defined[fn.Ident] = true
+	}
 	for _, fn := range program.AsmExternFn {
+		// the runtime for --nolibc defines the prelude itself, NASM won't
+		// take a label that is also extern
+		if defined[fn.Name] {
+			continue
+		}
 		if a.ostype == util.Linux {
-			a.Write(fmt.Sprintf(".extern %s", fn.Name))
+			a.directive(".extern", fn.Name)
 		} else if a.ostype == util.Darwin {
-			a.Write(fmt.Sprintf(".extern _%s", fn.Name))
+			a.directive(".extern", "_"+fn.Name)
 		}
 	}
 
-	if a.ostype == util.Linux {
-		a.Write(".globl main")
-		a.Write("main:")
+	// a shared library has no entry
+	if !a.Shared {
+		a.genEntry()
+	}
 
-	} else if a.ostype == util.Darwin {
-		a.Write(".globl _main")
-		a.Write("_main:")
+	for _, fn := range program.AsmFnDef {
+		a.currentFn = fn.Ident
+		a.GenFn(fn)
+	}
+	if a.debugFile != "" {
+		a.Write(".Letext0:")
+		// Mach-O keeps DWARF in segments of its own, there only the line
+		// table from the .loc directives is written
+		if a.ostype == util.Linux {
+			a.GenDebugSections(program.AsmFnDef)
+		}
 	}
+	if a.Syntax == NASM && a.ostype == util.Linux {
+		a.Write("section .note.GNU-stack noalloc noexec nowrite progbits")
+	} else if a.ostype == util.Linux {
+		a.Write(".section note.GNU-stack,\"\",@progbits")
+	}
+}
 
+// genEntry writes main, or _start for --nolibc, which hands argc and argv
+// to the runtime, calls үндсэн with argv and exits with its result. With
+// libc the exit goes through exit so stdio gets flushed.
+func (a *AsmGen) genEntry() {
+	if a.ostype == util.Linux && !a.NoLibc {
+		a.directive(".extern", "mon_rt_args")
+		a.directive(".extern", "exit")
+	}
 	if a.ostype == util.Linux {
-		a.Write("    call wndsen")
-		a.Write("    movq %rax, %rdi")
-		a.Write("    movq $60, %rax")
-		a.Write("    syscall")
+		entry := "main"
+		if a.NoLibc {
+			entry = "_start"
+		}
+		a.directive(".globl", entry)
+		a.Write(entry + ":")
+
 	} else if a.ostype == util.Darwin {
-		a.Write("    call _wndsen")
-		a.Write("    ret")
+		a.directive(".globl", "_main")
+		a.Write("_main:")
 	}
 
-	for _, fn := range program.AsmFnDef {
-		a.currentFn = fn.Ident
-		a.GenFn(fn)
+	if a.NoLibc {
+		// the kernel leaves argc at the top of the stack, argv after it
+		a.instr("mov", &asmtype.QuadWord{}, a.mem("rsp", 0, &asmtype.QuadWord{}), a.reg("rdi"))
+		a.instr("lea", &asmtype.QuadWord{}, a.mem("rsp", 8, &asmtype.QuadWord{}), a.reg("rsi"))
+	} else {
+		// main is entered with the stack 8 bytes off the 16 calls need
+		a.instr("push", &asmtype.QuadWord{}, a.reg("rbp"))
+		a.instr("mov", &asmtype.QuadWord{}, a.reg("rsp"), a.reg("rbp"))
 	}
-	if a.ostype == util.Linux {
-		a.Write(".section note.GNU-stack,\"\",@progbits")
+	a.call("call", "mon_rt_args")
+	a.instr("mov", &asmtype.QuadWord{}, a.reg("rax"), a.reg("rdi"))
+	a.call("call", utfconvert.Mangle("үндсэн"))
+	a.instr("mov", &asmtype.LongWord{}, a.reg("eax"), a.reg("edi"))
+	if a.NoLibc {
+		a.instr("mov", &asmtype.QuadWord{}, a.imm(60), a.reg("rax"))
+		a.instr("syscall", nil)
+	} else {
+		a.call("call", "exit")
 	}
 }
 
 func (a *AsmGen) GenFn(fn AsmFnDef) {
+	if a.Shared && fn.Global {
+		a.export(fn.Ident)
+	}
 	if a.ostype == util.Linux {
 		a.Write(fmt.Sprintf("%s:", fn.Ident))
 	} else if a.ostype == util.Darwin {
 		a.Write(fmt.Sprintf("_%s:", fn.Ident))
 	}
-	a.Write("    pushq %rbp")
-	a.Write("    movq %rsp, %rbp")
+	if fn.Debug != nil {
+		a.currentFile = a.fileNumbers[fn.Debug.File]
+		a.Write(fmt.Sprintf("    .loc %d %d", a.currentFile, fn.Debug.Line))
+	}
+	a.instr("push", &asmtype.QuadWord{}, a.reg("rbp"))
+	a.instr("mov", &asmtype.QuadWord{}, a.reg("rsp"), a.reg("rbp"))
 	for _, instr := range fn.Irs {
 		a.GenInstr(instr)
 		a.currentInstrIdx += 1
 	}
+	if fn.Debug != nil {
+		a.Write(fmt.Sprintf(".Lfunc_end.%s:", fn.Ident))
+	}
 }
 
 func (a *AsmGen) GenInstr(instr AsmInstruction) {
+	quad := &asmtype.QuadWord{}
 	switch ast := instr.(type) {
 	case StringLiteral:
 		label := a.AddString(ast.Value)
-		a.Write(fmt.Sprintf("    leaq %s(%%rip), %%rax", label))
+		a.instr("lea", quad, a.rip(label, nil), a.reg("rax"))
 		return
 	case Push:
-		a.Write(fmt.Sprintf("    pushq %s", a.GenOperand(ast.Op, &asmtype.QuadWord{})))
+		a.instr("push", quad, a.GenOperand(ast.Op, quad))
+	case Pop:
+		a.instr("pop", quad, a.RegisterShow(Register{Reg: ast.Reg}, quad))
 	case Call:
-		if a.ostype == util.Linux {
-			a.Write(fmt.Sprintf("    call %s", ast.Ident))
-		} else if a.ostype == util.Darwin {
-			a.Write(fmt.Sprintf("    call _%s", ast.Ident))
-		}
+		a.call("call", ast.Ident)
+	case TailCall:
+		a.instr("mov", quad, a.reg("rbp"), a.reg("rsp"))
+		a.instr("pop", quad, a.reg("rbp"))
+		a.call("jmp", ast.Ident)
 	case Label:
 		a.Write(fmt.Sprintf(".L%s:", ast.Ident))
+	case Loc:
+		if a.currentFile != 0 {
+			a.Write(fmt.Sprintf("    .loc %d %d", a.currentFile, ast.Line))
+		}
 	case SetCC:
-		a.Write(fmt.Sprintf("    set%s %s", ast.CC, a.GenOperand(ast.Op, nil)))
+		a.instr("set"+string(ast.CC), nil, a.GenOperand(ast.Op, &asmtype.Byte{}))
 	case JmpCC:
 		a.Write(fmt.Sprintf("    j%s .L%s", ast.CC, ast.Ident))
 	case Jmp:
 		a.Write(fmt.Sprintf("    jmp .L%s", ast.Ident))
+	case JmpTable:
+		table := fmt.Sprintf(".L%s", jumpTableLabel(a.tableCount))
+		a.tableCount++
+		long := &asmtype.LongWord{}
+		a.instr("lea", quad, a.rip(table, nil), a.reg("r10"))
+		a.instr(a.pick("movslq", "movsxd"), nil, a.indexed("r10", "r11", 4, long), a.reg("r11"))
+		a.instr("add", quad, a.reg("r10"), a.reg("r11"))
+		a.instr("jmp", nil, a.pick("*%r11", "r11"))
+		a.Write(fmt.Sprintf("%s:", table))
+		for _, target := range ast.Targets {
+			a.directive("    .long", fmt.Sprintf(".L%s - %s", target, table))
+		}
 	case Cmp:
-		a.Write(fmt.Sprintf("    cmp%s %s, %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+		if isDoubleType(ast.Type) {
+			a.instr("comisd", nil, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
+			return
+		}
+		a.instr("cmp", ast.Type, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
 	case AsmBinary:
-		if ast.Op == Mult {
-			a.Write(fmt.Sprintf("    imul%s %s, %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type)))
-		} else if ast.Op == Add {
-			a.Write(fmt.Sprintf("    add%s %s, %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type)))
-		} else if ast.Op == Sub {
-			a.Write(fmt.Sprintf("    sub%s %s, %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+		if isDoubleType(ast.Type) {
+			a.instr(string(ast.Op), nil, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
+			return
+		}
+		mnemonics := map[AsmAstBinaryOp]string{Mult: "imul", Add: "add", Sub: "sub", Xor: "xor"}
+		if mnemonic, ok := mnemonics[ast.Op]; ok {
+			a.instr(mnemonic, ast.Type, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
 		}
 	case Cdq:
 		switch ast.Type.(type) {
 		case *asmtype.QuadWord:
-			a.Write("    cqo")
+			a.instr("cqo", nil)
 		case *asmtype.LongWord:
-			a.Write("    cdq")
+			a.instr("cdq", nil)
 
 		}
 	case Idiv:
-		a.Write(fmt.Sprintf("    idiv%s %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type)))
+		a.instr("idiv", ast.Type, a.GenOperand(ast.Src, ast.Type))
 	case AsmMov:
 		if strLit, isStrLit := ast.Src.(StringLiteral); isStrLit {
 			label := a.AddString(strLit.Value)
-			a.Write(fmt.Sprintf("    leaq %s(%%rip), %%rax", label))
-			if reg, isReg := ast.Dst.(Register); !isReg || reg.Reg != AX {
-				a.Write(fmt.Sprintf("    mov%s %%rax, %s", a.GenType(ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+			// registers can be allocated to anything but r10/r11, so the
+			// address goes straight into a register destination or through r11
+			if reg, isReg := ast.Dst.(Register); isReg {
+				a.instr("lea", quad, a.rip(label, nil), a.RegisterShow(reg, quad))
+			} else {
+				a.instr("lea", quad, a.rip(label, nil), a.reg("r11"))
+				a.instr("mov", ast.Type, a.reg("r11"), a.GenOperand(ast.Dst, ast.Type))
 			}
+		} else if isDoubleType(ast.Type) {
+			// movq between a general register and an XMM register
+			mnemonic := "movsd"
+			if isGeneralRegister(ast.Src) || isGeneralRegister(ast.Dst) {
+				mnemonic = "movq"
+			}
+			a.instr(mnemonic, nil, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
 		} else {
-			a.Write(fmt.Sprintf("    mov%s %s, %s", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+			a.instr("mov", ast.Type, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, ast.Type))
 		}
+	case Cvtsi2sd:
+		a.instr("cvtsi2sd", ast.Type, a.GenOperand(ast.Src, ast.Type), a.GenOperand(ast.Dst, &asmtype.Double{}))
+	case Cvttsd2si:
+		a.instr("cvttsd2si", nil, a.GenOperand(ast.Src, &asmtype.Double{}), a.GenOperand(ast.Dst, ast.Type))
 	case AsmMovSx:
-		a.Write(fmt.Sprintf("    movslq %s, %s", a.GenOperand(ast.Src, &asmtype.LongWord{}), a.GenOperand(ast.Dst, &asmtype.QuadWord{})))
+		a.instr(a.pick("movslq", "movsxd"), nil, a.GenOperand(ast.Src, &asmtype.LongWord{}), a.GenOperand(ast.Dst, quad))
+	case AsmMovZb:
+		a.instr(a.pick("movzb"+a.GenType(ast.Type), "movzx"), nil, a.GenOperand(ast.Src, &asmtype.Byte{}), a.GenOperand(ast.Dst, ast.Type))
 	case AsmLoadFromMem:
-		a.Write(fmt.Sprintf("    mov%s (%%r10), %s", a.GenType(ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+		if _, isByte := ast.Type.(*asmtype.Byte); isByte {
+			long := &asmtype.LongWord{}
+			a.instr(a.pick("movzbl", "movzx"), nil, a.mem("r10", 0, ast.Type), a.GenOperand(ast.Dst, long))
+			return
+		}
+		a.instr("mov", ast.Type, a.mem("r10", 0, ast.Type), a.GenOperand(ast.Dst, ast.Type))
 	case AsmStoreToMem:
-		a.Write(fmt.Sprintf("    mov%s %s, (%%r10)", a.GenType(ast.Type), a.GenOperand(ast.Src, ast.Type)))
+		a.instr("mov", ast.Type, a.GenOperand(ast.Src, ast.Type), a.mem("r10", 0, ast.Type))
+	case Syscall:
+		a.instr("syscall", nil)
 	case Return:
-		a.Write("    movq %rbp, %rsp")
-		a.Write("    popq %rbp")
-		a.Write("    ret")
+		a.instr("mov", quad, a.reg("rbp"), a.reg("rsp"))
+		a.instr("pop", quad, a.reg("rbp"))
+		a.instr("ret", nil)
 	case Unary:
-		a.Write(fmt.Sprintf("    %s%s %s", string(ast.Op), a.GenType(ast.Type), a.GenOperand(ast.Dst, ast.Type)))
+		a.instr(string(ast.Op), ast.Type, a.GenOperand(ast.Dst, ast.Type))
 	case AllocateStack:
-		a.Write(fmt.Sprintf("    subq $%d, %%rsp", ast.Value))
+		a.instr("sub", quad, a.imm(int64(ast.Value)), a.reg("rsp"))
 		a.Write("")
 	}
 }
 
+// export makes a function visible outside the shared library.
+func (a *AsmGen) export(ident string) {
+	switch {
+	case a.ostype == util.Darwin:
+		a.directive(".globl", "_"+ident)
+	case a.Syntax == NASM:
+		a.Write(fmt.Sprintf("global %s:function", ident))
+	default:
+		a.Write(".globl " + ident)
+		a.Write(fmt.Sprintf(".type %s, @function", ident))
+	}
+}
+
+// call writes a call or jmp to a function. Mach-O symbols carry a leading
+// underscore, and NASM has to be told to go through the PLT for functions
+// in libc.
+func (a *AsmGen) call(mnemonic string, ident string) {
+	switch {
+	case a.ostype == util.Darwin:
+		a.Write(fmt.Sprintf("    %s _%s", mnemonic, ident))
+	case a.Syntax == NASM:
+		a.Write(fmt.Sprintf("    %s %s wrt ..plt", mnemonic, ident))
+	default:
+		a.Write(fmt.Sprintf("    %s %s", mnemonic, ident))
+	}
+}
+
 func (a *AsmGen) GenType(ksmtype asmtype.AsmType) string {
 	switch ksmtype.(type) {
 	case *asmtype.QuadWord:
@@ -290,6 +473,8 @@ func (a *AsmGen) GenType(ksmtype asmtype.AsmType) string {
 		return "l"
 	case *asmtype.StringType:
 		return "q"
+	case *asmtype.Byte:
+		return "b"
 	default:
 		panic(fmt.Sprintf("unimplemented gentype: %v, on idx: %d, fn:%s", ksmtype, a.currentInstrIdx, a.currentFn))
 	}
@@ -301,50 +486,88 @@ func (a *AsmGen) GenOperand(op AsmOperand, asmType asmtype.AsmType) string {
 	}
 	switch ast := op.(type) {
 	case Register:
+		if _, isByte := asmType.(*asmtype.Byte); isByte {
+			return a.ByteRegisterShow(ast)
+		}
 		return a.RegisterShow(ast, asmType)
 	case Imm:
 		if _, ok := asmType.(*asmtype.StringType); ok {
+			if a.intelOrder() {
+				return fmt.Sprintf("_str_%d", ast.Value)
+			}
 			return fmt.Sprintf("$_str_%d", ast.Value)
 		}
-		return fmt.Sprintf("$%d", ast.Value)
+		return a.imm(ast.Value)
 	case Stack:
-		return fmt.Sprintf("%d(%%rbp)", ast.Value)
+		return a.mem("rbp", ast.Value, asmType)
 	case StringLiteral:
 		label := a.AddString(ast.Value)
-		return fmt.Sprintf("%s(%%rip)", label)
+		return a.rip(label, asmType)
 	case RipRelative:
 		if a.ostype == util.Darwin {
-			return fmt.Sprintf("_%s(%%rip)", ast.Label)
+			return a.rip("_"+ast.Label, asmType)
 		}
-		return fmt.Sprintf("%s(%%rip)", ast.Label)
+		return a.rip(ast.Label, asmType)
 	default:
 		panic("unimplemented operand")
 	}
 }
 
 func (a *AsmGen) RegisterShow(reg Register, asmType asmtype.AsmType) string {
+	if isXMM(reg.Reg) {
+		return a.reg(string(reg.Reg))
+	}
+	numbered := isNumberedRegister(reg.Reg)
 	switch asmType.(type) {
-	case *asmtype.QuadWord, *asmtype.StringType:
-		if reg.Reg == R10 || reg.Reg == R11 {
-			return "%" + string(reg.Reg)
+	case *asmtype.QuadWord, *asmtype.StringType, *asmtype.Double:
+		if numbered {
+			return a.reg(string(reg.Reg))
 		}
 		if reg.Reg == SP {
-			return "%rsp"
+			return a.reg("rsp")
 		}
-		return "%r" + string(reg.Reg)
+		return a.reg("r" + string(reg.Reg))
 	case *asmtype.LongWord:
-		if reg.Reg == R10 || reg.Reg == R11 {
-			return "%" + string(reg.Reg) + "d"
+		if numbered {
+			return a.reg(string(reg.Reg) + "d")
 		}
 		if reg.Reg == SP {
-			return "%esp"
+			return a.reg("esp")
 		}
-		return "%e" + string(reg.Reg)
+		return a.reg("e" + string(reg.Reg))
 	default:
 		panic(fmt.Sprintf("unimplemented register type: %v", asmType))
 	}
 }
 
+// ByteRegisterShow returns the 8-bit name of a register, used by setcc.
+func (a *AsmGen) ByteRegisterShow(reg Register) string {
+	if isNumberedRegister(reg.Reg) {
+		return a.reg(string(reg.Reg) + "b")
+	}
+	switch reg.Reg {
+	case DI, SI:
+		return a.reg(string(reg.Reg) + "l")
+	default:
+		return a.reg(string(reg.Reg)[:1] + "l")
+	}
+}
+
+func isGeneralRegister(op AsmOperand) bool {
+	reg, ok := op.(Register)
+	return ok && !isXMM(reg.Reg)
+}
+
+// isNumberedRegister reports whether reg is one of r8-r15, which use the
+// r8/r8d/r8b naming scheme instead of rax/eax/al.
+func isNumberedRegister(reg AsmRegister) bool {
+	switch reg {
+	case R8, R9, R10, R11, R12, R13, R14, R15:
+		return true
+	}
+	return false
+}
+
 func (a *AsmGen) Write(line string) {
 	fmt.Fprintln(a.writer, line)
 }
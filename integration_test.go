@@ -2,26 +2,40 @@ package main
 
 import (
 	"bytes"
+	"debug/dwarf"
+	"debug/elf"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/your-moon/mon_lang/util/utfconvert"
 )
 
-func compileAndRun(t *testing.T, srcFile string) string {
+// compileAndRun builds srcFile with the extra gen flags and runs it. x86-64
+// output runs under Rosetta on Apple Silicon, aarch64 output under
+// qemu-user on other Linux hosts.
+func compileAndRun(t *testing.T, srcFile string, flags ...string) string {
 	t.Helper()
 	outFile := t.TempDir() + "/out"
 
 	// Compile
-	cmd := exec.Command("go", "run", ".", "gen", srcFile, "-o", outFile)
+	args := append([]string{"run", ".", "gen", srcFile, "-o", outFile}, flags...)
+	cmd := exec.Command("go", args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
 		t.Fatalf("compile failed: %v\nstderr: %s", err, stderr.String())
 	}
 
-	// Run (x86_64 on ARM mac)
-	runCmd := exec.Command("arch", "-x86_64", outFile)
+	runCmd := exec.Command(outFile)
+	aarch64 := len(flags) > 0 && flags[0] == "--target=aarch64"
+	if aarch64 && runtime.GOARCH != "arm64" {
+		runCmd = exec.Command("qemu-aarch64", "-L", "/usr/aarch64-linux-gnu", outFile)
+	} else if !aarch64 && runtime.GOOS == "darwin" && runtime.GOARCH == "arm64" {
+		runCmd = exec.Command("arch", "-x86_64", outFile)
+	}
 	var stdout bytes.Buffer
 	runCmd.Stdout = &stdout
 	runCmd.Stderr = &stderr
@@ -110,3 +124,604 @@ func TestElseIf(t *testing.T) {
 		t.Errorf("expected \"2\\n\", got %q", output)
 	}
 }
+
+func TestTailCalls(t *testing.T) {
+	output := compileAndRun(t, "test/features/tail_calls.mn")
+	expected := "50000005000000 21 20\n"
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+// TestBuiltinObject checks the object --obj writes without an assembler on
+// Linux, the other tests link and run it.
+func TestBuiltinObject(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the object is only encoded on linux")
+	}
+	outFile := t.TempDir() + "/out"
+	cmd := exec.Command("go", "run", ".", "gen", "test/features/globals.mn", "-o", outFile, "--obj")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+
+	f, err := elf.Open(outFile + ".o")
+	if err != nil {
+		t.Fatalf("not an ELF object: %v", err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_REL || f.Machine != elf.EM_X86_64 {
+		t.Errorf("expected an x86-64 relocatable object, got %v %v", f.Type, f.Machine)
+	}
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]elf.Symbol{}
+	for _, sym := range symbols {
+		found[sym.Name] = sym
+	}
+	if sym, ok := found["main"]; !ok || elf.ST_BIND(sym.Info) != elf.STB_GLOBAL {
+		t.Errorf("expected a global main, got %+v", sym)
+	}
+	if sym, ok := found["khevle"]; !ok || sym.Section != elf.SHN_UNDEF {
+		t.Errorf("expected khevle to be undefined, got %+v", sym)
+	}
+	if f.Section(".rela.text") == nil || f.Section(".rodata") == nil || f.Section(".data") == nil {
+		t.Errorf("missing sections in %v", f.Sections)
+	}
+}
+
+func TestAArch64(t *testing.T) {
+	if runtime.GOARCH != "arm64" {
+		for _, tool := range []string{"aarch64-linux-gnu-as", "aarch64-linux-gnu-gcc", "qemu-aarch64"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				t.Skipf("%s not found", tool)
+			}
+		}
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"test/features/control_flow.mn", "3 12 6 20 99\n"},
+		{"test/features/free.mn", "42\n"},
+		{"test/features/globals.mn", "3\n"},
+		{"test/features/import/main.mn", "30 12\n"},
+		{"test/features/types.mn", "300 30 42 100\n"},
+		{"test/features/tail_calls.mn", "50000005000000 21 20\n"},
+		{"test/features/bools.mn", "5 5 0 1\n"},
+		{"test/features/doubles.mn", doublesOutput},
+		{"test/features/structs.mn", structsOutput},
+		{"test/features/enums.mn", enumsOutput},
+		{"test/features/switch.mn", switchOutput},
+		{"test/features/stack_args.mn", stackArgsOutput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			output := compileAndRun(t, tt.file, "--target=aarch64")
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestNoLibc(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("the runtime for --nolibc is linux x86-64 only")
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"test/features/control_flow.mn", "3 12 6 20 99\n"},
+		{"test/features/free.mn", "42\n"},
+		{"test/features/strings.mn", "Монгол"},
+		{"test/features/types.mn", "300 30 42 100\n"},
+		{"test/features/tail_calls.mn", "50000005000000 21 20\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			output := compileAndRun(t, tt.file, "--nolibc")
+			if output != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+
+	// nothing but the program itself is in the file
+	outFile := t.TempDir() + "/out"
+	if out, err := exec.Command("go", "run", ".", "gen", "test/features/globals.mn", "-o", outFile, "--static").CombinedOutput(); err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+	f, err := elf.Open(outFile)
+	if err != nil {
+		t.Fatalf("not an ELF executable: %v", err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_EXEC {
+		t.Errorf("expected an executable, got %v", f.Type)
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP || prog.Type == elf.PT_DYNAMIC {
+			t.Errorf("expected a static executable, found %v", prog.Type)
+		}
+	}
+}
+
+func TestAsmSyntax(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the assembly is only checked on linux")
+	}
+	assemblers := map[string][]string{
+		"intel": {"as", "-o"},
+		"nasm":  {"nasm", "-f", "elf64", "-o"},
+	}
+	for syntax, assembler := range assemblers {
+		t.Run(syntax, func(t *testing.T) {
+			if _, err := exec.LookPath(assembler[0]); err != nil {
+				t.Skipf("%s not found", assembler[0])
+			}
+			outFile := t.TempDir() + "/out"
+			cmd := exec.Command("go", "run", ".", "gen", "test/features/control_flow.mn", "-o", outFile, "--asm", "--asm-syntax="+syntax)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("compile failed: %v\n%s", err, out)
+			}
+			asmFile := outFile + ".s"
+			if syntax == "nasm" {
+				asmFile = outFile + ".asm"
+			}
+			if syntax == "intel" {
+				data, _ := os.ReadFile(asmFile)
+				if !strings.HasPrefix(string(data), ".intel_syntax noprefix") || strings.Contains(string(data), "%r") {
+					t.Errorf("expected intel syntax, got\n%s", data)
+				}
+			}
+			args := append(assembler[1:], outFile+".o", asmFile)
+			if out, err := exec.Command(assembler[0], args...).CombinedOutput(); err != nil {
+				t.Errorf("%s failed: %v\n%s", assembler[0], err, out)
+			}
+		})
+	}
+}
+
+func TestShared(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("shared libraries are only checked on linux x86-64")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command("go", "run", ".", "gen", "test/features/shared.mn", "-o", dir+"/libshared", "--shared", "--emit-header")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+	header, err := os.ReadFile(dir + "/libshared.h")
+	if err != nil {
+		t.Fatalf("no header: %v", err)
+	}
+	for _, decl := range []string{
+		"/* фибоначчи */\nint64_t _M_44_38_31_3e_3d_30_47_47_38(int64_t n);\n",
+		"static inline int64_t fibonachchi(int64_t n) { return _M_44_38_31_3e_3d_30_47_47_38(n); }",
+		"static inline int64_t niylber(int32_t *j, int32_t urt)",
+		"static inline void mendlekh(const char *ner) { _M_3c_4d_3d_34_3b_4d_45(ner); }",
+		"struct Tseg {\n    int32_t x;\n    bool temdeg;\n    double jin;\n};\n",
+		"static inline double tseg_qsgqkh(Tseg *ts, int32_t alkham)",
+	} {
+		if !strings.Contains(string(header), decl) {
+			t.Errorf("expected %q in the header, got\n%s", decl, header)
+		}
+	}
+	if strings.Contains(string(header), "nuuts") {
+		t.Errorf("only тунх functions belong in the header, got\n%s", header)
+	}
+	lib, err := elf.Open(dir + "/libshared.so")
+	if err != nil {
+		t.Fatalf("not an ELF library: %v", err)
+	}
+	defer lib.Close()
+	symbols, _ := lib.DynamicSymbols()
+	for _, sym := range symbols {
+		if sym.Name == utfconvert.Mangle("нууц") {
+			t.Errorf("expected нууц to stay local")
+		}
+	}
+
+	caller := `#include <stdio.h>
+#include "libshared.h"
+int main(void) {
+    int32_t xs[] = {1, 2, 3, 4};
+    printf("%ld %ld\n", (long)fibonachchi(20), (long)niylber(xs, 4));
+    Tseg p = {5, false, 1.25};
+    double w = tseg_qsgqkh(&p, 3);
+    printf("%d %d %g\n", p.x, p.temdeg, w);
+    mendlekh("Монгол");
+    return 0;
+}
+`
+	if err := os.WriteFile(dir+"/main.c", []byte(caller), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("cc", "-o", dir+"/main", dir+"/main.c", dir+"/libshared.so", "-Wl,-rpath,"+dir).CombinedOutput(); err != nil {
+		t.Fatalf("cc failed: %v\n%s", err, out)
+	}
+	out, err := exec.Command(dir + "/main").CombinedOutput()
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	expected := "6765 10\n8 1 2.5\nМонгол\n"
+	if string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestDemangle(t *testing.T) {
+	cmd := exec.Command("go", "run", ".", "demangle")
+	cmd.Stdin = strings.NewReader("undefined reference to `_M_3d_4d_4d_34'\nmain khevle\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("demangle failed: %v\n%s", err, out)
+	}
+	if string(out) != "undefined reference to `нээд'\nmain khevle\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	out, err = exec.Command("go", "run", ".", "demangle", utfconvert.Mangle("үндсэн"), "printf").CombinedOutput()
+	if err != nil {
+		t.Fatalf("demangle failed: %v\n%s", err, out)
+	}
+	if string(out) != "үндсэн\nprintf\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("runs the x86-64 output directly")
+	}
+
+	tests := []struct {
+		name  string
+		flags []string
+	}{
+		{"libc", nil},
+		{"nolibc", []string{"--nolibc"}},
+		{"c", []string{"--target=c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outFile := t.TempDir() + "/out"
+			args := append([]string{"run", ".", "gen", "test/features/args.mn", "-o", outFile}, tt.flags...)
+			if out, err := exec.Command("go", args...).CombinedOutput(); err != nil {
+				t.Fatalf("compile failed: %v\n%s", err, out)
+			}
+			out, err := exec.Command(outFile, "нэг", "two", "гурав").Output()
+			exitErr, ok := err.(*exec.ExitError)
+			if !ok || exitErr.ExitCode() != 3 {
+				t.Fatalf("expected exit code 3, got %v", err)
+			}
+			if string(out) != "нэг\ntwo\nгурав\n" {
+				t.Errorf("unexpected output %q", out)
+			}
+		})
+	}
+
+	// a program without үндсэн doesn't compile
+	srcFile := t.TempDir() + "/no_main.mn"
+	if err := os.WriteFile(srcFile, []byte("функц туслах() -> тоо {\n    буц 1;\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "'үндсэн' функц олдсонгүй") {
+		t.Errorf("expected a missing үндсэн error, got %v\n%s", err, out)
+	}
+}
+
+func TestBools(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, "test/features/bools.mn", flags...)
+			expected := "5 5 0 1\n"
+			if output != expected {
+				t.Errorf("expected %q, got %q", expected, output)
+			}
+		})
+	}
+
+	// a condition has to be логик, a number is no longer enough
+	srcFile := t.TempDir() + "/int_cond.mn"
+	src := "функц үндсэн() -> тоо {\n    зарла x: тоо = 1;\n    хэрэв x бол {\n        буц 1;\n    }\n    буц 0;\n}\n"
+	if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "нөхцөл логик төрөлтэй байх ёстой") {
+		t.Errorf("expected a condition type error, got %v\n%s", err, out)
+	}
+}
+
+const doublesOutput = "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+
+func TestDoubles(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, "test/features/doubles.mn", flags...)
+			if output != doublesOutput {
+				t.Errorf("expected %q, got %q", doublesOutput, output)
+			}
+		})
+	}
+
+	// '%' only makes sense for integers
+	srcFile := t.TempDir() + "/mod.mn"
+	src := "функц үндсэн() -> тоо {\n    зарла x: бутархай = 2.5 % 2;\n    буц 0;\n}\n"
+	if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "'%' үйлдэл бутархай төрөл дээр хийгдэхгүй") {
+		t.Errorf("expected a '%%' type error, got %v\n%s", err, out)
+	}
+}
+
+const structsOutput = "25 7 8\n0 тэг 4999999995 Бат 145 35 үнэн\n38 54321 ижил 9\n"
+
+func TestStructs(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, "test/features/structs.mn", flags...)
+			if output != structsOutput {
+				t.Errorf("expected %q, got %q", structsOutput, output)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		body     string
+		expected string
+	}{
+		{"зарла ц: Цэг = шинэ Цэг;\n    ц.z = 1;", "'Цэг' бүтэц 'z' талбаргүй"},
+		{"зарла ц: Өнгө = шинэ Цэг;", "'Өнгө' төрөл олдсонгүй"},
+		{"зарла н: тоо = 1;\n    н.x = 2;", "'.x' зөвхөн бүтэц дээр хэрэглэгдэнэ"},
+		{"зарла ц: Цэг = шинэ Цэг;\n    зарла н: тоо = ц;", "'тоо' төрөлтэй, 'Цэг' утга оноож болохгүй"},
+	}
+	for _, tt := range errorTests {
+		srcFile := t.TempDir() + "/struct_error.mn"
+		src := "бүтэц Цэг { x: тоо, y: тоо }\n\nфункц үндсэн() -> тоо {\n    " + tt.body + "\n    буц 0;\n}\n"
+		if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+		if err == nil || !strings.Contains(string(out), tt.expected) {
+			t.Errorf("expected %q, got %v\n%s", tt.expected, err, out)
+		}
+	}
+}
+
+const enumsOutput = "улаан ногоон цэнхэр улаан 1 20 тэнцүү\n2 2\n1,2,4\n"
+
+func TestEnums(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, "test/features/enums.mn", flags...)
+			if output != enumsOutput {
+				t.Errorf("expected %q, got %q", enumsOutput, output)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		body     string
+		expected string
+	}{
+		{"сонго ө {\n        Өнгө.Улаан бол буц 1;\n    }", "Өнгө.Ногоон, Өнгө.Цэнхэр үлдсэн байна"},
+		{"сонго ө {\n        Өнгө.Улаан, Өнгө.Ногоон бол {}\n        Өнгө.Улаан, Өнгө.Цэнхэр бол {}\n    }", "'Өнгө.Улаан' хоёр удаа бичигдсэн байна"},
+		{"ө = Өнгө.Шар;", "'Өнгө' төрөл 'Шар' утгагүй"},
+		{"зарла н: тоо = ө;", "'тоо' төрөлтэй, 'Өнгө' утга оноож болохгүй"},
+		{"ө = 1;", "'Өнгө' төрөлтэй хувьсагчид 'тоо' утга оноож болохгүй"},
+		{"зарла н: тоо = ө + 1;", "эхлээд тоо(...) болгоно уу"},
+	}
+	for _, tt := range errorTests {
+		srcFile := t.TempDir() + "/enum_error.mn"
+		src := "төрөл Өнгө { Улаан, Ногоон, Цэнхэр }\n\nфункц үндсэн() -> тоо {\n    зарла ө: Өнгө = Өнгө.Ногоон;\n    " + tt.body + "\n    буц 0;\n}\n"
+		if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+		if err == nil || !strings.Contains(string(out), tt.expected) {
+			t.Errorf("expected %q, got %v\n%s", tt.expected, err, out)
+		}
+	}
+}
+
+const switchOutput = "? да мя лх пү ба амралт амралт ? \n123445 01239 дулаан\n43\n"
+
+func TestSwitch(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, "test/features/switch.mn", flags...)
+			if output != switchOutput {
+				t.Errorf("expected %q, got %q", switchOutput, output)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		body     string
+		expected string
+	}{
+		{"сонго н {\n        1..5 бол {}\n        5, 6 бол {}\n    }", "5 утга хоёр удаа бичигдсэн байна"},
+		{"сонго н {\n        м бол {}\n    }", "сонголтын утга тогтмол тоо байх ёстой"},
+		{"сонго н {\n        5..1 бол {}\n    }", "'5..1' хязгаарт утга алга"},
+		{"сонго н {\n        3000000000 бол {}\n    }", "3000000000 утга тоо төрөлд багтахгүй"},
+		{"сонго н > м {\n        эсвэл {}\n    }", "'логик' төрөл өгсөн байна"},
+	}
+	for _, tt := range errorTests {
+		srcFile := t.TempDir() + "/switch_error.mn"
+		src := "функц үндсэн() -> тоо {\n    зарла н: тоо = 1;\n    зарла м: тоо = 2;\n    " + tt.body + "\n    буц 0;\n}\n"
+		if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", t.TempDir()+"/out").CombinedOutput()
+		if err == nil || !strings.Contains(string(out), tt.expected) {
+			t.Errorf("expected %q, got %v\n%s", tt.expected, err, out)
+		}
+	}
+}
+
+const stackArgsOutput = "385 64000000140 10823\n"
+
+// TestStackArgs passes more бутархай and integer arguments than there are
+// registers, every backend has to agree with the interpreter.
+func TestStackArgs(t *testing.T) {
+	const srcFile = "test/features/stack_args.mn"
+	out, err := exec.Command("go", "run", ".", "interp", srcFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("interp failed: %v\n%s", err, out)
+	}
+	if string(out) != stackArgsOutput {
+		t.Fatalf("expected %q from interp, got %q", stackArgsOutput, out)
+	}
+
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}, {"--target=c"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, srcFile, flags...)
+			if output != stackArgsOutput {
+				t.Errorf("expected %q, got %q", stackArgsOutput, output)
+			}
+		})
+	}
+
+	t.Run("wasm", func(t *testing.T) {
+		node, err := exec.LookPath("node")
+		if err != nil {
+			t.Skip("node not found")
+		}
+		outFile := t.TempDir() + "/out"
+		if out, err := exec.Command("go", "run", ".", "gen", srcFile, "-o", outFile, "--emit=wasm").CombinedOutput(); err != nil {
+			t.Fatalf("compile failed: %v\n%s", err, out)
+		}
+		out, err := exec.Command(node, "wasm_gen/testdata/run.mjs", outFile+".wasm").Output()
+		if err != nil {
+			t.Fatalf("node failed: %v", err)
+		}
+		if string(out) != stackArgsOutput {
+			t.Errorf("expected %q, got %q", stackArgsOutput, out)
+		}
+	})
+}
+
+// TestRegisterPressure runs a program with more live values than registers,
+// many of them across calls, against the interpreter's output.
+func TestRegisterPressure(t *testing.T) {
+	const srcFile = "test/features/register_pressure.mn"
+	expected, err := exec.Command("go", "run", ".", "interp", srcFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("interp failed: %v\n%s", err, expected)
+	}
+	for _, flags := range [][]string{nil, {"-O2"}, {"--nolibc"}} {
+		t.Run(strings.Join(flags, " "), func(t *testing.T) {
+			output := compileAndRun(t, srcFile, flags...)
+			if output != string(expected) {
+				t.Errorf("expected %q, got %q", expected, output)
+			}
+		})
+	}
+}
+
+// TestDebugInfo builds with -g and reads the DWARF back: every function is
+// in .debug_info with its line and parameters, and the line table maps the
+// statements of the source to addresses inside the right function.
+func TestDebugInfo(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the debug info is only checked in ELF")
+	}
+	outFile := t.TempDir() + "/out"
+	if out, err := exec.Command("go", "run", ".", "gen", "test/features/functions.mn", "-o", outFile, "-g").CombinedOutput(); err != nil {
+		t.Fatalf("compile failed: %v\n%s", err, out)
+	}
+	f, err := elf.Open(outFile)
+	if err != nil {
+		t.Fatalf("not an ELF executable: %v", err)
+	}
+	defer f.Close()
+	data, err := f.DWARF()
+	if err != nil {
+		t.Fatalf("no DWARF: %v", err)
+	}
+
+	type fnRange struct {
+		line          int64
+		lowPC, highPC uint64
+		params        []string
+	}
+	fns := map[string]*fnRange{}
+	var unit *dwarf.Entry
+	var current *fnRange
+	reader := data.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			unit = entry
+		case dwarf.TagSubprogram:
+			current = &fnRange{line: entry.Val(dwarf.AttrDeclLine).(int64)}
+			current.lowPC, _ = entry.Val(dwarf.AttrLowpc).(uint64)
+			current.highPC, _ = entry.Val(dwarf.AttrHighpc).(uint64)
+			fns[entry.Val(dwarf.AttrName).(string)] = current
+		case dwarf.TagFormalParameter:
+			current.params = append(current.params, entry.Val(dwarf.AttrName).(string))
+		}
+	}
+	if unit == nil || unit.Val(dwarf.AttrName) != "test/features/functions.mn" {
+		t.Fatalf("expected a compile unit for functions.mn, got %v", unit)
+	}
+	factorial, main := fns["факториал"], fns["үндсэн"]
+	if factorial == nil || main == nil {
+		t.Fatalf("expected факториал and үндсэн, got %v", fns)
+	}
+	if factorial.line != 1 || main.line != 8 || strings.Join(factorial.params, ",") != "n" {
+		t.Errorf("unexpected functions: факториал %+v, үндсэн %+v", factorial, main)
+	}
+
+	lines, err := data.LineReader(unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[int]uint64{}
+	var row dwarf.LineEntry
+	for lines.Next(&row) == nil {
+		if row.EndSequence {
+			continue
+		}
+		if !strings.HasSuffix(row.File.Name, "functions.mn") {
+			t.Errorf("line %d maps to %s", row.Line, row.File.Name)
+		}
+		if _, ok := rows[row.Line]; !ok {
+			rows[row.Line] = row.Address
+		}
+	}
+	for line, fn := range map[int]*fnRange{1: factorial, 2: factorial, 3: factorial, 5: factorial, 8: main, 9: main} {
+		addr, ok := rows[line]
+		if !ok {
+			t.Errorf("no address for line %d", line)
+			continue
+		}
+		if addr < fn.lowPC || addr >= fn.highPC {
+			t.Errorf("line %d is at 0x%x, outside its function [0x%x, 0x%x)", line, addr, fn.lowPC, fn.highPC)
+		}
+	}
+	if rows[1] != factorial.lowPC || rows[8] != main.lowPC {
+		t.Errorf("a function's first line should start at its low_pc, got %v", rows)
+	}
+	if _, ok := rows[4]; ok {
+		t.Errorf("line 4 is only a closing brace, it has no code")
+	}
+}
@@ -0,0 +1,100 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// callBuiltin provides the functions stdlib/lib.c (and libc's malloc) supply
+// to native programs.
+func (i *Interpreter) callBuiltin(name string, args []int64) (int64, error) {
+	arg := func(idx int) int64 {
+		if idx < len(args) {
+			return args[idx]
+		}
+		return 0
+	}
+
+	switch name {
+	case "malloc":
+		return i.malloc(arg(0)), nil
+	case "хэвлэ":
+		fmt.Fprintf(i.out, "%d", arg(0))
+		return 0, nil
+	case "мөр_хэвлэх":
+		s, err := i.readString(arg(0))
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprint(i.out, s)
+		return 0, nil
+	case "унш":
+		return i.readInt(), nil
+	case "унш32":
+		return int64(int32(i.readInt())), nil
+	case "бутархай_хэвлэх":
+		fmt.Fprint(i.out, formatDouble(math.Float64frombits(uint64(arg(0)))))
+		return 0, nil
+	case "бутархай_унш":
+		return int64(math.Float64bits(i.readDouble())), nil
+	case "санамсаргүйТоо":
+		n := int32(arg(0))
+		if n <= 0 {
+			return 0, fmt.Errorf("ажиллах үеийн алдаа: санамсаргүйТоо эерэг тоо хүлээж авна, %d өгөгдсөн", n)
+		}
+		return int64(i.rng.Int31n(n) + 1), nil
+	case "одоо":
+		return time.Now().Unix(), nil
+	case "чөлөөлөх":
+		// the heap only grows, freeing is a no-op
+		return 0, nil
+	case "хүлээх":
+		i.out.Flush()
+		time.Sleep(time.Duration(int32(arg(0))) * time.Millisecond)
+		return 0, nil
+	case "аргын_тоо":
+		return int64(len(i.Args)), nil
+	case "дэлгэцЦэвэрлэх":
+		fmt.Fprint(i.out, "\033[H\033[2J")
+		i.out.Flush()
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("интерпретатор: '%s' гадаад функц дэмжигдээгүй", name)
+	}
+}
+
+// readInt behaves like scanf("%ld"): output is flushed first so prompts show
+// up, and a failed read leaves the result at zero.
+func (i *Interpreter) readInt() int64 {
+	i.out.Flush()
+	var n int64
+	fmt.Fscan(i.in, &n)
+	return n
+}
+
+// readDouble is readInt for scanf("%lf").
+func (i *Interpreter) readDouble() float64 {
+	i.out.Flush()
+	var f float64
+	fmt.Fscan(i.in, &f)
+	return f
+}
+
+// formatDouble writes f like printf("%g"). Go's %g already has six digits
+// and the same switch to the exponent form, only NaN and infinity are
+// spelled differently.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		if math.Signbit(f) {
+			return "-nan"
+		}
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return fmt.Sprintf("%.6g", f)
+}
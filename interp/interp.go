@@ -0,0 +1,519 @@
+package interp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// maxCallDepth is how deep calls may nest before the program is stopped
+// the way a native one would be by a stack overflow. Calls whose result is
+// returned right away don't count, they replace the caller's frame.
+const maxCallDepth = 100000
+
+// heapBase keeps every valid address well away from zero so a null pointer
+// dereference is caught instead of silently reading the first allocation.
+const heapBase = 0x10000
+
+type frame struct {
+	fn     *tackygen.TackyFn
+	vars   map[string]int64
+	labels map[string]int
+}
+
+// Interpreter executes a TackyProgram directly, without going through the
+// x86 backend. Integers are held as int64 and narrowed to the width of the
+// destination. A бутархай is held as the bits of its float64. Memory is a
+// flat byte slice backing malloc and string literals.
+type Interpreter struct {
+	program     tackygen.TackyProgram
+	symbolTable *symbols.SymbolTable
+	fns         map[string]*tackygen.TackyFn
+	labels      map[string]map[string]int
+	globals     map[string]int64
+	memory      []byte
+	strings     map[string]int64
+	in          *bufio.Reader
+	out         *bufio.Writer
+	rng         *rand.Rand
+	depth       int
+
+	// Args is what a native program gets as argv, the program name first.
+	Args []string
+}
+
+func New(program tackygen.TackyProgram, table *symbols.SymbolTable, in io.Reader, out io.Writer) *Interpreter {
+	interp := &Interpreter{
+		program:     program,
+		symbolTable: table,
+		fns:         make(map[string]*tackygen.TackyFn),
+		labels:      make(map[string]map[string]int),
+		globals:     make(map[string]int64),
+		strings:     make(map[string]int64),
+		in:          bufio.NewReader(in),
+		out:         bufio.NewWriter(out),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for i := range program.FnDefs {
+		fn := &program.FnDefs[i]
+		interp.fns[fn.Name] = fn
+		labels := map[string]int{}
+		for idx, instr := range fn.Instructions {
+			if lbl, ok := instr.(tackygen.Label); ok {
+				labels[lbl.Ident] = idx
+			}
+		}
+		interp.labels[fn.Name] = labels
+	}
+
+	for _, gv := range program.GlobalVars {
+		interp.globals[gv.Name] = gv.InitValue
+	}
+
+	return interp
+}
+
+// Run calls үндсэн and returns its result, which the native backend would
+// use as the process exit code.
+func (i *Interpreter) Run() (int64, error) {
+	defer i.out.Flush()
+	main, ok := i.fns["үндсэн"]
+	if !ok {
+		return 0, fmt.Errorf("'үндсэн' функц олдсонгүй")
+	}
+	if len(main.Params) == 0 {
+		return i.Call("үндсэн", nil)
+	}
+	// argv is an array of string addresses ending in a null pointer
+	argv := i.malloc(int64(8 * (len(i.Args) + 1)))
+	for idx, arg := range i.Args {
+		if err := i.store(argv+int64(8*idx), 8, i.internString(arg)); err != nil {
+			return 0, err
+		}
+	}
+	return i.Call("үндсэн", []int64{argv})
+}
+
+// pendingCall is a tail call the caller's Call makes in place of the
+// returning frame.
+type pendingCall struct {
+	name string
+	args []int64
+}
+
+func (i *Interpreter) Call(name string, args []int64) (int64, error) {
+	i.depth++
+	defer func() { i.depth-- }()
+	if i.depth > maxCallDepth {
+		return 0, fmt.Errorf("ажиллах үеийн алдаа: '%s' функцийг дуудахад дуудлагын гүн %d-с хэтэрлээ", name, maxCallDepth)
+	}
+
+	for {
+		fn, ok := i.fns[name]
+		if !ok {
+			return i.callBuiltin(name, args)
+		}
+		result, tail, err := i.exec(fn, args)
+		if err != nil || tail == nil {
+			return result, err
+		}
+		name, args = tail.name, tail.args
+	}
+}
+
+// exec runs fn until it returns, or until it reaches a tail call, which it
+// hands back so the frame is gone before the callee runs.
+func (i *Interpreter) exec(fn *tackygen.TackyFn, args []int64) (int64, *pendingCall, error) {
+	name := fn.Name
+	f := &frame{
+		fn:     fn,
+		vars:   make(map[string]int64),
+		labels: i.labels[name],
+	}
+	for idx, param := range fn.Params {
+		if idx < len(args) {
+			i.set(f, param, args[idx])
+		}
+	}
+
+	pc := 0
+	for pc < len(fn.Instructions) {
+		switch instr := fn.Instructions[pc].(type) {
+		case tackygen.Return:
+			return i.get(f, instr.Value), nil, nil
+		case tackygen.Copy:
+			i.set(f, instr.Dst, i.get(f, instr.Src))
+		case tackygen.SignExtend:
+			i.set(f, instr.Dst, int64(int32(i.get(f, instr.Src))))
+		case tackygen.Truncate:
+			i.set(f, instr.Dst, int64(int32(i.get(f, instr.Src))))
+		case tackygen.IntToDouble:
+			i.set(f, instr.Dst, int64(math.Float64bits(float64(i.get(f, instr.Src)))))
+		case tackygen.DoubleToInt:
+			i.set(f, instr.Dst, doubleToInt(i.get(f, instr.Src), i.sizeOf(instr.Dst)))
+		case tackygen.Unary:
+			if instr.Op == tackygen.Negate && i.isDouble(instr.Src) {
+				i.set(f, instr.Dst, i.get(f, instr.Src)^math.MinInt64)
+				break
+			}
+			val, err := i.unary(instr.Op, i.get(f, instr.Src))
+			if err != nil {
+				return 0, nil, err
+			}
+			i.set(f, instr.Dst, val)
+		case tackygen.Binary:
+			binary := i.binary
+			if i.isDouble(instr.Src1) {
+				binary = i.doubleBinary
+			}
+			val, err := binary(instr.Op, i.get(f, instr.Src1), i.get(f, instr.Src2))
+			if err != nil {
+				return 0, nil, err
+			}
+			i.set(f, instr.Dst, val)
+		case tackygen.Jump:
+			target, err := i.jump(f, instr.Target)
+			if err != nil {
+				return 0, nil, err
+			}
+			pc = target
+			continue
+		case tackygen.JumpIfZero:
+			if i.get(f, instr.Val) == 0 {
+				target, err := i.jump(f, instr.Ident)
+				if err != nil {
+					return 0, nil, err
+				}
+				pc = target
+				continue
+			}
+		case tackygen.JumpIfNotZero:
+			if i.get(f, instr.Val) != 0 {
+				target, err := i.jump(f, instr.Ident)
+				if err != nil {
+					return 0, nil, err
+				}
+				pc = target
+				continue
+			}
+		case tackygen.JumpTable:
+			// tackygen checked the range before the table
+			target, err := i.jump(f, instr.Targets[i.get(f, instr.Index)])
+			if err != nil {
+				return 0, nil, err
+			}
+			pc = target
+			continue
+		case tackygen.Label, tackygen.SourceLine:
+		case tackygen.FnCall:
+			args := make([]int64, len(instr.Args))
+			for idx, arg := range instr.Args {
+				args[idx] = i.get(f, arg)
+			}
+			if isTailCall(fn.Instructions, pc) {
+				return 0, &pendingCall{name: instr.Name, args: args}, nil
+			}
+			result, err := i.Call(instr.Name, args)
+			if err != nil {
+				return 0, nil, err
+			}
+			if instr.Dst != nil {
+				i.set(f, instr.Dst, result)
+			}
+		case tackygen.Load:
+			val, err := i.load(i.get(f, instr.Src), i.sizeOf(instr.Dst))
+			if err != nil {
+				return 0, nil, err
+			}
+			i.set(f, instr.Dst, val)
+		case tackygen.Store:
+			if err := i.store(i.get(f, instr.Dst), i.sizeOf(instr.Src), i.get(f, instr.Src)); err != nil {
+				return 0, nil, err
+			}
+		default:
+			return 0, nil, fmt.Errorf("интерпретатор: '%s' функцэд үл мэдэгдэх заавар: %T", name, instr)
+		}
+		pc++
+	}
+
+	return 0, nil, nil
+}
+
+// isTailCall reports whether instrs[pc] is a call whose result the next
+// instruction returns.
+func isTailCall(instrs []tackygen.Instruction, pc int) bool {
+	call := instrs[pc].(tackygen.FnCall)
+	if call.Dst == nil || pc+1 >= len(instrs) {
+		return false
+	}
+	ret, ok := instrs[pc+1].(tackygen.Return)
+	if !ok {
+		return false
+	}
+	dst, isVar := call.Dst.(tackygen.Var)
+	val, isVarVal := ret.Value.(tackygen.Var)
+	return isVar && isVarVal && dst.Name == val.Name
+}
+
+func (i *Interpreter) jump(f *frame, label string) (int, error) {
+	target, ok := f.labels[label]
+	if !ok {
+		return 0, fmt.Errorf("интерпретатор: '%s' шошго олдсонгүй", label)
+	}
+	return target, nil
+}
+
+func (i *Interpreter) unary(op tackygen.UnaryOperator, src int64) (int64, error) {
+	switch op {
+	case tackygen.Complement:
+		return ^src, nil
+	case tackygen.Negate:
+		return -src, nil
+	case tackygen.Not:
+		return boolToInt(src == 0), nil
+	default:
+		return 0, fmt.Errorf("интерпретатор: үл мэдэгдэх unary үйлдэл: %s", op)
+	}
+}
+
+func (i *Interpreter) binary(op tackygen.TackyBinaryOp, a, b int64) (int64, error) {
+	switch op {
+	case tackygen.Add:
+		return a + b, nil
+	case tackygen.Sub:
+		return a - b, nil
+	case tackygen.Mul:
+		return a * b, nil
+	case tackygen.Div:
+		if b == 0 {
+			return 0, fmt.Errorf("ажиллах үеийн алдаа: тэгээр хуваасан байна")
+		}
+		return a / b, nil
+	case tackygen.Modulo:
+		if b == 0 {
+			return 0, fmt.Errorf("ажиллах үеийн алдаа: тэгээр хуваасан байна")
+		}
+		return a % b, nil
+	case tackygen.Equal:
+		return boolToInt(a == b), nil
+	case tackygen.NotEqual:
+		return boolToInt(a != b), nil
+	case tackygen.LessThan:
+		return boolToInt(a < b), nil
+	case tackygen.LessThanEqual:
+		return boolToInt(a <= b), nil
+	case tackygen.GreaterThan:
+		return boolToInt(a > b), nil
+	case tackygen.GreaterThanEqual:
+		return boolToInt(a >= b), nil
+	default:
+		return 0, fmt.Errorf("интерпретатор: үл мэдэгдэх binary үйлдэл: %s", op)
+	}
+}
+
+// doubleBinary is binary on the bits of two бутархай.
+func (i *Interpreter) doubleBinary(op tackygen.TackyBinaryOp, bitsA, bitsB int64) (int64, error) {
+	a := math.Float64frombits(uint64(bitsA))
+	b := math.Float64frombits(uint64(bitsB))
+	result := func(f float64) (int64, error) {
+		return int64(math.Float64bits(f)), nil
+	}
+	switch op {
+	case tackygen.Add:
+		return result(a + b)
+	case tackygen.Sub:
+		return result(a - b)
+	case tackygen.Mul:
+		return result(a * b)
+	case tackygen.Div:
+		// like the hardware, dividing by zero gives inf or NaN
+		return result(a / b)
+	case tackygen.Equal:
+		return boolToInt(a == b), nil
+	case tackygen.NotEqual:
+		return boolToInt(a != b), nil
+	case tackygen.LessThan:
+		return boolToInt(a < b), nil
+	case tackygen.LessThanEqual:
+		return boolToInt(a <= b), nil
+	case tackygen.GreaterThan:
+		return boolToInt(a > b), nil
+	case tackygen.GreaterThanEqual:
+		return boolToInt(a >= b), nil
+	default:
+		return 0, fmt.Errorf("интерпретатор: бутархай дээр үл мэдэгдэх binary үйлдэл: %s", op)
+	}
+}
+
+// doubleToInt rounds toward zero like cvttsd2si, which gives the smallest
+// integer of the width for NaN and anything out of range.
+func doubleToInt(bits int64, size int) int64 {
+	f := math.Float64frombits(uint64(bits))
+	limit := math.Ldexp(1, 8*size-1)
+	if math.IsNaN(f) || f >= limit || f < -limit {
+		return -int64(limit)
+	}
+	return int64(f)
+}
+
+func (i *Interpreter) isDouble(val tackygen.TackyVal) bool {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		_, ok := v.Value.(*mconstant.Double)
+		return ok
+	case tackygen.Var:
+		if entry := i.symbolTable.Get(v.Name); entry != nil {
+			_, ok := entry.Type.(*mtypes.DoubleType)
+			return ok
+		}
+	}
+	return false
+}
+
+func (i *Interpreter) get(f *frame, val tackygen.TackyVal) int64 {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		return v.Value.GetValue()
+	case tackygen.StringConstant:
+		return i.internString(v.Value)
+	case tackygen.Var:
+		if value, ok := f.vars[v.Name]; ok {
+			return value
+		}
+		return i.globals[v.Name]
+	default:
+		panic(fmt.Sprintf("unimplemented tacky val: %T", val))
+	}
+}
+
+func (i *Interpreter) set(f *frame, dst tackygen.TackyVal, value int64) {
+	v, ok := dst.(tackygen.Var)
+	if !ok {
+		panic(fmt.Sprintf("cannot assign to %T", dst))
+	}
+	if i.sizeOf(dst) == 4 {
+		value = int64(int32(value))
+	}
+	if _, isGlobal := i.globals[v.Name]; isGlobal {
+		i.globals[v.Name] = value
+		return
+	}
+	f.vars[v.Name] = value
+}
+
+// sizeOf mirrors the widths the x86 backend uses: логик is 1 byte, тоо is 4,
+// everything else (тоо64, pointers, strings) is 8.
+func (i *Interpreter) sizeOf(val tackygen.TackyVal) int {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		switch v.Value.(type) {
+		case *mconstant.Int32:
+			return 4
+		case *mconstant.Bool:
+			return 1
+		}
+		return 8
+	case tackygen.Var:
+		entry := i.symbolTable.Get(v.Name)
+		if entry == nil {
+			return 8
+		}
+		switch entry.Type.(type) {
+		case *mtypes.Int32Type, *mtypes.EnumType, *mtypes.VoidType:
+			return 4
+		case *mtypes.BoolType:
+			return 1
+		}
+		return 8
+	default:
+		return 8
+	}
+}
+
+func (i *Interpreter) malloc(size int64) int64 {
+	// keep every block 8-byte aligned like a real allocator would
+	for len(i.memory)%8 != 0 {
+		i.memory = append(i.memory, 0)
+	}
+	addr := int64(heapBase + len(i.memory))
+	i.memory = append(i.memory, make([]byte, size)...)
+	return addr
+}
+
+func (i *Interpreter) internString(value string) int64 {
+	if addr, ok := i.strings[value]; ok {
+		return addr
+	}
+	addr := i.malloc(int64(len(value) + 1))
+	copy(i.memory[addr-heapBase:], value)
+	i.strings[value] = addr
+	return addr
+}
+
+func (i *Interpreter) checkAddr(addr int64, size int) (int64, error) {
+	offset := addr - heapBase
+	if addr == 0 || offset < 0 || offset+int64(size) > int64(len(i.memory)) {
+		return 0, fmt.Errorf("ажиллах үеийн алдаа: санах ойн буруу хаяг 0x%x", addr)
+	}
+	return offset, nil
+}
+
+func (i *Interpreter) load(addr int64, size int) (int64, error) {
+	offset, err := i.checkAddr(addr, size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int64(i.memory[offset]), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(i.memory[offset:]))), nil
+	}
+	return int64(binary.LittleEndian.Uint64(i.memory[offset:])), nil
+}
+
+func (i *Interpreter) store(addr int64, size int, value int64) error {
+	offset, err := i.checkAddr(addr, size)
+	if err != nil {
+		return err
+	}
+	switch size {
+	case 1:
+		i.memory[offset] = byte(value)
+		return nil
+	case 4:
+		binary.LittleEndian.PutUint32(i.memory[offset:], uint32(value))
+		return nil
+	}
+	binary.LittleEndian.PutUint64(i.memory[offset:], uint64(value))
+	return nil
+}
+
+func (i *Interpreter) readString(addr int64) (string, error) {
+	offset, err := i.checkAddr(addr, 1)
+	if err != nil {
+		return "", err
+	}
+	end := offset
+	for end < int64(len(i.memory)) && i.memory[end] != 0 {
+		end++
+	}
+	return string(i.memory[offset:end]), nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package interp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/parser"
+	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func interpret(t *testing.T, srcFile string, input string) (string, int64) {
+	t.Helper()
+	output, code, err := run(t, srcFile, input)
+	if err != nil {
+		t.Fatalf("interp failed: %v", err)
+	}
+	return output, code
+}
+
+// run is interpret that hands back the runtime error instead of failing.
+func run(t *testing.T, srcFile string, input string) (string, int64, error) {
+	t.Helper()
+	data, err := os.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	source := append([]int32(string(data)), 0)
+
+	uniqueGen := unique.NewUniqueGen()
+	p := parser.NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	table := symbols.NewSymbolTable()
+	resolver := semanticanalysis.NewSemanticAnalyzer(source, uniqueGen, table, filepath.Dir(srcFile), "../stdlib")
+	resolved, symbolTable, err := resolver.Analyze(program)
+	if err != nil {
+		t.Fatalf("semantic analysis failed: %v", err)
+	}
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolved)
+
+	var out bytes.Buffer
+	code, err := New(tackyProgram, symbolTable, strings.NewReader(input), &out).Run()
+	return out.String(), code, err
+}
+
+func TestControlFlow(t *testing.T) {
+	output, _ := interpret(t, "../test/features/control_flow.mn", "")
+	if output != "3 12 6 20 99\n" {
+		t.Errorf("expected %q, got %q", "3 12 6 20 99\n", output)
+	}
+}
+
+func TestFree(t *testing.T) {
+	output, _ := interpret(t, "../test/features/free.mn", "")
+	if output != "42\n" {
+		t.Errorf("expected %q, got %q", "42\n", output)
+	}
+}
+
+func TestTypeCoercion(t *testing.T) {
+	output, _ := interpret(t, "../test/features/types.mn", "")
+	if output != "300 30 42 100\n" {
+		t.Errorf("expected %q, got %q", "300 30 42 100\n", output)
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	expected := "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+	output, _ := interpret(t, "../test/features/doubles.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestReturnCode(t *testing.T) {
+	_, code := interpret(t, "../test/features/conditionals.mn", "")
+	if code != 16 {
+		t.Errorf("expected exit code 16, got %d", code)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	output, _ := interpret(t, "../test/examples/fibonacci.mn", "10\n")
+	if output != "5555" {
+		t.Errorf("expected %q, got %q", "5555", output)
+	}
+}
+
+// TestCallDepth checks a tail call replaces its caller's frame, while a
+// recursion that really is too deep is a runtime error rather than a crash.
+func TestCallDepth(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "depth.mn")
+	src := `функц тоолох(н тоо64, хур тоо64) -> тоо64 {
+    хэрэв н == 0 бол {
+        буц хур;
+    }
+    буц тоолох(н - 1, хур + 1);
+}
+
+функц гүн(н тоо64) -> тоо64 {
+    хэрэв н == 0 бол {
+        буц 0;
+    }
+    буц гүн(н - 1) + 1;
+}
+
+функц үндсэн() -> тоо {
+    хэвлэ(тоолох(1000000, 0));
+    мөр_хэвлэх("\n");
+    хэвлэ(гүн(1000000));
+    буц 0;
+}
+`
+	if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output, _, err := run(t, srcFile, "")
+	if output != "1000000\n" {
+		t.Errorf("expected the tail calls to finish, got %q", output)
+	}
+	if err == nil || !strings.Contains(err.Error(), "дуудлагын гүн") {
+		t.Errorf("expected a call depth error, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ const (
 
 	KeywordImport   Keyword = "ашигла"
 	KeywordPublic   Keyword = "тунх"
+	KeywordNoInline Keyword = "шигтгэхгүй"
 	KeywordBreak    Keyword = "зогс"
 	KeywordContinue Keyword = "үргэлжлүүл"
 	KeywordLoop     Keyword = "давт"
@@ -25,7 +26,16 @@ const (
 	KeywordInt    Keyword = "тоо"
 	KeywordLong   Keyword = "тоо64"
 	KeywordVoid   Keyword = "хоосон"
+	KeywordDouble Keyword = "бутархай"
+	KeywordBool   Keyword = "логик"
+	KeywordTrue   Keyword = "үнэн"
+	KeywordFalse  Keyword = "худал"
 	KeywordString Keyword = "мөр"
 	KeywordNew    Keyword = "шинэ"
+	KeywordStruct Keyword = "бүтэц"
+	// KeywordEnum is scanned as an IDENT, the parser only takes it as a
+	// keyword where it starts a declaration so төрөл stays a valid name
+	KeywordEnum   Keyword = "төрөл"
+	KeywordSwitch Keyword = "сонго"
 	KeywordElse   Keyword = "эсвэл"
 )
@@ -85,7 +85,7 @@ func (s *Scanner) Peek() int32 {
 }
 
 func (s *Scanner) BuildToken(ttype TokenType) Token {
-	if ttype == IDENT || ttype == NUMBER || ttype == STRING {
+	if ttype == IDENT || ttype == NUMBER || ttype == DOUBLE_NUMBER || ttype == STRING {
 		str := string(s.Source[s.Start:s.Cursor])
 		return BuildToken(ttype, &str, int(s.Line), int(s.Start), int(s.Cursor))
 	}
@@ -110,6 +110,9 @@ func (s *Scanner) ToKeyword() (Token, bool) {
 	if str == string(KeywordPublic) {
 		return s.BuildToken(PUBLIC), true
 	}
+	if str == string(KeywordNoInline) {
+		return s.BuildToken(NOINLINE), true
+	}
 	if str == string(KeywordContinue) {
 		return s.BuildToken(CONTINUE), true
 	}
@@ -161,12 +164,30 @@ func (s *Scanner) ToKeyword() (Token, bool) {
 	if str == string(KeywordVoid) {
 		return s.BuildToken(VOID), true
 	}
+	if str == string(KeywordDouble) {
+		return s.BuildToken(DOUBLE_TYPE), true
+	}
+	if str == string(KeywordBool) {
+		return s.BuildToken(BOOL_TYPE), true
+	}
+	if str == string(KeywordTrue) {
+		return s.BuildToken(TRUE), true
+	}
+	if str == string(KeywordFalse) {
+		return s.BuildToken(FALSE), true
+	}
 	if str == string(KeywordReturn) {
 		return s.BuildToken(RETURN), true
 	}
 	if str == string(KeywordNew) {
 		return s.BuildToken(NEW), true
 	}
+	if str == string(KeywordStruct) {
+		return s.BuildToken(STRUCT), true
+	}
+	if str == string(KeywordSwitch) {
+		return s.BuildToken(SWITCH), true
+	}
 	if str == string(KeywordElse) {
 		return s.BuildToken(ELSE), true
 	}
@@ -174,14 +195,50 @@ func (s *Scanner) ToKeyword() (Token, bool) {
 	return Token{}, false
 }
 
+// BuildNumber scans an integer, or a бутархай literal when a fraction or
+// an exponent follows: 3.14, 2.5e-3, 1e9. The dot needs a digit after it,
+// 1..10 stays a range.
 func (s *Scanner) BuildNumber() (Token, error) {
-	for s.isDigit(s.Peek()) {
+	s.digits()
+	isDouble := false
+	if s.Peek() == '.' && s.isDigit(s.peekAt(1)) {
+		isDouble = true
 		s.Next()
-
+		s.digits()
+	}
+	if s.Peek() == 'e' || s.Peek() == 'E' {
+		sign := uint(0)
+		if s.peekAt(1) == '+' || s.peekAt(1) == '-' {
+			sign = 1
+		}
+		if s.isDigit(s.peekAt(1 + sign)) {
+			isDouble = true
+			for i := uint(0); i <= sign; i++ {
+				s.Next()
+			}
+			s.digits()
+		}
 	}
 
+	if isDouble {
+		return s.BuildToken(DOUBLE_NUMBER), nil
+	}
 	return s.BuildToken(NUMBER), nil
 }
+
+func (s *Scanner) digits() {
+	for s.isDigit(s.Peek()) {
+		s.Next()
+	}
+}
+
+// peekAt looks n characters past Peek, 0 past the end of the source.
+func (s *Scanner) peekAt(n uint) int32 {
+	if s.Cursor+n >= uint(len(s.Source)) {
+		return 0
+	}
+	return s.Source[s.Cursor+n]
+}
 func (s *Scanner) BuildIdent() (Token, error) {
 	for s.isAlpha(s.Peek()) || s.Peek() == '_' {
 		s.Next()
@@ -39,36 +39,44 @@ const (
 	LOGICOR  TokenType = "LOGICOR"  // ||
 	NOT      TokenType = "NOT"      // !
 
-	RETURN TokenType = "RETURN"
-	PRINT  TokenType = "PRINT"
-	PUBLIC TokenType = "PUBLIC"
-	IMPORT TokenType = "IMPORT"
-	EXTERN TokenType = "EXTERN"
-	STATIC TokenType = "STATIC"
+	RETURN   TokenType = "RETURN"
+	PRINT    TokenType = "PRINT"
+	PUBLIC   TokenType = "PUBLIC"
+	IMPORT   TokenType = "IMPORT"
+	EXTERN   TokenType = "EXTERN"
+	STATIC   TokenType = "STATIC"
+	NOINLINE TokenType = "NOINLINE" // шигтгэхгүй
 
-	IDENT       TokenType = "IDENT"
-	NUMBER      TokenType = "NUMBER"
-	LONG        TokenType = "LONG"
-	STRING      TokenType = "STRING"
-	FN          TokenType = "FN"
-	VAR_DECL    TokenType = "DECL"
-	OPEN_PAREN  TokenType = "OPEN_PAREN"
-	CLOSE_PAREN TokenType = "CLOSE_PAREN"
-	RIGHT_ARROW TokenType = "RIGHT_ARROW"
+	IDENT         TokenType = "IDENT"
+	NUMBER        TokenType = "NUMBER"
+	DOUBLE_NUMBER TokenType = "DOUBLE_NUMBER" // 3.14, 1e-3
+	LONG          TokenType = "LONG"
+	STRING        TokenType = "STRING"
+	FN            TokenType = "FN"
+	VAR_DECL      TokenType = "DECL"
+	OPEN_PAREN    TokenType = "OPEN_PAREN"
+	CLOSE_PAREN   TokenType = "CLOSE_PAREN"
+	RIGHT_ARROW   TokenType = "RIGHT_ARROW"
 	OPEN_BRACE    TokenType = "OPEN_BRACE"
 	CLOSE_BRACE   TokenType = "CLOSE_BRACE"
 	OPEN_BRACKET  TokenType = "OPEN_BRACKET"  // [
 	CLOSE_BRACKET TokenType = "CLOSE_BRACKET" // ]
-	SEMICOLON   TokenType = "SEMICOLON"
-	COLON       TokenType = "COLON"
-	TILDE       TokenType = "TILDE"
-	EOF         TokenType = "EOF"
+	SEMICOLON     TokenType = "SEMICOLON"
+	COLON         TokenType = "COLON"
+	TILDE         TokenType = "TILDE"
+	EOF           TokenType = "EOF"
 
 	INT_TYPE    TokenType = "INT_TYPE"
 	STRING_TYPE TokenType = "STRING_TYPE"
 	VOID        TokenType = "VOID"
-	NEW         TokenType = "NEW"  // шинэ
-	ELSE        TokenType = "ELSE" // эсвэл
+	DOUBLE_TYPE TokenType = "DOUBLE_TYPE" // бутархай
+	BOOL_TYPE   TokenType = "BOOL_TYPE"
+	TRUE        TokenType = "TRUE"   // үнэн
+	FALSE       TokenType = "FALSE"  // худал
+	NEW         TokenType = "NEW"    // шинэ
+	STRUCT      TokenType = "STRUCT" // бүтэц
+	SWITCH      TokenType = "SWITCH" // сонго
+	ELSE        TokenType = "ELSE"   // эсвэл
 	ERROR       TokenType = "ERROR"
 )
 
@@ -21,6 +21,15 @@ type Linker struct {
 	osType     string
 	genAsm     bool
 	genObj     bool
+	source     string
+	sourceExt  string
+	compiler   string
+	target     string
+	object     []byte
+	executable []byte
+	noLibc     bool
+	nasm       bool
+	shared     bool
 }
 
 func NewLinker(outputFile string) *Linker {
@@ -41,6 +50,87 @@ func (l *Linker) SetAssemblyContent(content string) {
 	l.asmContent = content
 }
 
+// SetSourceContent is for the backends that leave the last step to another
+// compiler: Link writes content next to the output with extension ext and
+// builds it with compiler, cc for C and clang for LLVM IR.
+func (l *Linker) SetSourceContent(content string, ext string, compiler string) {
+	l.source = content
+	l.sourceExt = ext
+	l.compiler = compiler
+}
+
+// SetObjectContent hands over an object file that is already encoded, Link
+// then skips the assembler and only needs cc to link.
+func (l *Linker) SetObjectContent(object []byte) {
+	l.object = object
+}
+
+// SetExecutableContent hands over a static executable written by the
+// compiler itself, Link only puts it in place.
+func (l *Linker) SetExecutableContent(executable []byte) {
+	l.executable = executable
+}
+
+// SetNoLibc links with ld alone, the program carries its own runtime and
+// _start instead of lib.c and libc.
+func (l *Linker) SetNoLibc(noLibc bool) {
+	l.noLibc = noLibc
+}
+
+// SetNasm says the assembly is NASM syntax, it is written to .asm and
+// assembled with nasm.
+func (l *Linker) SetNasm(nasm bool) {
+	l.nasm = nasm
+}
+
+// SetShared links a shared library, OutputFile gets .so (.dylib on macOS)
+// and lib.c is built position independent along with the program.
+func (l *Linker) SetShared(shared bool) {
+	l.shared = shared
+	if !shared {
+		return
+	}
+	if l.osType == "darwin" {
+		l.outputFile += ".dylib"
+	} else {
+		l.outputFile += ".so"
+	}
+}
+
+// stem is the output file without the library extension SetShared gave
+// it, the assembly and the header are named after it.
+func (l *Linker) stem() string {
+	if !l.shared {
+		return l.outputFile
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(l.outputFile, ".so"), ".dylib")
+}
+
+// HeaderFile is where WriteHeader puts the C header, next to the output.
+func (l *Linker) HeaderFile() string {
+	return l.stem() + ".h"
+}
+
+// WriteHeader writes the C header made for --emit-header.
+func (l *Linker) WriteHeader(header string) error {
+	if err := os.WriteFile(l.HeaderFile(), []byte(header), 0644); err != nil {
+		return fmt.Errorf("%s файл бичихэд алдаа гарлаа: %v", l.HeaderFile(), err)
+	}
+	return nil
+}
+
+// SetTarget picks the toolchain for assembly from --target, x86_64 unless
+// told otherwise.
+func (l *Linker) SetTarget(target string) {
+	l.target = target
+}
+
+// crossAArch64 reports whether aarch64 output has to go through the cross
+// toolchain and qemu-user, that is whenever the host is not arm64.
+func (l *Linker) crossAArch64() bool {
+	return l.target == "aarch64" && runtime.GOARCH != "arm64"
+}
+
 func (l *Linker) SetGenerateAsm(genAsm bool) {
 	l.genAsm = genAsm
 }
@@ -57,29 +147,25 @@ func (l *Linker) Link() error {
 
 	outputName := filepath.Base(l.outputFile)
 
-	if l.genAsm {
-		return os.WriteFile(l.outputFile+".s", []byte(l.asmContent), 0644)
+	if l.source != "" {
+		return l.linkSource()
 	}
 
-	tempAsmFile := filepath.Join(outputDir, outputName+".s")
-	if err := os.WriteFile(tempAsmFile, []byte(l.asmContent), 0600); err != nil {
-		return fmt.Errorf("гаралтын түр ассемблер файл үүсгэхэд алдаа гарлаа: %v", err)
+	if l.genAsm {
+		return os.WriteFile(l.stem()+l.asmExt(), []byte(l.asmContent), 0644)
 	}
-	defer os.Remove(tempAsmFile)
 
-	objFile := filepath.Join(outputDir, outputName+".o")
-	var asmCmd *exec.Cmd
-	if l.osType == "darwin" && runtime.GOARCH == "arm64" {
-		asmCmd = exec.Command("arch", "-x86_64", "as", "-o", objFile, tempAsmFile)
-	} else {
-		asmCmd = exec.Command("as", "-o", objFile, tempAsmFile)
+	if l.executable != nil && !l.genObj {
+		return os.WriteFile(l.outputFile, l.executable, 0755)
 	}
 
-	var asmStdout, asmStderr bytes.Buffer
-	asmCmd.Stdout = &asmStdout
-	asmCmd.Stderr = &asmStderr
-	if err := asmCmd.Run(); err != nil {
-		return fmt.Errorf("ассембле хийхэд алдаа гарлаа: %v\nstdout: %s\nstderr: %s", err, asmStdout.String(), asmStderr.String())
+	objFile := filepath.Join(outputDir, outputName+".o")
+	if l.object != nil {
+		if err := os.WriteFile(objFile, l.object, 0644); err != nil {
+			return fmt.Errorf("объект файл бичихэд алдаа гарлаа: %v", err)
+		}
+	} else if err := l.assemble(objFile); err != nil {
+		return err
 	}
 
 	if l.genObj {
@@ -93,7 +179,17 @@ func (l *Linker) Link() error {
 
 	// Use cc to link with libc (provides malloc, printf, etc.)
 	var linkCmd *exec.Cmd
-	if l.osType == "darwin" && runtime.GOARCH == "arm64" {
+	if l.shared && l.osType == "darwin" {
+		linkCmd = exec.Command("cc", "-arch", "x86_64", "-dynamiclib", "-o", l.outputFile, objFile, stdlibFile)
+	} else if l.shared {
+		linkCmd = exec.Command("cc", "-shared", "-fPIC", "-o", l.outputFile, objFile, stdlibFile)
+	} else if l.noLibc {
+		linkCmd = exec.Command("ld", "-static", "-o", l.outputFile, objFile)
+	} else if l.crossAArch64() {
+		linkCmd = exec.Command("aarch64-linux-gnu-gcc", "-o", l.outputFile, objFile, stdlibFile)
+	} else if l.target == "aarch64" {
+		linkCmd = exec.Command("cc", "-o", l.outputFile, objFile, stdlibFile)
+	} else if l.osType == "darwin" && runtime.GOARCH == "arm64" {
 		linkCmd = exec.Command("arch", "-x86_64", "cc", "-arch", "x86_64", "-o", l.outputFile, objFile, stdlibFile)
 	} else if l.osType == "darwin" {
 		linkCmd = exec.Command("cc", "-arch", "x86_64", "-o", l.outputFile, objFile, stdlibFile)
@@ -112,12 +208,94 @@ func (l *Linker) Link() error {
 	return nil
 }
 
+// assemble runs the assembler over the assembly from SetAssemblyContent.
+func (l *Linker) assemble(objFile string) error {
+	tempAsmFile := strings.TrimSuffix(objFile, ".o") + l.asmExt()
+	if err := os.WriteFile(tempAsmFile, []byte(l.asmContent), 0600); err != nil {
+		return fmt.Errorf("гаралтын түр ассемблер файл үүсгэхэд алдаа гарлаа: %v", err)
+	}
+	defer os.Remove(tempAsmFile)
+
+	var asmCmd *exec.Cmd
+	if l.nasm && l.osType == "darwin" {
+		asmCmd = exec.Command("nasm", "-f", "macho64", "-o", objFile, tempAsmFile)
+	} else if l.nasm {
+		asmCmd = exec.Command("nasm", "-f", "elf64", "-o", objFile, tempAsmFile)
+	} else if l.crossAArch64() {
+		asmCmd = exec.Command("aarch64-linux-gnu-as", "-o", objFile, tempAsmFile)
+	} else if l.target == "aarch64" {
+		asmCmd = exec.Command("as", "-o", objFile, tempAsmFile)
+	} else if l.osType == "darwin" && runtime.GOARCH == "arm64" {
+		asmCmd = exec.Command("arch", "-x86_64", "as", "-o", objFile, tempAsmFile)
+	} else {
+		asmCmd = exec.Command("as", "-o", objFile, tempAsmFile)
+	}
+
+	var asmStdout, asmStderr bytes.Buffer
+	asmCmd.Stdout = &asmStdout
+	asmCmd.Stderr = &asmStderr
+	if err := asmCmd.Run(); err != nil {
+		return fmt.Errorf("ассембле хийхэд алдаа гарлаа: %v\nstdout: %s\nstderr: %s", err, asmStdout.String(), asmStderr.String())
+	}
+	return nil
+}
+
+func (l *Linker) asmExt() string {
+	if l.nasm {
+		return ".asm"
+	}
+	return ".s"
+}
+
+// WriteSource only writes the source file given to SetSourceContent and
+// returns its path.
+func (l *Linker) WriteSource() (string, error) {
+	sourceFile := l.outputFile + l.sourceExt
+	if err := os.WriteFile(sourceFile, []byte(l.source), 0644); err != nil {
+		return "", fmt.Errorf("%s файл бичихэд алдаа гарлаа: %v", sourceFile, err)
+	}
+	return sourceFile, nil
+}
+
+// linkSource keeps the generated source file, it is what gets carried to
+// machines the assembly backend doesn't run on.
+func (l *Linker) linkSource() error {
+	sourceFile, err := l.WriteSource()
+	if err != nil {
+		return err
+	}
+
+	// -O2 so calls in tail position don't grow the stack, as in the assembly
+	// backend
+	var compileCmd *exec.Cmd
+	switch {
+	case l.genAsm:
+		compileCmd = exec.Command(l.compiler, "-O2", "-S", "-o", l.outputFile+".s", sourceFile)
+	case l.genObj:
+		compileCmd = exec.Command(l.compiler, "-O2", "-c", "-o", l.outputFile+".o", sourceFile)
+	default:
+		compileCmd = exec.Command(l.compiler, "-O2", "-o", l.outputFile, sourceFile, filepath.Join(STDLIB_DIR, "lib.c"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	compileCmd.Stdout = &stdout
+	compileCmd.Stderr = &stderr
+	if err := compileCmd.Run(); err != nil {
+		return fmt.Errorf("%s-ээр хөрвүүлэхэд алдаа гарлаа: %v\nstdout: %s\nstderr: %s", l.compiler, err, stdout.String(), stderr.String())
+	}
+	return nil
+}
+
 func (l *Linker) MakeExecutable() error {
 	return os.Chmod(l.outputFile, 0755)
 }
 
-func (l *Linker) Run() error {
-	cmd := exec.Command(l.outputFile)
+// Run starts the program with args after its name.
+func (l *Linker) Run(args ...string) error {
+	cmd := exec.Command(l.outputFile, args...)
+	if l.crossAArch64() {
+		cmd = exec.Command("qemu-aarch64", append([]string{"-L", "/usr/aarch64-linux-gnu", l.outputFile}, args...)...)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
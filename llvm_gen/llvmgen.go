@@ -0,0 +1,644 @@
+package llvmgen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+// LLVMGen translates a TackyProgram into textual LLVM IR. Every TACKY
+// variable gets an alloca in the entry block and is loaded and stored around
+// each use, mem2reg turns them into SSA values once opt or clang run.
+type LLVMGen struct {
+	writer      io.Writer
+	symbolTable *symbols.SymbolTable
+
+	fnTypes    map[string]*mtypes.FnType
+	externs    map[string]bool
+	globals    map[string]bool
+	strings    map[string]int
+	stringList []string
+
+	// per function
+	body       []string
+	tempCount  int
+	blockCount int
+	terminated bool
+}
+
+func NewLLVMGen(writer io.Writer, symbolTable *symbols.SymbolTable) LLVMGen {
+	return LLVMGen{
+		writer:      writer,
+		symbolTable: symbolTable,
+		fnTypes:     make(map[string]*mtypes.FnType),
+		externs:     make(map[string]bool),
+		globals:     make(map[string]bool),
+		strings:     make(map[string]int),
+	}
+}
+
+var plainIdent = regexp.MustCompile(`^[A-Za-z$._][A-Za-z$._0-9]*$`)
+
+// ident writes name after the @ or % sigil, quoted when it has characters
+// LLVM identifiers can't hold unquoted.
+func ident(sigil string, name string) string {
+	if plainIdent.MatchString(name) {
+		return sigil + name
+	}
+	return sigil + quote(name)
+}
+
+// quote escapes what can't appear between quotes in LLVM assembly, UTF-8
+// is left readable.
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b < 0x20 || b == 0x7f || b == '"' || b == '\\' {
+			fmt.Fprintf(&buf, "\\%02X", b)
+		} else {
+			buf.WriteByte(b)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// fnIdent spells function names the way the assembly backend does, mangled
+// with utfconvert.Mangle, the externs have to match the symbols in lib.c.
+func (l *LLVMGen) fnIdent(name string) string {
+	if l.externs[name] {
+		return ident("@", utfconvert.UtfConvert(name))
+	}
+	return ident("@", utfconvert.Mangle(name))
+}
+
+func varIdent(name string) string {
+	return ident("%", name)
+}
+
+func labelIdent(name string) string {
+	return ident("%", "L."+name)
+}
+
+func llType(t mtypes.Type) string {
+	switch t.(type) {
+	case *mtypes.VoidType:
+		return "void"
+	case *mtypes.Int32Type, *mtypes.EnumType:
+		return "i32"
+	case *mtypes.BoolType:
+		return "i8"
+	case *mtypes.DoubleType:
+		return "double"
+	case *mtypes.StringType, *mtypes.ArrayType, *mtypes.StructType:
+		return "ptr"
+	default:
+		return "i64"
+	}
+}
+
+func (l *LLVMGen) varType(name string) string {
+	entry := l.symbolTable.Get(name)
+	if entry == nil {
+		return "i64"
+	}
+	return llType(entry.Type)
+}
+
+func (l *LLVMGen) valType(val tackygen.TackyVal) string {
+	switch v := val.(type) {
+	case tackygen.Var:
+		return l.varType(v.Name)
+	case tackygen.Constant:
+		switch v.Value.(type) {
+		case *mconstant.Int32:
+			return "i32"
+		case *mconstant.Bool:
+			return "i8"
+		case *mconstant.Double:
+			return "double"
+		}
+		return "i64"
+	case tackygen.StringConstant:
+		return "ptr"
+	}
+	panic(fmt.Sprintf("unimplemented val: %T", val))
+}
+
+func (l *LLVMGen) GenProgram(program tackygen.TackyProgram) {
+	for _, fn := range append(append([]tackygen.TackyFn{}, program.ExternDefs...), program.FnDefs...) {
+		if entry := l.symbolTable.Get(fn.Name); entry != nil {
+			if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+				l.fnTypes[fn.Name] = fnType
+			}
+		}
+	}
+	for _, fn := range program.ExternDefs {
+		l.externs[fn.Name] = true
+	}
+	for _, gv := range program.GlobalVars {
+		l.globals[gv.Name] = true
+	}
+
+	l.Write("; mon компиляторын үүсгэсэн LLVM IR")
+	l.Write("")
+	l.Write("declare ptr @malloc(i64)")
+	for _, fn := range program.ExternDefs {
+		if fnType, ok := l.fnTypes[fn.Name]; ok {
+			params := []string{}
+			for _, paramType := range fnType.ParamTypes {
+				params = append(params, llType(paramType))
+			}
+			l.Write(fmt.Sprintf("declare %s %s(%s)", llType(fnType.RetType), l.fnIdent(fn.Name), strings.Join(params, ", ")))
+		}
+	}
+	l.Write("")
+
+	if len(program.GlobalVars) > 0 {
+		for _, gv := range program.GlobalVars {
+			llt := l.varType(gv.Name)
+			init := fmt.Sprintf("%d", gv.InitValue)
+			switch llt {
+			case "double":
+				init = llDouble(math.Float64frombits(uint64(gv.InitValue)))
+			case "ptr":
+				// a global бүтэц or array starts out as a null reference
+				init = "null"
+			}
+			l.Write(fmt.Sprintf("%s = internal global %s %s, align %d", ident("@", gv.Name), llt, init, gv.Size))
+		}
+		l.Write("")
+	}
+
+	hasMain := false
+	for _, fn := range program.FnDefs {
+		l.GenFn(fn)
+		l.Write("")
+		hasMain = hasMain || fn.Name == "үндсэн"
+	}
+
+	if hasMain {
+		retType, arg := "i32", ""
+		if fnType := l.fnTypes["үндсэн"]; fnType != nil {
+			retType = llType(fnType.RetType)
+			if len(fnType.ParamTypes) == 1 {
+				arg = "ptr %argv"
+			}
+		}
+		// like the assembly entry, the runtime sees argc and argv first and
+		// аргс is argv
+		l.Write("declare ptr @mon_rt_args(i32, ptr)")
+		l.Write("")
+		l.Write("define i32 @main(i32 %argc, ptr %argv) {")
+		l.Write("entry:")
+		l.Write("  call ptr @mon_rt_args(i32 %argc, ptr %argv)")
+		switch retType {
+		case "void":
+			l.Write(fmt.Sprintf("  call void %s(%s)", l.fnIdent("үндсэн"), arg))
+			l.Write("  ret i32 0")
+		case "i64":
+			l.Write(fmt.Sprintf("  %%result = call i64 %s(%s)", l.fnIdent("үндсэн"), arg))
+			l.Write("  %code = trunc i64 %result to i32")
+			l.Write("  ret i32 %code")
+		default:
+			l.Write(fmt.Sprintf("  %%result = call i32 %s(%s)", l.fnIdent("үндсэн"), arg))
+			l.Write("  ret i32 %result")
+		}
+		l.Write("}")
+		l.Write("")
+	}
+
+	for i, s := range l.stringList {
+		l.Write(fmt.Sprintf("@.str.%d = private unnamed_addr constant [%d x i8] c%s", i, len(s)+1, quote(s+"\x00")))
+	}
+}
+
+func (l *LLVMGen) GenFn(fn tackygen.TackyFn) {
+	l.body = nil
+	l.tempCount = 0
+	l.blockCount = 0
+	l.terminated = false
+
+	fnType := l.fnTypes[fn.Name]
+	retType := "i32"
+	if fnType != nil {
+		retType = llType(fnType.RetType)
+	}
+
+	locals := []string{}
+	seen := map[string]bool{}
+	addLocal := func(val tackygen.TackyVal) {
+		v, ok := val.(tackygen.Var)
+		if !ok || seen[v.Name] || l.globals[v.Name] {
+			return
+		}
+		seen[v.Name] = true
+		locals = append(locals, v.Name)
+	}
+	for _, param := range fn.Params {
+		addLocal(param)
+	}
+	for _, instr := range fn.Instructions {
+		uses, def := tackygen.UsesAndDef(instr)
+		for _, use := range uses {
+			addLocal(use)
+		}
+		if def != nil {
+			addLocal(def)
+		}
+	}
+
+	params := []string{}
+	for i, param := range fn.Params {
+		params = append(params, fmt.Sprintf("%s %%.arg%d", l.paramType(fnType, i, param), i))
+	}
+
+	linkage := "internal "
+	if fn.Global {
+		linkage = ""
+	}
+	l.Write(fmt.Sprintf("define %s%s %s(%s) {", linkage, retType, l.fnIdent(fn.Name), strings.Join(params, ", ")))
+	l.Write("entry:")
+	for _, name := range locals {
+		if l.varType(name) == "void" {
+			continue
+		}
+		l.Write(fmt.Sprintf("  %s = alloca %s", varIdent(name), l.varType(name)))
+	}
+	for i, param := range fn.Params {
+		paramType := l.paramType(fnType, i, param)
+		arg := l.coerce(fmt.Sprintf("%%.arg%d", i), paramType, l.valType(param))
+		l.store(param.(tackygen.Var), arg)
+	}
+
+	for _, instr := range fn.Instructions {
+		l.genInstr(retType, instr)
+	}
+	if !l.terminated {
+		l.emit("unreachable")
+	}
+	for _, line := range l.body {
+		l.Write(line)
+	}
+	l.Write("}")
+}
+
+func (l *LLVMGen) paramType(fnType *mtypes.FnType, i int, param tackygen.TackyVal) string {
+	if fnType != nil && i < len(fnType.ParamTypes) {
+		return llType(fnType.ParamTypes[i])
+	}
+	return l.valType(param)
+}
+
+func (l *LLVMGen) emit(format string, args ...interface{}) {
+	l.body = append(l.body, "  "+fmt.Sprintf(format, args...))
+}
+
+func (l *LLVMGen) temp() string {
+	name := fmt.Sprintf("%%.t%d", l.tempCount)
+	l.tempCount++
+	return name
+}
+
+// startBlock opens a new basic block, falling through into it when the one
+// before isn't terminated yet.
+func (l *LLVMGen) startBlock(label string) {
+	if !l.terminated {
+		l.emit("br label %s", label)
+	}
+	l.body = append(l.body, strings.TrimPrefix(label, "%")+":")
+	l.terminated = false
+}
+
+// openBlock makes sure instructions after a terminator land in a block of
+// their own, code after a return or a jump is unreachable but still valid
+// TACKY.
+func (l *LLVMGen) openBlock() {
+	if l.terminated {
+		l.body = append(l.body, fmt.Sprintf(".b%d:", l.blockCount))
+		l.blockCount++
+		l.terminated = false
+	}
+}
+
+// coerce converts value from one LLVM type to another. TACKY does address
+// arithmetic on 64-bit integers, so pointers and i64 meet often. логик is an
+// i8 holding 0 or 1, it widens with zext.
+func (l *LLVMGen) coerce(value string, from string, to string) string {
+	if from == to {
+		return value
+	}
+	var op string
+	switch {
+	case from == "ptr":
+		op = "ptrtoint"
+	case to == "ptr":
+		op = "inttoptr"
+	case from == "i32" && to == "i64":
+		op = "sext"
+	case from == "i8":
+		op = "zext"
+	case from == "i64" && to == "i32", to == "i8":
+		op = "trunc"
+	default:
+		panic(fmt.Sprintf("can't convert %s to %s", from, to))
+	}
+	dst := l.temp()
+	l.emit("%s = %s %s %s to %s", dst, op, from, value, to)
+	return dst
+}
+
+// value reads val as an LLVM value of type want.
+func (l *LLVMGen) value(val tackygen.TackyVal, want string) string {
+	switch v := val.(type) {
+	case tackygen.Var:
+		llt := l.varType(v.Name)
+		dst := l.temp()
+		l.emit("%s = load %s, ptr %s", dst, llt, l.address(v))
+		return l.coerce(dst, llt, want)
+	case tackygen.Constant:
+		if d, ok := v.Value.(*mconstant.Double); ok {
+			return llDouble(d.Value)
+		}
+		if want == "ptr" {
+			return l.coerce(fmt.Sprintf("%d", v.Value.GetValue()), "i64", want)
+		}
+		return fmt.Sprintf("%d", v.Value.GetValue())
+	case tackygen.StringConstant:
+		return l.coerce(l.stringRef(v.Value), "ptr", want)
+	}
+	panic(fmt.Sprintf("unimplemented val: %T", val))
+}
+
+// llDouble writes f the way LLVM wants a double it can read back exactly,
+// the hexadecimal form of its bits.
+func llDouble(f float64) string {
+	return fmt.Sprintf("0x%016X", math.Float64bits(f))
+}
+
+func (l *LLVMGen) address(v tackygen.Var) string {
+	if l.globals[v.Name] {
+		return ident("@", v.Name)
+	}
+	return varIdent(v.Name)
+}
+
+func (l *LLVMGen) store(dst tackygen.Var, value string) {
+	l.emit("store %s %s, ptr %s", l.varType(dst.Name), value, l.address(dst))
+}
+
+func (l *LLVMGen) stringRef(s string) string {
+	id, ok := l.strings[s]
+	if !ok {
+		id = len(l.stringList)
+		l.strings[s] = id
+		l.stringList = append(l.stringList, s)
+	}
+	return fmt.Sprintf("@.str.%d", id)
+}
+
+var arithOps = map[tackygen.TackyBinaryOp]string{
+	tackygen.Add:    "add",
+	tackygen.Sub:    "sub",
+	tackygen.Mul:    "mul",
+	tackygen.Div:    "sdiv",
+	tackygen.Modulo: "srem",
+}
+
+var compareOps = map[tackygen.TackyBinaryOp]string{
+	tackygen.Equal:            "eq",
+	tackygen.NotEqual:         "ne",
+	tackygen.LessThan:         "slt",
+	tackygen.LessThanEqual:    "sle",
+	tackygen.GreaterThan:      "sgt",
+	tackygen.GreaterThanEqual: "sge",
+}
+
+var doubleArithOps = map[tackygen.TackyBinaryOp]string{
+	tackygen.Add: "fadd",
+	tackygen.Sub: "fsub",
+	tackygen.Mul: "fmul",
+	tackygen.Div: "fdiv",
+}
+
+// doubleCompareOps are ordered, false when either side is a NaN, except for
+// != which is true then.
+var doubleCompareOps = map[tackygen.TackyBinaryOp]string{
+	tackygen.Equal:            "oeq",
+	tackygen.NotEqual:         "une",
+	tackygen.LessThan:         "olt",
+	tackygen.LessThanEqual:    "ole",
+	tackygen.GreaterThan:      "ogt",
+	tackygen.GreaterThanEqual: "oge",
+}
+
+// intType is the integer type a value of LLVM type t is compared as.
+func intType(t string) string {
+	if t == "ptr" {
+		return "i64"
+	}
+	return t
+}
+
+func (l *LLVMGen) genInstr(retType string, instr tackygen.Instruction) {
+	if lbl, ok := instr.(tackygen.Label); ok {
+		l.startBlock(labelIdent(lbl.Ident))
+		return
+	}
+	if _, ok := instr.(tackygen.SourceLine); ok {
+		return
+	}
+	l.openBlock()
+
+	switch ir := instr.(type) {
+	case tackygen.Copy:
+		dst := ir.Dst.(tackygen.Var)
+		l.store(dst, l.value(ir.Src, l.varType(dst.Name)))
+	case tackygen.Truncate:
+		dst := ir.Dst.(tackygen.Var)
+		l.store(dst, l.value(ir.Src, l.varType(dst.Name)))
+	case tackygen.SignExtend:
+		dst := ir.Dst.(tackygen.Var)
+		l.store(dst, l.value(ir.Src, l.varType(dst.Name)))
+	case tackygen.IntToDouble:
+		dst := ir.Dst.(tackygen.Var)
+		srcType := intType(l.valType(ir.Src))
+		result := l.temp()
+		l.emit("%s = sitofp %s %s to double", result, srcType, l.value(ir.Src, srcType))
+		l.store(dst, result)
+	case tackygen.DoubleToInt:
+		dst := ir.Dst.(tackygen.Var)
+		dstType := l.varType(dst.Name)
+		result := l.temp()
+		l.emit("%s = fptosi double %s to %s", result, l.value(ir.Src, "double"), dstType)
+		l.store(dst, result)
+	case tackygen.Unary:
+		dst := ir.Dst.(tackygen.Var)
+		dstType := intType(l.varType(dst.Name))
+		result := l.temp()
+		switch {
+		case ir.Op == tackygen.Negate && dstType == "double":
+			l.emit("%s = fneg double %s", result, l.value(ir.Src, dstType))
+		case ir.Op == tackygen.Negate:
+			l.emit("%s = sub %s 0, %s", result, dstType, l.value(ir.Src, dstType))
+		case ir.Op == tackygen.Complement:
+			l.emit("%s = xor %s %s, -1", result, dstType, l.value(ir.Src, dstType))
+		case ir.Op == tackygen.Not:
+			srcType := intType(l.valType(ir.Src))
+			cond := l.temp()
+			l.emit("%s = icmp eq %s %s, 0", cond, srcType, l.value(ir.Src, srcType))
+			l.emit("%s = zext i1 %s to %s", result, cond, dstType)
+		default:
+			panic(fmt.Sprintf("unimplemented unary op: %s", ir.Op))
+		}
+		l.store(dst, l.coerce(result, dstType, l.varType(dst.Name)))
+	case tackygen.Binary:
+		dst := ir.Dst.(tackygen.Var)
+		dstType := intType(l.varType(dst.Name))
+		result := l.temp()
+		if l.valType(ir.Src1) == "double" {
+			l.genDoubleBinary(ir, dstType, result)
+		} else if op, ok := arithOps[ir.Op]; ok {
+			src1 := l.value(ir.Src1, dstType)
+			src2 := l.value(ir.Src2, dstType)
+			l.emit("%s = %s %s %s, %s", result, op, dstType, src1, src2)
+		} else if cc, ok := compareOps[ir.Op]; ok {
+			// compare in the wider of the two operand types
+			cmpType := "i32"
+			if intType(l.valType(ir.Src1)) == "i64" || intType(l.valType(ir.Src2)) == "i64" {
+				cmpType = "i64"
+			}
+			src1 := l.value(ir.Src1, cmpType)
+			src2 := l.value(ir.Src2, cmpType)
+			cond := l.temp()
+			l.emit("%s = icmp %s %s %s, %s", cond, cc, cmpType, src1, src2)
+			l.emit("%s = zext i1 %s to %s", result, cond, dstType)
+		} else {
+			panic(fmt.Sprintf("unimplemented binary op: %s", ir.Op))
+		}
+		l.store(dst, l.coerce(result, dstType, l.varType(dst.Name)))
+	case tackygen.Load:
+		dst := ir.Dst.(tackygen.Var)
+		addr := l.value(ir.Src, "ptr")
+		result := l.temp()
+		l.emit("%s = load %s, ptr %s", result, l.varType(dst.Name), addr)
+		l.store(dst, result)
+	case tackygen.Store:
+		addr := l.value(ir.Dst, "ptr")
+		srcType := l.valType(ir.Src)
+		l.emit("store %s %s, ptr %s", srcType, l.value(ir.Src, srcType), addr)
+	case tackygen.Jump:
+		l.emit("br label %s", labelIdent(ir.Target))
+		l.terminated = true
+	case tackygen.JumpIfZero:
+		l.condJump(ir.Val, "eq", ir.Ident)
+	case tackygen.JumpIfNotZero:
+		l.condJump(ir.Val, "ne", ir.Ident)
+	case tackygen.JumpTable:
+		l.jumpTable(ir)
+	case tackygen.Return:
+		if retType == "void" {
+			l.emit("ret void")
+		} else {
+			l.emit("ret %s %s", retType, l.value(ir.Value, retType))
+		}
+		l.terminated = true
+	case tackygen.FnCall:
+		l.genCall(ir)
+	default:
+		panic(fmt.Sprintf("unimplemented instruction: %T", instr))
+	}
+}
+
+// genDoubleBinary is the бутархай half of Binary, both operands are doubles.
+func (l *LLVMGen) genDoubleBinary(ir tackygen.Binary, dstType string, result string) {
+	src1 := l.value(ir.Src1, "double")
+	src2 := l.value(ir.Src2, "double")
+	if op, ok := doubleArithOps[ir.Op]; ok {
+		l.emit("%s = %s double %s, %s", result, op, src1, src2)
+		return
+	}
+	cc, ok := doubleCompareOps[ir.Op]
+	if !ok {
+		panic(fmt.Sprintf("unimplemented double op: %s", ir.Op))
+	}
+	cond := l.temp()
+	l.emit("%s = fcmp %s double %s, %s", cond, cc, src1, src2)
+	l.emit("%s = zext i1 %s to %s", result, cond, dstType)
+}
+
+func (l *LLVMGen) condJump(val tackygen.TackyVal, cc string, target string) {
+	valType := intType(l.valType(val))
+	cond := l.temp()
+	l.emit("%s = icmp %s %s %s, 0", cond, cc, valType, l.value(val, valType))
+	next := fmt.Sprintf("%%.b%d", l.blockCount)
+	l.blockCount++
+	l.emit("br i1 %s, label %s, label %s", cond, labelIdent(target), next)
+	l.terminated = true
+	l.startBlock(next)
+}
+
+// jumpTable becomes a switch, tackygen checked the range before so the
+// default is never taken and can be any of the targets.
+func (l *LLVMGen) jumpTable(table tackygen.JumpTable) {
+	indexType := intType(l.valType(table.Index))
+	cases := make([]string, len(table.Targets))
+	for i, target := range table.Targets {
+		cases[i] = fmt.Sprintf("%s %d, label %s", indexType, i, labelIdent(target))
+	}
+	l.emit("switch %s %s, label %s [ %s ]", indexType, l.value(table.Index, indexType),
+		labelIdent(table.Targets[0]), strings.Join(cases, " "))
+	l.terminated = true
+}
+
+func (l *LLVMGen) genCall(call tackygen.FnCall) {
+	fnType := l.fnTypes[call.Name]
+	args := []string{}
+	for i, arg := range call.Args {
+		var paramType string
+		switch {
+		case call.Name == "malloc":
+			paramType = "i64"
+		case fnType != nil && i < len(fnType.ParamTypes):
+			paramType = llType(fnType.ParamTypes[i])
+		default:
+			paramType = l.valType(arg)
+		}
+		args = append(args, fmt.Sprintf("%s %s", paramType, l.value(arg, paramType)))
+	}
+
+	retType := "i64"
+	switch {
+	case call.Name == "malloc":
+		retType = "ptr"
+	case fnType != nil:
+		retType = llType(fnType.RetType)
+	}
+
+	callee := l.fnIdent(call.Name)
+	if call.Name == "malloc" {
+		callee = "@malloc"
+	}
+	dst, hasDst := call.Dst.(tackygen.Var)
+	if retType == "void" || !hasDst || l.varType(dst.Name) == "void" {
+		l.emit("call %s %s(%s)", retType, callee, strings.Join(args, ", "))
+		return
+	}
+	result := l.temp()
+	l.emit("%s = call %s %s(%s)", result, retType, callee, strings.Join(args, ", "))
+	l.store(dst, l.coerce(result, retType, l.varType(dst.Name)))
+}
+
+func (l *LLVMGen) Write(line string) {
+	fmt.Fprintln(l.writer, line)
+}
@@ -0,0 +1,129 @@
+package llvmgen
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/parser"
+	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func genIR(t *testing.T, srcFile string) string {
+	t.Helper()
+	data, err := os.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	source := append([]int32(string(data)), 0)
+
+	uniqueGen := unique.NewUniqueGen()
+	p := parser.NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	table := symbols.NewSymbolTable()
+	resolver := semanticanalysis.NewSemanticAnalyzer(source, uniqueGen, table, filepath.Dir(srcFile), "../stdlib")
+	resolved, symbolTable, err := resolver.Analyze(program)
+	if err != nil {
+		t.Fatalf("semantic analysis failed: %v", err)
+	}
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolved)
+
+	var ir bytes.Buffer
+	llvmGen := NewLLVMGen(&ir, symbolTable)
+	llvmGen.GenProgram(tackyProgram)
+	return ir.String()
+}
+
+func compileAndRun(t *testing.T, srcFile string, input string) string {
+	t.Helper()
+	clang, err := exec.LookPath("clang")
+	if err != nil {
+		t.Skip("clang not found")
+	}
+
+	dir := t.TempDir()
+	llFile := filepath.Join(dir, "out.ll")
+	if err := os.WriteFile(llFile, []byte(genIR(t, srcFile)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "out")
+	if out, err := exec.Command(clang, "-O2", "-o", exe, llFile, "../stdlib/lib.c").CombinedOutput(); err != nil {
+		t.Fatalf("clang failed: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(exe)
+	cmd.Stdin = strings.NewReader(input)
+	output, _ := cmd.Output()
+	return string(output)
+}
+
+// TestVerify runs the IR of the feature tests through llvm-as, which
+// rejects anything the LLVM verifier doesn't accept.
+func TestVerify(t *testing.T) {
+	llvmAs, err := exec.LookPath("llvm-as")
+	if err != nil {
+		t.Skip("llvm-as not found")
+	}
+	for _, name := range []string{"conditionals", "control_flow", "free", "functions", "globals", "strings", "tail_calls", "types", "doubles", "structs", "enums", "switch"} {
+		file := "../test/features/" + name + ".mn"
+		ir := genIR(t, file)
+		out, err := runLLVMAs(llvmAs, ir)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", file, err, out)
+		}
+	}
+}
+
+// runLLVMAs retries with -opaque-pointers for LLVM 14, where ptr is still
+// behind a flag.
+func runLLVMAs(llvmAs string, ir string) ([]byte, error) {
+	cmd := exec.Command(llvmAs, "-o", os.DevNull)
+	cmd.Stdin = strings.NewReader(ir)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return out, nil
+	}
+	cmd = exec.Command(llvmAs, "-opaque-pointers", "-o", os.DevNull)
+	cmd.Stdin = strings.NewReader(ir)
+	return cmd.CombinedOutput()
+}
+
+func TestControlFlow(t *testing.T) {
+	output := compileAndRun(t, "../test/features/control_flow.mn", "")
+	if output != "3 12 6 20 99\n" {
+		t.Errorf("expected %q, got %q", "3 12 6 20 99\n", output)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	output := compileAndRun(t, "../test/features/tail_calls.mn", "")
+	if output != "50000005000000 21 20\n" {
+		t.Errorf("expected %q, got %q", "50000005000000 21 20\n", output)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	output := compileAndRun(t, "../test/examples/fibonacci.mn", "10\n")
+	if output != "5555" {
+		t.Errorf("expected %q, got %q", "5555", output)
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	expected := "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+	output := compileAndRun(t, "../test/features/doubles.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
@@ -1,5 +1,7 @@
 package mconstant
 
+import "math"
+
 var IntZero = Int32{
 	Value: 0,
 }
@@ -8,6 +10,14 @@ var IntOne = Int32{
 	Value: 1,
 }
 
+var False = Bool{
+	Value: false,
+}
+
+var True = Bool{
+	Value: true,
+}
+
 type Const interface {
 	constant()
 	GetValue() int64
@@ -26,3 +36,25 @@ type Int32 struct {
 
 func (i Int32) constant()       {}
 func (i Int32) GetValue() int64 { return int64(i.Value) }
+
+// Bool is a логик constant, GetValue gives 1 for үнэн and 0 for худал.
+type Bool struct {
+	Value bool
+}
+
+func (b Bool) constant() {}
+func (b Bool) GetValue() int64 {
+	if b.Value {
+		return 1
+	}
+	return 0
+}
+
+// Double is a бутархай constant, GetValue gives its IEEE 754 bits so it can
+// go into memory or a general register as it is.
+type Double struct {
+	Value float64
+}
+
+func (d Double) constant()       {}
+func (d Double) GetValue() int64 { return int64(math.Float64bits(d.Value)) }
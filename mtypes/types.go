@@ -16,6 +16,17 @@ type Int32Type struct{}
 
 func (t *Int32Type) typecheck() {}
 
+// DoubleType is бутархай, an IEEE 754 double.
+type DoubleType struct{}
+
+func (t *DoubleType) typecheck() {}
+
+// BoolType is логик, the type of comparisons and conditions. It takes one
+// byte in memory.
+type BoolType struct{}
+
+func (t *BoolType) typecheck() {}
+
 type StringType struct{}
 
 func (t *StringType) typecheck() {}
@@ -26,6 +37,87 @@ type ArrayType struct {
 
 func (t *ArrayType) typecheck() {}
 
+// StructType is a бүтэц. A value of it is a reference to a heap block laid
+// out like a C struct: every field sits at a multiple of its alignment and
+// the size is rounded up to the largest one. The parser only knows the
+// name, the type checker fills in the fields with SetFields.
+type StructType struct {
+	Name   string
+	Fields []Field
+	Size   int64
+	Align  int64
+}
+
+type Field struct {
+	Name   string
+	Type   Type
+	Offset int64
+}
+
+func (t *StructType) typecheck() {}
+
+// SetFields lays the fields out in the order they are declared.
+func (t *StructType) SetFields(fields []Field) {
+	t.Fields = fields
+	t.Size, t.Align = 0, 1
+	for i := range t.Fields {
+		size := SizeOf(t.Fields[i].Type)
+		t.Size = alignUp(t.Size, size)
+		t.Fields[i].Offset = t.Size
+		t.Size += size
+		t.Align = max(t.Align, size)
+	}
+	t.Size = alignUp(t.Size, t.Align)
+}
+
+// Field finds a field by name.
+func (t *StructType) Field(name string) (Field, bool) {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// EnumType is a төрөл, a closed set of named values. A value of it is the
+// index of its variant, kept as a тоо, but it only turns into a тоо or
+// back through a cast. The parser only knows the name, the type checker
+// hands out the declared one.
+type EnumType struct {
+	Name     string
+	Variants []string
+}
+
+func (t *EnumType) typecheck() {}
+
+// Variant gives the tag of a variant by name.
+func (t *EnumType) Variant(name string) (int64, bool) {
+	for i, variant := range t.Variants {
+		if variant == name {
+			return int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// SizeOf is how many bytes a value of t takes in memory, which is also its
+// alignment. логик takes 1, тоо and төрөл 4. мөр, arrays and structs are
+// pointers, they take 8 like тоо64 and бутархай.
+func SizeOf(t Type) int64 {
+	switch t.(type) {
+	case *BoolType:
+		return 1
+	case *Int32Type, *EnumType:
+		return 4
+	}
+	return 8
+}
+
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
 type FnType struct {
 	ParamTypes []Type
 	RetType    Type
@@ -0,0 +1,230 @@
+package optimizer
+
+import (
+	"math"
+
+	"github.com/your-moon/mon_lang/mconstant"
+
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// ConstantFolding evaluates instructions whose operands are all constants and
+// turns conditional jumps on constants into plain jumps or nothing.
+type ConstantFolding struct {
+	symbolTable *symbols.SymbolTable
+}
+
+func NewConstantFolding(table *symbols.SymbolTable) *ConstantFolding {
+	return &ConstantFolding{symbolTable: table}
+}
+
+func (c *ConstantFolding) Name() string { return "constant-folding" }
+
+func (c *ConstantFolding) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	changed := false
+	out := make([]tackygen.Instruction, 0, len(fn.Instructions))
+
+	for _, instr := range fn.Instructions {
+		folded, keep, ok := c.fold(instr)
+		if !ok {
+			out = append(out, instr)
+			continue
+		}
+		changed = true
+		if keep {
+			out = append(out, folded)
+		}
+	}
+
+	fn.Instructions = out
+	return fn, changed
+}
+
+// fold returns the replacement for instr, whether the replacement should be
+// kept at all, and whether folding applied.
+func (c *ConstantFolding) fold(instr tackygen.Instruction) (tackygen.Instruction, bool, bool) {
+	switch ir := instr.(type) {
+	case tackygen.Binary:
+		a, ok1 := ir.Src1.(tackygen.Constant)
+		b, ok2 := ir.Src2.(tackygen.Constant)
+		if !ok1 || !ok2 {
+			return nil, false, false
+		}
+		if isDouble(ir.Src1, c.symbolTable) {
+			value, ok := evalDoubleBinary(ir.Op, a.Value.(*mconstant.Double).Value, b.Value.(*mconstant.Double).Value)
+			if !ok {
+				return nil, false, false
+			}
+			return tackygen.Copy{Src: constantLike(value, ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+		}
+		value, ok := evalBinary(ir.Op, a.Value.GetValue(), b.Value.GetValue(), is32(ir.Src1, c.symbolTable))
+		if !ok {
+			return nil, false, false
+		}
+		return tackygen.Copy{Src: constantLike(value, ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+	case tackygen.Unary:
+		src, ok := ir.Src.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		if d, double := src.Value.(*mconstant.Double); double {
+			if ir.Op != tackygen.Negate {
+				return nil, false, false
+			}
+			return tackygen.Copy{Src: tackygen.Constant{Value: &mconstant.Double{Value: -d.Value}}, Dst: ir.Dst}, true, true
+		}
+		value := evalUnary(ir.Op, src.Value.GetValue(), is32(ir.Src, c.symbolTable))
+		return tackygen.Copy{Src: constantLike(value, ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+	case tackygen.IntToDouble:
+		src, ok := ir.Src.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		return tackygen.Copy{Src: tackygen.Constant{Value: &mconstant.Double{Value: float64(src.Value.GetValue())}}, Dst: ir.Dst}, true, true
+	case tackygen.DoubleToInt:
+		src, ok := ir.Src.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		// out of range the hardware decides, so that is left to run
+		d := math.Trunc(src.Value.(*mconstant.Double).Value)
+		if is32(ir.Dst, c.symbolTable) && (d < math.MinInt32 || d > math.MaxInt32) || !(d >= math.MinInt64 && d < math.MaxInt64) {
+			return nil, false, false
+		}
+		return tackygen.Copy{Src: constantLike(int64(d), ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+	case tackygen.SignExtend:
+		src, ok := ir.Src.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		return tackygen.Copy{Src: constantLike(int64(int32(src.Value.GetValue())), ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+	case tackygen.Truncate:
+		src, ok := ir.Src.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		return tackygen.Copy{Src: constantLike(int64(int32(src.Value.GetValue())), ir.Dst, c.symbolTable), Dst: ir.Dst}, true, true
+	case tackygen.JumpIfZero:
+		val, ok := ir.Val.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		if val.Value.GetValue() == 0 {
+			return tackygen.Jump{Target: ir.Ident}, true, true
+		}
+		return nil, false, true
+	case tackygen.JumpIfNotZero:
+		val, ok := ir.Val.(tackygen.Constant)
+		if !ok {
+			return nil, false, false
+		}
+		if val.Value.GetValue() != 0 {
+			return tackygen.Jump{Target: ir.Ident}, true, true
+		}
+		return nil, false, true
+	case tackygen.JumpTable:
+		index, ok := ir.Index.(tackygen.Constant)
+		if !ok || index.Value.GetValue() < 0 || index.Value.GetValue() >= int64(len(ir.Targets)) {
+			return nil, false, false
+		}
+		return tackygen.Jump{Target: ir.Targets[index.Value.GetValue()]}, true, true
+	}
+	return nil, false, false
+}
+
+// evalBinary computes op with the wrapping of the operand width. Division
+// that would trap at runtime is left alone so the program still traps.
+func evalBinary(op tackygen.TackyBinaryOp, a, b int64, narrow bool) (int64, bool) {
+	wrap := func(v int64) int64 {
+		if narrow {
+			return int64(int32(v))
+		}
+		return v
+	}
+
+	switch op {
+	case tackygen.Add:
+		return wrap(a + b), true
+	case tackygen.Sub:
+		return wrap(a - b), true
+	case tackygen.Mul:
+		return wrap(a * b), true
+	case tackygen.Div, tackygen.Modulo:
+		if b == 0 {
+			return 0, false
+		}
+		if b == -1 && ((narrow && a == math.MinInt32) || (!narrow && a == math.MinInt64)) {
+			return 0, false
+		}
+		if op == tackygen.Div {
+			return wrap(a / b), true
+		}
+		return wrap(a % b), true
+	case tackygen.Equal:
+		return boolToInt(a == b), true
+	case tackygen.NotEqual:
+		return boolToInt(a != b), true
+	case tackygen.LessThan:
+		return boolToInt(a < b), true
+	case tackygen.LessThanEqual:
+		return boolToInt(a <= b), true
+	case tackygen.GreaterThan:
+		return boolToInt(a > b), true
+	case tackygen.GreaterThanEqual:
+		return boolToInt(a >= b), true
+	}
+	return 0, false
+}
+
+// evalDoubleBinary computes op on two бутархай, an arithmetic result comes
+// back as its bits.
+func evalDoubleBinary(op tackygen.TackyBinaryOp, a, b float64) (int64, bool) {
+	bits := func(v float64) int64 { return int64(math.Float64bits(v)) }
+	switch op {
+	case tackygen.Add:
+		return bits(a + b), true
+	case tackygen.Sub:
+		return bits(a - b), true
+	case tackygen.Mul:
+		return bits(a * b), true
+	case tackygen.Div:
+		return bits(a / b), true
+	case tackygen.Equal:
+		return boolToInt(a == b), true
+	case tackygen.NotEqual:
+		return boolToInt(a != b), true
+	case tackygen.LessThan:
+		return boolToInt(a < b), true
+	case tackygen.LessThanEqual:
+		return boolToInt(a <= b), true
+	case tackygen.GreaterThan:
+		return boolToInt(a > b), true
+	case tackygen.GreaterThanEqual:
+		return boolToInt(a >= b), true
+	}
+	return 0, false
+}
+
+func evalUnary(op tackygen.UnaryOperator, v int64, narrow bool) int64 {
+	var result int64
+	switch op {
+	case tackygen.Complement:
+		result = ^v
+	case tackygen.Negate:
+		result = -v
+	case tackygen.Not:
+		return boolToInt(v == 0)
+	}
+	if narrow {
+		return int64(int32(result))
+	}
+	return result
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
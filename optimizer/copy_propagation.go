@@ -0,0 +1,189 @@
+package optimizer
+
+import (
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// CopyPropagation replaces reads of a variable with the value last copied
+// into it, when that copy reaches the read along every path.
+type CopyPropagation struct {
+	symbolTable *symbols.SymbolTable
+}
+
+func NewCopyPropagation(table *symbols.SymbolTable) *CopyPropagation {
+	return &CopyPropagation{symbolTable: table}
+}
+
+func (c *CopyPropagation) Name() string { return "copy-propagation" }
+
+// copies maps a variable to the value it currently holds a copy of. A nil
+// copies means "not computed yet", the top of the lattice.
+type copies map[string]tackygen.TackyVal
+
+func (c *CopyPropagation) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	instrs := fn.Instructions
+	if len(instrs) == 0 {
+		return fn, false
+	}
+	reaching := c.reachingCopies(instrs, globals)
+
+	changed := false
+	out := make([]tackygen.Instruction, 0, len(instrs))
+	for idx, instr := range instrs {
+		in := reaching[idx]
+		if in == nil {
+			out = append(out, instr)
+			continue
+		}
+
+		if cp, ok := instr.(tackygen.Copy); ok && isRedundantCopy(cp, in) {
+			changed = true
+			continue
+		}
+
+		rewritten := tackygen.MapUses(instr, func(val tackygen.TackyVal) tackygen.TackyVal {
+			name, ok := varName(val)
+			if !ok {
+				return val
+			}
+			src, ok := in[name]
+			if !ok {
+				return val
+			}
+			changed = true
+			if constant, isConst := src.(tackygen.Constant); isConst {
+				return constantLike(constant.Value.GetValue(), val, c.symbolTable)
+			}
+			return src
+		})
+		out = append(out, rewritten)
+	}
+
+	fn.Instructions = out
+	return fn, changed
+}
+
+// isRedundantCopy catches x := y when x already holds y, either from an
+// earlier x := y or y := x.
+func isRedundantCopy(cp tackygen.Copy, in copies) bool {
+	dst, _ := varName(cp.Dst)
+	if src, ok := in[dst]; ok && sameVal(src, cp.Src) {
+		return true
+	}
+	if srcName, ok := varName(cp.Src); ok {
+		if src, ok := in[srcName]; ok && sameVal(src, cp.Dst) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CopyPropagation) reachingCopies(instrs []tackygen.Instruction, globals map[string]bool) []copies {
+	labels := labelIndexes(instrs)
+	in := make([]copies, len(instrs))
+	in[0] = copies{}
+
+	worklist := []int{0}
+	queued := make([]bool, len(instrs))
+	queued[0] = true
+	for len(worklist) > 0 {
+		idx := worklist[0]
+		worklist = worklist[1:]
+		queued[idx] = false
+
+		out := c.transfer(instrs[idx], in[idx], globals)
+		for _, succ := range successors(instrs, labels, idx) {
+			merged := meet(in[succ], out)
+			if in[succ] != nil && sameCopies(in[succ], merged) {
+				continue
+			}
+			in[succ] = merged
+			if !queued[succ] {
+				queued[succ] = true
+				worklist = append(worklist, succ)
+			}
+		}
+	}
+	return in
+}
+
+func (c *CopyPropagation) transfer(instr tackygen.Instruction, in copies, globals map[string]bool) copies {
+	out := copies{}
+	for k, v := range in {
+		out[k] = v
+	}
+
+	if _, isCall := instr.(tackygen.FnCall); isCall {
+		// the callee may write any global
+		for k, v := range out {
+			name, isVar := varName(v)
+			if globals[k] || (isVar && globals[name]) {
+				delete(out, k)
+			}
+		}
+	}
+
+	_, def := tackygen.UsesAndDef(instr)
+	dst, ok := varName(def)
+	if !ok {
+		return out
+	}
+	for k, v := range out {
+		if name, isVar := varName(v); k == dst || (isVar && name == dst) {
+			delete(out, k)
+		}
+	}
+
+	cp, isCopy := instr.(tackygen.Copy)
+	if !isCopy || globals[dst] {
+		return out
+	}
+	switch src := cp.Src.(type) {
+	case tackygen.Constant:
+		out[dst] = src
+	case tackygen.Var:
+		if src.Name != dst && !globals[src.Name] && is32(src, c.symbolTable) == is32(cp.Dst, c.symbolTable) {
+			out[dst] = src
+		}
+	}
+	return out
+}
+
+func meet(a, b copies) copies {
+	if a == nil {
+		result := copies{}
+		for k, v := range b {
+			result[k] = v
+		}
+		return result
+	}
+	result := copies{}
+	for k, v := range a {
+		if other, ok := b[k]; ok && sameVal(other, v) {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func sameCopies(a, b copies) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, ok := b[k]; !ok || !sameVal(other, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameVal(a, b tackygen.TackyVal) bool {
+	ca, okA := a.(tackygen.Constant)
+	cb, okB := b.(tackygen.Constant)
+	if okA || okB {
+		return okA && okB && ca.Value.GetValue() == cb.Value.GetValue()
+	}
+	return a == b
+}
@@ -0,0 +1,143 @@
+package optimizer
+
+import (
+	"math"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// successors returns the indexes control can reach right after instrs[idx].
+func successors(instrs []tackygen.Instruction, labels map[string]int, idx int) []int {
+	switch instr := instrs[idx].(type) {
+	case tackygen.Return:
+		return nil
+	case tackygen.Jump:
+		return []int{labels[instr.Target]}
+	case tackygen.JumpIfZero:
+		return appendFallthrough(instrs, idx, labels[instr.Ident])
+	case tackygen.JumpIfNotZero:
+		return appendFallthrough(instrs, idx, labels[instr.Ident])
+	case tackygen.JumpTable:
+		succs := []int{}
+		seen := map[string]bool{}
+		for _, target := range instr.Targets {
+			if !seen[target] {
+				seen[target] = true
+				succs = append(succs, labels[target])
+			}
+		}
+		return succs
+	default:
+		if idx+1 < len(instrs) {
+			return []int{idx + 1}
+		}
+		return nil
+	}
+}
+
+func appendFallthrough(instrs []tackygen.Instruction, idx int, target int) []int {
+	if idx+1 < len(instrs) && idx+1 != target {
+		return []int{target, idx + 1}
+	}
+	return []int{target}
+}
+
+func labelIndexes(instrs []tackygen.Instruction) map[string]int {
+	labels := map[string]int{}
+	for idx, instr := range instrs {
+		if lbl, ok := instr.(tackygen.Label); ok {
+			labels[lbl.Ident] = idx
+		}
+	}
+	return labels
+}
+
+func predecessors(instrs []tackygen.Instruction, labels map[string]int) [][]int {
+	preds := make([][]int, len(instrs))
+	for idx := range instrs {
+		for _, succ := range successors(instrs, labels, idx) {
+			preds[succ] = append(preds[succ], idx)
+		}
+	}
+	return preds
+}
+
+func varName(val tackygen.TackyVal) (string, bool) {
+	v, ok := val.(tackygen.Var)
+	return v.Name, ok
+}
+
+// is32 reports whether a value is 4 bytes wide in the backend, which decides
+// how arithmetic on it wraps.
+func is32(val tackygen.TackyVal, table *symbols.SymbolTable) bool {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		_, ok := v.Value.(*mconstant.Int32)
+		return ok
+	case tackygen.Var:
+		entry := table.Get(v.Name)
+		if entry == nil {
+			return false
+		}
+		switch entry.Type.(type) {
+		case *mtypes.Int32Type, *mtypes.EnumType, *mtypes.VoidType:
+			return true
+		}
+	}
+	return false
+}
+
+// isBool reports whether a value is a логик, which the backend keeps in a
+// byte.
+func isBool(val tackygen.TackyVal, table *symbols.SymbolTable) bool {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		_, ok := v.Value.(*mconstant.Bool)
+		return ok
+	case tackygen.Var:
+		entry := table.Get(v.Name)
+		if entry == nil {
+			return false
+		}
+		_, ok := entry.Type.(*mtypes.BoolType)
+		return ok
+	}
+	return false
+}
+
+// isDouble reports whether a value is a бутархай, whose GetValue is the
+// bit pattern rather than a number.
+func isDouble(val tackygen.TackyVal, table *symbols.SymbolTable) bool {
+	switch v := val.(type) {
+	case tackygen.Constant:
+		_, ok := v.Value.(*mconstant.Double)
+		return ok
+	case tackygen.Var:
+		entry := table.Get(v.Name)
+		if entry == nil {
+			return false
+		}
+		_, ok := entry.Type.(*mtypes.DoubleType)
+		return ok
+	}
+	return false
+}
+
+// constantLike builds a constant with the width of like, so swapping it in
+// for like does not change the operand size the backend picks. For a
+// бутархай value is the bit pattern.
+func constantLike(value int64, like tackygen.TackyVal, table *symbols.SymbolTable) tackygen.Constant {
+	if isDouble(like, table) {
+		return tackygen.Constant{Value: &mconstant.Double{Value: math.Float64frombits(uint64(value))}}
+	}
+	if isBool(like, table) {
+		return tackygen.Constant{Value: &mconstant.Bool{Value: value != 0}}
+	}
+	if is32(like, table) {
+		return tackygen.Constant{Value: &mconstant.Int32{Value: int32(value)}}
+	}
+	return tackygen.Constant{Value: &mconstant.Int64{Value: value}}
+}
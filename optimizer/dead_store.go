@@ -0,0 +1,106 @@
+package optimizer
+
+import "github.com/your-moon/mon_lang/tackygen"
+
+// DeadStoreElimination removes side effect free instructions whose result is
+// never read. Calls and stores always stay, and so do writes to globals since
+// other functions can read them.
+type DeadStoreElimination struct{}
+
+func NewDeadStoreElimination() *DeadStoreElimination {
+	return &DeadStoreElimination{}
+}
+
+func (d *DeadStoreElimination) Name() string { return "dead-store" }
+
+func (d *DeadStoreElimination) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	instrs := fn.Instructions
+	if len(instrs) == 0 {
+		return fn, false
+	}
+	liveOut := liveness(instrs)
+
+	changed := false
+	out := make([]tackygen.Instruction, 0, len(instrs))
+	for idx, instr := range instrs {
+		if isPure(instr) {
+			_, def := tackygen.UsesAndDef(instr)
+			if dst, ok := varName(def); ok && !globals[dst] && !liveOut[idx][dst] {
+				changed = true
+				continue
+			}
+		}
+		out = append(out, instr)
+	}
+
+	fn.Instructions = out
+	return fn, changed
+}
+
+func isPure(instr tackygen.Instruction) bool {
+	switch instr.(type) {
+	case tackygen.Copy, tackygen.Binary, tackygen.Unary, tackygen.SignExtend, tackygen.Truncate, tackygen.IntToDouble, tackygen.DoubleToInt, tackygen.Load:
+		return true
+	}
+	return false
+}
+
+// liveness computes, for every instruction, the variables that may still be
+// read after it runs.
+func liveness(instrs []tackygen.Instruction) []map[string]bool {
+	labels := labelIndexes(instrs)
+	preds := predecessors(instrs, labels)
+	liveIn := make([]map[string]bool, len(instrs))
+	liveOut := make([]map[string]bool, len(instrs))
+	for idx := range instrs {
+		liveIn[idx] = map[string]bool{}
+		liveOut[idx] = map[string]bool{}
+	}
+
+	worklist := make([]int, 0, len(instrs))
+	queued := make([]bool, len(instrs))
+	for idx := len(instrs) - 1; idx >= 0; idx-- {
+		worklist = append(worklist, idx)
+		queued[idx] = true
+	}
+
+	for len(worklist) > 0 {
+		idx := worklist[0]
+		worklist = worklist[1:]
+		queued[idx] = false
+
+		out := map[string]bool{}
+		for _, succ := range successors(instrs, labels, idx) {
+			for name := range liveIn[succ] {
+				out[name] = true
+			}
+		}
+		liveOut[idx] = out
+
+		uses, def := tackygen.UsesAndDef(instrs[idx])
+		in := map[string]bool{}
+		for name := range out {
+			in[name] = true
+		}
+		if dst, ok := varName(def); ok {
+			delete(in, dst)
+		}
+		for _, use := range uses {
+			if name, ok := varName(use); ok {
+				in[name] = true
+			}
+		}
+
+		if len(in) == len(liveIn[idx]) {
+			continue
+		}
+		liveIn[idx] = in
+		for _, pred := range preds[idx] {
+			if !queued[pred] {
+				queued[pred] = true
+				worklist = append(worklist, pred)
+			}
+		}
+	}
+	return liveOut
+}
@@ -0,0 +1,206 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// inlineThreshold is the largest callee, counted in instructions other than
+// labels, that gets copied into its callers. It covers helpers like их and
+// бага from stdlib/math.mn, not loops.
+const inlineThreshold = 12
+
+// Inliner replaces calls to small, non-recursive functions with a copy of
+// their body. It works on the whole program rather than one function, so it
+// runs once ahead of the per-function passes, which then clean up the copies
+// of arguments and return values it leaves behind.
+type Inliner struct {
+	symbolTable *symbols.SymbolTable
+	names       *NameGen
+}
+
+func NewInliner(table *symbols.SymbolTable, names *NameGen) *Inliner {
+	return &Inliner{symbolTable: table, names: names}
+}
+
+func (in *Inliner) Name() string {
+	return "inline"
+}
+
+// Run inlines every eligible call site once. Callee bodies are taken as they
+// were before this run, so a callee's own calls stay calls.
+func (in *Inliner) Run(program tackygen.TackyProgram) (tackygen.TackyProgram, bool) {
+	bodies := map[string]tackygen.TackyFn{}
+	for _, fn := range program.FnDefs {
+		bodies[fn.Name] = fn
+	}
+	globals := map[string]bool{}
+	for _, global := range program.GlobalVars {
+		globals[global.Name] = true
+	}
+	recursive := recursiveFns(program.FnDefs)
+
+	inlinable := map[string]bool{}
+	for _, fn := range program.FnDefs {
+		inlinable[fn.Name] = !fn.NoInline && !recursive[fn.Name] && fnSize(fn) <= inlineThreshold
+	}
+
+	changed := false
+	for i, fn := range program.FnDefs {
+		out := []tackygen.Instruction{}
+		for _, instr := range fn.Instructions {
+			call, ok := instr.(tackygen.FnCall)
+			if !ok || !inlinable[call.Name] || call.Name == fn.Name {
+				out = append(out, instr)
+				continue
+			}
+			out = append(out, in.expand(call, bodies[call.Name], globals)...)
+			changed = true
+		}
+		program.FnDefs[i].Instructions = out
+	}
+	return program, changed
+}
+
+// fnSize counts the instructions that end up as machine code.
+func fnSize(fn tackygen.TackyFn) int {
+	size := 0
+	for _, instr := range fn.Instructions {
+		switch instr.(type) {
+		case tackygen.Label, tackygen.SourceLine:
+		default:
+			size++
+		}
+	}
+	return size
+}
+
+// recursiveFns reports the functions that can reach a call to themselves,
+// directly or through other functions of the program.
+func recursiveFns(fns []tackygen.TackyFn) map[string]bool {
+	calls := map[string][]string{}
+	for _, fn := range fns {
+		for _, instr := range fn.Instructions {
+			if call, ok := instr.(tackygen.FnCall); ok {
+				calls[fn.Name] = append(calls[fn.Name], call.Name)
+			}
+		}
+	}
+
+	recursive := map[string]bool{}
+	for _, fn := range fns {
+		seen := map[string]bool{}
+		stack := append([]string{}, calls[fn.Name]...)
+		for len(stack) > 0 {
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if name == fn.Name {
+				recursive[fn.Name] = true
+				break
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			stack = append(stack, calls[name]...)
+		}
+	}
+	return recursive
+}
+
+// expand returns the callee body specialised for one call: arguments are
+// copied into renamed parameters and every Return becomes a copy into the
+// call's destination followed by a jump past the body.
+func (in *Inliner) expand(call tackygen.FnCall, callee tackygen.TackyFn, globals map[string]bool) []tackygen.Instruction {
+	vars := map[string]string{}
+	rename := func(val tackygen.TackyVal) tackygen.TackyVal {
+		v, ok := val.(tackygen.Var)
+		if !ok || globals[v.Name] {
+			return val
+		}
+		if _, done := vars[v.Name]; !done {
+			vars[v.Name] = in.names.Temp(in.symbolTable.Get(v.Name).Type).Name
+		}
+		return tackygen.Var{Name: vars[v.Name]}
+	}
+
+	renamedLabels := map[string]string{}
+	for _, instr := range callee.Instructions {
+		if lbl, ok := instr.(tackygen.Label); ok {
+			renamedLabels[lbl.Ident] = in.names.Label(labelPrefix(lbl.Ident))
+		}
+	}
+	end := in.names.Label("inline_end")
+
+	returnsValue := call.Dst != nil
+	if fnType, ok := entryFnType(in.symbolTable.Get(callee.Name)); ok {
+		if _, isVoid := fnType.RetType.(*mtypes.VoidType); isVoid {
+			returnsValue = false
+		}
+	}
+
+	out := []tackygen.Instruction{}
+	for i, param := range callee.Params {
+		dst := rename(param)
+		out = append(out, tackygen.Copy{Src: in.typedLike(call.Args[i], dst), Dst: dst})
+	}
+
+	for _, instr := range callee.Instructions {
+		switch ir := instr.(type) {
+		case tackygen.SourceLine:
+			// lines of the callee would be read as lines of the caller's file
+		case tackygen.Label:
+			out = append(out, tackygen.Label{Ident: renamedLabels[ir.Ident]})
+		case tackygen.Jump:
+			out = append(out, tackygen.Jump{Target: renamedLabels[ir.Target]})
+		case tackygen.JumpIfZero:
+			out = append(out, tackygen.JumpIfZero{Val: rename(ir.Val), Ident: renamedLabels[ir.Ident]})
+		case tackygen.JumpIfNotZero:
+			out = append(out, tackygen.JumpIfNotZero{Val: rename(ir.Val), Ident: renamedLabels[ir.Ident]})
+		case tackygen.JumpTable:
+			targets := make([]string, len(ir.Targets))
+			for i, target := range ir.Targets {
+				targets[i] = renamedLabels[target]
+			}
+			out = append(out, tackygen.JumpTable{Index: rename(ir.Index), Targets: targets})
+		case tackygen.Return:
+			if returnsValue {
+				out = append(out, tackygen.Copy{Src: in.typedLike(rename(ir.Value), call.Dst), Dst: call.Dst})
+			}
+			out = append(out, tackygen.Jump{Target: end})
+		default:
+			instr = tackygen.MapUses(instr, rename)
+			out = append(out, tackygen.MapDef(instr, rename))
+		}
+	}
+
+	return append(out, tackygen.Label{Ident: end})
+}
+
+// typedLike gives an integer constant the width of the variable it is copied
+// into, the backend picks the operand size from the source.
+func (in *Inliner) typedLike(val tackygen.TackyVal, dst tackygen.TackyVal) tackygen.TackyVal {
+	if c, ok := val.(tackygen.Constant); ok {
+		return constantLike(c.Value.GetValue(), dst, in.symbolTable)
+	}
+	return val
+}
+
+// labelPrefix strips the counter MakeLabel appended, else.4 becomes else.
+func labelPrefix(label string) string {
+	if i := strings.LastIndex(label, "."); i > 0 {
+		return label[:i]
+	}
+	return label
+}
+
+func entryFnType(entry *symbols.Entry) (*mtypes.FnType, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	fnType, ok := entry.Type.(*mtypes.FnType)
+	return fnType, ok
+}
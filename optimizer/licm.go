@@ -0,0 +1,95 @@
+package optimizer
+
+import (
+	"github.com/your-moon/mon_lang/cfg"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// LoopInvariantCodeMotion moves computations whose operands don't change
+// inside a loop into a preheader that runs once before it. Only side effect
+// free instructions that can't trap are moved, since the preheader also runs
+// when the loop body doesn't, and only when their destination is assigned
+// nowhere else in the function.
+type LoopInvariantCodeMotion struct {
+	names *NameGen
+}
+
+func NewLoopInvariantCodeMotion(names *NameGen) *LoopInvariantCodeMotion {
+	return &LoopInvariantCodeMotion{names: names}
+}
+
+func (l *LoopInvariantCodeMotion) Name() string { return "licm" }
+
+func (l *LoopInvariantCodeMotion) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	return rewriteLoops(fn, func(g *cfg.Graph, loop *cfg.Loop) bool {
+		return l.hoist(g, loop, defCounts(g.ToFn()), globals)
+	})
+}
+
+func (l *LoopInvariantCodeMotion) hoist(g *cfg.Graph, loop *cfg.Loop, fnDefs map[string]int, globals map[string]bool) bool {
+	info := newLoopInfo(g, loop, globals)
+
+	hoisted := []tackygen.Instruction{}
+	moved := map[*cfg.BasicBlock]map[int]bool{}
+	for found := true; found; {
+		found = false
+		for _, b := range info.blocks {
+			for idx, instr := range b.Instructions {
+				if moved[b][idx] || !l.hoistable(instr, info, fnDefs) {
+					continue
+				}
+				if moved[b] == nil {
+					moved[b] = map[int]bool{}
+				}
+				moved[b][idx] = true
+				name, _ := varName(defOf(instr))
+				info.defs[name]--
+				hoisted = append(hoisted, instr)
+				found = true
+			}
+		}
+	}
+	if len(hoisted) == 0 {
+		return false
+	}
+
+	pre := g.InsertPreheader(loop, l.names.Label("loop_pre"))
+	if pre == nil {
+		return false
+	}
+	pre.Instructions = append(pre.Instructions, hoisted...)
+	for b, indexes := range moved {
+		kept := []tackygen.Instruction{}
+		for idx, instr := range b.Instructions {
+			if !indexes[idx] {
+				kept = append(kept, instr)
+			}
+		}
+		b.Instructions = kept
+	}
+	return true
+}
+
+func (l *LoopInvariantCodeMotion) hoistable(instr tackygen.Instruction, info *loopInfo, fnDefs map[string]int) bool {
+	switch ir := instr.(type) {
+	case tackygen.Copy, tackygen.Unary, tackygen.SignExtend, tackygen.Truncate, tackygen.IntToDouble, tackygen.DoubleToInt:
+	case tackygen.Binary:
+		if ir.Op == tackygen.Div || ir.Op == tackygen.Modulo {
+			return false
+		}
+	default:
+		return false
+	}
+
+	uses, def := tackygen.UsesAndDef(instr)
+	dst, ok := varName(def)
+	if !ok || info.globals[dst] || fnDefs[dst] != 1 {
+		return false
+	}
+	for _, use := range uses {
+		if !info.invariant(use) {
+			return false
+		}
+	}
+	return true
+}
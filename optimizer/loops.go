@@ -0,0 +1,87 @@
+package optimizer
+
+import (
+	"github.com/your-moon/mon_lang/cfg"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// rewriteLoops hands the loops of fn, innermost first, to rewrite until one
+// of them changes. Changes move code between blocks and add preheaders, so
+// the graph and its loops are rebuilt and the walk starts over after each.
+func rewriteLoops(fn tackygen.TackyFn, rewrite func(g *cfg.Graph, loop *cfg.Loop) bool) (tackygen.TackyFn, bool) {
+	changed := false
+	for {
+		g := cfg.Build(fn)
+		dom := cfg.ComputeDominators(g)
+		rewritten := false
+		for _, loop := range cfg.FindLoops(g, dom) {
+			if rewrite(g, loop) {
+				rewritten = true
+				break
+			}
+		}
+		if !rewritten {
+			return fn, changed
+		}
+		fn = g.ToFn()
+		changed = true
+	}
+}
+
+// loopInfo is what the loop passes need to know about one loop.
+type loopInfo struct {
+	loop *cfg.Loop
+	// blocks of the loop in layout order
+	blocks  []*cfg.BasicBlock
+	defs    map[string]int
+	hasCall bool
+	globals map[string]bool
+}
+
+func newLoopInfo(g *cfg.Graph, loop *cfg.Loop, globals map[string]bool) *loopInfo {
+	info := &loopInfo{loop: loop, defs: map[string]int{}, globals: globals}
+	for _, b := range g.Blocks {
+		if !loop.Contains(b) {
+			continue
+		}
+		info.blocks = append(info.blocks, b)
+		for _, instr := range b.Instructions {
+			if _, isCall := instr.(tackygen.FnCall); isCall {
+				info.hasCall = true
+			}
+			if name, ok := varName(defOf(instr)); ok {
+				info.defs[name]++
+			}
+		}
+	}
+	return info
+}
+
+// invariant reports whether val holds the same value on every iteration.
+// Globals can change behind a call.
+func (l *loopInfo) invariant(val tackygen.TackyVal) bool {
+	name, ok := varName(val)
+	if !ok {
+		return true
+	}
+	if l.globals[name] && l.hasCall {
+		return false
+	}
+	return l.defs[name] == 0
+}
+
+func defOf(instr tackygen.Instruction) tackygen.TackyVal {
+	_, def := tackygen.UsesAndDef(instr)
+	return def
+}
+
+// defCounts counts the assignments to each variable of fn.
+func defCounts(fn tackygen.TackyFn) map[string]int {
+	counts := map[string]int{}
+	for _, instr := range fn.Instructions {
+		if name, ok := varName(defOf(instr)); ok {
+			counts[name]++
+		}
+	}
+	return counts
+}
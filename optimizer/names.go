@@ -0,0 +1,52 @@
+package optimizer
+
+import (
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+// NameGen hands out temporaries and labels for code the passes create. Names
+// come from the frontend's UniqueGen, but ones already taken are skipped: a
+// program read back from textual TACKY arrives with a fresh generator, and
+// labels have to be unique across the whole assembly file.
+type NameGen struct {
+	uniqueGen   *unique.UniqueGen
+	symbolTable *symbols.SymbolTable
+	labels      map[string]bool
+}
+
+func NewNameGen(table *symbols.SymbolTable, uniqueGen *unique.UniqueGen) *NameGen {
+	return &NameGen{uniqueGen: uniqueGen, symbolTable: table, labels: map[string]bool{}}
+}
+
+// Reserve records every label the program already uses.
+func (n *NameGen) Reserve(program tackygen.TackyProgram) {
+	for _, fn := range program.FnDefs {
+		for _, instr := range fn.Instructions {
+			if lbl, ok := instr.(tackygen.Label); ok {
+				n.labels[lbl.Ident] = true
+			}
+		}
+	}
+}
+
+// Temp returns a new variable of type t, registered in the symbol table.
+func (n *NameGen) Temp(t mtypes.Type) tackygen.Var {
+	name := n.uniqueGen.MakeTemp()
+	for n.symbolTable.Get(name) != nil {
+		name = n.uniqueGen.MakeTemp()
+	}
+	n.symbolTable.AddVar(t, name)
+	return tackygen.Var{Name: name}
+}
+
+func (n *NameGen) Label(prefix string) string {
+	name := n.uniqueGen.MakeLabel(prefix)
+	for n.labels[name] {
+		name = n.uniqueGen.MakeLabel(prefix)
+	}
+	n.labels[name] = true
+	return name
+}
@@ -0,0 +1,310 @@
+package optimizer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/interp"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func optimize(t *testing.T, level int, src string) string {
+	t.Helper()
+	program, table, err := tackygen.ParseTacky(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	program = NewPassManager(level, table, &unique.UniqueGen{}).Run(program)
+
+	var out bytes.Buffer
+	if err := tackygen.NewTackyPrinter(&out, table).PrintProgram(program); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestFoldArithmeticChain(t *testing.T) {
+	src := `extern fn хэвлэ(i64) -> void
+
+fn үндсэн() -> i32 {
+    var tmp.0: i32
+    var tmp.1: i32
+    var x_1: i32
+    var tmp.2: i32
+    var tmp.3: void
+    tmp.0 := mul 2, 3
+    tmp.1 := add tmp.0, 1
+    x_1 := tmp.1
+    tmp.2 := eq 1, 0
+    jz tmp.2, end.0
+    tmp.3 := call хэвлэ(99)
+  end.0:
+    tmp.3 := call хэвлэ(x_1)
+    return 0
+}
+`
+	expected := `extern fn хэвлэ(i64) -> void
+
+fn үндсэн() -> i32 {
+    var tmp.3: void
+    tmp.3 := call хэвлэ(7)
+    return 0
+}
+`
+	if got := optimize(t, 2, src); got != expected {
+		t.Errorf("unexpected result:\n%s", got)
+	}
+	if got := optimize(t, 0, src); got != src {
+		t.Errorf("-O0 should leave the program alone:\n%s", got)
+	}
+}
+
+func TestFoldWrapsToOperandWidth(t *testing.T) {
+	src := `fn f() -> i32 {
+    var a_1: i32
+    var b_2: i64
+    var c_3: i32
+    a_1 := add 2147483647, 1
+    b_2 := add 2147483647L, 1L
+    c_3 := div 1, 0
+    return a_1
+}
+`
+	got := optimize(t, 1, src)
+	for _, want := range []string{"a_1 := -2147483648", "b_2 := 2147483648L", "c_3 := div 1, 0"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestCopyPropagationRespectsJoins(t *testing.T) {
+	src := `extern fn унш32() -> i32
+
+fn f(c_1: i32) -> i32 {
+    var x_2: i32
+    jz c_1, else.0
+    x_2 := 1
+    jump end.1
+  else.0:
+    x_2 := 2
+  end.1:
+    return x_2
+}
+
+fn g() -> i32 {
+    var x_3: i32
+    var y_4: i32
+    x_3 := call унш32()
+    y_4 := x_3
+    return y_4
+}
+`
+	got := optimize(t, 2, src)
+	if !strings.Contains(got, "return x_2") {
+		t.Errorf("x_2 has two reaching values and must not be replaced:\n%s", got)
+	}
+	if !strings.Contains(got, "return x_3") || strings.Contains(got, "y_4 :=") {
+		t.Errorf("y_4 should be propagated and its copy removed:\n%s", got)
+	}
+}
+
+func TestFoldJumpTable(t *testing.T) {
+	src := `extern fn хэвлэ(i64) -> void
+
+fn f() -> i32 {
+    var x_1: i32
+    var tmp.0: void
+    x_1 := 2
+    jtable x_1, [case.0, case.1, case.2]
+  case.0:
+    tmp.0 := call хэвлэ(10)
+    jump end.3
+  case.1:
+    tmp.0 := call хэвлэ(20)
+    jump end.3
+  case.2:
+    tmp.0 := call хэвлэ(30)
+  end.3:
+    return 0
+}
+`
+	got := optimize(t, 2, src)
+	if strings.Contains(got, "jtable") || strings.Contains(got, "хэвлэ(10)") || strings.Contains(got, "хэвлэ(20)") {
+		t.Errorf("a constant index should leave only its own case:\n%s", got)
+	}
+	if !strings.Contains(got, "хэвлэ(30)") {
+		t.Errorf("the case the index picks must stay:\n%s", got)
+	}
+}
+
+func TestGlobalsSurviveCalls(t *testing.T) {
+	src := `global g_1: i32 = 0
+
+extern fn өөрчлөх() -> void
+
+fn f() -> i32 {
+    var tmp.0: void
+    g_1 := 5
+    tmp.0 := call өөрчлөх()
+    return g_1
+}
+`
+	got := optimize(t, 2, src)
+	if !strings.Contains(got, "g_1 := 5") || !strings.Contains(got, "return g_1") {
+		t.Errorf("global writes and reads across calls must stay:\n%s", got)
+	}
+}
+
+func TestPrintAfterUnknownPass(t *testing.T) {
+	pm := NewPassManager(2, nil, &unique.UniqueGen{})
+	if err := pm.SetPrintAfter("no-such-pass", &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown pass")
+	}
+}
+
+func TestInlineSmallFunctions(t *testing.T) {
+	src := `public fn их_1(а_2: i32, б_3: i32) -> i32 {
+    var tmp.0: i32
+    tmp.0 := gt а_2, б_3
+    jz tmp.0, end.0
+    return а_2
+  end.0:
+    return б_3
+}
+
+noinline fn давхар_4(а_5: i32) -> i32 {
+    var tmp.1: i32
+    tmp.1 := mul а_5, 2
+    return tmp.1
+}
+
+fn тоол_6(n_7: i32) -> i32 {
+    var tmp.2: i32
+    var tmp.3: i32
+    tmp.2 := sub n_7, 1
+    tmp.3 := call тоол_6(tmp.2)
+    return tmp.3
+}
+
+fn үндсэн() -> i32 {
+    var tmp.4: i32
+    var tmp.5: i32
+    var tmp.6: i32
+    var tmp.7: i32
+    tmp.4 := call их_1(3, 9)
+    tmp.5 := call давхар_4(tmp.4)
+    tmp.6 := call тоол_6(tmp.5)
+    tmp.7 := add tmp.4, tmp.6
+    return tmp.7
+}
+`
+	got := optimize(t, 2, src)
+	main := got[strings.Index(got, "fn үндсэн"):]
+	if strings.Contains(main, "call их_1") {
+		t.Errorf("их_1 should be inlined:\n%s", main)
+	}
+	if !strings.Contains(main, "call давхар_4(9)") {
+		t.Errorf("noinline function must stay a call, with the inlined result folded in:\n%s", main)
+	}
+	if !strings.Contains(main, "call тоол_6(") {
+		t.Errorf("recursive function must stay a call:\n%s", main)
+	}
+}
+
+const loopSource = `extern fn malloc
+
+fn run_1(n_2: i32) -> i32 {
+    var size_4: i64
+    var base_3: i64
+    var i_5: i32
+    var tmp.0: i32
+    var tmp.1: i64
+    var tmp.2: i64
+    var tmp.3: i64
+    var tmp.4: i32
+    var tmp.5: i32
+    var s_6: i32
+    var tmp.6: i32
+    var tmp.7: i64
+    var tmp.8: i64
+    var tmp.9: i64
+    var tmp.10: i32
+    var tmp.11: i32
+    size_4 := signextend n_2
+    size_4 := mul size_4, 4L
+    base_3 := call malloc(size_4)
+    i_5 := 0
+  fill.0:
+    tmp.0 := lt i_5, n_2
+    jz tmp.0, filled.1
+    tmp.1 := signextend i_5
+    tmp.2 := mul tmp.1, 4L
+    tmp.3 := add base_3, tmp.2
+    tmp.4 := mul i_5, 3
+    store tmp.4, tmp.3
+    tmp.5 := add i_5, 1
+    i_5 := tmp.5
+    jump fill.0
+  filled.1:
+    s_6 := 0
+    i_5 := n_2
+  sum.2:
+    jz i_5, done.3
+    i_5 := sub i_5, 1
+    tmp.6 := sub n_2, 1
+    tmp.7 := signextend i_5
+    tmp.8 := mul tmp.7, 4L
+    tmp.9 := add base_3, tmp.8
+    tmp.10 := load tmp.9
+    tmp.11 := mul tmp.10, tmp.6
+    s_6 := add s_6, tmp.11
+    jump sum.2
+  done.3:
+    return s_6
+}
+`
+
+func TestLoopOptimizationsKeepResults(t *testing.T) {
+	program, table, err := tackygen.ParseTacky(loopSource)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	args := []int64{0, 1, 5, 10}
+	want := make([]int64, len(args))
+	for i, n := range args {
+		want[i], err = interp.New(program, table, strings.NewReader(""), &bytes.Buffer{}).Call("run_1", []int64{n})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	optimized := NewPassManager(2, table, &unique.UniqueGen{}).Run(program)
+	var out bytes.Buffer
+	tackygen.NewTackyPrinter(&out, table).PrintProgram(optimized)
+	got := out.String()
+
+	fill := got[strings.Index(got, "fill.0:"):strings.Index(got, "filled.1:")]
+	if strings.Contains(fill, "mul") || strings.Contains(fill, "signextend") {
+		t.Errorf("address arithmetic left in the fill loop:\n%s", got)
+	}
+	if !strings.Contains(got, ", -4L") {
+		t.Errorf("descending loop should step its pointer by -4:\n%s", got)
+	}
+	sum := got[strings.Index(got, "sum.2:"):]
+	if strings.Contains(sum, "sub n_2, 1") {
+		t.Errorf("n_2 - 1 should be hoisted out of the loop:\n%s", got)
+	}
+
+	for i, n := range args {
+		result, err := interp.New(optimized, table, strings.NewReader(""), &bytes.Buffer{}).Call("run_1", []int64{n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want[i] {
+			t.Errorf("run_1(%d) = %d after -O2, want %d", n, result, want[i])
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package optimizer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+// Pass rewrites a single function and reports whether anything changed.
+// globals holds the names of program level variables, which other functions
+// can read and write behind the pass's back.
+type Pass interface {
+	Name() string
+	Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool)
+}
+
+// maxIterations bounds the fixpoint loop, the passes only ever shrink or
+// simplify code so this is a safety net rather than a tuning knob.
+const maxIterations = 32
+
+type PassManager struct {
+	names       *NameGen
+	inliner     *Inliner
+	passes      []Pass
+	symbolTable *symbols.SymbolTable
+	printAfter  string
+	out         io.Writer
+}
+
+// NewPassManager builds the pipeline for an -O level: 0 runs nothing, 1 folds
+// constants and drops unreachable code, 2 inlines small functions first and
+// adds copy propagation, dead store elimination and the loop passes.
+// uniqueGen names the temporaries and labels the passes create.
+func NewPassManager(level int, table *symbols.SymbolTable, uniqueGen *unique.UniqueGen) *PassManager {
+	pm := &PassManager{symbolTable: table, names: NewNameGen(table, uniqueGen)}
+	if level >= 1 {
+		pm.passes = append(pm.passes,
+			NewConstantFolding(table),
+			NewUnreachableCodeElimination(),
+		)
+	}
+	if level >= 2 {
+		pm.inliner = NewInliner(table, pm.names)
+		pm.passes = append(pm.passes,
+			NewCopyPropagation(table),
+			NewDeadStoreElimination(),
+			NewLoopInvariantCodeMotion(pm.names),
+			NewStrengthReduction(table, pm.names),
+		)
+	}
+	return pm
+}
+
+// PassNames lists every pass --print-after accepts.
+func PassNames() []string {
+	pm := NewPassManager(2, symbols.NewSymbolTable(), &unique.UniqueGen{})
+	names := []string{pm.inliner.Name()}
+	for _, pass := range pm.passes {
+		names = append(names, pass.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetPrintAfter dumps each function to w every time the named pass runs on it.
+func (pm *PassManager) SetPrintAfter(pass string, w io.Writer) error {
+	for _, name := range PassNames() {
+		if name == pass {
+			pm.printAfter = pass
+			pm.out = w
+			return nil
+		}
+	}
+	return fmt.Errorf("'%s' гэсэн pass байхгүй, боломжит нэрс: %s", pass, strings.Join(PassNames(), ", "))
+}
+
+func (pm *PassManager) Run(program tackygen.TackyProgram) tackygen.TackyProgram {
+	pm.names.Reserve(program)
+	if pm.inliner != nil {
+		program, _ = pm.inliner.Run(program)
+		if pm.inliner.Name() == pm.printAfter {
+			fmt.Fprintf(pm.out, "---- %s ДАРАА ----:\n", pm.inliner.Name())
+			tackygen.NewTackyPrinter(pm.out, pm.symbolTable).PrintProgram(program)
+		}
+	}
+	for i, fn := range program.FnDefs {
+		program.FnDefs[i] = pm.RunFn(fn, program.GlobalVars)
+	}
+	return program
+}
+
+// RunFn applies the passes in order, over and over, until none of them
+// changes the function any more.
+func (pm *PassManager) RunFn(fn tackygen.TackyFn, globals []tackygen.GlobalVar) tackygen.TackyFn {
+	globalNames := map[string]bool{}
+	for _, global := range globals {
+		globalNames[global.Name] = true
+	}
+
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		changed := false
+		for _, pass := range pm.passes {
+			var passChanged bool
+			fn, passChanged = pass.Run(fn, globalNames)
+			changed = changed || passChanged
+
+			if pass.Name() == pm.printAfter {
+				fmt.Fprintf(pm.out, "---- %s ДАРАА (%d-р давталт) ----:\n", pass.Name(), iteration)
+				tackygen.NewTackyPrinter(pm.out, pm.symbolTable).PrintFn(fn, globals)
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return fn
+}
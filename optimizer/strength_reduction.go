@@ -0,0 +1,353 @@
+package optimizer
+
+import (
+	"github.com/your-moon/mon_lang/cfg"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+)
+
+// StrengthReduction turns multiplications by an induction variable into
+// additions. Array indexing computes base + sext(i) * 4 on every access; when
+// i only ever moves by a constant step inside the loop, the address gets a
+// variable of its own that starts at the first element in the preheader and
+// moves by 4 * step alongside i.
+type StrengthReduction struct {
+	symbolTable *symbols.SymbolTable
+	names       *NameGen
+}
+
+func NewStrengthReduction(table *symbols.SymbolTable, names *NameGen) *StrengthReduction {
+	return &StrengthReduction{symbolTable: table, names: names}
+}
+
+func (s *StrengthReduction) Name() string { return "strength-reduction" }
+
+func (s *StrengthReduction) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	return rewriteLoops(fn, func(g *cfg.Graph, loop *cfg.Loop) bool {
+		return s.reduce(g, loop, g.ToFn(), globals)
+	})
+}
+
+// site is an instruction position inside a block.
+type site struct {
+	block *cfg.BasicBlock
+	index int
+}
+
+// derived describes a variable holding scale * iv + offset + base, iv widened
+// to 64 bits first when signExtend is set. base is nil when there is none.
+// Widening after adding the offset is treated as widening before, the two
+// only differ when the 32 bit value overflows.
+type derived struct {
+	iv         string
+	scale      int64
+	offset     int64
+	signExtend bool
+	base       tackygen.TackyVal
+	def        site
+	// operand is the variable the value was derived from, iv itself or
+	// another derived variable
+	operand string
+}
+
+func (s *StrengthReduction) reduce(g *cfg.Graph, loop *cfg.Loop, fn tackygen.TackyFn, globals map[string]bool) bool {
+	info := newLoopInfo(g, loop, globals)
+	steps := s.inductionVariables(info)
+	if len(steps) == 0 {
+		return false
+	}
+
+	fnDefs := defCounts(fn)
+	derivations := map[string]derived{}
+	for _, b := range info.blocks {
+		// derived values only hold until their induction variable moves, so
+		// they are tracked one block at a time
+		current := map[string]derived{}
+		for idx, instr := range b.Instructions {
+			_, def := tackygen.UsesAndDef(instr)
+			dst, hasDst := varName(def)
+			if hasDst {
+				delete(current, dst)
+				for name, d := range current {
+					if d.iv == dst || d.operand == dst {
+						delete(current, name)
+					}
+				}
+			}
+			if !hasDst || globals[dst] || fnDefs[dst] != 1 || steps[dst] != nil {
+				continue
+			}
+			if d, ok := s.derive(instr, current, steps, info); ok {
+				d.def = site{block: b, index: idx}
+				current[dst] = d
+				derivations[dst] = d
+			}
+		}
+	}
+
+	// only the ends of a chain are worth a variable of their own, the steps
+	// leading up to them die once the end is replaced
+	consumed := map[string]int{}
+	for _, d := range derivations {
+		if _, isDerived := derivations[d.operand]; isDerived {
+			consumed[d.operand]++
+		}
+	}
+	uses := useCounts(fn)
+	leaves := []string{}
+	for _, b := range info.blocks {
+		for _, instr := range b.Instructions {
+			name, ok := varName(defOf(instr))
+			if !ok {
+				continue
+			}
+			if d, isDerived := derivations[name]; isDerived && d.scale != 1 && uses[name] > consumed[name] {
+				leaves = append(leaves, name)
+			}
+		}
+	}
+	if len(leaves) == 0 {
+		return false
+	}
+
+	pre := g.InsertPreheader(loop, s.names.Label("loop_pre"))
+	if pre == nil {
+		return false
+	}
+
+	after := map[*cfg.BasicBlock]map[int][]tackygen.Instruction{}
+	for _, name := range leaves {
+		d := derivations[name]
+		reduced := s.names.Temp(s.symbolTable.Get(name).Type)
+		pre.Instructions = append(pre.Instructions, s.initialValue(d, reduced)...)
+		d.def.block.Instructions[d.def.index] = tackygen.Copy{Src: reduced, Dst: tackygen.Var{Name: name}}
+
+		for _, step := range steps[d.iv] {
+			if after[step.at.block] == nil {
+				after[step.at.block] = map[int][]tackygen.Instruction{}
+			}
+			after[step.at.block][step.at.index] = append(after[step.at.block][step.at.index], tackygen.Binary{
+				Op:   tackygen.Add,
+				Src1: reduced,
+				Src2: constantLike(d.scale*step.by, reduced, s.symbolTable),
+				Dst:  reduced,
+			})
+		}
+	}
+	for b, inserts := range after {
+		out := []tackygen.Instruction{}
+		for idx, instr := range b.Instructions {
+			out = append(out, instr)
+			out = append(out, inserts[idx]...)
+		}
+		b.Instructions = out
+	}
+	return true
+}
+
+// initialValue computes scale * iv + offset + base into dst, for the
+// preheader.
+func (s *StrengthReduction) initialValue(d derived, dst tackygen.Var) []tackygen.Instruction {
+	instrs := []tackygen.Instruction{}
+	var iv tackygen.TackyVal = tackygen.Var{Name: d.iv}
+	if d.signExtend {
+		wide := s.names.Temp(&mtypes.Int64Type{})
+		instrs = append(instrs, tackygen.SignExtend{Src: iv, Dst: wide})
+		iv = wide
+	}
+	instrs = append(instrs, tackygen.Binary{Op: tackygen.Mul, Src1: iv, Src2: constantLike(d.scale, dst, s.symbolTable), Dst: dst})
+	if d.offset != 0 {
+		instrs = append(instrs, tackygen.Binary{Op: tackygen.Add, Src1: dst, Src2: constantLike(d.offset, dst, s.symbolTable), Dst: dst})
+	}
+	if d.base != nil {
+		instrs = append(instrs, tackygen.Binary{Op: tackygen.Add, Src1: dst, Src2: d.base, Dst: dst})
+	}
+	return instrs
+}
+
+// derive recognises dst := sext x, dst := x * c, dst := x + c, dst := x - c
+// and dst := x + invariant, where x is an induction variable or a value
+// derived from one with no invariant added yet.
+func (s *StrengthReduction) derive(instr tackygen.Instruction, current map[string]derived, steps map[string][]ivStep, info *loopInfo) (derived, bool) {
+	linear := func(val tackygen.TackyVal) (derived, bool) {
+		name, ok := varName(val)
+		if !ok {
+			return derived{}, false
+		}
+		if steps[name] != nil {
+			return derived{iv: name, scale: 1, operand: name}, true
+		}
+		d, ok := current[name]
+		if !ok || d.base != nil {
+			return derived{}, false
+		}
+		d.operand = name
+		return d, true
+	}
+
+	switch ir := instr.(type) {
+	case tackygen.SignExtend:
+		if d, ok := linear(ir.Src); ok && !d.signExtend {
+			d.signExtend = true
+			return d, true
+		}
+	case tackygen.Binary:
+		switch ir.Op {
+		case tackygen.Mul:
+			if c, ok := ir.Src2.(tackygen.Constant); ok {
+				if d, ok := linear(ir.Src1); ok {
+					d.scale *= c.Value.GetValue()
+					d.offset *= c.Value.GetValue()
+					return d, true
+				}
+			}
+			if c, ok := ir.Src1.(tackygen.Constant); ok {
+				if d, ok := linear(ir.Src2); ok {
+					d.scale *= c.Value.GetValue()
+					d.offset *= c.Value.GetValue()
+					return d, true
+				}
+			}
+		case tackygen.Sub:
+			if c, ok := ir.Src2.(tackygen.Constant); ok {
+				if d, ok := linear(ir.Src1); ok {
+					d.offset -= c.Value.GetValue()
+					return d, true
+				}
+			}
+		case tackygen.Add:
+			if c, ok := ir.Src2.(tackygen.Constant); ok {
+				if d, ok := linear(ir.Src1); ok {
+					d.offset += c.Value.GetValue()
+					return d, true
+				}
+			}
+			if c, ok := ir.Src1.(tackygen.Constant); ok {
+				if d, ok := linear(ir.Src2); ok {
+					d.offset += c.Value.GetValue()
+					return d, true
+				}
+			}
+			if d, ok := linear(ir.Src1); ok && info.invariant(ir.Src2) {
+				d.base = ir.Src2
+				return d, true
+			}
+			if d, ok := linear(ir.Src2); ok && info.invariant(ir.Src1) {
+				d.base = ir.Src1
+				return d, true
+			}
+		}
+	}
+	return derived{}, false
+}
+
+// ivStep is one assignment moving an induction variable by a constant.
+type ivStep struct {
+	at site
+	by int64
+}
+
+// inductionVariables finds the basic induction variables of a loop: locals
+// whose every assignment inside it adds a constant to themselves, either
+// directly as i := i + c or through a temporary, t := i + c followed by
+// i := t, the way the frontend compiles i = i + 1.
+func (s *StrengthReduction) inductionVariables(info *loopInfo) map[string][]ivStep {
+	steps := map[string][]ivStep{}
+	other := map[string]bool{}
+	for _, b := range info.blocks {
+		// temporaries holding iv + c, until either side changes
+		pending := map[string]ivStep{}
+		pendingIV := map[string]string{}
+		for idx, instr := range b.Instructions {
+			_, def := tackygen.UsesAndDef(instr)
+			dst, ok := varName(def)
+			if !ok {
+				continue
+			}
+
+			var src string
+			by, isStep := int64(0), false
+			switch ir := instr.(type) {
+			case tackygen.Binary:
+				src, by, isStep = constantStep(ir)
+			case tackygen.Copy:
+				if t, ok := varName(ir.Src); ok && pendingIV[t] == dst {
+					src, by, isStep = dst, pending[t].by, true
+				}
+			}
+
+			for t, iv := range pendingIV {
+				if t == dst || iv == dst {
+					delete(pendingIV, t)
+					delete(pending, t)
+				}
+			}
+
+			switch {
+			case isStep && src == dst:
+				steps[dst] = append(steps[dst], ivStep{at: site{block: b, index: idx}, by: by})
+			case isStep:
+				pending[dst] = ivStep{by: by}
+				pendingIV[dst] = src
+				other[dst] = true
+			default:
+				other[dst] = true
+			}
+		}
+	}
+
+	for name := range steps {
+		entry := s.symbolTable.Get(name)
+		if other[name] || info.globals[name] || entry == nil || !isInteger(entry.Type) {
+			delete(steps, name)
+		}
+	}
+	return steps
+}
+
+// constantStep matches x + c, c + x and x - c.
+func constantStep(ir tackygen.Binary) (string, int64, bool) {
+	switch ir.Op {
+	case tackygen.Add:
+		if c, ok := ir.Src2.(tackygen.Constant); ok {
+			if name, ok := varName(ir.Src1); ok {
+				return name, c.Value.GetValue(), true
+			}
+		}
+		if c, ok := ir.Src1.(tackygen.Constant); ok {
+			if name, ok := varName(ir.Src2); ok {
+				return name, c.Value.GetValue(), true
+			}
+		}
+	case tackygen.Sub:
+		if c, ok := ir.Src2.(tackygen.Constant); ok {
+			if name, ok := varName(ir.Src1); ok {
+				return name, -c.Value.GetValue(), true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+func isInteger(t mtypes.Type) bool {
+	switch t.(type) {
+	case *mtypes.Int32Type, *mtypes.Int64Type, *mtypes.EnumType:
+		return true
+	}
+	return false
+}
+
+// useCounts counts the reads of each variable of fn.
+func useCounts(fn tackygen.TackyFn) map[string]int {
+	counts := map[string]int{}
+	for _, instr := range fn.Instructions {
+		uses, _ := tackygen.UsesAndDef(instr)
+		for _, use := range uses {
+			if name, ok := varName(use); ok {
+				counts[name]++
+			}
+		}
+	}
+	return counts
+}
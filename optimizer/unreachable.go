@@ -0,0 +1,84 @@
+package optimizer
+
+import "github.com/your-moon/mon_lang/tackygen"
+
+// UnreachableCodeElimination drops instructions control can never reach, jumps
+// to the label right after them and labels nothing jumps to.
+type UnreachableCodeElimination struct{}
+
+func NewUnreachableCodeElimination() *UnreachableCodeElimination {
+	return &UnreachableCodeElimination{}
+}
+
+func (u *UnreachableCodeElimination) Name() string { return "unreachable-code" }
+
+func (u *UnreachableCodeElimination) Run(fn tackygen.TackyFn, globals map[string]bool) (tackygen.TackyFn, bool) {
+	instrs := fn.Instructions
+	if len(instrs) == 0 {
+		return fn, false
+	}
+	labels := labelIndexes(instrs)
+
+	reachable := make([]bool, len(instrs))
+	worklist := []int{0}
+	reachable[0] = true
+	for len(worklist) > 0 {
+		idx := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, succ := range successors(instrs, labels, idx) {
+			if !reachable[succ] {
+				reachable[succ] = true
+				worklist = append(worklist, succ)
+			}
+		}
+	}
+
+	changed := false
+	live := make([]tackygen.Instruction, 0, len(instrs))
+	for idx, instr := range instrs {
+		if !reachable[idx] {
+			changed = true
+			continue
+		}
+		live = append(live, instr)
+	}
+
+	// a jump straight to the next label is a fallthrough
+	out := make([]tackygen.Instruction, 0, len(live))
+	for idx, instr := range live {
+		if jmp, ok := instr.(tackygen.Jump); ok && idx+1 < len(live) {
+			if lbl, ok := live[idx+1].(tackygen.Label); ok && lbl.Ident == jmp.Target {
+				changed = true
+				continue
+			}
+		}
+		out = append(out, instr)
+	}
+
+	targets := map[string]bool{}
+	for _, instr := range out {
+		switch ir := instr.(type) {
+		case tackygen.Jump:
+			targets[ir.Target] = true
+		case tackygen.JumpIfZero:
+			targets[ir.Ident] = true
+		case tackygen.JumpIfNotZero:
+			targets[ir.Ident] = true
+		case tackygen.JumpTable:
+			for _, target := range ir.Targets {
+				targets[target] = true
+			}
+		}
+	}
+	final := out[:0]
+	for _, instr := range out {
+		if lbl, ok := instr.(tackygen.Label); ok && !targets[lbl.Ident] {
+			changed = true
+			continue
+		}
+		final = append(final, instr)
+	}
+
+	fn.Instructions = final
+	return fn, changed
+}
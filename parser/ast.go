@@ -88,3 +88,85 @@ func (a *ASTProgram) PrintAST(depth int) string {
 func indent(depth int) string {
 	return strings.Repeat("  ", depth)
 }
+
+// LineOf returns the source line a statement, declaration or expression
+// starts on, 0 when the node carries no token.
+func LineOf(node BlockItem) int {
+	return TokenOf(node).Line
+}
+
+// TokenOf returns the token the parser kept for a node, where errors about
+// it point. It is the zero Token when the node carries none.
+func TokenOf(node BlockItem) lexer.Token {
+	switch n := node.(type) {
+	case *VarDecl:
+		return n.Token
+	case *FnDecl:
+		return n.Token
+	case *StructDecl:
+		return n.Token
+	case *EnumDecl:
+		return n.Token
+	case *ASTSwitch:
+		return n.Token
+	case *ASTWhile:
+		return n.Token
+	case *ASTLoop:
+		return n.Token
+	case *ASTBreakStmt:
+		return n.Token
+	case *ASTContinueStmt:
+		return n.Token
+	case *ASTReturnStmt:
+		return n.Token
+	case *ASTPrintStmt:
+		return n.Token
+	case *ASTNullStmt:
+		return n.Token
+	case *ASTIfStmt:
+		return TokenOf(n.Cond)
+	case *ExpressionStmt:
+		return TokenOf(n.Expression)
+	case *ASTFnCall:
+		return n.Token
+	case *ASTConditional:
+		return n.Token
+	case *ASTConstInt:
+		return n.Token
+	case *ASTConstLong:
+		return n.Token
+	case *ASTConstDouble:
+		return n.Token
+	case *ASTConstBool:
+		return n.Token
+	case *ASTCast:
+		return TokenOf(n.Expr)
+	case *ASTStringExpression:
+		return n.Token
+	case *ASTPrefixExpression:
+		return n.Token
+	case *ASTBinary:
+		return n.Token
+	case *ASTAssignment:
+		return n.Token
+	case *ASTRangeExpr:
+		return n.Token
+	case *ASTVar:
+		return n.Token
+	case *ASTUnary:
+		return n.Token
+	case *ASTInfixExpression:
+		return n.Token
+	case *ASTArrayIndex:
+		return n.Token
+	case *ASTNewArray:
+		return n.Token
+	case *ASTFieldAccess:
+		return n.Token
+	case *ASTNewStruct:
+		return n.Token
+	case *ASTEnumConst:
+		return n.Token
+	}
+	return lexer.Token{}
+}
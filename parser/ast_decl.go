@@ -30,6 +30,9 @@ type FnDecl struct {
 	StorageClass StorageClass
 	IsPublic     bool
 	IsExtern     bool
+	NoInline     bool
+	// File is set on functions taken from an imported file
+	File string
 }
 
 func (d *FnDecl) declNode() {}
@@ -121,6 +124,57 @@ func (d *VarDecl) PrintAST(depth int) string {
 	}
 }
 
+// StructDecl declares a бүтэц: бүтэц Цэг { x: тоо, y: тоо }
+type StructDecl struct {
+	Token    lexer.Token
+	Ident    string
+	Fields   []Param
+	IsPublic bool
+}
+
+func (d *StructDecl) declNode() {}
+func (d *StructDecl) TokenLiteral() string {
+	return d.Ident
+}
+
+func (d *StructDecl) PrintAST(depth int) string {
+	out := fmt.Sprintf("%sStruct: %s", indent(depth), d.Ident)
+	for i, field := range d.Fields {
+		prefix := "├─"
+		if i == len(d.Fields)-1 {
+			prefix = "└─"
+		}
+		out += fmt.Sprintf("\n%s%s %s: %s", indent(depth), prefix, field.Ident, field.Type)
+	}
+	return out
+}
+
+// EnumDecl declares a төрөл: төрөл Өнгө { Улаан, Ногоон, Цэнхэр }. Each
+// variant token holds its name.
+type EnumDecl struct {
+	Token    lexer.Token
+	Ident    string
+	Variants []lexer.Token
+	IsPublic bool
+}
+
+func (d *EnumDecl) declNode() {}
+func (d *EnumDecl) TokenLiteral() string {
+	return d.Ident
+}
+
+func (d *EnumDecl) PrintAST(depth int) string {
+	out := fmt.Sprintf("%sEnum: %s", indent(depth), d.Ident)
+	for i, variant := range d.Variants {
+		prefix := "├─"
+		if i == len(d.Variants)-1 {
+			prefix = "└─"
+		}
+		out += fmt.Sprintf("\n%s%s %s", indent(depth), prefix, *variant.Value)
+	}
+	return out
+}
+
 type Decl struct {
 	Token lexer.Token
 	Ident string
@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 
 	"github.com/your-moon/mon_lang/lexer"
 	"github.com/your-moon/mon_lang/mtypes"
@@ -68,6 +69,10 @@ func (op ASTBinOp) String() string {
 	}
 }
 
+// ASTCast converts Expr to TargetType. The type checker puts one around
+// every expression that has to change between бутархай and an integer type,
+// and the program writes one to turn a тоо into a төрөл or back: тоо(ө),
+// Өнгө(2).
 type ASTCast struct {
 	TargetType mtypes.Type
 	Expr       ASTExpression
@@ -75,8 +80,12 @@ type ASTCast struct {
 }
 
 func (a *ASTCast) expressionNode()       {}
+func (a *ASTCast) TokenLiteral() string  { return a.Expr.TokenLiteral() }
 func (a *ASTCast) GetType() mtypes.Type  { return a.Type }
 func (a *ASTCast) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTCast) PrintAST(depth int) string {
+	return a.Expr.PrintAST(depth)
+}
 
 type ASTFnCall struct {
 	Token lexer.Token
@@ -170,6 +179,39 @@ func (a *ASTConstLong) PrintAST(depth int) string {
 	return fmt.Sprintf("%d", a.Value)
 }
 
+type ASTConstDouble struct {
+	Token lexer.Token
+	Value float64
+	Type  mtypes.Type
+}
+
+func (a *ASTConstDouble) expressionNode()       {}
+func (a *ASTConstDouble) constant()             {}
+func (a *ASTConstDouble) TokenLiteral() string  { return string(a.Token.Type) }
+func (a *ASTConstDouble) GetType() mtypes.Type  { return a.Type }
+func (a *ASTConstDouble) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTConstDouble) PrintAST(depth int) string {
+	return strconv.FormatFloat(a.Value, 'g', -1, 64)
+}
+
+type ASTConstBool struct {
+	Token lexer.Token
+	Value bool
+	Type  mtypes.Type
+}
+
+func (a *ASTConstBool) expressionNode()       {}
+func (a *ASTConstBool) constant()             {}
+func (a *ASTConstBool) TokenLiteral() string  { return string(a.Token.Type) }
+func (a *ASTConstBool) GetType() mtypes.Type  { return a.Type }
+func (a *ASTConstBool) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTConstBool) PrintAST(depth int) string {
+	if a.Value {
+		return "үнэн"
+	}
+	return "худал"
+}
+
 type ASTStringExpression struct {
 	Token lexer.Token
 	Value string
@@ -367,3 +409,51 @@ func (a *ASTNewArray) SetType(t mtypes.Type) { a.Type = t }
 func (a *ASTNewArray) PrintAST(depth int) string {
 	return fmt.Sprintf("%sшинэ %s[%s]", indent(depth), a.ElementType, a.Size.PrintAST(0))
 }
+
+// ASTFieldAccess reads a field of a бүтэц: цэг.x
+type ASTFieldAccess struct {
+	Token  lexer.Token
+	Struct ASTExpression
+	Field  string
+	Type   mtypes.Type
+}
+
+func (a *ASTFieldAccess) expressionNode()       {}
+func (a *ASTFieldAccess) TokenLiteral() string  { return "FIELD" }
+func (a *ASTFieldAccess) GetType() mtypes.Type  { return a.Type }
+func (a *ASTFieldAccess) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTFieldAccess) PrintAST(depth int) string {
+	return fmt.Sprintf("%s%s.%s", indent(depth), a.Struct.PrintAST(0), a.Field)
+}
+
+// ASTNewStruct represents heap struct allocation: шинэ Цэг
+type ASTNewStruct struct {
+	Token lexer.Token
+	Type  mtypes.Type
+}
+
+func (a *ASTNewStruct) expressionNode()       {}
+func (a *ASTNewStruct) TokenLiteral() string  { return "NEW" }
+func (a *ASTNewStruct) GetType() mtypes.Type  { return a.Type }
+func (a *ASTNewStruct) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTNewStruct) PrintAST(depth int) string {
+	return fmt.Sprintf("%sшинэ %s", indent(depth), a.Type.(*mtypes.StructType).Name)
+}
+
+// ASTEnumConst is a variant of a төрөл: Өнгө.Улаан. The resolver makes one
+// from the field access the parser saw, the type checker fills in Value.
+type ASTEnumConst struct {
+	Token   lexer.Token
+	Enum    string
+	Variant string
+	Value   int64
+	Type    mtypes.Type
+}
+
+func (a *ASTEnumConst) expressionNode()       {}
+func (a *ASTEnumConst) TokenLiteral() string  { return "ENUM" }
+func (a *ASTEnumConst) GetType() mtypes.Type  { return a.Type }
+func (a *ASTEnumConst) SetType(t mtypes.Type) { a.Type = t }
+func (a *ASTEnumConst) PrintAST(depth int) string {
+	return fmt.Sprintf("%s%s.%s", indent(depth), a.Enum, a.Variant)
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/your-moon/mon_lang/lexer"
 )
@@ -180,3 +181,47 @@ func (a *ASTPrintStmt) PrintAST(depth int) string {
 	}
 	return fmt.Sprintf("%sprint", indent(depth))
 }
+
+// ASTSwitch runs the case one of whose values equals Value, or Default
+// when none does. A case value is a constant or a range of them:
+//
+//	сонго ө {
+//	    Өнгө.Улаан бол { ... }
+//	    Өнгө.Ногоон, Өнгө.Цэнхэр бол { ... }
+//	}
+//	сонго н {
+//	    1, 3..5 бол { ... }
+//	    эсвэл { ... }
+//	}
+type ASTSwitch struct {
+	Token   lexer.Token
+	Value   ASTExpression
+	Cases   []ASTCase
+	Default ASTStmt
+}
+
+type ASTCase struct {
+	Token  lexer.Token
+	Values []ASTExpression
+	Body   ASTStmt
+}
+
+func (a *ASTSwitch) statementNode()       {}
+func (a *ASTSwitch) TokenLiteral() string { return "SWITCH" }
+func (a *ASTSwitch) PrintAST(depth int) string {
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("%sSwitch %s:\n", indent(depth), a.Value.PrintAST(0)))
+	for _, c := range a.Cases {
+		values := make([]string, len(c.Values))
+		for i, value := range c.Values {
+			values[i] = value.PrintAST(0)
+		}
+		out.WriteString(fmt.Sprintf("%s├─ %s:\n", indent(depth), strings.Join(values, ", ")))
+		out.WriteString(c.Body.PrintAST(depth+1) + "\n")
+	}
+	if a.Default != nil {
+		out.WriteString(fmt.Sprintf("%s├─ эсвэл:\n", indent(depth)))
+		out.WriteString(a.Default.PrintAST(depth+1) + "\n")
+	}
+	return out.String()
+}
@@ -53,10 +53,18 @@ var tokenTranslations = map[lexer.TokenType]string{
 	lexer.CLOSE_PAREN:      ")",
 	lexer.RIGHT_ARROW:      "->",
 	lexer.INT_TYPE:         "тоо",
+	lexer.DOUBLE_NUMBER:    "бутархай тоо",
+	lexer.DOUBLE_TYPE:      "бутархай",
+	lexer.BOOL_TYPE:        "логик",
+	lexer.TRUE:             "үнэн",
+	lexer.FALSE:            "худал",
 	lexer.IF:               "хэрэв",
 	lexer.IFNOT:            "бол",
 	lexer.RETURN:           "буц",
 	lexer.VAR_DECL:         "зарла",
+	lexer.FN:               "функц",
+	lexer.NOINLINE:         "шигтгэхгүй",
+	lexer.SWITCH:           "сонго",
 }
 
 // Error message formatters
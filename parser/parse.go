@@ -80,11 +80,27 @@ func (p *Parser) ParseProgram() (*ASTProgram, error) {
 }
 
 func (p *Parser) parseDecl(globl bool, extern bool) ASTDecl {
+	if p.atEnumDecl() {
+		return p.parseEnumDecl(globl)
+	}
 	switch p.current.Type {
 	case lexer.FN:
 		return p.parseFnDecl(globl, extern)
+	case lexer.NOINLINE:
+		// шигтгэхгүй функц ... keeps the optimizer from inlining the function
+		if !p.expect(lexer.FN) {
+			return nil
+		}
+		fn := p.parseFnDecl(globl, extern)
+		if fn == nil {
+			return nil
+		}
+		fn.NoInline = true
+		return fn
 	case lexer.VAR_DECL:
 		return p.parseVarDecl(globl, extern)
+	case lexer.STRUCT:
+		return p.parseStructDecl(globl)
 	default:
 		panic(fmt.Sprintf("unimplemented token: %s", p.current.Type))
 	}
@@ -177,6 +193,8 @@ func (p *Parser) parseStmt() ASTStmt {
 		return p.parseReturn()
 	case lexer.IF:
 		return p.parseIf()
+	case lexer.SWITCH:
+		return p.parseSwitch()
 	case lexer.OPEN_BRACE:
 		return p.parseCompoundStmt()
 	default:
@@ -290,6 +308,101 @@ func (p *Parser) parseFnDecl(isPublic bool, isExtern bool) *FnDecl {
 	return ast
 }
 
+// <struct> ::= "бүтэц" <identifier> "{" { <identifier> [ ":" ] <type> [ "," ] } "}"
+func (p *Parser) parseStructDecl(isPublic bool) *StructDecl {
+	ast := &StructDecl{
+		Token:    p.current,
+		IsPublic: isPublic,
+	}
+
+	if !p.expect(lexer.IDENT) {
+		p.appendError(ErrMissingIdentifier)
+		return nil
+	}
+	ast.Ident = *p.current.Value
+
+	if !p.expect(lexer.OPEN_BRACE) {
+		p.appendError(ErrMissingBraceOpen)
+		return nil
+	}
+
+	for !p.peekIs(lexer.CLOSE_BRACE) {
+		if !p.expect(lexer.IDENT) {
+			p.appendError(ErrMissingIdentifier)
+			p.skipPast(lexer.CLOSE_BRACE)
+			return nil
+		}
+		field := Param{Token: p.current, Ident: *p.current.Value}
+
+		// optional colon between ident and type
+		p.checkOptional(lexer.COLON)
+
+		fieldType, err := p.parseType()
+		if err != nil {
+			p.appendError(err.Error())
+			p.skipPast(lexer.CLOSE_BRACE)
+			return nil
+		}
+		p.nextToken() // consume type
+		field.Type = p.tryParseArrayType(fieldType)
+		ast.Fields = append(ast.Fields, field)
+
+		p.checkOptional(lexer.COMMA)
+	}
+	p.nextToken() // consume }
+
+	return ast
+}
+
+// <enum> ::= "төрөл" <identifier> "{" { <identifier> [ "," ] } "}"
+// atEnumDecl reports whether a declaration starts with төрөл Name. Programs
+// that use төрөл as a variable name predate enums, so it is only a keyword
+// here.
+func (p *Parser) atEnumDecl() bool {
+	return p.current.Type == lexer.IDENT && p.current.Value != nil &&
+		*p.current.Value == string(lexer.KeywordEnum) && p.peekIs(lexer.IDENT)
+}
+
+func (p *Parser) parseEnumDecl(isPublic bool) *EnumDecl {
+	ast := &EnumDecl{
+		Token:    p.current,
+		IsPublic: isPublic,
+	}
+
+	if !p.expect(lexer.IDENT) {
+		p.appendError(ErrMissingIdentifier)
+		return nil
+	}
+	ast.Ident = *p.current.Value
+
+	if !p.expect(lexer.OPEN_BRACE) {
+		p.appendError(ErrMissingBraceOpen)
+		return nil
+	}
+
+	for !p.peekIs(lexer.CLOSE_BRACE) {
+		if !p.expect(lexer.IDENT) {
+			p.appendError(ErrMissingIdentifier)
+			p.skipPast(lexer.CLOSE_BRACE)
+			return nil
+		}
+		ast.Variants = append(ast.Variants, p.current)
+		p.checkOptional(lexer.COMMA)
+	}
+	p.nextToken() // consume }
+
+	return ast
+}
+
+// skipPast drops tokens up to and including the next t, so parsing can go
+// on after an error.
+func (p *Parser) skipPast(t lexer.TokenType) {
+	for !p.peekIs(t) && !p.peekIs(lexer.EOF) {
+		p.nextToken()
+	}
+	p.nextToken()
+}
+
 func (p *Parser) parseParams() ([]Param, error) {
 	params := []Param{}
 
@@ -343,8 +456,15 @@ func (p *Parser) parseType() (mtypes.Type, error) {
 		return &mtypes.Int64Type{}, nil
 	case lexer.STRING_TYPE:
 		return &mtypes.StringType{}, nil
+	case lexer.DOUBLE_TYPE:
+		return &mtypes.DoubleType{}, nil
+	case lexer.BOOL_TYPE:
+		return &mtypes.BoolType{}, nil
 	case lexer.VOID:
 		return &mtypes.VoidType{}, nil
+	case lexer.IDENT:
+		// a бүтэц or a төрөл, the type checker tells which
+		return &mtypes.StructType{Name: *p.peekToken.Value}, nil
 	default:
 		return &mtypes.VoidType{}, errors.New(ErrMissingIntType, p.current.Line, p.current.Span, p.source, "Синтакс шинжилгээ")
 	}
@@ -463,6 +583,63 @@ func (p *Parser) parseIf() *ASTIfStmt {
 	return ast
 }
 
+// <switch> ::= "сонго" <exp> "{" { <exp> { "," <exp> } "бол" <statement> } "}"
+func (p *Parser) parseSwitch() *ASTSwitch {
+	ast := &ASTSwitch{
+		Token: p.peekToken,
+	}
+
+	p.nextToken() // consume 'сонго'
+	ast.Value = p.parseExpr(Lowest)
+	if ast.Value == nil {
+		return nil
+	}
+
+	if !p.expect(lexer.OPEN_BRACE) {
+		p.appendError(ErrMissingBraceOpen)
+		return nil
+	}
+
+	for !p.peekIs(lexer.CLOSE_BRACE) {
+		if p.peekIs(lexer.EOF) {
+			p.appendError(ErrMissingBraceClose)
+			return nil
+		}
+		// эсвэл is the last arm
+		if p.checkOptional(lexer.ELSE) {
+			ast.Default = p.parseStmt()
+			if ast.Default == nil || !p.expect(lexer.CLOSE_BRACE) {
+				return nil
+			}
+			return ast
+		}
+		c := ASTCase{Token: p.peekToken}
+		for {
+			value := p.parseExpr(Lowest)
+			if value == nil {
+				return nil
+			}
+			c.Values = append(c.Values, value)
+			if !p.checkOptional(lexer.COMMA) {
+				break
+			}
+		}
+
+		if !p.expect(lexer.IS) {
+			p.appendError(ErrMissingIs)
+			return nil
+		}
+		c.Body = p.parseStmt()
+		if c.Body == nil {
+			return nil
+		}
+		ast.Cases = append(ast.Cases, c)
+	}
+	p.nextToken() // consume }
+
+	return ast
+}
+
 func (p *Parser) parseWhile() *ASTWhile {
 	ast := &ASTWhile{
 		Token: p.peekToken,
@@ -531,7 +708,7 @@ func (p *Parser) parseLoop() *ASTLoop {
 
 func (p *Parser) parseReturn() *ASTReturnStmt {
 	ast := &ASTReturnStmt{
-		Token: p.current,
+		Token: p.peekToken,
 	}
 
 	p.nextToken() // consume 'буц'
@@ -552,10 +729,17 @@ func (p *Parser) parseFactor() ASTExpression {
 		return p.parseIdent()
 	case lexer.NUMBER:
 		return p.parseConst()
+	case lexer.DOUBLE_NUMBER:
+		return p.parseDoubleConst()
+	case lexer.TRUE, lexer.FALSE:
+		p.nextToken()
+		return &ASTConstBool{Token: p.current, Value: next.Type == lexer.TRUE}
 	case lexer.STRING:
 		return p.parseString()
 	case lexer.NEW:
-		return p.parseNewArray()
+		return p.parseNew()
+	case lexer.INT_TYPE, lexer.LONG, lexer.DOUBLE_TYPE:
+		return p.parseCast()
 	case lexer.MINUS, lexer.TILDE, lexer.NOT:
 		return p.parseUnary(next.Type)
 	case lexer.OPEN_PAREN:
@@ -641,8 +825,10 @@ func (p *Parser) parseExpr(minPrec int) ASTExpression {
 				left = &ASTAssignment{Token: p.current, Left: lhs, Right: right}
 			case *ASTArrayIndex:
 				left = &ASTAssignment{Token: p.current, Left: lhs, Right: right}
+			case *ASTFieldAccess:
+				left = &ASTAssignment{Token: p.current, Left: lhs, Right: right}
 			default:
-				panic("left side of assign must be var or array index")
+				panic("left side of assign must be var, array index or field")
 			}
 		} else if op == ASTBinOp(A_QUESTIONMARK) {
 			middle := p.parseExpr(Lowest)
@@ -760,10 +946,14 @@ func (p *Parser) parseUnary(op lexer.TokenType) *ASTUnary {
 	}
 }
 
-func (p *Parser) parseNewArray() *ASTNewArray {
+// parseNew reads шинэ тоо[N], or шинэ Цэг for a бүтэц.
+func (p *Parser) parseNew() ASTExpression {
 	p.nextToken() // consume шинэ
 	elementType, _ := p.parseType()
 	p.nextToken() // consume type keyword (тоо)
+	if structType, ok := elementType.(*mtypes.StructType); ok && !p.peekIs(lexer.OPEN_BRACKET) {
+		return &ASTNewStruct{Token: p.current, Type: structType}
+	}
 	if !p.expect(lexer.OPEN_BRACKET) {
 		p.appendError("'[' байх ёстой")
 		return nil
@@ -781,6 +971,27 @@ func (p *Parser) parseNewArray() *ASTNewArray {
 	}
 }
 
+// parseCast reads a conversion written as a call of the type: тоо(ө),
+// бутархай(н). A төрөл written the same way looks like a call here, the
+// resolver turns it into a cast.
+func (p *Parser) parseCast() ASTExpression {
+	target, _ := p.parseType()
+	p.nextToken() // consume type keyword
+	if !p.expect(lexer.OPEN_PAREN) {
+		p.appendError(ErrMissingParenOpen)
+		return nil
+	}
+	expr := p.parseExpr(Lowest)
+	if expr == nil {
+		return nil
+	}
+	if !p.expect(lexer.CLOSE_PAREN) {
+		p.appendError(ErrMissingParenClose)
+		return nil
+	}
+	return &ASTCast{TargetType: target, Expr: expr}
+}
+
 func (p *Parser) parseGrouping() ASTExpression {
 	p.nextToken()
 	inner := p.parseExpr(Lowest)
@@ -826,27 +1037,48 @@ func (p *Parser) parseIdent() ASTExpression {
 	p.nextToken()
 
 	if p.peekIs(lexer.OPEN_PAREN) {
-		return p.parseFnCall()
+		return p.parsePostfix(p.parseFnCall())
 	}
 
-	if p.peekIs(lexer.OPEN_BRACKET) {
-		p.nextToken() // consume [
-		index := p.parseExpr(Lowest)
-		if !p.expect(lexer.CLOSE_BRACKET) {
-			p.appendError("']' байх ёстой")
-			return nil
-		}
-		return &ASTArrayIndex{
-			Token: next,
-			Array: &ASTVar{Token: next, Ident: *next.Value},
-			Index: index,
-		}
-	}
-
-	return &ASTVar{
+	return p.parsePostfix(&ASTVar{
 		Token: next,
 		Ident: *next.Value,
+	})
+}
+
+// parsePostfix reads the indexes and field accesses that follow a variable
+// or a call: шугам.эхлэл.x, цэгүүд[i].y
+func (p *Parser) parsePostfix(expr ASTExpression) ASTExpression {
+	for expr != nil {
+		switch {
+		case p.peekIs(lexer.OPEN_BRACKET):
+			p.nextToken() // consume [
+			index := p.parseExpr(Lowest)
+			if !p.expect(lexer.CLOSE_BRACKET) {
+				p.appendError("']' байх ёстой")
+				return nil
+			}
+			expr = &ASTArrayIndex{
+				Token: TokenOf(expr),
+				Array: expr,
+				Index: index,
+			}
+		case p.peekIs(lexer.DOT):
+			p.nextToken() // consume .
+			if !p.expect(lexer.IDENT) {
+				p.appendError("'.' тэмдэгтийн араас талбарын нэр байх ёстой")
+				return nil
+			}
+			expr = &ASTFieldAccess{
+				Token:  p.current,
+				Struct: expr,
+				Field:  *p.current.Value,
+			}
+		default:
+			return expr
+		}
 	}
+	return nil
 }
 
 func (p *Parser) parseConst() ASTConst {
@@ -868,6 +1100,18 @@ func (p *Parser) parseConst() ASTConst {
 	return &ASTConstInt{Token: next, Value: intVal}
 }
 
+func (p *Parser) parseDoubleConst() ASTConst {
+	next := p.peekToken
+	p.nextToken()
+
+	value, err := strconv.ParseFloat(*next.Value, 64)
+	if err != nil {
+		p.appendError("cannot parse number")
+		return nil
+	}
+	return &ASTConstDouble{Token: next, Value: value}
+}
+
 func (p *Parser) peekPrecedence() int {
 	if prec, ok := precedences[p.peekToken.Type]; ok {
 		return prec
@@ -7,6 +7,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/your-moon/mon_lang/lexer"
+	"github.com/your-moon/mon_lang/mtypes"
 )
 
 func TestParseSimple(t *testing.T) {
@@ -195,6 +196,127 @@ func TestParseDeclarations(t *testing.T) {
 	}
 }
 
+func TestParseStruct(t *testing.T) {
+	source := []int32("бүтэц Цэг { x: тоо, y тоо64 } функц f(ш Шугам, цэгүүд Цэг[]) -> тоо { ш.эхлэл.x = цэгүүд[0].y; буц шинэ Цэг; }")
+	p := NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Failed to parse struct: %v", err)
+	}
+
+	structDecl, ok := program.Decls[0].(*StructDecl)
+	if !ok {
+		t.Fatalf("Expected struct declaration, got %T", program.Decls[0])
+	}
+	if structDecl.Ident != "Цэг" || len(structDecl.Fields) != 2 || structDecl.Fields[1].Ident != "y" {
+		t.Errorf("Unexpected struct declaration: %s", structDecl.PrintAST(0))
+	}
+
+	fnDecl := program.Decls[1].(*FnDecl)
+	if param, ok := fnDecl.Params[0].Type.(*mtypes.StructType); !ok || param.Name != "Шугам" {
+		t.Errorf("Expected a Шугам parameter, got %v", fnDecl.Params[0].Type)
+	}
+
+	// ш.эхлэл.x = цэгүүд[0].y
+	assign := fnDecl.Body.BlockItems[0].(*ExpressionStmt).Expression.(*ASTAssignment)
+	left, ok := assign.Left.(*ASTFieldAccess)
+	if !ok || left.Field != "x" {
+		t.Fatalf("Expected .x on the left, got %T", assign.Left)
+	}
+	if inner, ok := left.Struct.(*ASTFieldAccess); !ok || inner.Field != "эхлэл" {
+		t.Errorf("Expected ш.эхлэл inside, got %T", left.Struct)
+	}
+	right, ok := assign.Right.(*ASTFieldAccess)
+	if !ok || right.Field != "y" {
+		t.Fatalf("Expected .y on the right, got %T", assign.Right)
+	}
+	if _, ok := right.Struct.(*ASTArrayIndex); !ok {
+		t.Errorf("Expected цэгүүд[0] inside, got %T", right.Struct)
+	}
+
+	ret := fnDecl.Body.BlockItems[1].(*ASTReturnStmt)
+	if _, ok := ret.ReturnValue.(*ASTNewStruct); !ok {
+		t.Errorf("Expected шинэ Цэг, got %T", ret.ReturnValue)
+	}
+}
+
+func TestParseEnum(t *testing.T) {
+	source := []int32("төрөл Өнгө { Улаан, Ногоон Цэнхэр } функц f(ө Өнгө) -> тоо { сонго ө { Өнгө.Улаан, Өнгө.Ногоон бол буц тоо(ө); Өнгө.Цэнхэр бол {} } буц 0; }")
+	p := NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Failed to parse enum: %v", err)
+	}
+
+	enumDecl, ok := program.Decls[0].(*EnumDecl)
+	if !ok {
+		t.Fatalf("Expected enum declaration, got %T", program.Decls[0])
+	}
+	if enumDecl.Ident != "Өнгө" || len(enumDecl.Variants) != 3 || *enumDecl.Variants[2].Value != "Цэнхэр" {
+		t.Errorf("Unexpected enum declaration: %s", enumDecl.PrintAST(0))
+	}
+
+	fnDecl := program.Decls[1].(*FnDecl)
+	switchStmt, ok := fnDecl.Body.BlockItems[0].(*ASTSwitch)
+	if !ok {
+		t.Fatalf("Expected сонго, got %T", fnDecl.Body.BlockItems[0])
+	}
+	if len(switchStmt.Cases) != 2 || len(switchStmt.Cases[0].Values) != 2 || len(switchStmt.Cases[1].Values) != 1 {
+		t.Fatalf("Unexpected cases: %s", switchStmt.PrintAST(0))
+	}
+	ret := switchStmt.Cases[0].Body.(*ASTReturnStmt)
+	if cast, ok := ret.ReturnValue.(*ASTCast); !ok {
+		t.Errorf("Expected тоо(ө), got %T", ret.ReturnValue)
+	} else if _, ok := cast.TargetType.(*mtypes.Int32Type); !ok {
+		t.Errorf("Expected a cast to тоо, got %v", cast.TargetType)
+	}
+}
+
+// TestParseEnumKeywordAsName checks төрөл is still a name everywhere but at
+// the start of a declaration, as it was before enums.
+func TestParseEnumKeywordAsName(t *testing.T) {
+	source := []int32("төрөл Өнгө { Улаан } зарла төрөл: тоо = 1; функц f(төрөл тоо) -> тоо { зарла х: тоо = төрөл + 1; төрөл = х; буц төрөл; }")
+	p := NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if _, ok := program.Decls[0].(*EnumDecl); !ok {
+		t.Fatalf("Expected enum declaration, got %T", program.Decls[0])
+	}
+	if decl, ok := program.Decls[1].(*VarDecl); !ok || decl.Ident != "төрөл" {
+		t.Errorf("Expected a global named төрөл, got %T", program.Decls[1])
+	}
+	fnDecl := program.Decls[2].(*FnDecl)
+	if len(fnDecl.Params) != 1 || len(fnDecl.Body.BlockItems) != 3 {
+		t.Errorf("Unexpected function: %s", fnDecl.PrintAST(0))
+	}
+}
+
+func TestParseSwitch(t *testing.T) {
+	source := []int32("функц f(н тоо) -> тоо { сонго н { -1, 2..5 бол буц 1; эсвэл буц 2; } буц 0; }")
+	p := NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Failed to parse сонго: %v", err)
+	}
+
+	fnDecl := program.Decls[0].(*FnDecl)
+	switchStmt, ok := fnDecl.Body.BlockItems[0].(*ASTSwitch)
+	if !ok {
+		t.Fatalf("Expected сонго, got %T", fnDecl.Body.BlockItems[0])
+	}
+	if len(switchStmt.Cases) != 1 || len(switchStmt.Cases[0].Values) != 2 {
+		t.Fatalf("Unexpected cases: %s", switchStmt.PrintAST(0))
+	}
+	if _, ok := switchStmt.Cases[0].Values[1].(*ASTRangeExpr); !ok {
+		t.Errorf("Expected a range, got %T", switchStmt.Cases[0].Values[1])
+	}
+	if _, ok := switchStmt.Default.(*ASTReturnStmt); !ok {
+		t.Errorf("Expected an эсвэл arm, got %T", switchStmt.Default)
+	}
+}
+
 func TestParseExamples(t *testing.T) {
 	testDirs := []string{
 		"../test",
@@ -43,10 +43,11 @@ type RunRequest struct {
 	Code string `json:"code"`
 }
 
-type RunResponse struct {
-	Stdout   string `json:"stdout"`
+// CompileResponse carries the module from --emit=wasm, base64 encoded by
+// encoding/json.
+type CompileResponse struct {
+	Wasm     []byte `json:"wasm,omitempty"`
 	Stderr   string `json:"stderr"`
-	ExitCode int    `json:"exitCode"`
 	Duration string `json:"duration"`
 	Error    string `json:"error,omitempty"`
 }
@@ -82,7 +83,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) routes() {
 	// API routes
-	s.mux.HandleFunc("/api/run", s.handleRun)
+	s.mux.HandleFunc("/api/compile", s.handleCompile)
 	s.mux.HandleFunc("/api/examples", s.handleExamples)
 
 	// Static files (Next.js export)
@@ -93,10 +94,24 @@ func (s *Server) routes() {
 	s.mux.Handle("/", http.FileServer(http.FS(staticSub)))
 }
 
-func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+// handleCompile only compiles to WebAssembly, the browser runs the module
+// so nothing the user wrote executes on the server.
+func (s *Server) handleCompile(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	resp := s.compileCode(req.Code)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readRequest rate limits and decodes a RunRequest, on failure the error
+// response is already written.
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request) (RunRequest, bool) {
+	var req RunRequest
 	if r.Method != "POST" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+		return req, false
 	}
 
 	// Rate limit
@@ -105,50 +120,46 @@ func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
 		ip = strings.Split(fwd, ",")[0]
 	}
 	if !s.limiter.Allow(ip) {
-		writeJSON(w, http.StatusTooManyRequests, RunResponse{
+		writeJSON(w, http.StatusTooManyRequests, CompileResponse{
 			Error: "Хэт олон хүсэлт. Түр хүлээнэ үү.",
 		})
-		return
+		return req, false
 	}
 
 	// Read body
 	body, err := io.ReadAll(io.LimitReader(r.Body, maxCodeSize+1))
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, RunResponse{Error: "read error"})
-		return
+		writeJSON(w, http.StatusBadRequest, CompileResponse{Error: "read error"})
+		return req, false
 	}
 	if len(body) > maxCodeSize {
-		writeJSON(w, http.StatusBadRequest, RunResponse{Error: "code too large (max 64KB)"})
-		return
+		writeJSON(w, http.StatusBadRequest, CompileResponse{Error: "code too large (max 64KB)"})
+		return req, false
 	}
 
-	var req RunRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		writeJSON(w, http.StatusBadRequest, RunResponse{Error: "invalid JSON"})
-		return
+		writeJSON(w, http.StatusBadRequest, CompileResponse{Error: "invalid JSON"})
+		return req, false
 	}
 	if strings.TrimSpace(req.Code) == "" {
-		writeJSON(w, http.StatusBadRequest, RunResponse{Error: "empty code"})
-		return
+		writeJSON(w, http.StatusBadRequest, CompileResponse{Error: "empty code"})
+		return req, false
 	}
-
-	resp := s.runCode(req.Code)
-	writeJSON(w, http.StatusOK, resp)
+	return req, true
 }
 
-func (s *Server) runCode(code string) RunResponse {
-	start := time.Now()
-
-	// Create temp directory
+// workspace writes code as program.mn into a temp directory next to the
+// stdlib, the caller removes the directory.
+func (s *Server) workspace(code string) (string, error) {
 	tmpDir, err := os.MkdirTemp("", "monplay-*")
 	if err != nil {
-		return RunResponse{Error: fmt.Sprintf("temp dir error: %v", err)}
+		return "", fmt.Errorf("temp dir error: %v", err)
 	}
-	defer os.RemoveAll(tmpDir)
 
 	// Symlink stdlib
 	if err := os.Symlink(s.stdlib, filepath.Join(tmpDir, "stdlib")); err != nil {
-		return RunResponse{Error: fmt.Sprintf("stdlib symlink error: %v", err)}
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("stdlib symlink error: %v", err)
 	}
 
 	// Symlink stdlib .mn files so imports like ашигла "math.mn" work
@@ -162,41 +173,52 @@ func (s *Server) runCode(code string) RunResponse {
 	// Write source
 	srcFile := filepath.Join(tmpDir, "program.mn")
 	if err := os.WriteFile(srcFile, []byte(code), 0644); err != nil {
-		return RunResponse{Error: fmt.Sprintf("write error: %v", err)}
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("write error: %v", err)
+	}
+	return tmpDir, nil
+}
+
+func (s *Server) compileCode(code string) CompileResponse {
+	start := time.Now()
+
+	tmpDir, err := s.workspace(code)
+	if err != nil {
+		return CompileResponse{Error: err.Error()}
 	}
+	defer os.RemoveAll(tmpDir)
 
-	// Compile and run
+	// the compiler alone finishes well within the timeout, this only guards
+	// against it hanging
 	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, s.compiler, "gen", "program.mn", "--run")
+	cmd := exec.CommandContext(ctx, s.compiler, "gen", "program.mn", "--emit=wasm", "-o", "./program")
 	cmd.Dir = tmpDir
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &limitedWriter{buf: &stdout, limit: maxOutputSize}
+	var stderr bytes.Buffer
 	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxOutputSize}
 
 	err = cmd.Run()
-	duration := time.Since(start)
-
-	resp := RunResponse{
-		Stdout:   stdout.String(),
+	resp := CompileResponse{
 		Stderr:   stderr.String(),
-		Duration: fmt.Sprintf("%.1fms", float64(duration.Milliseconds())),
+		Duration: fmt.Sprintf("%.1fms", float64(time.Since(start).Milliseconds())),
 	}
-
 	if ctx.Err() == context.DeadlineExceeded {
 		resp.Error = "Хугацаа хэтэрсэн (5 секунд)"
-		resp.ExitCode = -1
-	} else if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			resp.ExitCode = exitErr.ExitCode()
-		} else {
-			resp.Error = err.Error()
-			resp.ExitCode = -1
-		}
+		return resp
+	}
+	if err != nil {
+		resp.Error = "Хөрвүүлэлт амжилтгүй боллоо"
+		return resp
 	}
 
+	wasm, err := os.ReadFile(filepath.Join(tmpDir, "program.wasm"))
+	if err != nil {
+		resp.Error = fmt.Sprintf("read error: %v", err)
+		return resp
+	}
+	resp.Wasm = wasm
 	return resp
 }
 
@@ -12,8 +12,8 @@ import {
 } from "@/components/ui/select";
 import { Badge } from "@/components/ui/badge";
 import { Separator } from "@/components/ui/separator";
-import { Play, Loader2 } from "lucide-react";
-import { runCode, getExamples, type Example, type RunResult } from "@/lib/api";
+import { Play, Loader2, Square } from "lucide-react";
+import { runCode, stopCode, getExamples, type Example, type RunResult } from "@/lib/api";
 import OutputPanel from "@/components/output-panel";
 import { ThemeToggle } from "@/components/theme-toggle";
 
@@ -134,6 +134,12 @@ export default function Home() {
             Ctrl+Enter
           </kbd>
         </Button>
+        {isRunning && (
+          <Button onClick={stopCode} size="sm" variant="outline" className="gap-1.5">
+            <Square className="h-3.5 w-3.5" />
+            Зогсоох
+          </Button>
+        )}
         {examples.length > 0 && (
           <>
             <Separator orientation="vertical" className="h-4" />
@@ -25,6 +25,8 @@ function registerMonLanguage(monaco: Parameters<OnMount>[1]) {
       "хоосон",
       "тоо",
       "тоо64",
+      "бутархай",
+      "логик",
       "мөр",
       "шинэ",
       "зогс",
@@ -35,6 +37,8 @@ function registerMonLanguage(monaco: Parameters<OnMount>[1]) {
       "үнэн",
       "худал",
       "бүтэц",
+      "төрөл",
+      "сонго",
       "массив",
     ],
     operators: [
@@ -79,7 +83,7 @@ function registerMonLanguage(monaco: Parameters<OnMount>[1]) {
             },
           },
         ],
-        [/\d*\.\d+([eE][-+]?\d+)?/, "number.float"],
+        [/\d+(\.\d+)?[eE][-+]?\d+|\d+\.\d+/, "number.float"],
         [/\d+/, "number"],
         [/"([^"\\]|\\.)*$/, "string.invalid"],
         [/"/, { token: "string.quote", bracket: "@open", next: "@string" }],
@@ -1,3 +1,5 @@
+import { runWasm, stopWasm } from "./wasm";
+
 const API_URL = process.env.NEXT_PUBLIC_API_URL || "";
 
 export interface RunResult {
@@ -8,14 +10,22 @@ export interface RunResult {
   error: string;
 }
 
+interface CompileResult {
+  wasm?: string;
+  stderr: string;
+  duration: string;
+  error?: string;
+}
+
 export interface Example {
   name: string;
   filename: string;
   code: string;
 }
 
+// runCode only asks the server to compile, the module runs in the browser.
 export async function runCode(code: string): Promise<RunResult> {
-  const res = await fetch(`${API_URL}/api/run`, {
+  const res = await fetch(`${API_URL}/api/compile`, {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify({ code }),
@@ -25,7 +35,31 @@ export async function runCode(code: string): Promise<RunResult> {
     throw new Error(`Server error: ${res.status}`);
   }
 
-  return res.json();
+  const compiled: CompileResult = await res.json();
+  if (compiled.error || !compiled.wasm) {
+    return {
+      stdout: "",
+      stderr: compiled.stderr,
+      exitCode: 1,
+      duration: compiled.duration,
+      error: compiled.error,
+    };
+  }
+
+  const start = performance.now();
+  const wasm = Uint8Array.from(atob(compiled.wasm), (c) => c.charCodeAt(0));
+  const result = await runWasm(wasm);
+  return {
+    stdout: result.stdout,
+    stderr: "",
+    exitCode: result.exitCode,
+    duration: `${(performance.now() - start).toFixed(1)}ms`,
+    error: result.error,
+  };
+}
+
+export function stopCode() {
+  stopWasm();
 }
 
 export async function getExamples(): Promise<Example[]> {
@@ -0,0 +1,62 @@
+// The "env" imports of a module from --emit=wasm, they do what stdlib/lib.c
+// does. The playground's worker and wasm_gen/testdata/run.mjs both use this
+// one copy.
+
+/**
+ * @typedef {object} Host
+ * @property {(s: string) => void} print writes to stdout
+ * @property {() => string | undefined} token the next whitespace separated
+ *   word of stdin, undefined once there is none
+ * @property {() => WebAssembly.Memory} memory the instance's memory
+ */
+
+// formatG writes d like printf("%g") does.
+/** @param {number} d */
+export function formatG(d) {
+  if (Number.isNaN(d)) {
+    const bits = new DataView(new Float64Array([d]).buffer);
+    return bits.getUint8(7) & 0x80 ? "-nan" : "nan";
+  }
+  if (!Number.isFinite(d)) return d < 0 ? "-inf" : "inf";
+  if (d === 0) return Object.is(d, -0) ? "-0" : "0";
+  const [mantissa, e] = d.toExponential(5).split("e");
+  const exp = Number(e);
+  if (exp < -4 || exp >= 6) {
+    const digits = mantissa.replace(/\.?0+$/, "");
+    return `${digits}e${exp < 0 ? "-" : "+"}${String(Math.abs(exp)).padStart(2, "0")}`;
+  }
+  const fixed = d.toFixed(5 - exp);
+  return fixed.includes(".") ? fixed.replace(/\.?0+$/, "") : fixed;
+}
+
+/** @param {Host} host */
+export function hostEnv(host) {
+  /** @param {number} ptr */
+  const cString = (ptr) => {
+    const bytes = new Uint8Array(host.memory().buffer);
+    let end = ptr;
+    while (bytes[end] !== 0) end++;
+    return new TextDecoder().decode(bytes.subarray(ptr, end));
+  };
+
+  return {
+    /** @param {bigint} n */
+    khevle: (n) => host.print(n.toString()),
+    /** @param {number} ptr */
+    mqr_khevlekh: (ptr) => host.print(cString(ptr)),
+    unsh: () => BigInt(host.token() ?? 0),
+    unsh32: () => Number(host.token() ?? 0) | 0,
+    /** @param {number} d */
+    butarkhay_khevlekh: (d) => host.print(formatG(d)),
+    butarkhay_unsh: () => parseFloat(host.token() ?? "0"),
+    /** @param {number} n */
+    sanamsargwyToo: (n) => Math.floor(Math.random() * n) + 1,
+    odoo: () => BigInt(Math.floor(Date.now() / 1000)),
+    chqlqqlqkh: () => {},
+    khwleekh: () => {},
+    delgetsTseverlekh: () => host.print("\x1b[H\x1b[2J"),
+    // аргс only holds the program name, as for a native run without
+    // arguments
+    argyin_too: () => 1,
+  };
+}
@@ -0,0 +1,40 @@
+// Runs a module from --emit=wasm off the main thread with the imports from
+// wasm-host.mjs. There is no stdin and хүлээх doesn't wait.
+
+import { hostEnv } from "./wasm-host.mjs";
+
+const MAX_OUTPUT = 64 * 1024;
+
+export interface WorkerResult {
+  stdout: string;
+  exitCode: number;
+  error: string;
+}
+
+let memory: WebAssembly.Memory;
+let stdout = "";
+
+function print(s: string) {
+  if (stdout.length < MAX_OUTPUT) {
+    stdout = (stdout + s).slice(0, MAX_OUTPUT);
+  }
+}
+
+// there is no stdin, every read gets 0
+const env = hostEnv({ print, token: () => undefined, memory: () => memory });
+
+self.onmessage = async (e: MessageEvent<Uint8Array>) => {
+  stdout = "";
+  const result: WorkerResult = { stdout: "", exitCode: 0, error: "" };
+  try {
+    const { instance } = await WebAssembly.instantiate(e.data, { env });
+    memory = instance.exports.memory as WebAssembly.Memory;
+    const main = instance.exports.main as () => number;
+    result.exitCode = main() & 0xff;
+  } catch (err) {
+    result.exitCode = -1;
+    result.error = `Ажиллах үед алдаа гарлаа: ${err instanceof Error ? err.message : String(err)}`;
+  }
+  result.stdout = stdout;
+  self.postMessage(result);
+};
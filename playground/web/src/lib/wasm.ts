@@ -0,0 +1,34 @@
+import type { WorkerResult } from "./wasm-worker";
+
+let worker: Worker | null = null;
+let stopRun: (() => void) | null = null;
+
+// runWasm runs the module in a worker so a program that never ends doesn't
+// freeze the page, stopWasm or starting another run ends it.
+export function runWasm(wasm: Uint8Array): Promise<WorkerResult> {
+  stopWasm();
+  const current = new Worker(new URL("./wasm-worker.ts", import.meta.url), {
+    type: "module",
+  });
+  worker = current;
+
+  return new Promise((resolve) => {
+    const finish = (result: WorkerResult) => {
+      current.terminate();
+      if (worker === current) {
+        worker = null;
+        stopRun = null;
+      }
+      resolve(result);
+    };
+    stopRun = () => finish({ stdout: "", exitCode: -1, error: "Зогсоолоо" });
+    current.onmessage = (e: MessageEvent<WorkerResult>) => finish(e.data);
+    current.onerror = (e) =>
+      finish({ stdout: "", exitCode: -1, error: e.message });
+    current.postMessage(wasm);
+  });
+}
+
+export function stopWasm() {
+  stopRun?.();
+}
@@ -141,6 +141,23 @@ func (r *LoopPass) LabelStmt(currentLabel string, program parser.ASTStmt) (parse
 		}
 		nodetype.Else = klse
 		return nodetype, nil
+	case *parser.ASTSwitch:
+		// зогс in a case still leaves the loop around the сонго
+		for i := range nodetype.Cases {
+			body, err := r.LabelStmt(currentLabel, nodetype.Cases[i].Body)
+			if err != nil {
+				return nil, err
+			}
+			nodetype.Cases[i].Body = body
+		}
+		if nodetype.Default != nil {
+			body, err := r.LabelStmt(currentLabel, nodetype.Default)
+			if err != nil {
+				return nil, err
+			}
+			nodetype.Default = body
+		}
+		return nodetype, nil
 	default:
 		return program, nil
 	}
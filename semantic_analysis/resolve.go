@@ -6,6 +6,7 @@ import (
 
 	compilererrors "github.com/your-moon/mon_lang/errors"
 	"github.com/your-moon/mon_lang/lexer"
+	"github.com/your-moon/mon_lang/mtypes"
 	"github.com/your-moon/mon_lang/parser"
 	"github.com/your-moon/mon_lang/util/unique"
 )
@@ -34,6 +35,9 @@ type Resolver struct {
 	source      []int32
 	uniqueGen   unique.UniqueGen
 	errors      []compilererrors.CompilerError
+	// enums are the names of the declared төрөл types, Өнгө.Улаан is a
+	// variant and Өнгө(2) a cast unless a variable or a function hides them
+	enums map[string]bool
 }
 
 func NewResolver(source []int32, uniqueGen unique.UniqueGen) *Resolver {
@@ -41,6 +45,7 @@ func NewResolver(source []int32, uniqueGen unique.UniqueGen) *Resolver {
 		tempCounter: 0,
 		source:      source,
 		uniqueGen:   uniqueGen,
+		enums:       make(map[string]bool),
 	}
 }
 
@@ -80,6 +85,11 @@ func (r *Resolver) resolveParams(params []parser.Param, innerMap map[string]VarE
 func (r *Resolver) Resolve(program *parser.ASTProgram) (*parser.ASTProgram, error) {
 	emptyMap := make(IdMap)
 	var resolveErrors []string
+	for _, decl := range program.Decls {
+		if enumDecl, ok := decl.(*parser.EnumDecl); ok {
+			r.enums[enumDecl.Ident] = true
+		}
+	}
 	for i, decl := range program.Decls {
 		newMap, resolvedDecl, err := r.ResolveDecl(decl, emptyMap)
 		if err != nil {
@@ -103,6 +113,9 @@ func (r *Resolver) ResolveDecl(decl parser.ASTDecl, innerMap IdMap) (IdMap, pars
 		return r.ResolveFnDecl(declType, innerMap)
 	case *parser.VarDecl:
 		return r.ResolveFileScopeVarDecl(declType, innerMap)
+	case *parser.StructDecl, *parser.EnumDecl:
+		// type, field and variant names live apart from variables
+		return innerMap, decl, nil
 	default:
 		panic("unimplemented decl type on resolve")
 	}
@@ -327,10 +340,57 @@ func (r *Resolver) ResolveStmt(program parser.ASTStmt, innerMap IdMap) (parser.A
 		}
 		nodetype.Expression = resolvedExpr
 		return nodetype, nil
+	case *parser.ASTSwitch:
+		resolvedValue, err := r.ResolveExpr(nodetype.Value, innerMap)
+		if err != nil {
+			return nil, err
+		}
+		nodetype.Value = resolvedValue
+
+		for i := range nodetype.Cases {
+			c := &nodetype.Cases[i]
+			for j, value := range c.Values {
+				resolvedCaseValue, err := r.ResolveExpr(value, innerMap)
+				if err != nil {
+					return nil, err
+				}
+				c.Values[j] = resolvedCaseValue
+			}
+			body, err := r.ResolveStmt(c.Body, innerMap)
+			if err != nil {
+				return nil, err
+			}
+			c.Body = body
+		}
+		if nodetype.Default != nil {
+			body, err := r.ResolveStmt(nodetype.Default, innerMap)
+			if err != nil {
+				return nil, err
+			}
+			nodetype.Default = body
+		}
+		return nodetype, nil
 	}
 	return program, nil
 }
 
+// resolveEnumCast turns Өнгө(н) into a cast to the төрөл. The type checker
+// finds the type by its name like any other written in the source.
+func (r *Resolver) resolveEnumCast(call *parser.ASTFnCall, innerMap IdMap) (parser.ASTExpression, error) {
+	if len(call.Args) != 1 {
+		return nil, r.createSemanticError(
+			fmt.Sprintf("'%s' төрөл рүү хөрвүүлэхэд нэг утга өгнө, %d өгсөн байна", call.Ident, len(call.Args)),
+			call.Token.Line,
+			call.Token.Span,
+		)
+	}
+	arg, err := r.ResolveExpr(call.Args[0], innerMap)
+	if err != nil {
+		return nil, err
+	}
+	return &parser.ASTCast{TargetType: &mtypes.StructType{Name: call.Ident}, Expr: arg}, nil
+}
+
 func (r *Resolver) copyIdMap(mapToCopy map[string]VarEntry) map[string]VarEntry {
 	newMap := make(map[string]VarEntry)
 
@@ -387,6 +447,9 @@ func (r *Resolver) ResolveExpr(program parser.ASTExpression, innerMap IdMap) (pa
 
 	switch nodetype := program.(type) {
 	case *parser.ASTFnCall:
+		if _, exists := innerMap[nodetype.Ident]; !exists && r.enums[nodetype.Ident] {
+			return r.resolveEnumCast(nodetype, innerMap)
+		}
 		if _, exists := innerMap[nodetype.Ident]; !exists {
 			return nil, r.createSemanticError(
 				fmt.Sprintf(compilererrors.ErrNotDeclaredFnCall, nodetype.Ident),
@@ -450,6 +513,7 @@ func (r *Resolver) ResolveExpr(program parser.ASTExpression, innerMap IdMap) (pa
 		}
 
 		return &parser.ASTAssignment{
+			Token: nodetype.Token,
 			Left:  resolvedLeft,
 			Right: resolvedRight,
 		}, nil
@@ -475,6 +539,7 @@ func (r *Resolver) ResolveExpr(program parser.ASTExpression, innerMap IdMap) (pa
 			return nil, err
 		}
 		return &parser.ASTUnary{
+			Token: nodetype.Token,
 			Inner: resolvedInner,
 			Op:    nodetype.Op,
 		}, nil
@@ -491,6 +556,7 @@ func (r *Resolver) ResolveExpr(program parser.ASTExpression, innerMap IdMap) (pa
 		}
 
 		return &parser.ASTBinary{
+			Token: nodetype.Token,
 			Left:  resolvedLeft,
 			Right: resolvedRight,
 			Op:    nodetype.Op,
@@ -528,6 +594,37 @@ func (r *Resolver) ResolveExpr(program parser.ASTExpression, innerMap IdMap) (pa
 			Size:        resolvedSize,
 			Type:        nodetype.Type,
 		}, nil
+
+	case *parser.ASTFieldAccess:
+		if enum, ok := nodetype.Struct.(*parser.ASTVar); ok {
+			if _, exists := innerMap[enum.Ident]; !exists && r.enums[enum.Ident] {
+				return &parser.ASTEnumConst{
+					Token:   nodetype.Token,
+					Enum:    enum.Ident,
+					Variant: nodetype.Field,
+				}, nil
+			}
+		}
+		resolvedStruct, err := r.ResolveExpr(nodetype.Struct, innerMap)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.ASTFieldAccess{
+			Token:  nodetype.Token,
+			Struct: resolvedStruct,
+			Field:  nodetype.Field,
+		}, nil
+
+	case *parser.ASTNewStruct:
+		return nodetype, nil
+
+	case *parser.ASTCast:
+		resolvedExpr, err := r.ResolveExpr(nodetype.Expr, innerMap)
+		if err != nil {
+			return nil, err
+		}
+		nodetype.Expr = resolvedExpr
+		return nodetype, nil
 	}
 
 	return nil, r.createSemanticError(
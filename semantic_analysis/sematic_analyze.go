@@ -18,6 +18,10 @@ type SemanticAnalyzer struct {
 	importedFiles map[string]bool
 	baseDir       string
 	stdlibDir     string
+
+	// RequireMain is set when the program becomes an executable, which
+	// can't be built without үндсэн. A library (--shared) doesn't need one.
+	RequireMain bool
 }
 
 func NewSemanticAnalyzer(source []int32, uniqueGen unique.UniqueGen, table *symbols.SymbolTable, baseDir string, stdlibDir string) *SemanticAnalyzer {
@@ -96,12 +100,21 @@ func (s *SemanticAnalyzer) processImports(program *parser.ASTProgram) (*parser.A
 			switch dt := d.(type) {
 			case *parser.FnDecl:
 				if dt.IsPublic {
+					dt.File = filePath
 					importedDecls = append(importedDecls, dt)
 				}
 			case *parser.VarDecl:
 				if dt.IsPublic {
 					importedDecls = append(importedDecls, dt)
 				}
+			case *parser.StructDecl:
+				if dt.IsPublic {
+					importedDecls = append(importedDecls, dt)
+				}
+			case *parser.EnumDecl:
+				if dt.IsPublic {
+					importedDecls = append(importedDecls, dt)
+				}
 			}
 		}
 	}
@@ -128,5 +141,10 @@ func (s *SemanticAnalyzer) Analyze(program *parser.ASTProgram) (*parser.ASTProgr
 	if err != nil {
 		return nil, nil, err
 	}
+	if s.RequireMain {
+		if entry := s.typeChecker.symbolTable.GetOptional(MainFn); entry == nil || !entry.IsDefined {
+			return nil, nil, fmt.Errorf("'үндсэн' функц олдсонгүй, программ үндсэн() -> тоо эсвэл үндсэн(аргс: мөр[]) -> тоо функцээс эхэлнэ")
+		}
+	}
 	return program, s.typeChecker.symbolTable, nil
 }
@@ -2,6 +2,8 @@ package semanticanalysis
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	compilererrors "github.com/your-moon/mon_lang/errors"
 	"github.com/your-moon/mon_lang/lexer"
@@ -15,17 +17,41 @@ type TypeChecker struct {
 	source      []int32
 	uniqueGen   unique.UniqueGen
 	symbolTable *symbols.SymbolTable
+	// retType is what the function being checked returns
+	retType mtypes.Type
+	// structs are the declared бүтэц types by name
+	structs map[string]*mtypes.StructType
+	// enums are the declared төрөл types by name
+	enums map[string]*mtypes.EnumType
 }
 
 func NewTypeChecker(source []int32, uniqueGen unique.UniqueGen, table *symbols.SymbolTable) *TypeChecker {
-	return &TypeChecker{source: source, uniqueGen: uniqueGen, symbolTable: table}
+	return &TypeChecker{
+		source:      source,
+		uniqueGen:   uniqueGen,
+		symbolTable: table,
+		structs:     make(map[string]*mtypes.StructType),
+		enums:       make(map[string]*mtypes.EnumType),
+	}
 }
 
 func (c *TypeChecker) createSemanticError(message string, line int, span lexer.Span) error {
 	return compilererrors.New(message, line, span, c.source, "Семантик шинжилгээ")
 }
 
+// errorAt reports message at the token the parser kept for node.
+func (c *TypeChecker) errorAt(message string, node parser.BlockItem) error {
+	token := parser.TokenOf(node)
+	return c.createSemanticError(message, token.Line, token.Span)
+}
+
 func (c *TypeChecker) CheckTopLevel(program *parser.ASTProgram) (*parser.ASTProgram, error) {
+	if err := c.checkEnumDecls(program); err != nil {
+		return nil, err
+	}
+	if err := c.checkStructDecls(program); err != nil {
+		return nil, err
+	}
 	for i, decl := range program.Decls {
 		switch decltype := decl.(type) {
 		case *parser.FnDecl:
@@ -40,6 +66,7 @@ func (c *TypeChecker) CheckTopLevel(program *parser.ASTProgram) (*parser.ASTProg
 				return nil, err
 			}
 			program.Decls[i] = decl
+		case *parser.StructDecl, *parser.EnumDecl:
 		default:
 			panic(fmt.Sprintf("unsupported top-level declaration: %T", decl))
 		}
@@ -47,17 +74,120 @@ func (c *TypeChecker) CheckTopLevel(program *parser.ASTProgram) (*parser.ASTProg
 	return program, nil
 }
 
+// checkEnumDecls registers every төрөл with its variants, numbered from 0
+// in the order they are written.
+func (c *TypeChecker) checkEnumDecls(program *parser.ASTProgram) error {
+	for _, decl := range program.Decls {
+		enumDecl, ok := decl.(*parser.EnumDecl)
+		if !ok {
+			continue
+		}
+		if _, exists := c.enums[enumDecl.Ident]; exists {
+			return c.errorAt(fmt.Sprintf("төрөл '%s'-ийг дахин зарласан байна", enumDecl.Ident), enumDecl)
+		}
+		if len(enumDecl.Variants) == 0 {
+			return c.errorAt(fmt.Sprintf("'%s' төрөл дор хаяж нэг утгатай байх ёстой", enumDecl.Ident), enumDecl)
+		}
+		enumType := &mtypes.EnumType{Name: enumDecl.Ident}
+		for _, variant := range enumDecl.Variants {
+			if _, exists := enumType.Variant(*variant.Value); exists {
+				return c.createSemanticError(fmt.Sprintf("'%s' төрлийн '%s' утга давхардсан байна", enumDecl.Ident, *variant.Value), variant.Line, variant.Span)
+			}
+			enumType.Variants = append(enumType.Variants, *variant.Value)
+		}
+		c.enums[enumDecl.Ident] = enumType
+	}
+	return nil
+}
+
+// checkStructDecls lays out every бүтэц before anything uses one. All the
+// names are known before the fields are looked at, so a бүтэц can point to
+// one declared after it or to itself.
+func (c *TypeChecker) checkStructDecls(program *parser.ASTProgram) error {
+	decls := []*parser.StructDecl{}
+	for _, decl := range program.Decls {
+		structDecl, ok := decl.(*parser.StructDecl)
+		if !ok {
+			continue
+		}
+		if _, exists := c.structs[structDecl.Ident]; exists {
+			return c.errorAt(fmt.Sprintf("бүтэц '%s'-ийг дахин зарласан байна", structDecl.Ident), structDecl)
+		}
+		if _, exists := c.enums[structDecl.Ident]; exists {
+			return c.errorAt(fmt.Sprintf("'%s' нэр төрөл болон бүтэц хоёуланд өгөгдсөн байна", structDecl.Ident), structDecl)
+		}
+		c.structs[structDecl.Ident] = &mtypes.StructType{Name: structDecl.Ident}
+		decls = append(decls, structDecl)
+	}
+
+	for _, decl := range decls {
+		fields := []mtypes.Field{}
+		seen := map[string]bool{}
+		for _, field := range decl.Fields {
+			if seen[field.Ident] {
+				return c.createSemanticError(fmt.Sprintf("'%s' бүтцийн '%s' талбар давхардсан байна", decl.Ident, field.Ident), field.Token.Line, field.Token.Span)
+			}
+			seen[field.Ident] = true
+			fieldType, err := c.resolveType(field.Type, field.Token)
+			if err != nil {
+				return err
+			}
+			if _, isVoid := fieldType.(*mtypes.VoidType); isVoid {
+				return c.createSemanticError(fmt.Sprintf("'%s' талбар хоосон төрөлтэй байж болохгүй", field.Ident), field.Token.Line, field.Token.Span)
+			}
+			fields = append(fields, mtypes.Field{Name: field.Ident, Type: fieldType})
+		}
+		c.structs[decl.Ident].SetFields(fields)
+	}
+	return nil
+}
+
+// resolveType swaps a бүтэц or a төрөл the parser only knows by name, also
+// as an array element, for the declared one.
+func (c *TypeChecker) resolveType(t mtypes.Type, token lexer.Token) (mtypes.Type, error) {
+	switch ty := t.(type) {
+	case *mtypes.StructType:
+		if declared, ok := c.structs[ty.Name]; ok {
+			return declared, nil
+		}
+		if declared, ok := c.enums[ty.Name]; ok {
+			return declared, nil
+		}
+		return nil, c.createSemanticError(fmt.Sprintf("'%s' төрөл олдсонгүй", ty.Name), token.Line, token.Span)
+	case *mtypes.ArrayType:
+		elementType, err := c.resolveType(ty.ElementType, token)
+		if err != nil {
+			return nil, err
+		}
+		return &mtypes.ArrayType{ElementType: elementType}, nil
+	}
+	return t, nil
+}
+
 func (c *TypeChecker) checkFnDecl(decl *parser.FnDecl) (*parser.FnDecl, error) {
 	paramTypes := make([]mtypes.Type, len(decl.Params))
 	for i, param := range decl.Params {
-		paramTypes[i] = param.Type
+		paramType, err := c.resolveType(param.Type, param.Token)
+		if err != nil {
+			return nil, err
+		}
+		decl.Params[i].Type = paramType
+		paramTypes[i] = paramType
+	}
+	retType, err := c.resolveType(decl.ReturnType, decl.Token)
+	if err != nil {
+		return nil, err
 	}
+	decl.ReturnType = retType
 	fnType := &mtypes.FnType{
 		ParamTypes: paramTypes,
 		RetType:    decl.ReturnType,
 	}
 	hasBody := decl.Body != nil && !decl.IsExtern
 	alreadyDefined := false
+	if decl.Ident == MainFn && !isMainType(fnType) {
+		return nil, c.createSemanticError("'үндсэн' функц () эсвэл (аргс: мөр[]) параметртэй, тоо, тоо64 эсвэл хоосон буцаах ёстой", decl.Token.Line, decl.Token.Span)
+	}
 
 	prev := c.symbolTable.GetOptional(decl.Ident)
 	//decl is in symbol table
@@ -78,6 +208,7 @@ func (c *TypeChecker) checkFnDecl(decl *parser.FnDecl) (*parser.FnDecl, error) {
 		for _, param := range decl.Params {
 			c.symbolTable.AddVar(param.Type, param.Ident)
 		}
+		c.retType = decl.ReturnType
 		block, err := c.checkBlock(decl.Body)
 		if err != nil {
 			return nil, err
@@ -88,6 +219,30 @@ func (c *TypeChecker) checkFnDecl(decl *parser.FnDecl) (*parser.FnDecl, error) {
 	return decl, nil
 }
 
+// MainFn is where the program starts, it gets argv as a мөр[] if it asks
+// for it.
+const MainFn = "үндсэн"
+
+func isMainType(fnType *mtypes.FnType) bool {
+	switch fnType.RetType.(type) {
+	case *mtypes.Int32Type, *mtypes.Int64Type, *mtypes.VoidType:
+	default:
+		return false
+	}
+	switch len(fnType.ParamTypes) {
+	case 0:
+		return true
+	case 1:
+		arr, ok := fnType.ParamTypes[0].(*mtypes.ArrayType)
+		if !ok {
+			return false
+		}
+		_, ok = arr.ElementType.(*mtypes.StringType)
+		return ok
+	}
+	return false
+}
+
 func (c *TypeChecker) checkBlock(block *parser.ASTBlock) (*parser.ASTBlock, error) {
 	for i, item := range block.BlockItems {
 		blockItem, err := c.checkBlockItem(item)
@@ -122,7 +277,7 @@ func (c *TypeChecker) checkStmt(stmt parser.ASTStmt) (parser.ASTStmt, error) {
 	switch typestmt := stmt.(type) {
 	case *parser.ASTWhile:
 		if typestmt.Cond != nil {
-			cond, err := c.checkExpr(typestmt.Cond)
+			cond, err := c.checkCond(typestmt.Cond)
 			if err != nil {
 				return nil, err
 			}
@@ -169,7 +324,7 @@ func (c *TypeChecker) checkStmt(stmt parser.ASTStmt) (parser.ASTStmt, error) {
 		}
 		return typestmt, nil
 	case *parser.ASTIfStmt:
-		cond, err := c.checkExpr(typestmt.Cond)
+		cond, err := c.checkCond(typestmt.Cond)
 		if err != nil {
 			return nil, err
 		}
@@ -196,13 +351,19 @@ func (c *TypeChecker) checkStmt(stmt parser.ASTStmt) (parser.ASTStmt, error) {
 		}
 		typestmt.Expression = expr
 		return typestmt, nil
+	case *parser.ASTSwitch:
+		return c.checkSwitch(typestmt)
 	case *parser.ASTReturnStmt:
 		if typestmt.ReturnValue != nil {
 			expr, err := c.checkExpr(typestmt.ReturnValue)
 			if err != nil {
 				return nil, err
 			}
-			typestmt.ReturnValue = expr
+			if c.retType != nil && mismatched(c.retType, expr.GetType()) {
+				return nil, c.errorAt(fmt.Sprintf("функц '%s' буцаах ёстой, '%s' буцааж байна",
+					c.typeName(c.retType), c.typeName(expr.GetType())), expr)
+			}
+			typestmt.ReturnValue = convertTo(expr, c.retType)
 		}
 		return typestmt, nil
 	default:
@@ -210,21 +371,173 @@ func (c *TypeChecker) checkStmt(stmt parser.ASTStmt) (parser.ASTStmt, error) {
 	}
 }
 
+// caseSpan is the values lo..hi one case value of a сонго covers.
+type caseSpan struct {
+	lo, hi int64
+}
+
+// checkSwitch checks a сонго over a тоо, тоо64 or төрөл. Over a төрөл every
+// case value has to be one of its variants, over an integer a constant or a
+// хүртэл range of them. No value may be covered twice, not even by two
+// overlapping ranges. A сонго over a төрөл without an эсвэл arm has to cover
+// every variant; over an integer, or with эсвэл, the values no case covers
+// go to эсвэл or skip the сонго.
+func (c *TypeChecker) checkSwitch(stmt *parser.ASTSwitch) (parser.ASTStmt, error) {
+	value, err := c.checkExpr(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	stmt.Value = value
+	valueType := value.GetType()
+	enumType, isEnum := valueType.(*mtypes.EnumType)
+	if !isEnum && !isInteger(valueType) {
+		return nil, c.errorAt(fmt.Sprintf("сонго зөвхөн тоо, тоо64 эсвэл төрөл дээр хийгдэнэ, '%s' төрөл өгсөн байна", c.typeName(valueType)), value)
+	}
+
+	covered := []caseSpan{}
+	for i := range stmt.Cases {
+		cs := &stmt.Cases[i]
+		for j, caseValue := range cs.Values {
+			checked, span, err := c.checkCaseValue(caseValue, valueType)
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range covered {
+				if span.lo > other.hi || other.lo > span.hi {
+					continue
+				}
+				if isEnum {
+					return nil, c.errorAt(fmt.Sprintf("'%s.%s' хоёр удаа бичигдсэн байна", enumType.Name, enumType.Variants[span.lo]), checked)
+				}
+				return nil, c.errorAt(fmt.Sprintf("%d утга хоёр удаа бичигдсэн байна", max(span.lo, other.lo)), checked)
+			}
+			covered = append(covered, span)
+			cs.Values[j] = checked
+		}
+		body, err := c.checkStmt(cs.Body)
+		if err != nil {
+			return nil, err
+		}
+		cs.Body = body
+	}
+	if stmt.Default != nil {
+		body, err := c.checkStmt(stmt.Default)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Default = body
+		return stmt, nil
+	}
+	if !isEnum {
+		return stmt, nil
+	}
+
+	// without эсвэл every variant needs its case
+	missing := []string{}
+	for i, variant := range enumType.Variants {
+		if !slices.ContainsFunc(covered, func(span caseSpan) bool { return span.lo == int64(i) }) {
+			missing = append(missing, enumType.Name+"."+variant)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, c.errorAt(fmt.Sprintf("сонго '%s' төрлийн бүх утгыг хамрах ёстой, %s үлдсэн байна", enumType.Name, strings.Join(missing, ", ")), stmt)
+	}
+	return stmt, nil
+}
+
+// checkCaseValue checks one value of a сонго case against the type of the
+// сонго: a variant of its төрөл, or an integer constant or a range of them
+// which it turns into constants of the сонго's type.
+func (c *TypeChecker) checkCaseValue(expr parser.ASTExpression, valueType mtypes.Type) (parser.ASTExpression, caseSpan, error) {
+	if enumType, isEnum := valueType.(*mtypes.EnumType); isEnum {
+		checked, err := c.checkExpr(expr)
+		if err != nil {
+			return nil, caseSpan{}, err
+		}
+		variant, ok := checked.(*parser.ASTEnumConst)
+		if !ok || variant.Type != enumType {
+			return nil, caseSpan{}, c.errorAt(fmt.Sprintf("'%s' төрлийн сонголтод зөвхөн түүний утгууд бичигдэнэ", enumType.Name), checked)
+		}
+		return variant, caseSpan{variant.Value, variant.Value}, nil
+	}
+
+	if rangeExpr, isRange := expr.(*parser.ASTRangeExpr); isRange {
+		start, lo, err := c.caseConstant(rangeExpr.Start, valueType)
+		if err != nil {
+			return nil, caseSpan{}, err
+		}
+		end, hi, err := c.caseConstant(rangeExpr.End, valueType)
+		if err != nil {
+			return nil, caseSpan{}, err
+		}
+		if lo > hi {
+			return nil, caseSpan{}, c.errorAt(fmt.Sprintf("'%d..%d' хязгаарт утга алга", lo, hi), rangeExpr)
+		}
+		rangeExpr.Start, rangeExpr.End, rangeExpr.Type = start, end, valueType
+		return rangeExpr, caseSpan{lo, hi}, nil
+	}
+
+	constant, value, err := c.caseConstant(expr, valueType)
+	if err != nil {
+		return nil, caseSpan{}, err
+	}
+	return constant, caseSpan{value, value}, nil
+}
+
+// caseConstant reads an integer literal, negated or not, as a constant of
+// valueType.
+func (c *TypeChecker) caseConstant(expr parser.ASTExpression, valueType mtypes.Type) (parser.ASTExpression, int64, error) {
+	value, ok := integerLiteral(expr)
+	if !ok {
+		return nil, 0, c.errorAt("сонголтын утга тогтмол тоо байх ёстой", expr)
+	}
+	token := parser.TokenOf(expr)
+	if _, isLong := valueType.(*mtypes.Int64Type); isLong {
+		return &parser.ASTConstLong{Token: token, Value: value, Type: valueType}, value, nil
+	}
+	if value != int64(int32(value)) {
+		return nil, 0, c.errorAt(fmt.Sprintf("%d утга тоо төрөлд багтахгүй", value), expr)
+	}
+	return &parser.ASTConstInt{Token: token, Value: value, Type: valueType}, value, nil
+}
+
+func integerLiteral(expr parser.ASTExpression) (int64, bool) {
+	switch expr := expr.(type) {
+	case *parser.ASTConstInt:
+		return expr.Value, true
+	case *parser.ASTConstLong:
+		return expr.Value, true
+	case *parser.ASTUnary:
+		value, ok := integerLiteral(expr.Inner)
+		return -value, ok && expr.Op == lexer.MINUS
+	}
+	return 0, false
+}
+
 func (c *TypeChecker) checkDecl(decl parser.ASTDecl) (parser.ASTDecl, error) {
 	switch decl := decl.(type) {
 	case *parser.VarDecl:
+		varType, err := c.resolveType(decl.VarType, decl.Token)
+		if err != nil {
+			return nil, err
+		}
+		decl.VarType = varType
 		c.symbolTable.AddVar(decl.VarType, decl.Ident)
 		if decl.Expr != nil {
 			exprCheck, err := c.checkExpr(decl.Expr)
 			if err != nil {
 				return nil, err
 			}
+			if decl.VarType != nil && mismatched(decl.VarType, exprCheck.GetType()) {
+				return nil, c.errorAt(fmt.Sprintf("'%s' хувьсагч '%s' төрөлтэй, '%s' утга оноож болохгүй",
+					decl.Ident, c.typeName(decl.VarType), c.typeName(exprCheck.GetType())), exprCheck)
+			}
 			_, isInt32 := exprCheck.GetType().(*mtypes.Int32Type)
 			declType, isDeclInt64 := decl.VarType.(*mtypes.Int64Type)
 			if isInt32 && isDeclInt64 {
 				exprCheck.SetType(declType)
 			}
-			decl.Expr = exprCheck
+			decl.Expr = convertTo(exprCheck, decl.VarType)
 		}
 		return decl, nil
 	case *parser.FnDecl:
@@ -249,8 +562,12 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 		if err != nil {
 			return nil, err
 		}
+		if mismatched(left.GetType(), right.GetType()) {
+			return nil, c.errorAt(fmt.Sprintf("'%s' төрөлтэй хувьсагчид '%s' утга оноож болохгүй",
+				c.typeName(left.GetType()), c.typeName(right.GetType())), right)
+		}
 		expr.Left = left
-		expr.Right = right
+		expr.Right = convertTo(right, left.GetType())
 		// For array index assignment, the type is the element type
 		expr.Type = left.GetType()
 		return expr, nil
@@ -260,10 +577,31 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 			return nil, err
 		}
 		expr.Inner = inner
+		if expr.Op == lexer.NOT {
+			if !isBool(inner.GetType()) {
+				return nil, c.errorAt(fmt.Sprintf("'!' үйлдлийн операнд логик төрөлтэй байх ёстой, '%s' төрөл өгсөн байна", c.typeName(inner.GetType())), inner)
+			}
+			expr.Type = &mtypes.BoolType{}
+			return expr, nil
+		}
+		if isBool(inner.GetType()) || isStruct(inner.GetType()) || isEnum(inner.GetType()) {
+			op := "-"
+			if expr.Op == lexer.TILDE {
+				op = "~"
+			}
+			return nil, c.errorAt(fmt.Sprintf("'%s' үйлдэл %s төрөл дээр хийгдэхгүй", op, c.typeName(inner.GetType())), inner)
+		}
+		if isDouble(inner.GetType()) {
+			if expr.Op == lexer.TILDE {
+				return nil, c.errorAt("'~' үйлдэл бутархай төрөл дээр хийгдэхгүй", inner)
+			}
+			expr.Type = inner.GetType()
+			return expr, nil
+		}
 		expr.Type = &mtypes.Int32Type{}
 		return expr, nil
 	case *parser.ASTConditional:
-		cond, err := c.checkExpr(expr.Cond)
+		cond, err := c.checkCond(expr.Cond)
 		if err != nil {
 			return nil, err
 		}
@@ -275,10 +613,14 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 		if err != nil {
 			return nil, err
 		}
-		expr.Cond = cond
-		expr.Then = then
-		expr.Else = klse
+		if mismatched(then.GetType(), klse.GetType()) {
+			return nil, c.errorAt(fmt.Sprintf("'?:' хоёр талын утга ижил төрөлтэй байх ёстой, '%s' ба '%s' өгсөн байна",
+				c.typeName(then.GetType()), c.typeName(klse.GetType())), expr)
+		}
 		common := c.getCommonType(then.GetType(), klse.GetType())
+		expr.Cond = cond
+		expr.Then = convertTo(then, common)
+		expr.Else = convertTo(klse, common)
 		expr.Type = common
 		return expr, nil
 	case parser.ASTConst:
@@ -287,6 +629,10 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 			extype.Type = &mtypes.Int32Type{}
 		case *parser.ASTConstLong:
 			extype.Type = &mtypes.Int64Type{}
+		case *parser.ASTConstDouble:
+			extype.Type = &mtypes.DoubleType{}
+		case *parser.ASTConstBool:
+			extype.Type = &mtypes.BoolType{}
 		}
 		return expr, nil
 	case *parser.ASTStringExpression:
@@ -303,10 +649,7 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 		}
 		expr.Left = left
 		expr.Right = right
-		//TODO: HANDLE DIFF CASES AND AND,OR | ADD,OR,MUL,DIV,MOD
-		common := c.getCommonType(left.GetType(), right.GetType())
-		expr.Type = common
-		return expr, nil
+		return c.checkBinary(expr)
 	case *parser.ASTVar:
 		dVar := c.symbolTable.Get(expr.Ident)
 		if dVar == nil {
@@ -327,6 +670,9 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 		if err != nil {
 			return nil, err
 		}
+		if isDouble(idx.GetType()) || isEnum(idx.GetType()) {
+			return nil, c.errorAt(fmt.Sprintf("массивын индекс бүхэл тоо байх ёстой, '%s' төрөл өгсөн байна", c.typeName(idx.GetType())), idx)
+		}
 		expr.Array = arr
 		expr.Index = idx
 		// Set type to element type
@@ -338,14 +684,79 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 		return expr, nil
 
 	case *parser.ASTNewArray:
+		elementType, err := c.resolveType(expr.ElementType, expr.Token)
+		if err != nil {
+			return nil, err
+		}
+		expr.ElementType = elementType
 		size, err := c.checkExpr(expr.Size)
 		if err != nil {
 			return nil, err
 		}
+		if isDouble(size.GetType()) || isEnum(size.GetType()) {
+			return nil, c.errorAt(fmt.Sprintf("массивын хэмжээ бүхэл тоо байх ёстой, '%s' төрөл өгсөн байна", c.typeName(size.GetType())), size)
+		}
 		expr.Size = size
 		expr.Type = &mtypes.ArrayType{ElementType: expr.ElementType}
 		return expr, nil
 
+	case *parser.ASTNewStruct:
+		structType, err := c.resolveType(expr.Type, expr.Token)
+		if err != nil {
+			return nil, err
+		}
+		if !isStruct(structType) {
+			return nil, c.errorAt(fmt.Sprintf("'%s' бүтэц биш тул шинэ-ээр үүсгэж болохгүй", c.typeName(structType)), expr)
+		}
+		expr.Type = structType
+		return expr, nil
+
+	case *parser.ASTEnumConst:
+		enumType := c.enums[expr.Enum]
+		value, ok := enumType.Variant(expr.Variant)
+		if !ok {
+			return nil, c.errorAt(fmt.Sprintf("'%s' төрөл '%s' утгагүй", expr.Enum, expr.Variant), expr)
+		}
+		expr.Value = value
+		expr.Type = enumType
+		return expr, nil
+
+	case *parser.ASTCast:
+		// only the casts the program writes get here, convertTo makes its
+		// own after checking
+		inner, err := c.checkExpr(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		target, err := c.resolveType(expr.TargetType, parser.TokenOf(inner))
+		if err != nil {
+			return nil, err
+		}
+		if !castable(inner.GetType(), target) {
+			return nil, c.errorAt(fmt.Sprintf("'%s' төрлийг '%s' болгож хөрвүүлэхгүй", c.typeName(inner.GetType()), c.typeName(target)), inner)
+		}
+		expr.Expr = inner
+		expr.TargetType = target
+		expr.Type = target
+		return expr, nil
+
+	case *parser.ASTFieldAccess:
+		inner, err := c.checkExpr(expr.Struct)
+		if err != nil {
+			return nil, err
+		}
+		expr.Struct = inner
+		structType, ok := inner.GetType().(*mtypes.StructType)
+		if !ok {
+			return nil, c.errorAt(fmt.Sprintf("'.%s' зөвхөн бүтэц дээр хэрэглэгдэнэ, '%s' төрөл өгсөн байна", expr.Field, c.typeName(inner.GetType())), expr)
+		}
+		field, ok := structType.Field(expr.Field)
+		if !ok {
+			return nil, c.errorAt(fmt.Sprintf("'%s' бүтэц '%s' талбаргүй", structType.Name, expr.Field), expr)
+		}
+		expr.Type = field.Type
+		return expr, nil
+
 	case *parser.ASTFnCall:
 		fn := c.symbolTable.Get(expr.Ident)
 		if fn == nil {
@@ -368,6 +779,9 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 					return nil, err
 				}
 				expr.Args[i] = checkedArg
+				if i < len(checkType.ParamTypes) {
+					expr.Args[i] = convertTo(checkedArg, checkType.ParamTypes[i])
+				}
 
 				if i < len(checkType.ParamTypes) {
 					argType := checkedArg.GetType()
@@ -389,7 +803,150 @@ func (c *TypeChecker) checkExpr(expr parser.ASTExpression) (parser.ASTExpression
 	return nil, c.createSemanticError(fmt.Sprintf("unreachable expr %T", expr), 0, lexer.Span{})
 }
 
+// checkCond checks the condition of хэрэв, давтах or ?:, which has to be
+// логик. A тоо is no longer taken as true when it isn't 0, so хэрэв x = 1
+// бол is an error instead of an assignment that is always true.
+func (c *TypeChecker) checkCond(cond parser.ASTExpression) (parser.ASTExpression, error) {
+	cond, err := c.checkExpr(cond)
+	if err != nil {
+		return nil, err
+	}
+	if !isBool(cond.GetType()) {
+		return nil, c.errorAt(fmt.Sprintf("нөхцөл логик төрөлтэй байх ёстой, '%s' төрөл өгсөн байна", c.typeName(cond.GetType())), cond)
+	}
+	return cond, nil
+}
+
+// checkBinary types a binary expression whose operands are checked. &&
+// and || take логик, comparisons give логик, == and != also compare two
+// логик, and arithmetic is on numbers only. When one side is бутархай the
+// other is converted and the operation is done on doubles.
+func (c *TypeChecker) checkBinary(expr *parser.ASTBinary) (parser.ASTExpression, error) {
+	leftType, rightType := expr.Left.GetType(), expr.Right.GetType()
+	switch expr.Op {
+	case parser.ASTBinOp(parser.A_AND), parser.ASTBinOp(parser.A_OR):
+		for _, operand := range []parser.ASTExpression{expr.Left, expr.Right} {
+			if !isBool(operand.GetType()) {
+				return nil, c.errorAt(fmt.Sprintf("'%s' үйлдлийн операнд логик төрөлтэй байх ёстой, '%s' төрөл өгсөн байна",
+					expr.Op, c.typeName(operand.GetType())), operand)
+			}
+		}
+		expr.Type = &mtypes.BoolType{}
+		return expr, nil
+	case parser.ASTBinOp(parser.A_EQUALTO), parser.ASTBinOp(parser.A_NOTEQUAL):
+		if mismatched(leftType, rightType) {
+			return nil, c.errorAt(fmt.Sprintf("'%s' үйлдлийн хоёр тал ижил төрөлтэй байх ёстой, '%s' ба '%s' өгсөн байна",
+				expr.Op, c.typeName(leftType), c.typeName(rightType)), expr)
+		}
+		c.convertOperands(expr)
+		expr.Type = &mtypes.BoolType{}
+		return expr, nil
+	}
+	if isBool(leftType) || isBool(rightType) {
+		return nil, c.errorAt(fmt.Sprintf("'%s' үйлдэл логик төрөл дээр хийгдэхгүй", expr.Op), expr)
+	}
+	if isStruct(leftType) || isStruct(rightType) {
+		return nil, c.errorAt(fmt.Sprintf("'%s' үйлдэл бүтэц дээр хийгдэхгүй", expr.Op), expr)
+	}
+	if isEnum(leftType) || isEnum(rightType) {
+		return nil, c.errorAt(fmt.Sprintf("'%s' үйлдэл төрөл дээр хийгдэхгүй, эхлээд тоо(...) болгоно уу", expr.Op), expr)
+	}
+	if expr.Op == parser.ASTBinOp(parser.A_MOD) && (isDouble(leftType) || isDouble(rightType)) {
+		return nil, c.errorAt("'%' үйлдэл бутархай төрөл дээр хийгдэхгүй", expr)
+	}
+	c.convertOperands(expr)
+	switch expr.Op {
+	case parser.ASTBinOp(parser.A_LESSTHAN), parser.ASTBinOp(parser.A_LESSTHANEQUAL),
+		parser.ASTBinOp(parser.A_GREATERTHAN), parser.ASTBinOp(parser.A_GREATERTHANEQUAL):
+		expr.Type = &mtypes.BoolType{}
+	default:
+		expr.Type = c.getCommonType(leftType, rightType)
+	}
+	return expr, nil
+}
+
+func isBool(t mtypes.Type) bool {
+	_, ok := t.(*mtypes.BoolType)
+	return ok
+}
+
+func isStruct(t mtypes.Type) bool {
+	_, ok := t.(*mtypes.StructType)
+	return ok
+}
+
+func isEnum(t mtypes.Type) bool {
+	_, ok := t.(*mtypes.EnumType)
+	return ok
+}
+
+// mismatched tells when a value of type from can't go where to is wanted.
+// Only a логик goes into a логик, and only a бүтэц or a төрөл into the
+// same one.
+func mismatched(to, from mtypes.Type) bool {
+	if isBool(to) != isBool(from) {
+		return true
+	}
+	if isStruct(to) || isStruct(from) || isEnum(to) || isEnum(from) {
+		return to != from
+	}
+	return false
+}
+
+func isInteger(t mtypes.Type) bool {
+	switch t.(type) {
+	case *mtypes.Int32Type, *mtypes.Int64Type:
+		return true
+	}
+	return false
+}
+
+// castable tells which conversions a program may write: between тоо, тоо64
+// and бутархай, and between a төрөл and a тоо or тоо64.
+func castable(from, to mtypes.Type) bool {
+	if isEnum(from) || isEnum(to) {
+		return from == to || isEnum(from) && isInteger(to) || isInteger(from) && isEnum(to)
+	}
+	return isNumber(from) && isNumber(to)
+}
+
+func isDouble(t mtypes.Type) bool {
+	_, ok := t.(*mtypes.DoubleType)
+	return ok
+}
+
+func isNumber(t mtypes.Type) bool {
+	switch t.(type) {
+	case *mtypes.Int32Type, *mtypes.Int64Type, *mtypes.DoubleType:
+		return true
+	}
+	return false
+}
+
+// convertTo wraps expr in an ASTCast when it goes between бутархай and
+// тоо or тоо64 to become target. Between тоо and тоо64 tackygen still sign
+// extends on its own.
+func convertTo(expr parser.ASTExpression, target mtypes.Type) parser.ASTExpression {
+	from := expr.GetType()
+	if !isNumber(from) || !isNumber(target) || isDouble(from) == isDouble(target) {
+		return expr
+	}
+	return &parser.ASTCast{TargetType: target, Expr: expr, Type: target}
+}
+
+// convertOperands makes both sides of expr бутархай when one of them is.
+func (c *TypeChecker) convertOperands(expr *parser.ASTBinary) {
+	if isDouble(expr.Left.GetType()) || isDouble(expr.Right.GetType()) {
+		double := &mtypes.DoubleType{}
+		expr.Left = convertTo(expr.Left, double)
+		expr.Right = convertTo(expr.Right, double)
+	}
+}
+
 func (c *TypeChecker) typesCompatible(argType, paramType mtypes.Type) bool {
+	if isBool(argType) || isBool(paramType) || isStruct(argType) || isStruct(paramType) || isEnum(argType) || isEnum(paramType) {
+		return !mismatched(paramType, argType)
+	}
 	// int32 and int64 are compatible (implicit widening)
 	_, argIsInt32 := argType.(*mtypes.Int32Type)
 	_, argIsInt64 := argType.(*mtypes.Int64Type)
@@ -412,7 +969,7 @@ func (c *TypeChecker) typesCompatible(argType, paramType mtypes.Type) bool {
 }
 
 func (c *TypeChecker) typeName(t mtypes.Type) string {
-	switch t.(type) {
+	switch t := t.(type) {
 	case *mtypes.Int32Type:
 		return "тоо"
 	case *mtypes.Int64Type:
@@ -421,8 +978,16 @@ func (c *TypeChecker) typeName(t mtypes.Type) string {
 		return "мөр"
 	case *mtypes.VoidType:
 		return "хоосон"
+	case *mtypes.BoolType:
+		return "логик"
+	case *mtypes.DoubleType:
+		return "бутархай"
 	case *mtypes.ArrayType:
 		return "массив"
+	case *mtypes.StructType:
+		return t.Name
+	case *mtypes.EnumType:
+		return t.Name
 	default:
 		return fmt.Sprintf("%T", t)
 	}
@@ -432,5 +997,8 @@ func (c *TypeChecker) getCommonType(t1, t2 mtypes.Type) mtypes.Type {
 	if t1 == t2 {
 		return t1
 	}
+	if isDouble(t1) || isDouble(t2) {
+		return &mtypes.DoubleType{}
+	}
 	return &mtypes.Int64Type{}
 }
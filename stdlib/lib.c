@@ -27,6 +27,18 @@ int unsh32(void) {
     return n;
 }
 
+// бутархай_хэвлэх - print a double, like %g
+void butarkhay_khevlekh(double d) {
+    printf("%g", d);
+}
+
+// бутархай_унш - read a double
+double butarkhay_unsh(void) {
+    double d;
+    scanf("%lf", &d);
+    return d;
+}
+
 // санамсаргүйТоо - random number (1 to n)
 int sanamsargwyToo(int n) {
     static int seeded = 0;
@@ -57,3 +69,16 @@ void delgetsTseverlekh(void) {
     printf("\033[H\033[2J");
     fflush(stdout);
 }
+
+static int mon_argc;
+
+// main hands argc and argv over before it calls үндсэн, argv becomes аргс
+char **mon_rt_args(int argc, char **argv) {
+    mon_argc = argc;
+    return argv;
+}
+
+// аргын_тоо - number of command-line arguments, the program name included
+int argyin_too(void) {
+    return mon_argc;
+}
@@ -0,0 +1,132 @@
+package tackygen
+
+// UsesAndDef lists the values an instruction reads and the variable it
+// writes, if any.
+func UsesAndDef(instr Instruction) ([]TackyVal, TackyVal) {
+	switch ir := instr.(type) {
+	case Copy:
+		return []TackyVal{ir.Src}, ir.Dst
+	case Truncate:
+		return []TackyVal{ir.Src}, ir.Dst
+	case SignExtend:
+		return []TackyVal{ir.Src}, ir.Dst
+	case IntToDouble:
+		return []TackyVal{ir.Src}, ir.Dst
+	case DoubleToInt:
+		return []TackyVal{ir.Src}, ir.Dst
+	case Unary:
+		return []TackyVal{ir.Src}, ir.Dst
+	case Binary:
+		return []TackyVal{ir.Src1, ir.Src2}, ir.Dst
+	case Load:
+		return []TackyVal{ir.Src}, ir.Dst
+	case Store:
+		return []TackyVal{ir.Src, ir.Dst}, nil
+	case FnCall:
+		return ir.Args, ir.Dst
+	case JumpIfZero:
+		return []TackyVal{ir.Val}, nil
+	case JumpIfNotZero:
+		return []TackyVal{ir.Val}, nil
+	case JumpTable:
+		return []TackyVal{ir.Index}, nil
+	case Return:
+		return []TackyVal{ir.Value}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// MapUses rewrites every value an instruction reads, leaving its destination
+// alone.
+func MapUses(instr Instruction, f func(TackyVal) TackyVal) Instruction {
+	switch ir := instr.(type) {
+	case Copy:
+		ir.Src = f(ir.Src)
+		return ir
+	case Truncate:
+		ir.Src = f(ir.Src)
+		return ir
+	case SignExtend:
+		ir.Src = f(ir.Src)
+		return ir
+	case IntToDouble:
+		ir.Src = f(ir.Src)
+		return ir
+	case DoubleToInt:
+		ir.Src = f(ir.Src)
+		return ir
+	case Unary:
+		ir.Src = f(ir.Src)
+		return ir
+	case Binary:
+		ir.Src1 = f(ir.Src1)
+		ir.Src2 = f(ir.Src2)
+		return ir
+	case Load:
+		ir.Src = f(ir.Src)
+		return ir
+	case Store:
+		ir.Src = f(ir.Src)
+		ir.Dst = f(ir.Dst)
+		return ir
+	case FnCall:
+		args := make([]TackyVal, len(ir.Args))
+		for i, arg := range ir.Args {
+			args[i] = f(arg)
+		}
+		ir.Args = args
+		return ir
+	case JumpIfZero:
+		ir.Val = f(ir.Val)
+		return ir
+	case JumpIfNotZero:
+		ir.Val = f(ir.Val)
+		return ir
+	case JumpTable:
+		ir.Index = f(ir.Index)
+		return ir
+	case Return:
+		ir.Value = f(ir.Value)
+		return ir
+	default:
+		return instr
+	}
+}
+
+// MapDef rewrites the variable an instruction writes, if it has one.
+func MapDef(instr Instruction, f func(TackyVal) TackyVal) Instruction {
+	switch ir := instr.(type) {
+	case Copy:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case Truncate:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case SignExtend:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case IntToDouble:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case DoubleToInt:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case Unary:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case Binary:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case Load:
+		ir.Dst = f(ir.Dst)
+		return ir
+	case FnCall:
+		if ir.Dst != nil {
+			ir.Dst = f(ir.Dst)
+		}
+		return ir
+	default:
+		return instr
+	}
+}
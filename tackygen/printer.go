@@ -0,0 +1,373 @@
+package tackygen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+// Textual TACKY
+//
+// TackyPrinter writes a TackyProgram in a line oriented text form that
+// ParseTacky reads back. Types of every variable are written out so the
+// backend can run from the text alone, without the frontend's symbol table.
+//
+//	# comment
+//	global counter_1: i32 = 0
+//	extern fn хэвлэ(i64) -> void
+//	extern fn malloc
+//	public fn нэмэх_2(a_3: i32, b_4: i32) -> i32 {
+//	    var tmp.0: i32
+//	    tmp.0 := add a_3, b_4
+//	    return tmp.0
+//	}
+//
+// A function the inliner must leave alone is written "noinline fn", after
+// "public" when both apply. Types are i32, i64, bool, f64, str, void, []T
+// for arrays, struct Name for a бүтэц and enum Name for a төрөл. Values are
+// variable names, integer constants (i32, or i64 with an L suffix such as
+// 5L), f64 constants that always have a point such as 2.0 or -0.0, true
+// and false, and double quoted strings using Go escapes. A NaN f64 is
+// written nan, or -nan with its sign bit set, and the infinities inf and
+// -inf; the NaN's payload isn't kept.
+// Instructions:
+//
+//	x := v                    copy
+//	x := truncate v           i64 -> i32
+//	x := signextend v         i32 -> i64
+//	x := inttodouble v        i32 or i64 -> f64
+//	x := doubletoint v        f64 -> i32 or i64
+//	x := complement|negate|not v
+//	x := add|sub|mul|div|mod|eq|ne|lt|le|gt|ge a, b
+//	x := load p
+//	store v, p
+//	x := call f(a, b)         or without a result: call f(a, b)
+//	jump L
+//	jz v, L                   jump if v == 0
+//	jnz v, L                  jump if v != 0
+//	jtable v, [L0, L1, ...]   jump to the v-th label, v is already in range
+//	L:
+//	return v
+//	line N                    what follows comes from source line N, for -g
+type TackyPrinter struct {
+	w           io.Writer
+	symbolTable *symbols.SymbolTable
+	err         error
+}
+
+func NewTackyPrinter(w io.Writer, table *symbols.SymbolTable) *TackyPrinter {
+	return &TackyPrinter{w: w, symbolTable: table}
+}
+
+var binaryOpNames = map[TackyBinaryOp]string{
+	Add:              "add",
+	Sub:              "sub",
+	Mul:              "mul",
+	Div:              "div",
+	Modulo:           "mod",
+	Equal:            "eq",
+	NotEqual:         "ne",
+	LessThan:         "lt",
+	LessThanEqual:    "le",
+	GreaterThan:      "gt",
+	GreaterThanEqual: "ge",
+}
+
+var unaryOpNames = map[UnaryOperator]string{
+	Complement: "complement",
+	Negate:     "negate",
+	Not:        "not",
+}
+
+func (p *TackyPrinter) PrintProgram(program TackyProgram) error {
+	for _, gv := range program.GlobalVars {
+		init := fmt.Sprintf("%d", gv.InitValue)
+		if p.typeOf(gv.Name) == "f64" {
+			init = formatDouble(math.Float64frombits(uint64(gv.InitValue)))
+		}
+		p.printf("global %s: %s = %s\n", gv.Name, p.typeOf(gv.Name), init)
+	}
+	if len(program.GlobalVars) > 0 {
+		p.printf("\n")
+	}
+
+	for _, fn := range program.ExternDefs {
+		p.printExtern(fn)
+	}
+	if len(program.ExternDefs) > 0 {
+		p.printf("\n")
+	}
+
+	for i, fn := range program.FnDefs {
+		if i > 0 {
+			p.printf("\n")
+		}
+		p.PrintFn(fn, program.GlobalVars)
+	}
+
+	return p.err
+}
+
+func (p *TackyPrinter) printExtern(fn TackyFn) {
+	entry := p.symbolTable.Get(fn.Name)
+	fnType, ok := entryFnType(entry)
+	if !ok {
+		// malloc is called implicitly and has no declaration in the source
+		p.printf("extern fn %s\n", fn.Name)
+		return
+	}
+	params := make([]string, len(fnType.ParamTypes))
+	for i, t := range fnType.ParamTypes {
+		params[i] = TypeName(t)
+	}
+	p.printf("extern fn %s(%s) -> %s\n", fn.Name, strings.Join(params, ", "), TypeName(fnType.RetType))
+}
+
+func (p *TackyPrinter) PrintFn(fn TackyFn, globals []GlobalVar) error {
+	retType := "i32"
+	if fnType, ok := entryFnType(p.symbolTable.Get(fn.Name)); ok {
+		retType = TypeName(fnType.RetType)
+	}
+
+	params := make([]string, len(fn.Params))
+	declared := map[string]bool{}
+	for _, global := range globals {
+		declared[global.Name] = true
+	}
+	for i, param := range fn.Params {
+		name := param.val()
+		declared[name] = true
+		params[i] = fmt.Sprintf("%s: %s", name, p.typeOf(name))
+	}
+
+	if fn.Global {
+		p.printf("public ")
+	}
+	if fn.NoInline {
+		p.printf("noinline ")
+	}
+	p.printf("fn %s(%s) -> %s {\n", fn.Name, strings.Join(params, ", "), retType)
+
+	for _, name := range instructionVars(fn.Instructions) {
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+		p.printf("    var %s: %s\n", name, p.typeOf(name))
+	}
+
+	for _, instr := range fn.Instructions {
+		if _, isLabel := instr.(Label); isLabel {
+			p.printf("  %s\n", FormatInstruction(instr))
+			continue
+		}
+		p.printf("    %s\n", FormatInstruction(instr))
+	}
+	p.printf("}\n")
+
+	return p.err
+}
+
+func (p *TackyPrinter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *TackyPrinter) typeOf(name string) string {
+	entry := p.symbolTable.Get(name)
+	if entry == nil {
+		if p.err == nil {
+			p.err = fmt.Errorf("tacky хэвлэх: '%s' хувьсагчийн төрөл олдсонгүй", name)
+		}
+		return "?"
+	}
+	return TypeName(entry.Type)
+}
+
+func entryFnType(entry *symbols.Entry) (*mtypes.FnType, bool) {
+	if entry == nil {
+		return nil, false
+	}
+	fnType, ok := entry.Type.(*mtypes.FnType)
+	return fnType, ok
+}
+
+func TypeName(t mtypes.Type) string {
+	switch ty := t.(type) {
+	case *mtypes.Int32Type:
+		return "i32"
+	case *mtypes.Int64Type:
+		return "i64"
+	case *mtypes.BoolType:
+		return "bool"
+	case *mtypes.DoubleType:
+		return "f64"
+	case *mtypes.StringType:
+		return "str"
+	case *mtypes.VoidType:
+		return "void"
+	case *mtypes.ArrayType:
+		return "[]" + TypeName(ty.ElementType)
+	case *mtypes.StructType:
+		return "struct " + ty.Name
+	case *mtypes.EnumType:
+		return "enum " + ty.Name
+	default:
+		return fmt.Sprintf("%T", t)
+	}
+}
+
+// FormatInstruction renders a single instruction in the textual TACKY syntax.
+func FormatInstruction(instr Instruction) string {
+	switch ir := instr.(type) {
+	case Copy:
+		return fmt.Sprintf("%s := %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case Truncate:
+		return fmt.Sprintf("%s := truncate %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case SignExtend:
+		return fmt.Sprintf("%s := signextend %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case IntToDouble:
+		return fmt.Sprintf("%s := inttodouble %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case DoubleToInt:
+		return fmt.Sprintf("%s := doubletoint %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case Unary:
+		return fmt.Sprintf("%s := %s %s", FormatVal(ir.Dst), unaryOpNames[ir.Op], FormatVal(ir.Src))
+	case Binary:
+		return fmt.Sprintf("%s := %s %s, %s", FormatVal(ir.Dst), binaryOpNames[ir.Op], FormatVal(ir.Src1), FormatVal(ir.Src2))
+	case Load:
+		return fmt.Sprintf("%s := load %s", FormatVal(ir.Dst), FormatVal(ir.Src))
+	case Store:
+		return fmt.Sprintf("store %s, %s", FormatVal(ir.Src), FormatVal(ir.Dst))
+	case FnCall:
+		args := make([]string, len(ir.Args))
+		for i, arg := range ir.Args {
+			args[i] = FormatVal(arg)
+		}
+		call := fmt.Sprintf("call %s(%s)", ir.Name, strings.Join(args, ", "))
+		if ir.Dst == nil {
+			return call
+		}
+		return fmt.Sprintf("%s := %s", FormatVal(ir.Dst), call)
+	case Jump:
+		return fmt.Sprintf("jump %s", ir.Target)
+	case JumpIfZero:
+		return fmt.Sprintf("jz %s, %s", FormatVal(ir.Val), ir.Ident)
+	case JumpIfNotZero:
+		return fmt.Sprintf("jnz %s, %s", FormatVal(ir.Val), ir.Ident)
+	case JumpTable:
+		return fmt.Sprintf("jtable %s, [%s]", FormatVal(ir.Index), strings.Join(ir.Targets, ", "))
+	case Label:
+		return fmt.Sprintf("%s:", ir.Ident)
+	case Return:
+		return fmt.Sprintf("return %s", FormatVal(ir.Value))
+	case SourceLine:
+		return fmt.Sprintf("line %d", ir.Line)
+	default:
+		// a comment would silently drop the instruction from the text
+		panic(fmt.Sprintf("tacky хэвлэх: үл мэдэгдэх заавар %T", instr))
+	}
+}
+
+// FormatVal renders a single value in the textual TACKY syntax.
+func FormatVal(val TackyVal) string {
+	switch v := val.(type) {
+	case Constant:
+		switch c := v.Value.(type) {
+		case *mconstant.Int64:
+			return fmt.Sprintf("%dL", c.Value)
+		case *mconstant.Bool:
+			return strconv.FormatBool(c.Value)
+		case *mconstant.Double:
+			return formatDouble(c.Value)
+		}
+		return fmt.Sprintf("%d", v.Value.GetValue())
+	case StringConstant:
+		return strconv.Quote(v.Value)
+	case Var:
+		return v.Name
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// formatDouble writes an f64 constant without an exponent and with a point,
+// so the parser tells it from an i32. NaN and the infinities, which constant
+// folding makes out of 0.0 / 0.0 and 1.0 / 0.0, are written as printf's %g
+// would: nan, -nan, inf and -inf.
+func formatDouble(value float64) string {
+	switch {
+	case math.IsNaN(value) && math.Signbit(value):
+		return "-nan"
+	case math.IsNaN(value):
+		return "nan"
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// instructionVars lists every variable an instruction sequence touches, in
+// order of first appearance.
+func instructionVars(instrs []Instruction) []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(vals ...TackyVal) {
+		for _, val := range vals {
+			if v, ok := val.(Var); ok && !seen[v.Name] {
+				seen[v.Name] = true
+				names = append(names, v.Name)
+			}
+		}
+	}
+
+	for _, instr := range instrs {
+		switch ir := instr.(type) {
+		case Copy:
+			add(ir.Src, ir.Dst)
+		case Truncate:
+			add(ir.Src, ir.Dst)
+		case SignExtend:
+			add(ir.Src, ir.Dst)
+		case IntToDouble:
+			add(ir.Src, ir.Dst)
+		case DoubleToInt:
+			add(ir.Src, ir.Dst)
+		case Unary:
+			add(ir.Src, ir.Dst)
+		case Binary:
+			add(ir.Src1, ir.Src2, ir.Dst)
+		case Load:
+			add(ir.Src, ir.Dst)
+		case Store:
+			add(ir.Src, ir.Dst)
+		case FnCall:
+			add(ir.Args...)
+			if ir.Dst != nil {
+				add(ir.Dst)
+			}
+		case JumpIfZero:
+			add(ir.Val)
+		case JumpIfNotZero:
+			add(ir.Val)
+		case JumpTable:
+			add(ir.Index)
+		case Return:
+			add(ir.Value)
+		}
+	}
+	return names
+}
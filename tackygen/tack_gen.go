@@ -18,6 +18,8 @@ type TackyGen struct {
 	SymbolTable     *symbols.SymbolTable
 	GlobalConstants map[string]mconstant.Const
 	MutableGlobals  map[string]bool
+	// DebugInfo marks the start of every statement with a SourceLine
+	DebugInfo bool
 }
 
 func NewTackyGen(uniquegen unique.UniqueGen, table *symbols.SymbolTable) TackyGen {
@@ -49,18 +51,40 @@ func (c *TackyGen) EmitTacky(node *parser.ASTProgram) TackyProgram {
 			// Top-level variable declarations become global variables in .data section
 			var initValue int64
 			size := 4 // default Int32
-			if stmttype.Expr != nil {
-				switch constExpr := stmttype.Expr.(type) {
+			initExpr := stmttype.Expr
+			cast, isCast := initExpr.(*parser.ASTCast)
+			if isCast {
+				initExpr = cast.Expr
+			}
+			if initExpr != nil {
+				switch constExpr := initExpr.(type) {
 				case *parser.ASTConstInt:
 					initValue = int64(constExpr.Value)
 				case *parser.ASTConstLong:
 					initValue = constExpr.Value
 					size = 8
+				case *parser.ASTConstBool:
+					initValue = (&mconstant.Bool{Value: constExpr.Value}).GetValue()
+				case *parser.ASTEnumConst:
+					initValue = constExpr.Value
+				case *parser.ASTConstDouble:
+					initValue = (&mconstant.Double{Value: constExpr.Value}).GetValue()
+					if isCast {
+						initValue = int64(constExpr.Value)
+					}
 				}
 			}
 			if stmttype.VarType != nil {
-				if _, is64 := stmttype.VarType.(*mtypes.Int64Type); is64 {
+				switch stmttype.VarType.(type) {
+				case *mtypes.Int64Type, *mtypes.StructType:
+					size = 8
+				case *mtypes.BoolType:
+					size = 1
+				case *mtypes.DoubleType:
 					size = 8
+					if isCast {
+						initValue = (&mconstant.Double{Value: float64(initValue)}).GetValue()
+					}
 				}
 			}
 			c.MutableGlobals[stmttype.Ident] = true
@@ -89,7 +113,7 @@ func (c *TackyGen) EmitTackyFn(node *parser.FnDecl) TackyFn {
 	for _, param := range node.Params {
 		params = append(params, c.EmitTackyParam(&param))
 	}
-	return TackyFn{Name: node.Ident, Instructions: irs, Params: params, Global: node.IsPublic, IsExtern: node.IsExtern}
+	return TackyFn{Name: node.Ident, Instructions: irs, Params: params, Global: node.IsPublic, IsExtern: node.IsExtern, NoInline: node.NoInline, File: node.File, Line: node.Token.Line}
 }
 
 func (c *TackyGen) EmitTackyBlock(node parser.ASTBlock) []Instruction {
@@ -101,15 +125,29 @@ func (c *TackyGen) EmitTackyBlock(node parser.ASTBlock) []Instruction {
 }
 
 func (c *TackyGen) EmitTackyBlockItem(node parser.BlockItem) []Instruction {
+	irs := c.sourceLine(node)
 	switch ast := node.(type) {
 	case parser.ASTStmt:
-		return c.EmitTackyStmt(ast)
+		return append(irs, c.EmitTackyStmt(ast)...)
 	case parser.ASTDecl:
-		return c.EmitTackyLocalDecl(ast)
+		return append(irs, c.EmitTackyLocalDecl(ast)...)
 	}
 	return []Instruction{}
 }
 
+// sourceLine marks where the code for node starts when debug info is on.
+// Blocks have no line of their own, their items are marked instead.
+func (c *TackyGen) sourceLine(node parser.BlockItem) []Instruction {
+	if !c.DebugInfo {
+		return nil
+	}
+	line := parser.LineOf(node)
+	if line == 0 {
+		return nil
+	}
+	return []Instruction{SourceLine{Line: line}}
+}
+
 func (c *TackyGen) EmitTackyLocalDecl(node parser.ASTDecl) []Instruction {
 	switch ast := node.(type) {
 	case *parser.FnDecl:
@@ -146,6 +184,8 @@ func (c *TackyGen) EmitTackyStmt(node parser.ASTStmt) []Instruction {
 		breakLabel := c.breakLabel(ast.Id)
 
 		irs = append(irs, Label{Ident: startLabel.Name})
+		// the condition runs again on every iteration
+		irs = append(irs, c.sourceLine(ast.Cond)...)
 
 		condVal, condValIrs := c.EmitExpr(ast.Cond)
 		irs = append(irs, condValIrs...)
@@ -186,7 +226,7 @@ func (c *TackyGen) EmitTackyStmt(node parser.ASTStmt) []Instruction {
 
 			endVal, endValIrs := c.EmitExpr(rangeExpr.End)
 			loopVarVal, loopVarValIrs := c.EmitExpr(ast.Var)
-			temp := c.makeTemp(ast.Var.GetType())
+			temp := c.makeTemp(&mtypes.BoolType{})
 			irs = append(irs, Binary{
 				Op:   LessThanEqual,
 				Src1: loopVarVal,
@@ -291,6 +331,8 @@ func (c *TackyGen) EmitTackyStmt(node parser.ASTStmt) []Instruction {
 		_, valIrs := c.EmitExpr(ast.Expression)
 		irs = append(irs, valIrs...)
 		return irs
+	case *parser.ASTSwitch:
+		return c.emitSwitch(ast)
 	}
 
 	return []Instruction{}
@@ -360,7 +402,7 @@ func (c *TackyGen) EmitAndExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 	irs := []Instruction{}
 	falseLabel := c.makeLabel("and_false")
 	endLabel := c.makeLabel("and_end")
-	dst := c.makeTemp(&mtypes.Int32Type{})
+	dst := c.makeTemp(&mtypes.BoolType{})
 
 	v1, v1Irs := c.EmitExpr(expr.Left)
 	irs = append(irs, v1Irs...)
@@ -376,7 +418,7 @@ func (c *TackyGen) EmitAndExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 			Ident: falseLabel.Name,
 		},
 		Copy{
-			Src: Constant{Value: &mconstant.IntOne},
+			Src: Constant{Value: &mconstant.True},
 			Dst: dst,
 		},
 		Jump{
@@ -386,7 +428,7 @@ func (c *TackyGen) EmitAndExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 			Ident: falseLabel.Name,
 		},
 		Copy{
-			Src: Constant{Value: &mconstant.IntZero},
+			Src: Constant{Value: &mconstant.False},
 			Dst: dst,
 		},
 		Label{
@@ -401,7 +443,7 @@ func (c *TackyGen) EmitOrExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 	irs := []Instruction{}
 	trueLabel := c.makeLabel("or_true")
 	endLabel := c.makeLabel("or_end")
-	dst := c.makeTemp(&mtypes.Int32Type{})
+	dst := c.makeTemp(&mtypes.BoolType{})
 
 	left, leftIrs := c.EmitExpr(expr.Left)
 	irs = append(irs, leftIrs...)
@@ -417,7 +459,7 @@ func (c *TackyGen) EmitOrExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 			Ident: trueLabel.Name,
 		},
 		Copy{
-			Src: Constant{Value: &mconstant.IntZero},
+			Src: Constant{Value: &mconstant.False},
 			Dst: dst,
 		},
 		Jump{
@@ -427,7 +469,7 @@ func (c *TackyGen) EmitOrExpr(expr *parser.ASTBinary) (TackyVal, []Instruction)
 			Ident: trueLabel.Name,
 		},
 		Copy{
-			Src: Constant{Value: &mconstant.IntOne},
+			Src: Constant{Value: &mconstant.True},
 			Dst: dst,
 		},
 		Label{
@@ -503,9 +545,9 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 		// Sign-extend size to 64-bit if needed
 		size64 := c.makeTemp(&mtypes.Int64Type{})
 		irs = append(irs, SignExtend{Src: sizeVal, Dst: size64})
-		// byteSize = size * 4 (element size for Int32)
+		// byteSize = size * element size
 		byteSize := c.makeTemp(&mtypes.Int64Type{})
-		irs = append(irs, Binary{Op: Mul, Src1: size64, Src2: Constant{Value: &mconstant.Int64{Value: 4}}, Dst: byteSize})
+		irs = append(irs, Binary{Op: Mul, Src1: size64, Src2: Constant{Value: &mconstant.Int64{Value: mtypes.SizeOf(expr.ElementType)}}, Dst: byteSize})
 		// Call malloc
 		dst := c.makeTemp(&mtypes.Int64Type{})
 		irs = append(irs, FnCall{Name: "malloc", Args: []TackyVal{byteSize}, Dst: dst})
@@ -520,9 +562,9 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 		// Sign-extend index to 64-bit
 		idx64 := c.makeTemp(&mtypes.Int64Type{})
 		irs = append(irs, SignExtend{Src: indexVal, Dst: idx64})
-		// offset = index * 4
+		// offset = index * element size
 		offset := c.makeTemp(&mtypes.Int64Type{})
-		irs = append(irs, Binary{Op: Mul, Src1: idx64, Src2: Constant{Value: &mconstant.Int64{Value: 4}}, Dst: offset})
+		irs = append(irs, Binary{Op: Mul, Src1: idx64, Src2: Constant{Value: &mconstant.Int64{Value: mtypes.SizeOf(expr.Type)}}, Dst: offset})
 		// addr = base + offset
 		addr := c.makeTemp(&mtypes.Int64Type{})
 		irs = append(irs, Binary{Op: Add, Src1: basePtr, Src2: offset, Dst: addr})
@@ -531,6 +573,27 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 		irs = append(irs, Load{Src: addr, Dst: dst})
 		return dst, irs
 
+	case *parser.ASTNewStruct:
+		// a new бүтэц starts out zeroed, a мөр, array or бүтэц field as a
+		// null pointer
+		structType := expr.Type.(*mtypes.StructType)
+		dst := c.makeTemp(&mtypes.Int64Type{})
+		irs := []Instruction{FnCall{Name: "malloc", Args: []TackyVal{Constant{Value: &mconstant.Int64{Value: structType.Size}}}, Dst: dst}}
+		for _, field := range structType.Fields {
+			addr, addrIrs := c.fieldAddr(dst, field)
+			irs = append(irs, addrIrs...)
+			irs = append(irs, Store{Src: zeroOf(field.Type), Dst: addr})
+		}
+		return dst, irs
+
+	case *parser.ASTFieldAccess:
+		base, irs := c.EmitExpr(expr.Struct)
+		addr, addrIrs := c.fieldAddr(base, fieldOf(expr))
+		irs = append(irs, addrIrs...)
+		dst := c.makeTemp(expr.Type)
+		irs = append(irs, Load{Src: addr, Dst: dst})
+		return dst, irs
+
 	case *parser.ASTAssignment:
 		irs := []Instruction{}
 		switch lhs := expr.Left.(type) {
@@ -549,7 +612,7 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 			idx64 := c.makeTemp(&mtypes.Int64Type{})
 			irs = append(irs, SignExtend{Src: indexVal, Dst: idx64})
 			offset := c.makeTemp(&mtypes.Int64Type{})
-			irs = append(irs, Binary{Op: Mul, Src1: idx64, Src2: Constant{Value: &mconstant.Int64{Value: 4}}, Dst: offset})
+			irs = append(irs, Binary{Op: Mul, Src1: idx64, Src2: Constant{Value: &mconstant.Int64{Value: mtypes.SizeOf(lhs.Type)}}, Dst: offset})
 			addr := c.makeTemp(&mtypes.Int64Type{})
 			irs = append(irs, Binary{Op: Add, Src1: basePtr, Src2: offset, Dst: addr})
 			// Evaluate RHS
@@ -558,8 +621,21 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 			// Store
 			irs = append(irs, Store{Src: rhsResult, Dst: addr})
 			return rhsResult, irs
+		case *parser.ASTFieldAccess:
+			base, baseIrs := c.EmitExpr(lhs.Struct)
+			irs = append(irs, baseIrs...)
+			addr, addrIrs := c.fieldAddr(base, fieldOf(lhs))
+			irs = append(irs, addrIrs...)
+			rhsResult, rhsIrs := c.EmitExpr(expr.Right)
+			irs = append(irs, rhsIrs...)
+			// Store writes as many bytes as its source has, a тоо going
+			// into a тоо64 field is widened first
+			rhsResult, extIrs := c.maybeSignExtend(rhsResult, expr.Right.GetType(), lhs.Type)
+			irs = append(irs, extIrs...)
+			irs = append(irs, Store{Src: rhsResult, Dst: addr})
+			return rhsResult, irs
 		default:
-			panic("assignment left side must be var or array index")
+			panic("assignment left side must be var, array index or field")
 		}
 	case parser.ASTConst:
 		exprType := expr.GetType()
@@ -573,10 +649,36 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 			return Constant{Value: &mconstant.Int32{Value: int32(consttype.Value)}}, []Instruction{}
 		case *parser.ASTConstLong:
 			return Constant{Value: &mconstant.Int64{Value: consttype.Value}}, []Instruction{}
+		case *parser.ASTConstBool:
+			return Constant{Value: &mconstant.Bool{Value: consttype.Value}}, []Instruction{}
+		case *parser.ASTConstDouble:
+			return Constant{Value: &mconstant.Double{Value: consttype.Value}}, []Instruction{}
 		default:
 			panic("unimplemented type")
 
 		}
+	case *parser.ASTCast:
+		src, irs := c.EmitExpr(expr.Expr)
+		_, fromDouble := expr.Expr.GetType().(*mtypes.DoubleType)
+		_, toDouble := expr.Type.(*mtypes.DoubleType)
+		switch {
+		case fromDouble && toDouble:
+			return src, irs
+		case toDouble:
+			dst := c.makeTemp(expr.Type)
+			return dst, append(irs, IntToDouble{Src: src, Dst: dst})
+		case fromDouble:
+			dst := c.makeTemp(expr.Type)
+			return dst, append(irs, DoubleToInt{Src: src, Dst: dst})
+		}
+		// between тоо, тоо64 and a төрөл only the width can change
+		if wide, extIrs := c.maybeSignExtend(src, expr.Expr.GetType(), expr.Type); extIrs != nil {
+			return wide, append(irs, extIrs...)
+		}
+		dst := c.makeTemp(expr.Type)
+		return dst, append(irs, Copy{Src: src, Dst: dst})
+	case *parser.ASTEnumConst:
+		return Constant{Value: &mconstant.Int32{Value: int32(expr.Value)}}, []Instruction{}
 	case *parser.ASTStringExpression:
 		// Handle string literals
 		return StringConstant{Value: expr.Value}, []Instruction{}
@@ -616,13 +718,20 @@ func (c *TackyGen) EmitExpr(node parser.ASTExpression) (TackyVal, []Instruction)
 			v2, v2Irs := c.EmitExpr(expr.Right)
 			irs = append(irs, v2Irs...)
 
-			// Sign-extend if mixed 32/64-bit
-			_, commonIs64 := expr.Type.(*mtypes.Int64Type)
-			if commonIs64 {
-				v1ext, v1extIrs := c.maybeSignExtend(v1, expr.Left.GetType(), expr.Type)
+			// Sign-extend if mixed 32/64-bit. A comparison gives логик, it
+			// is done in the wider of its operand types.
+			operandType := expr.Type
+			if _, isBool := expr.Type.(*mtypes.BoolType); isBool {
+				operandType = expr.Left.GetType()
+				if _, rightIs64 := expr.Right.GetType().(*mtypes.Int64Type); rightIs64 {
+					operandType = expr.Right.GetType()
+				}
+			}
+			if _, commonIs64 := operandType.(*mtypes.Int64Type); commonIs64 {
+				v1ext, v1extIrs := c.maybeSignExtend(v1, expr.Left.GetType(), operandType)
 				irs = append(irs, v1extIrs...)
 				v1 = v1ext
-				v2ext, v2extIrs := c.maybeSignExtend(v2, expr.Right.GetType(), expr.Type)
+				v2ext, v2extIrs := c.maybeSignExtend(v2, expr.Right.GetType(), operandType)
 				irs = append(irs, v2extIrs...)
 				v2 = v2ext
 			}
@@ -671,14 +780,46 @@ func (c *TackyGen) PrettyPrint(program TackyProgram) {
 
 func (c *TackyGen) maybeSignExtend(val TackyVal, fromType, toType mtypes.Type) (TackyVal, []Instruction) {
 	_, fromIs32 := fromType.(*mtypes.Int32Type)
+	_, fromIsEnum := fromType.(*mtypes.EnumType)
 	_, toIs64 := toType.(*mtypes.Int64Type)
-	if fromIs32 && toIs64 {
+	if (fromIs32 || fromIsEnum) && toIs64 {
 		dst := c.makeTemp(&mtypes.Int64Type{})
 		return dst, []Instruction{SignExtend{Src: val, Dst: dst}}
 	}
 	return val, nil
 }
 
+// fieldOf finds the field expr reads, the type checker made sure it is
+// there.
+func fieldOf(expr *parser.ASTFieldAccess) mtypes.Field {
+	field, ok := expr.Struct.GetType().(*mtypes.StructType).Field(expr.Field)
+	if !ok {
+		panic(fmt.Sprintf("no field %s in the struct", expr.Field))
+	}
+	return field
+}
+
+// fieldAddr is the address of field in the бүтэц base points to.
+func (c *TackyGen) fieldAddr(base TackyVal, field mtypes.Field) (TackyVal, []Instruction) {
+	if field.Offset == 0 {
+		return base, nil
+	}
+	addr := c.makeTemp(&mtypes.Int64Type{})
+	return addr, []Instruction{Binary{Op: Add, Src1: base, Src2: Constant{Value: &mconstant.Int64{Value: field.Offset}}, Dst: addr}}
+}
+
+// zeroOf is a zero as wide as a value of t, all zero bits are also 0.0
+// and a null pointer.
+func zeroOf(t mtypes.Type) TackyVal {
+	switch mtypes.SizeOf(t) {
+	case 1:
+		return Constant{Value: &mconstant.False}
+	case 4:
+		return Constant{Value: &mconstant.IntZero}
+	}
+	return Constant{Value: &mconstant.Int64{Value: 0}}
+}
+
 func (c *TackyGen) makeTemp(mtype mtypes.Type) Var {
 	temp := fmt.Sprintf("tmp.%d", c.TempCount)
 	c.TempCount += 1
@@ -706,3 +847,172 @@ func (c *TackyGen) makeLabel(prefix string) Var {
 	c.LabelCount += 1
 	return Var{Name: temp}
 }
+
+// minJumpTableCases is how many case values a сонго needs before its
+// values index a jump table. The table also has to be at least half full
+// and at most maxJumpTableSize long, so a few far apart values or wide
+// ranges are still compared one by one.
+const (
+	minJumpTableCases = 4
+	maxJumpTableSize  = 256
+)
+
+// switchTarget sends the values lo..hi to label.
+type switchTarget struct {
+	lo, hi int64
+	label  string
+}
+
+// emitSwitch jumps to the case of a сонго whose value matches, through a
+// jump table when the case values are dense and a chain of comparisons
+// otherwise. The case bodies follow in order, each jumping to the end,
+// then the эсвэл body that values matching no case go to.
+func (c *TackyGen) emitSwitch(ast *parser.ASTSwitch) []Instruction {
+	value, irs := c.EmitExpr(ast.Value)
+	endLabel := c.makeLabel("switch_end").Name
+	otherwise := endLabel
+	if ast.Default != nil {
+		otherwise = c.makeLabel("default").Name
+	}
+
+	caseLabels := make([]string, len(ast.Cases))
+	targets := []switchTarget{}
+	for i, cs := range ast.Cases {
+		caseLabels[i] = c.makeLabel("case").Name
+		for _, caseValue := range cs.Values {
+			lo, hi := switchRange(caseValue)
+			targets = append(targets, switchTarget{lo: lo, hi: hi, label: caseLabels[i]})
+		}
+	}
+
+	if lo, hi, ok := jumpTableRange(targets); ok {
+		irs = append(irs, c.emitJumpTable(value, ast.Value.GetType(), targets, lo, hi, otherwise)...)
+	} else {
+		irs = append(irs, c.emitCompareChain(value, ast.Value.GetType(), targets, otherwise)...)
+	}
+
+	for i, cs := range ast.Cases {
+		irs = append(irs, Label{Ident: caseLabels[i]})
+		irs = append(irs, c.EmitTackyStmt(cs.Body)...)
+		irs = append(irs, Jump{Target: endLabel})
+	}
+	if ast.Default != nil {
+		irs = append(irs, Label{Ident: otherwise})
+		irs = append(irs, c.EmitTackyStmt(ast.Default)...)
+	}
+	irs = append(irs, Label{Ident: endLabel})
+	return irs
+}
+
+// jumpTableRange tells whether targets are dense enough for a jump table
+// and which values the table spans.
+func jumpTableRange(targets []switchTarget) (int64, int64, bool) {
+	if len(targets) == 0 {
+		return 0, 0, false
+	}
+	lo, hi := targets[0].lo, targets[0].hi
+	values := uint64(0)
+	for _, target := range targets {
+		// the differences are taken unsigned, a range can be wider than
+		// int64 holds
+		if uint64(target.hi-target.lo) >= maxJumpTableSize {
+			return 0, 0, false
+		}
+		values += uint64(target.hi-target.lo) + 1
+		lo, hi = min(lo, target.lo), max(hi, target.hi)
+	}
+	size := uint64(hi-lo) + 1
+	ok := values >= minJumpTableCases && size <= maxJumpTableSize && size <= 2*values
+	return lo, hi, ok
+}
+
+// emitJumpTable sends value outside lo..hi to otherwise and indexes a
+// table with the rest.
+func (c *TackyGen) emitJumpTable(value TackyVal, valueType mtypes.Type, targets []switchTarget, lo, hi int64, otherwise string) []Instruction {
+	table := make([]string, hi-lo+1)
+	for i := range table {
+		table[i] = otherwise
+	}
+	for _, target := range targets {
+		// counting from lo up to hi could overflow at the top of int64
+		start := target.lo - lo
+		for i := int64(0); i <= target.hi-target.lo; i++ {
+			table[start+i] = target.label
+		}
+	}
+
+	below := c.makeTemp(&mtypes.BoolType{})
+	above := c.makeTemp(&mtypes.BoolType{})
+	irs := []Instruction{
+		Binary{Op: LessThan, Src1: value, Src2: switchConstant(lo, valueType), Dst: below},
+		JumpIfNotZero{Val: below, Ident: otherwise},
+		Binary{Op: GreaterThan, Src1: value, Src2: switchConstant(hi, valueType), Dst: above},
+		JumpIfNotZero{Val: above, Ident: otherwise},
+	}
+	index := value
+	if lo != 0 {
+		offset := c.makeTemp(switchIndexType(valueType))
+		irs = append(irs, Binary{Op: Sub, Src1: value, Src2: switchConstant(lo, valueType), Dst: offset})
+		index = offset
+	}
+	return append(irs, JumpTable{Index: index, Targets: table})
+}
+
+// emitCompareChain tests the case values one after another, a range with
+// a comparison at each end.
+func (c *TackyGen) emitCompareChain(value TackyVal, valueType mtypes.Type, targets []switchTarget, otherwise string) []Instruction {
+	irs := []Instruction{}
+	for _, target := range targets {
+		if target.lo == target.hi {
+			equal := c.makeTemp(&mtypes.BoolType{})
+			irs = append(irs,
+				Binary{Op: Equal, Src1: value, Src2: switchConstant(target.lo, valueType), Dst: equal},
+				JumpIfNotZero{Val: equal, Ident: target.label},
+			)
+			continue
+		}
+		below := c.makeTemp(&mtypes.BoolType{})
+		inside := c.makeTemp(&mtypes.BoolType{})
+		next := c.makeLabel("range_next").Name
+		irs = append(irs,
+			Binary{Op: LessThan, Src1: value, Src2: switchConstant(target.lo, valueType), Dst: below},
+			JumpIfNotZero{Val: below, Ident: next},
+			Binary{Op: LessThanEqual, Src1: value, Src2: switchConstant(target.hi, valueType), Dst: inside},
+			JumpIfNotZero{Val: inside, Ident: target.label},
+			Label{Ident: next},
+		)
+	}
+	return append(irs, Jump{Target: otherwise})
+}
+
+// switchRange is the values a case value stands for, the type checker only
+// lets constants and ranges of them through.
+func switchRange(expr parser.ASTExpression) (int64, int64) {
+	switch expr := expr.(type) {
+	case *parser.ASTEnumConst:
+		return expr.Value, expr.Value
+	case *parser.ASTConstInt:
+		return expr.Value, expr.Value
+	case *parser.ASTConstLong:
+		return expr.Value, expr.Value
+	case *parser.ASTRangeExpr:
+		lo, _ := switchRange(expr.Start)
+		hi, _ := switchRange(expr.End)
+		return lo, hi
+	}
+	panic(fmt.Sprintf("unimplemented case value %T", expr))
+}
+
+func switchIndexType(valueType mtypes.Type) mtypes.Type {
+	if _, isLong := valueType.(*mtypes.Int64Type); isLong {
+		return &mtypes.Int64Type{}
+	}
+	return &mtypes.Int32Type{}
+}
+
+func switchConstant(value int64, valueType mtypes.Type) TackyVal {
+	if _, isLong := valueType.(*mtypes.Int64Type); isLong {
+		return Constant{Value: &mconstant.Int64{Value: value}}
+	}
+	return Constant{Value: &mconstant.Int32{Value: int32(value)}}
+}
@@ -77,6 +77,27 @@ func (s SignExtend) Ir() {
 	fmt.Printf("%s signextend:= %s\n", s.Dst.val(), s.Src.val())
 }
 
+// IntToDouble converts an i32 or i64 Src to the f64 Dst.
+type IntToDouble struct {
+	Src TackyVal
+	Dst TackyVal
+}
+
+func (s IntToDouble) Ir() {
+	fmt.Printf("%s inttodouble:= %s\n", s.Dst.val(), s.Src.val())
+}
+
+// DoubleToInt converts the f64 Src to an i32 or i64 Dst, rounding toward
+// zero as C does.
+type DoubleToInt struct {
+	Src TackyVal
+	Dst TackyVal
+}
+
+func (s DoubleToInt) Ir() {
+	fmt.Printf("%s doubletoint:= %s\n", s.Dst.val(), s.Src.val())
+}
+
 type Copy struct {
 	Src TackyVal
 	Dst TackyVal
@@ -112,6 +133,17 @@ func (j JumpIfNotZero) Ir() {
 	fmt.Printf("if %s != 0 goto %s\n", j.Val.val(), j.Ident)
 }
 
+// JumpTable goes to Targets[Index]. TackyGen checks the bounds first, so
+// Index is always one of the entries.
+type JumpTable struct {
+	Index   TackyVal
+	Targets []string
+}
+
+func (j JumpTable) Ir() {
+	fmt.Printf("goto %v[%s]\n", j.Targets, j.Index.val())
+}
+
 type Label struct {
 	Ident string
 }
@@ -120,6 +152,16 @@ func (u Label) Ir() {
 	fmt.Printf("%s:\n", u.Ident)
 }
 
+// SourceLine marks where the code for a line of the source starts. TackyGen
+// only emits it for -g, the backend turns it into a .loc directive.
+type SourceLine struct {
+	Line int
+}
+
+func (u SourceLine) Ir() {
+	fmt.Printf("line %d\n", u.Line)
+}
+
 type Return struct {
 	Value TackyVal
 }
@@ -199,7 +241,12 @@ type TackyFn struct {
 	Params       []TackyVal
 	IsExtern     bool
 	Global       bool
+	NoInline     bool
 	Instructions []Instruction
+	// File is the source file of an imported function, empty for the file
+	// being compiled. Line is where the function is declared.
+	File string
+	Line int
 }
 
 func (f TackyFn) Ir() {
@@ -0,0 +1,674 @@
+package tackygen
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+)
+
+// ParseTacky reads the textual form written by TackyPrinter back into a
+// TackyProgram, together with a symbol table holding the declared types so
+// the program can go straight to the backend.
+func ParseTacky(source string) (TackyProgram, *symbols.SymbolTable, error) {
+	p := &tackyParser{
+		table: symbols.NewSymbolTable(),
+		lines: strings.Split(source, "\n"),
+	}
+	program, err := p.parseProgram()
+	if err != nil {
+		return TackyProgram{}, nil, err
+	}
+	return program, p.table, nil
+}
+
+type tackyParser struct {
+	table  *symbols.SymbolTable
+	lines  []string
+	lineNo int
+	toks   []string
+	pos    int
+}
+
+var binaryOpsByName = map[string]TackyBinaryOp{}
+var unaryOpsByName = map[string]UnaryOperator{}
+
+func init() {
+	for op, name := range binaryOpNames {
+		binaryOpsByName[name] = op
+	}
+	for op, name := range unaryOpNames {
+		unaryOpsByName[name] = op
+	}
+}
+
+func (p *tackyParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("tacky парсингийн алдаа: %d-р мөр: %s", p.lineNo, fmt.Sprintf(format, args...))
+}
+
+// nextLine loads the next non empty line into the token buffer, it returns
+// false at the end of input.
+func (p *tackyParser) nextLine() (bool, error) {
+	for p.lineNo < len(p.lines) {
+		line := p.lines[p.lineNo]
+		p.lineNo++
+		toks, err := tokenizeTackyLine(line)
+		if err != nil {
+			return false, p.errorf("%v", err)
+		}
+		if len(toks) == 0 {
+			continue
+		}
+		p.toks = toks
+		p.pos = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *tackyParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *tackyParser) next() string {
+	tok := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *tackyParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return p.errorf("'%s' хүлээж байсан, '%s' олдлоо", tok, got)
+	}
+	return nil
+}
+
+func (p *tackyParser) expectEnd() error {
+	if p.pos < len(p.toks) {
+		return p.errorf("илүү тэмдэгт: '%s'", p.peek())
+	}
+	return nil
+}
+
+func (p *tackyParser) ident() (string, error) {
+	tok := p.next()
+	if !isTackyIdent(tok) {
+		return "", p.errorf("нэр хүлээж байсан, '%s' олдлоо", tok)
+	}
+	return tok, nil
+}
+
+func (p *tackyParser) parseProgram() (TackyProgram, error) {
+	program := TackyProgram{}
+	for {
+		ok, err := p.nextLine()
+		if err != nil {
+			return program, err
+		}
+		if !ok {
+			return program, nil
+		}
+
+		switch p.peek() {
+		case "global":
+			gv, err := p.parseGlobal()
+			if err != nil {
+				return program, err
+			}
+			program.GlobalVars = append(program.GlobalVars, gv)
+		case "extern":
+			fn, err := p.parseExtern()
+			if err != nil {
+				return program, err
+			}
+			program.ExternDefs = append(program.ExternDefs, fn)
+		case "public", "noinline", "fn":
+			fn, err := p.parseFn()
+			if err != nil {
+				return program, err
+			}
+			program.FnDefs = append(program.FnDefs, fn)
+		default:
+			return program, p.errorf("'global', 'extern' эсвэл 'fn' хүлээж байсан, '%s' олдлоо", p.peek())
+		}
+	}
+}
+
+func (p *tackyParser) parseGlobal() (GlobalVar, error) {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return GlobalVar{}, err
+	}
+	if err := p.expect(":"); err != nil {
+		return GlobalVar{}, err
+	}
+	t, err := p.parseType()
+	if err != nil {
+		return GlobalVar{}, err
+	}
+	if err := p.expect("="); err != nil {
+		return GlobalVar{}, err
+	}
+	initTok := p.next()
+	init, err := strconv.ParseInt(strings.TrimSuffix(initTok, "L"), 10, 64)
+	if _, isDouble := t.(*mtypes.DoubleType); isDouble {
+		var value float64
+		value, err = parseDouble(initTok)
+		init = int64(math.Float64bits(value))
+	}
+	if err != nil {
+		return GlobalVar{}, p.errorf("буруу анхны утга '%s'", initTok)
+	}
+	if err := p.expectEnd(); err != nil {
+		return GlobalVar{}, err
+	}
+
+	size := 8
+	switch t.(type) {
+	case *mtypes.Int32Type, *mtypes.EnumType:
+		size = 4
+	case *mtypes.BoolType:
+		size = 1
+	}
+	p.table.AddVar(t, name)
+	return GlobalVar{Name: name, InitValue: init, Size: size}, nil
+}
+
+func (p *tackyParser) parseExtern() (TackyFn, error) {
+	p.next()
+	if err := p.expect("fn"); err != nil {
+		return TackyFn{}, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return TackyFn{}, err
+	}
+	fn := TackyFn{Name: name, IsExtern: true}
+	if p.peek() == "" {
+		return fn, nil
+	}
+
+	if err := p.expect("("); err != nil {
+		return TackyFn{}, err
+	}
+	fnType := &mtypes.FnType{}
+	for p.peek() != ")" {
+		if len(fnType.ParamTypes) > 0 {
+			if err := p.expect(","); err != nil {
+				return TackyFn{}, err
+			}
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return TackyFn{}, err
+		}
+		fnType.ParamTypes = append(fnType.ParamTypes, t)
+	}
+	p.next()
+	if fnType.RetType, err = p.parseReturnType(); err != nil {
+		return TackyFn{}, err
+	}
+	if err := p.expectEnd(); err != nil {
+		return TackyFn{}, err
+	}
+	p.table.AddFn(fnType, name, false)
+	return fn, nil
+}
+
+func (p *tackyParser) parseFn() (TackyFn, error) {
+	fn := TackyFn{}
+	if p.peek() == "public" {
+		p.next()
+		fn.Global = true
+	}
+	if p.peek() == "noinline" {
+		p.next()
+		fn.NoInline = true
+	}
+	if err := p.expect("fn"); err != nil {
+		return fn, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return fn, err
+	}
+	fn.Name = name
+
+	if err := p.expect("("); err != nil {
+		return fn, err
+	}
+	fnType := &mtypes.FnType{}
+	for p.peek() != ")" {
+		if len(fn.Params) > 0 {
+			if err := p.expect(","); err != nil {
+				return fn, err
+			}
+		}
+		paramName, paramType, err := p.parseTypedName()
+		if err != nil {
+			return fn, err
+		}
+		p.table.AddVar(paramType, paramName)
+		fn.Params = append(fn.Params, Var{Name: paramName})
+		fnType.ParamTypes = append(fnType.ParamTypes, paramType)
+	}
+	p.next()
+	if fnType.RetType, err = p.parseReturnType(); err != nil {
+		return fn, err
+	}
+	if err := p.expect("{"); err != nil {
+		return fn, err
+	}
+	if err := p.expectEnd(); err != nil {
+		return fn, err
+	}
+	p.table.AddFn(fnType, name, true)
+
+	for {
+		ok, err := p.nextLine()
+		if err != nil {
+			return fn, err
+		}
+		if !ok {
+			return fn, p.errorf("'%s' функцийн '}' олдсонгүй", name)
+		}
+		if p.peek() == "}" {
+			p.next()
+			return fn, p.expectEnd()
+		}
+		if p.peek() == "var" {
+			p.next()
+			varName, varType, err := p.parseTypedName()
+			if err != nil {
+				return fn, err
+			}
+			p.table.AddVar(varType, varName)
+			if err := p.expectEnd(); err != nil {
+				return fn, err
+			}
+			continue
+		}
+
+		instr, err := p.parseInstruction()
+		if err != nil {
+			return fn, err
+		}
+		if err := p.expectEnd(); err != nil {
+			return fn, err
+		}
+		fn.Instructions = append(fn.Instructions, instr)
+	}
+}
+
+func (p *tackyParser) parseTypedName() (string, mtypes.Type, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return "", nil, err
+	}
+	t, err := p.parseType()
+	return name, t, err
+}
+
+func (p *tackyParser) parseReturnType() (mtypes.Type, error) {
+	if err := p.expect("->"); err != nil {
+		return nil, err
+	}
+	return p.parseType()
+}
+
+func (p *tackyParser) parseType() (mtypes.Type, error) {
+	tok := p.next()
+	switch tok {
+	case "i32":
+		return &mtypes.Int32Type{}, nil
+	case "i64":
+		return &mtypes.Int64Type{}, nil
+	case "bool":
+		return &mtypes.BoolType{}, nil
+	case "f64":
+		return &mtypes.DoubleType{}, nil
+	case "str":
+		return &mtypes.StringType{}, nil
+	case "void":
+		return &mtypes.VoidType{}, nil
+	case "[":
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &mtypes.ArrayType{ElementType: elem}, nil
+	case "struct":
+		// only the name, a бүтэц is a pointer as far as the backends care
+		name := p.next()
+		if !isTackyIdent(name) {
+			return nil, p.errorf("бүтцийн нэр байх ёстой, '%s' олдсон", name)
+		}
+		return &mtypes.StructType{Name: name}, nil
+	case "enum":
+		// a төрөл is a тоо, the variants don't matter after type checking
+		name := p.next()
+		if !isTackyIdent(name) {
+			return nil, p.errorf("төрлийн нэр байх ёстой, '%s' олдсон", name)
+		}
+		return &mtypes.EnumType{Name: name}, nil
+	default:
+		return nil, p.errorf("үл мэдэгдэх төрөл '%s'", tok)
+	}
+}
+
+func (p *tackyParser) parseInstruction() (Instruction, error) {
+	// a label is a lone name followed by ':'
+	if len(p.toks) == 2 && p.toks[1] == ":" && isTackyIdent(p.toks[0]) {
+		p.pos = 2
+		return Label{Ident: p.toks[0]}, nil
+	}
+
+	switch p.peek() {
+	case "jump":
+		p.next()
+		target, err := p.ident()
+		return Jump{Target: target}, err
+	case "jz", "jnz":
+		op := p.next()
+		val, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		target, err := p.ident()
+		if op == "jz" {
+			return JumpIfZero{Val: val, Ident: target}, err
+		}
+		return JumpIfNotZero{Val: val, Ident: target}, err
+	case "jtable":
+		p.next()
+		index, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		targets := []string{}
+		for p.peek() != "]" {
+			if len(targets) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			target, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+		p.next()
+		return JumpTable{Index: index, Targets: targets}, nil
+	case "return":
+		p.next()
+		val, err := p.parseVal()
+		return Return{Value: val}, err
+	case "line":
+		p.next()
+		tok := p.next()
+		line, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, p.errorf("мөрийн дугаар хүлээж байсан, '%s' олдлоо", tok)
+		}
+		return SourceLine{Line: line}, nil
+	case "store":
+		p.next()
+		src, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		dst, err := p.parseVal()
+		return Store{Src: src, Dst: dst}, err
+	case "call":
+		return p.parseCall(nil)
+	}
+
+	dstName, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	dst := Var{Name: dstName}
+	if err := p.expect(":="); err != nil {
+		return nil, err
+	}
+
+	// an operator keyword standing alone is a variable of the same name
+	op := p.peek()
+	if p.pos+1 >= len(p.toks) {
+		src, err := p.parseVal()
+		return Copy{Src: src, Dst: dst}, err
+	}
+
+	switch {
+	case op == "call":
+		return p.parseCall(dst)
+	case op == "truncate" || op == "signextend" || op == "inttodouble" || op == "doubletoint" || op == "load":
+		p.next()
+		src, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "truncate":
+			return Truncate{Src: src, Dst: dst}, nil
+		case "signextend":
+			return SignExtend{Src: src, Dst: dst}, nil
+		case "inttodouble":
+			return IntToDouble{Src: src, Dst: dst}, nil
+		case "doubletoint":
+			return DoubleToInt{Src: src, Dst: dst}, nil
+		default:
+			return Load{Src: src, Dst: dst}, nil
+		}
+	case unaryOpsByName[op] != "":
+		p.next()
+		src, err := p.parseVal()
+		return Unary{Op: unaryOpsByName[op], Src: src, Dst: dst}, err
+	case binaryOpsByName[op] != "":
+		p.next()
+		src1, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		src2, err := p.parseVal()
+		return Binary{Op: binaryOpsByName[op], Src1: src1, Src2: src2, Dst: dst}, err
+	default:
+		return nil, p.errorf("үл мэдэгдэх үйлдэл '%s'", op)
+	}
+}
+
+func (p *tackyParser) parseCall(dst TackyVal) (Instruction, error) {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := []TackyVal{}
+	for p.peek() != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseVal()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	return FnCall{Name: name, Args: args, Dst: dst}, nil
+}
+
+func (p *tackyParser) parseVal() (TackyVal, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, p.errorf("утга хүлээж байсан, мөр дууссан")
+	case strings.HasPrefix(tok, "\""):
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return nil, p.errorf("буруу мөр тогтмол %s", tok)
+		}
+		return StringConstant{Value: s}, nil
+	case isNonFinite(tok):
+		f, _ := parseDouble(tok)
+		return Constant{Value: &mconstant.Double{Value: f}}, nil
+	case tok[0] == '-' || unicode.IsDigit(rune(tok[0])):
+		if strings.Contains(tok, ".") {
+			f, err := parseDouble(tok)
+			if err != nil {
+				return nil, p.errorf("буруу бутархай тоо '%s'", tok)
+			}
+			return Constant{Value: &mconstant.Double{Value: f}}, nil
+		}
+		if strings.HasSuffix(tok, "L") {
+			n, err := strconv.ParseInt(strings.TrimSuffix(tok, "L"), 10, 64)
+			if err != nil {
+				return nil, p.errorf("буруу тоо '%s'", tok)
+			}
+			return Constant{Value: &mconstant.Int64{Value: n}}, nil
+		}
+		n, err := strconv.ParseInt(tok, 10, 32)
+		if err != nil {
+			return nil, p.errorf("буруу тоо '%s'", tok)
+		}
+		return Constant{Value: &mconstant.Int32{Value: int32(n)}}, nil
+	case tok == "true" || tok == "false":
+		return Constant{Value: &mconstant.Bool{Value: tok == "true"}}, nil
+	case isTackyIdent(tok):
+		return Var{Name: tok}, nil
+	default:
+		return nil, p.errorf("утга хүлээж байсан, '%s' олдлоо", tok)
+	}
+}
+
+// isNonFinite reports whether tok is one of the words formatDouble writes
+// for NaN and the infinities. No variable is named like them, every name
+// the frontend makes has a suffix.
+func isNonFinite(tok string) bool {
+	switch tok {
+	case "nan", "-nan", "inf", "-inf":
+		return true
+	}
+	return false
+}
+
+// parseDouble reads an f64 constant as formatDouble writes it.
+func parseDouble(tok string) (float64, error) {
+	switch tok {
+	case "nan":
+		return math.Float64frombits(0x7ff8000000000000), nil
+	case "-nan":
+		return math.Float64frombits(0xfff8000000000000), nil
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(tok, 64)
+}
+
+func isTackyIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+func isTackyIdent(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	for i, r := range tok {
+		if !isTackyIdentRune(r) {
+			return false
+		}
+		if i == 0 && unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenizeTackyLine(line string) ([]string, error) {
+	var toks []string
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#':
+			return toks, nil
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					j++
+					continue
+				}
+				if runes[j] == '"' {
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("хаагдаагүй мөр тогтмол")
+			}
+			toks = append(toks, string(runes[i:j+1]))
+			i = j + 1
+		case r == ':' && i+1 < len(runes) && runes[i+1] == '=':
+			toks = append(toks, ":=")
+			i += 2
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+			toks = append(toks, "->")
+			i += 2
+		case r == '-' || isTackyIdentRune(r):
+			j := i + 1
+			for j < len(runes) && isTackyIdentRune(runes[j]) {
+				j++
+			}
+			toks = append(toks, string(runes[i:j]))
+			i = j
+		case strings.ContainsRune("(),:={}[]", r):
+			toks = append(toks, string(r))
+			i++
+		default:
+			return nil, fmt.Errorf("үл мэдэгдэх тэмдэгт '%c'", r)
+		}
+	}
+	return toks, nil
+}
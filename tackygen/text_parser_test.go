@@ -0,0 +1,179 @@
+package tackygen
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/mconstant"
+)
+
+const roundTripSource = `global тоолуур_1: i32 = 7
+global бэлэн_7: bool = 1
+global хувь_10: f64 = 0.5
+
+extern fn malloc
+extern fn хэвлэ(i64) -> void
+extern fn мөр_хэвлэх(str) -> void
+
+public fn нэмэх_2(a_3: i32, b_4: i64) -> i64 {
+    var tmp.0: i64
+    var tmp.1: i64
+    tmp.0 := signextend a_3
+    tmp.1 := add tmp.0, b_4
+    return tmp.1
+}
+
+fn тэгш_8(н_9: i32) -> bool {
+    var tmp.7: bool
+    tmp.7 := eq н_9, 0
+    jnz tmp.7, end.2
+    tmp.7 := false
+    бэлэн_7 := true
+  end.2:
+    return tmp.7
+}
+
+fn бүхэл_11(х_12: f64) -> i64 {
+    var tmp.8: f64
+    var tmp.9: i64
+    tmp.8 := mul х_12, 2.5
+    tmp.8 := add tmp.8, хувь_10
+    tmp.9 := doubletoint tmp.8
+    tmp.8 := inttodouble tmp.9
+    return tmp.9
+}
+
+fn y_13(ц_14: struct Цэг) -> i32 {
+    var tmp.10: i64
+    var tmp.11: i32
+    tmp.10 := add ц_14, 4L
+    tmp.11 := load tmp.10
+    store 0, ц_14
+    return tmp.11
+}
+
+fn нэр_15(ө_16: enum Өнгө) -> i32 {
+    line 3
+    jtable ө_16, [case.3, case.4, case.3]
+  case.3:
+    return 1
+  case.4:
+    return 2
+}
+
+fn үндсэн() -> i32 {
+    var arr_5: []i32
+    var tmp.3: i32
+    var tmp.4: i32
+    var tmp.2: i64
+    var tmp.6: i32
+    var tmp.5: void
+    arr_5 := call malloc(40L)
+    store -3, arr_5
+    tmp.3 := load arr_5
+    tmp.4 := not tmp.3
+    jz tmp.4, else.0
+    tmp.2 := call нэмэх_2(тоолуур_1, -9223372036854775808L)
+    tmp.6 := truncate tmp.2
+    tmp.4 := mod tmp.6, 3
+    jump end.1
+  else.0:
+    tmp.5 := call мөр_хэвлэх("мөр \"хашилт\"\n")
+    jnz tmp.3, end.1
+  end.1:
+    tmp.3 := negate tmp.4
+    тоолуур_1 := tmp.3
+    return 0
+}
+`
+
+func TestTackyRoundTrip(t *testing.T) {
+	program, table, err := ParseTacky(roundTripSource)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := NewTackyPrinter(&out, table).PrintProgram(program); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	if out.String() != roundTripSource {
+		t.Errorf("round trip mismatch:\n%s", out.String())
+	}
+}
+
+func TestTackyParseErrors(t *testing.T) {
+	cases := []string{
+		"fn f() -> i32 {\n    return 0\n",
+		"fn f() -> i32 {\n    x := frobnicate 1, 2\n}\n",
+		"global x: f32 = 0\n",
+		"fn f(x: struct 1) -> i32 {\n    return 0\n}\n",
+		"fn f() -> i32 {\n    return \"unterminated\n}\n",
+	}
+	for _, src := range cases {
+		if _, _, err := ParseTacky(src); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
+
+type unknownInstruction struct{}
+
+func (unknownInstruction) Ir() {}
+
+// TestFormatUnknownInstruction checks an instruction the printer doesn't
+// know stops it rather than going missing from the text.
+func TestFormatUnknownInstruction(t *testing.T) {
+	defer func() {
+		r := recover()
+		if msg, ok := r.(string); !ok || !strings.Contains(msg, "unknownInstruction") {
+			t.Errorf("expected a panic naming the instruction, got %v", r)
+		}
+	}()
+	FormatInstruction(unknownInstruction{})
+}
+
+// TestDoubleRoundTrip checks the f64 constants constant folding can make
+// out of a division by zero come back from the text as they went in.
+func TestDoubleRoundTrip(t *testing.T) {
+	values := []float64{
+		math.NaN(),
+		math.Float64frombits(0xfff8000000000000),
+		math.Inf(1),
+		math.Inf(-1),
+		math.Copysign(0, -1),
+	}
+	same := func(a, b float64) bool {
+		if math.IsNaN(a) {
+			return math.IsNaN(b) && math.Signbit(a) == math.Signbit(b)
+		}
+		return math.Float64bits(a) == math.Float64bits(b)
+	}
+	for _, value := range values {
+		src := fmt.Sprintf("global g_1: f64 = %s\n\nfn f_2() -> f64 {\n    return %s\n}\n",
+			formatDouble(value), FormatVal(Constant{Value: &mconstant.Double{Value: value}}))
+		program, table, err := ParseTacky(src)
+		if err != nil {
+			t.Errorf("%v: parse failed: %v\n%s", value, err, src)
+			continue
+		}
+		if got := math.Float64frombits(uint64(program.GlobalVars[0].InitValue)); !same(got, value) {
+			t.Errorf("%v: global came back as %v", value, got)
+		}
+		ret := program.FnDefs[0].Instructions[0].(Return)
+		if got := ret.Value.(Constant).Value.(*mconstant.Double).Value; !same(got, value) {
+			t.Errorf("%v: constant came back as %v", value, got)
+		}
+
+		var out bytes.Buffer
+		if err := NewTackyPrinter(&out, table).PrintProgram(program); err != nil {
+			t.Fatalf("print failed: %v", err)
+		}
+		if out.String() != src {
+			t.Errorf("%v: round trip mismatch:\n%s", value, out.String())
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package utfconvert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MangledPrefix starts every symbol Mangle makes. No libc or lib.c symbol
+// begins with it, so a Mon function called main or malloc can't clash.
+const MangledPrefix = "_M"
+
+// Mangle spells a Mon function or global as an assembler symbol. UtfConvert
+// is readable but loses information, ц and тс both become ts, so the symbol
+// escapes code points instead and Demangle can always get the name back:
+//
+//	a-z A-Z 0-9    as they are
+//	_              __
+//	U+0400-U+04FF  _ and two hex digits of the offset, ф is _44
+//	other BMP      _u and four hex digits
+//	the rest       _U and six hex digits
+//
+// фибоначчи becomes _M_44_38_31_3e_3d_30_47_47_38. Externs name C functions
+// and keep their UtfConvert spelling.
+func Mangle(name string) string {
+	var buf strings.Builder
+	buf.WriteString(MangledPrefix)
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			buf.WriteRune(r)
+		case r == '_':
+			buf.WriteString("__")
+		case r >= 0x400 && r <= 0x4ff:
+			fmt.Fprintf(&buf, "_%02x", r-0x400)
+		case r <= 0xffff:
+			fmt.Fprintf(&buf, "_u%04x", r)
+		default:
+			fmt.Fprintf(&buf, "_U%06x", r)
+		}
+	}
+	return buf.String()
+}
+
+// Demangle turns a symbol made by Mangle back into the Mon name, ok is false
+// for anything Mangle can't have written.
+func Demangle(symbol string) (name string, ok bool) {
+	if !strings.HasPrefix(symbol, MangledPrefix) || len(symbol) == len(MangledPrefix) {
+		return "", false
+	}
+	var buf strings.Builder
+	s := symbol[len(MangledPrefix):]
+	for len(s) > 0 {
+		if s[0] != '_' {
+			if !isSymbolByte(s[0]) {
+				return "", false
+			}
+			buf.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		if len(s) < 2 {
+			return "", false
+		}
+		digits, base := 2, rune(0x400)
+		switch s[1] {
+		case '_':
+			buf.WriteByte('_')
+			s = s[2:]
+			continue
+		case 'u':
+			digits, base, s = 4, 0, s[1:]
+		case 'U':
+			digits, base, s = 6, 0, s[1:]
+		}
+		if len(s) < 1+digits || !isLowerHex(s[1:1+digits]) {
+			return "", false
+		}
+		code, _ := strconv.ParseUint(s[1:1+digits], 16, 32)
+		buf.WriteRune(base + rune(code))
+		s = s[1+digits:]
+	}
+	return buf.String(), true
+}
+
+func isSymbolByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// DemangleText demangles every symbol in text and leaves the rest alone, for
+// linker errors, nm, objdump or perf output. The extra underscore Mach-O puts
+// in front of C symbols is dropped along with the symbol.
+func DemangleText(text string) string {
+	var buf strings.Builder
+	for i := 0; i < len(text); {
+		if !isSymbolByte(text[i]) {
+			buf.WriteByte(text[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(text) && isSymbolByte(text[j]) {
+			j++
+		}
+		word := text[i:j]
+		symbol := word
+		if strings.HasPrefix(symbol, "_"+MangledPrefix) {
+			symbol = symbol[1:]
+		}
+		if name, ok := Demangle(symbol); ok {
+			buf.WriteString(name)
+		} else {
+			buf.WriteString(word)
+		}
+		i = j
+	}
+	return buf.String()
+}
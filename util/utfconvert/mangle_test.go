@@ -0,0 +1,33 @@
+package utfconvert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMangle(t *testing.T) {
+	assert.Equal(t, "_M_44_38_31_3e_3d_30_47_47_38", Mangle("фибоначчи"))
+	assert.Equal(t, "_Mmain", Mangle("main"))
+	assert.Equal(t, "_M_3c_e9_40__x2", Mangle("мөр_x2"))
+
+	// ц and тс transliterate the same, the symbols must not
+	assert.Equal(t, UtfConvert("ц"), UtfConvert("тс"))
+	assert.NotEqual(t, Mangle("ц"), Mangle("тс"))
+
+	for _, name := range []string{"үндсэн", "санамсаргүйТоо", "a_b", "_", "x__y", "λ", "😀", "мөр.1"} {
+		demangled, ok := Demangle(Mangle(name))
+		assert.True(t, ok, name)
+		assert.Equal(t, name, demangled)
+	}
+
+	for _, symbol := range []string{"main", "_M", "_M_4", "_M_4g", "_Mu_", "_M_u04", "_M.x"} {
+		_, ok := Demangle(symbol)
+		assert.False(t, ok, symbol)
+	}
+}
+
+func TestDemangleText(t *testing.T) {
+	text := "undefined reference to `_M_44_38_31_3e_3d_30_47_47_38'\n  call __M_3d_30_4f@PLT; khevle+0x10"
+	assert.Equal(t, "undefined reference to `фибоначчи'\n  call ная@PLT; khevle+0x10", DemangleText(text))
+}
@@ -0,0 +1,561 @@
+package wasmgen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValType is a WebAssembly value type, f32 is never used.
+type ValType byte
+
+const (
+	I32 ValType = 0x7f
+	I64 ValType = 0x7e
+	F64 ValType = 0x7c
+)
+
+func (t ValType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case F64:
+		return "f64"
+	}
+	return "i64"
+}
+
+type FuncType struct {
+	Params  []ValType
+	Results []ValType
+}
+
+func (f FuncType) key() string {
+	return fmt.Sprint(f.Params, f.Results)
+}
+
+type immKind int
+
+const (
+	immNone immKind = iota
+	immIndex
+	immI32
+	immI64
+	// the bits of an f64, little endian in the binary
+	immF64
+	immMem
+	immBlock
+	immTable
+	// the memory index of memory.size and memory.grow, only in the binary
+	immMemIdx
+)
+
+type opInfo struct {
+	code byte
+	name string
+	imm  immKind
+}
+
+// Op is an instruction opcode together with its text name.
+type Op *opInfo
+
+var (
+	OpUnreachable = &opInfo{0x00, "unreachable", immNone}
+	OpBlock       = &opInfo{0x02, "block", immBlock}
+	OpLoop        = &opInfo{0x03, "loop", immBlock}
+	OpIf          = &opInfo{0x04, "if", immBlock}
+	OpEnd         = &opInfo{0x0b, "end", immNone}
+	OpBr          = &opInfo{0x0c, "br", immIndex}
+	OpBrTable     = &opInfo{0x0e, "br_table", immTable}
+	OpReturn      = &opInfo{0x0f, "return", immNone}
+	OpCall        = &opInfo{0x10, "call", immIndex}
+	OpReturnCall  = &opInfo{0x12, "return_call", immIndex}
+	OpDrop        = &opInfo{0x1a, "drop", immNone}
+	OpLocalGet    = &opInfo{0x20, "local.get", immIndex}
+	OpLocalSet    = &opInfo{0x21, "local.set", immIndex}
+	OpLocalTee    = &opInfo{0x22, "local.tee", immIndex}
+	OpGlobalGet   = &opInfo{0x23, "global.get", immIndex}
+	OpGlobalSet   = &opInfo{0x24, "global.set", immIndex}
+	OpI32Load     = &opInfo{0x28, "i32.load", immMem}
+	OpI64Load     = &opInfo{0x29, "i64.load", immMem}
+	OpF64Load     = &opInfo{0x2b, "f64.load", immMem}
+	OpI32Load8U   = &opInfo{0x2d, "i32.load8_u", immMem}
+	OpI32Store    = &opInfo{0x36, "i32.store", immMem}
+	OpI64Store    = &opInfo{0x37, "i64.store", immMem}
+	OpF64Store    = &opInfo{0x39, "f64.store", immMem}
+	OpI32Store8   = &opInfo{0x3a, "i32.store8", immMem}
+	OpMemorySize  = &opInfo{0x3f, "memory.size", immMemIdx}
+	OpMemoryGrow  = &opInfo{0x40, "memory.grow", immMemIdx}
+	OpI32Const    = &opInfo{0x41, "i32.const", immI32}
+	OpI64Const    = &opInfo{0x42, "i64.const", immI64}
+	OpF64Const    = &opInfo{0x44, "f64.const", immF64}
+
+	OpI32Eqz  = &opInfo{0x45, "i32.eqz", immNone}
+	OpI32Eq   = &opInfo{0x46, "i32.eq", immNone}
+	OpI32Ne   = &opInfo{0x47, "i32.ne", immNone}
+	OpI32LtS  = &opInfo{0x48, "i32.lt_s", immNone}
+	OpI32LtU  = &opInfo{0x49, "i32.lt_u", immNone}
+	OpI32GtS  = &opInfo{0x4a, "i32.gt_s", immNone}
+	OpI32GtU  = &opInfo{0x4b, "i32.gt_u", immNone}
+	OpI32LeS  = &opInfo{0x4c, "i32.le_s", immNone}
+	OpI32GeS  = &opInfo{0x4e, "i32.ge_s", immNone}
+	OpI64Eqz  = &opInfo{0x50, "i64.eqz", immNone}
+	OpI64Eq   = &opInfo{0x51, "i64.eq", immNone}
+	OpI64Ne   = &opInfo{0x52, "i64.ne", immNone}
+	OpI64LtS  = &opInfo{0x53, "i64.lt_s", immNone}
+	OpI64GtS  = &opInfo{0x55, "i64.gt_s", immNone}
+	OpI64LeS  = &opInfo{0x57, "i64.le_s", immNone}
+	OpI64GeS  = &opInfo{0x59, "i64.ge_s", immNone}
+	OpF64Eq   = &opInfo{0x61, "f64.eq", immNone}
+	OpF64Ne   = &opInfo{0x62, "f64.ne", immNone}
+	OpF64Lt   = &opInfo{0x63, "f64.lt", immNone}
+	OpF64Gt   = &opInfo{0x64, "f64.gt", immNone}
+	OpF64Le   = &opInfo{0x65, "f64.le", immNone}
+	OpF64Ge   = &opInfo{0x66, "f64.ge", immNone}
+	OpI32Add  = &opInfo{0x6a, "i32.add", immNone}
+	OpI32Sub  = &opInfo{0x6b, "i32.sub", immNone}
+	OpI32Mul  = &opInfo{0x6c, "i32.mul", immNone}
+	OpI32DivS = &opInfo{0x6d, "i32.div_s", immNone}
+	OpI32DivU = &opInfo{0x6e, "i32.div_u", immNone}
+	OpI32RemS = &opInfo{0x6f, "i32.rem_s", immNone}
+	OpI32And  = &opInfo{0x71, "i32.and", immNone}
+	OpI32Xor  = &opInfo{0x73, "i32.xor", immNone}
+	OpI32Shl  = &opInfo{0x74, "i32.shl", immNone}
+	OpI32ShrU = &opInfo{0x76, "i32.shr_u", immNone}
+	OpI64Add  = &opInfo{0x7c, "i64.add", immNone}
+	OpI64Sub  = &opInfo{0x7d, "i64.sub", immNone}
+	OpI64Mul  = &opInfo{0x7e, "i64.mul", immNone}
+	OpI64DivS = &opInfo{0x7f, "i64.div_s", immNone}
+	OpI64RemS = &opInfo{0x81, "i64.rem_s", immNone}
+	OpI64Xor  = &opInfo{0x85, "i64.xor", immNone}
+	OpF64Neg  = &opInfo{0x9a, "f64.neg", immNone}
+	OpF64Add  = &opInfo{0xa0, "f64.add", immNone}
+	OpF64Sub  = &opInfo{0xa1, "f64.sub", immNone}
+	OpF64Mul  = &opInfo{0xa2, "f64.mul", immNone}
+	OpF64Div  = &opInfo{0xa3, "f64.div", immNone}
+
+	OpI32WrapI64     = &opInfo{0xa7, "i32.wrap_i64", immNone}
+	OpI32TruncF64S   = &opInfo{0xaa, "i32.trunc_f64_s", immNone}
+	OpI64ExtendI32S  = &opInfo{0xac, "i64.extend_i32_s", immNone}
+	OpI64ExtendI32U  = &opInfo{0xad, "i64.extend_i32_u", immNone}
+	OpI64TruncF64S   = &opInfo{0xb0, "i64.trunc_f64_s", immNone}
+	OpF64ConvertI32S = &opInfo{0xb7, "f64.convert_i32_s", immNone}
+	OpF64ConvertI64S = &opInfo{0xb9, "f64.convert_i64_s", immNone}
+)
+
+// Instr is one instruction. Args holds the immediates: an index, a
+// constant, alignment and offset for memory access, the result type of a
+// block (0x40 for none) or the labels of a br_table.
+type Instr struct {
+	Op      Op
+	Args    []int64
+	Comment string
+}
+
+type Local struct {
+	Name string
+	Type ValType
+}
+
+type Func struct {
+	Name    string
+	Type    FuncType
+	Params  []string
+	Locals  []Local
+	Body    []Instr
+	Export  string
+	typeIdx int
+}
+
+type Import struct {
+	Module  string
+	Name    string
+	Type    FuncType
+	typeIdx int
+}
+
+type Global struct {
+	Name string
+	Type ValType
+	Init int64
+}
+
+type Data struct {
+	Offset int
+	Bytes  []byte
+}
+
+// Module is a WebAssembly module with one exported memory. Imports take the
+// first function indices, as in the binary format.
+type Module struct {
+	Imports   []Import
+	Funcs     []Func
+	Globals   []Global
+	Data      []Data
+	MinPages  int
+	types     []FuncType
+	typeIndex map[string]int
+}
+
+func (m *Module) typeOf(f FuncType) int {
+	if m.typeIndex == nil {
+		m.typeIndex = map[string]int{}
+	}
+	if idx, ok := m.typeIndex[f.key()]; ok {
+		return idx
+	}
+	m.typeIndex[f.key()] = len(m.types)
+	m.types = append(m.types, f)
+	return len(m.types) - 1
+}
+
+func (m *Module) assignTypes() {
+	for i := range m.Imports {
+		m.Imports[i].typeIdx = m.typeOf(m.Imports[i].Type)
+	}
+	for i := range m.Funcs {
+		m.Funcs[i].typeIdx = m.typeOf(m.Funcs[i].Type)
+	}
+}
+
+func uleb(buf *bytes.Buffer, v uint64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			buf.WriteByte(b | 0x80)
+			continue
+		}
+		buf.WriteByte(b)
+		return
+	}
+}
+
+func sleb(buf *bytes.Buffer, v int64) {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			buf.WriteByte(b)
+			return
+		}
+		buf.WriteByte(b | 0x80)
+	}
+}
+
+func name(buf *bytes.Buffer, s string) {
+	uleb(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func section(out *bytes.Buffer, id byte, content *bytes.Buffer) {
+	out.WriteByte(id)
+	uleb(out, uint64(content.Len()))
+	out.Write(content.Bytes())
+}
+
+func encodeInstr(buf *bytes.Buffer, in Instr) {
+	buf.WriteByte(in.Op.code)
+	switch in.Op.imm {
+	case immIndex:
+		uleb(buf, uint64(in.Args[0]))
+	case immI32, immI64:
+		sleb(buf, in.Args[0])
+	case immF64:
+		binary.Write(buf, binary.LittleEndian, uint64(in.Args[0]))
+	case immMem:
+		uleb(buf, uint64(in.Args[0]))
+		uleb(buf, uint64(in.Args[1]))
+	case immBlock:
+		buf.WriteByte(byte(in.Args[0]))
+	case immMemIdx:
+		buf.WriteByte(0x00)
+	case immTable:
+		// the last label is the default
+		uleb(buf, uint64(len(in.Args)-1))
+		for _, label := range in.Args {
+			uleb(buf, uint64(label))
+		}
+	}
+}
+
+// WriteBinary writes the module in the binary format browsers load.
+func (m *Module) WriteBinary(w io.Writer) error {
+	m.assignTypes()
+	out := &bytes.Buffer{}
+	out.Write([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+
+	types := &bytes.Buffer{}
+	uleb(types, uint64(len(m.types)))
+	for _, t := range m.types {
+		types.WriteByte(0x60)
+		uleb(types, uint64(len(t.Params)))
+		for _, p := range t.Params {
+			types.WriteByte(byte(p))
+		}
+		uleb(types, uint64(len(t.Results)))
+		for _, r := range t.Results {
+			types.WriteByte(byte(r))
+		}
+	}
+	section(out, 1, types)
+
+	if len(m.Imports) > 0 {
+		imports := &bytes.Buffer{}
+		uleb(imports, uint64(len(m.Imports)))
+		for _, imp := range m.Imports {
+			name(imports, imp.Module)
+			name(imports, imp.Name)
+			imports.WriteByte(0x00)
+			uleb(imports, uint64(imp.typeIdx))
+		}
+		section(out, 2, imports)
+	}
+
+	funcs := &bytes.Buffer{}
+	uleb(funcs, uint64(len(m.Funcs)))
+	for _, f := range m.Funcs {
+		uleb(funcs, uint64(f.typeIdx))
+	}
+	section(out, 3, funcs)
+
+	memory := &bytes.Buffer{}
+	uleb(memory, 1)
+	memory.WriteByte(0x00)
+	uleb(memory, uint64(m.MinPages))
+	section(out, 5, memory)
+
+	if len(m.Globals) > 0 {
+		globals := &bytes.Buffer{}
+		uleb(globals, uint64(len(m.Globals)))
+		for _, g := range m.Globals {
+			globals.WriteByte(byte(g.Type))
+			globals.WriteByte(0x01)
+			encodeInstr(globals, Instr{Op: constOp(g.Type), Args: []int64{g.Init}})
+			globals.WriteByte(OpEnd.code)
+		}
+		section(out, 6, globals)
+	}
+
+	exports := &bytes.Buffer{}
+	exported := 0
+	for _, f := range m.Funcs {
+		if f.Export != "" {
+			exported++
+		}
+	}
+	uleb(exports, uint64(exported+1))
+	name(exports, "memory")
+	exports.WriteByte(0x02)
+	uleb(exports, 0)
+	for i, f := range m.Funcs {
+		if f.Export != "" {
+			name(exports, f.Export)
+			exports.WriteByte(0x00)
+			uleb(exports, uint64(len(m.Imports)+i))
+		}
+	}
+	section(out, 7, exports)
+
+	code := &bytes.Buffer{}
+	uleb(code, uint64(len(m.Funcs)))
+	for _, f := range m.Funcs {
+		body := &bytes.Buffer{}
+		// locals are declared in runs of the same type
+		runs := []Local{}
+		counts := []uint64{}
+		for _, l := range f.Locals {
+			if len(runs) > 0 && runs[len(runs)-1].Type == l.Type {
+				counts[len(counts)-1]++
+				continue
+			}
+			runs = append(runs, l)
+			counts = append(counts, 1)
+		}
+		uleb(body, uint64(len(runs)))
+		for i, l := range runs {
+			uleb(body, counts[i])
+			body.WriteByte(byte(l.Type))
+		}
+		for _, in := range f.Body {
+			encodeInstr(body, in)
+		}
+		body.WriteByte(OpEnd.code)
+		uleb(code, uint64(body.Len()))
+		code.Write(body.Bytes())
+	}
+	section(out, 10, code)
+
+	if len(m.Data) > 0 {
+		data := &bytes.Buffer{}
+		uleb(data, uint64(len(m.Data)))
+		for _, d := range m.Data {
+			data.WriteByte(0x00)
+			encodeInstr(data, Instr{Op: OpI32Const, Args: []int64{int64(d.Offset)}})
+			data.WriteByte(OpEnd.code)
+			uleb(data, uint64(len(d.Bytes)))
+			data.Write(d.Bytes)
+		}
+		section(out, 11, data)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// watIdent makes name usable as a $identifier, WAT only allows printable
+// ASCII there.
+func watIdent(name string) string {
+	var buf strings.Builder
+	buf.WriteByte('$')
+	for _, r := range name {
+		if r > ' ' && r < 0x7f && !strings.ContainsRune("\"(),;[]{}", r) {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	return buf.String()
+}
+
+func watString(b []byte) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, c := range b {
+		if c < 0x20 || c == 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(&buf, "\\%02x", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// constOp is the const instruction of t. An f64 constant is given as its
+// bits, like a global's Init.
+func constOp(t ValType) Op {
+	switch t {
+	case I32:
+		return OpI32Const
+	case F64:
+		return OpF64Const
+	}
+	return OpI64Const
+}
+
+// watF64 writes the f64 with the given bits so it reads back exactly, NaNs
+// keep their payload.
+func watF64(bits int64) string {
+	f := math.Float64frombits(uint64(bits))
+	switch {
+	case math.IsNaN(f):
+		sign := ""
+		if bits < 0 {
+			sign = "-"
+		}
+		return fmt.Sprintf("%snan:0x%x", sign, uint64(bits)&(1<<52-1))
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'x', -1, 64)
+}
+
+// watConst writes the immediate of t's const instruction.
+func watConst(t ValType, v int64) string {
+	if t == F64 {
+		return watF64(v)
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func watTypes(kind string, types []ValType) string {
+	if len(types) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, t := range types {
+		parts = append(parts, t.String())
+	}
+	return fmt.Sprintf(" (%s %s)", kind, strings.Join(parts, " "))
+}
+
+// WriteText writes the module in the text format. Instructions refer to
+// everything by index, the $names are only there for reading.
+func (m *Module) WriteText(w io.Writer) error {
+	m.assignTypes()
+	var buf strings.Builder
+	buf.WriteString("(module\n")
+	for i, t := range m.types {
+		fmt.Fprintf(&buf, "  (type (;%d;) (func%s%s))\n", i, watTypes("param", t.Params), watTypes("result", t.Results))
+	}
+	for i, imp := range m.Imports {
+		fmt.Fprintf(&buf, "  (import %s %s (func (;%d;) (type %d)))\n", watString([]byte(imp.Module)), watString([]byte(imp.Name)), i, imp.typeIdx)
+	}
+	fmt.Fprintf(&buf, "  (memory (;0;) %d)\n", m.MinPages)
+	for i, g := range m.Globals {
+		fmt.Fprintf(&buf, "  (global %s (;%d;) (mut %s) (%s.const %s))\n", watIdent(g.Name), i, g.Type, g.Type, watConst(g.Type, g.Init))
+	}
+	buf.WriteString("  (export \"memory\" (memory 0))\n")
+	for i, f := range m.Funcs {
+		if f.Export != "" {
+			fmt.Fprintf(&buf, "  (export %s (func %d))\n", watString([]byte(f.Export)), len(m.Imports)+i)
+		}
+	}
+	for i, f := range m.Funcs {
+		fmt.Fprintf(&buf, "  (func %s (;%d;) (type %d)", watIdent(f.Name), len(m.Imports)+i, f.typeIdx)
+		for j, p := range f.Type.Params {
+			fmt.Fprintf(&buf, " (param %s %s)", watIdent(f.Params[j]), p)
+		}
+		buf.WriteString(watTypes("result", f.Type.Results) + "\n")
+		for _, l := range f.Locals {
+			fmt.Fprintf(&buf, "    (local %s %s)\n", watIdent(l.Name), l.Type)
+		}
+		depth := 2
+		for _, in := range f.Body {
+			if in.Op == OpEnd {
+				depth--
+			}
+			buf.WriteString(strings.Repeat("  ", depth) + in.Op.name)
+			switch in.Op.imm {
+			case immIndex, immI32, immI64:
+				fmt.Fprintf(&buf, " %d", in.Args[0])
+			case immF64:
+				fmt.Fprintf(&buf, " %s", watF64(in.Args[0]))
+			case immMem:
+				if in.Args[1] != 0 {
+					fmt.Fprintf(&buf, " offset=%d", in.Args[1])
+				}
+				fmt.Fprintf(&buf, " align=%d", 1<<in.Args[0])
+			case immBlock:
+				if in.Args[0] != 0x40 {
+					fmt.Fprintf(&buf, " (result %s)", ValType(in.Args[0]))
+				}
+			case immTable:
+				for _, label := range in.Args {
+					fmt.Fprintf(&buf, " %d", label)
+				}
+			}
+			if in.Comment != "" {
+				fmt.Fprintf(&buf, " ;; %s", in.Comment)
+			}
+			buf.WriteString("\n")
+			if in.Op.imm == immBlock {
+				depth++
+			}
+		}
+		buf.WriteString("  )\n")
+	}
+	for _, d := range m.Data {
+		fmt.Fprintf(&buf, "  (data (i32.const %d) %s)\n", d.Offset, watString(d.Bytes))
+	}
+	buf.WriteString(")\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
@@ -0,0 +1,20 @@
+// Runs a module from --emit=wasm under node, the imports come from the
+// playground's host so both run a module the same way.
+import { readFileSync } from "fs";
+import { hostEnv } from "../../playground/web/src/lib/wasm-host.mjs";
+
+const tokens = readFileSync(0, "utf8").split(/\s+/).filter(Boolean);
+let memory;
+let out = "";
+
+const env = hostEnv({
+  print: (s) => { out += s; },
+  token: () => tokens.shift(),
+  memory: () => memory,
+});
+
+const { instance } = await WebAssembly.instantiate(readFileSync(process.argv[2]), { env });
+memory = instance.exports.memory;
+const code = instance.exports.main();
+process.stdout.write(out);
+process.exitCode = code & 0xff;
@@ -0,0 +1,841 @@
+package wasmgen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/your-moon/mon_lang/mconstant"
+	"github.com/your-moon/mon_lang/mtypes"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/utfconvert"
+)
+
+// kind is how a TACKY value is held. Strings and arrays are addresses in
+// linear memory, i32 in wasm32, but unlike тоо they widen without a sign.
+// логик is an i32 holding 0 or 1 and a single byte in memory.
+type kind int
+
+const (
+	kindVoid kind = iota
+	kindI32
+	kindI64
+	kindPtr
+	kindBool
+	kindF64
+)
+
+func (k kind) valType() ValType {
+	switch k {
+	case kindI64:
+		return I64
+	case kindF64:
+		return F64
+	}
+	return I32
+}
+
+func kindOf(t mtypes.Type) kind {
+	switch t.(type) {
+	case *mtypes.VoidType:
+		return kindVoid
+	case *mtypes.Int32Type, *mtypes.EnumType:
+		return kindI32
+	case *mtypes.BoolType:
+		return kindBool
+	case *mtypes.DoubleType:
+		return kindF64
+	case *mtypes.StringType, *mtypes.ArrayType, *mtypes.StructType:
+		return kindPtr
+	default:
+		return kindI64
+	}
+}
+
+const (
+	// the first bytes stay zero so no string or array lives at address 0
+	dataStart = 8
+	pageSize  = 65536
+)
+
+// WasmGen translates a TackyProgram into a WebAssembly module. The prelude
+// externs the program calls become imports from "env" under the names
+// lib.c gives them, malloc is a bump allocator in the module, and "main"
+// returns what үндсэн returns.
+//
+// TACKY jumps anywhere while wasm only has structured control flow. Every
+// label starts a block, nested so that breaking out of block i lands on
+// the code of label i: forward jumps are a plain br, backward jumps set
+// $pc and go around a loop that dispatches on it with br_table.
+type WasmGen struct {
+	writer      io.Writer
+	symbolTable *symbols.SymbolTable
+	// TailCalls makes self tail calls loops and other tail calls
+	// return_call
+	TailCalls bool
+	// Text writes the text format instead of the binary one
+	Text bool
+
+	module   Module
+	fnTypes  map[string]*mtypes.FnType
+	funcIdx  map[string]int
+	globals  map[string]int
+	strings  map[string]int
+	dataEnd  int
+	heapIdx  int
+	mallocFn int
+
+	// per function
+	fn      tackygen.TackyFn
+	locals  map[string]int
+	kinds   map[string]kind
+	retKind kind
+	body    []Instr
+	blocks  map[string]int
+	nblocks int
+	current int
+	depth   int
+	pcLocal int
+}
+
+func NewWasmGen(writer io.Writer, symbolTable *symbols.SymbolTable) WasmGen {
+	return WasmGen{
+		writer:      writer,
+		symbolTable: symbolTable,
+		TailCalls:   true,
+		fnTypes:     make(map[string]*mtypes.FnType),
+		funcIdx:     make(map[string]int),
+		globals:     make(map[string]int),
+		strings:     make(map[string]int),
+		dataEnd:     dataStart,
+	}
+}
+
+func (g *WasmGen) GenProgram(program tackygen.TackyProgram) error {
+	for _, fn := range append(append([]tackygen.TackyFn{}, program.ExternDefs...), program.FnDefs...) {
+		if entry := g.symbolTable.Get(fn.Name); entry != nil {
+			if fnType, ok := entry.Type.(*mtypes.FnType); ok {
+				g.fnTypes[fn.Name] = fnType
+			}
+		}
+	}
+
+	// only the externs that are called are imported, the host doesn't have
+	// to provide the rest of the prelude
+	defined := map[string]bool{}
+	for _, fn := range program.FnDefs {
+		defined[fn.Name] = true
+	}
+	for _, fn := range program.ExternDefs {
+		if fn.Name == "malloc" || defined[fn.Name] || !calls(program, fn.Name) {
+			continue
+		}
+		g.funcIdx[fn.Name] = len(g.module.Imports)
+		g.module.Imports = append(g.module.Imports, Import{
+			Module: "env",
+			Name:   utfconvert.UtfConvert(fn.Name),
+			Type:   g.signature(fn.Name, nil),
+		})
+	}
+	base := len(g.module.Imports)
+	g.mallocFn = base
+	for i, fn := range program.FnDefs {
+		g.funcIdx[fn.Name] = base + 1 + i
+	}
+
+	for _, gv := range program.GlobalVars {
+		g.globals[gv.Name] = len(g.module.Globals)
+		g.module.Globals = append(g.module.Globals, Global{
+			Name: utfconvert.UtfConvert(gv.Name),
+			Type: g.varKind(gv.Name).valType(),
+			Init: gv.InitValue,
+		})
+	}
+	g.heapIdx = len(g.module.Globals)
+	g.module.Globals = append(g.module.Globals, Global{Name: ".heap", Type: I32})
+
+	g.module.Funcs = append(g.module.Funcs, Func{Name: "malloc"})
+	hasMain := false
+	for _, fn := range program.FnDefs {
+		g.module.Funcs = append(g.module.Funcs, g.genFn(fn))
+		hasMain = hasMain || fn.Name == "үндсэн"
+	}
+	if hasMain {
+		g.module.Funcs = append(g.module.Funcs, g.genMain())
+	}
+
+	// the heap starts after the strings, the first page holds both
+	heapStart := (g.dataEnd + 15) &^ 15
+	g.module.Globals[g.heapIdx].Init = int64(heapStart)
+	g.module.MinPages = heapStart/pageSize + 1
+	g.module.Funcs[0] = g.genMalloc()
+
+	if g.Text {
+		return g.module.WriteText(g.writer)
+	}
+	return g.module.WriteBinary(g.writer)
+}
+
+func calls(program tackygen.TackyProgram, name string) bool {
+	for _, fn := range program.FnDefs {
+		for _, instr := range fn.Instructions {
+			if call, ok := instr.(tackygen.FnCall); ok && call.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signature is the wasm type of a function, params is used when the symbol
+// table doesn't know it.
+func (g *WasmGen) signature(name string, params []tackygen.TackyVal) FuncType {
+	ft := FuncType{}
+	fnType := g.fnTypes[name]
+	if fnType == nil {
+		for _, p := range params {
+			ft.Params = append(ft.Params, g.valKind(p).valType())
+		}
+		ft.Results = []ValType{I64}
+		return ft
+	}
+	for _, p := range fnType.ParamTypes {
+		ft.Params = append(ft.Params, kindOf(p).valType())
+	}
+	if ret := kindOf(fnType.RetType); ret != kindVoid {
+		ft.Results = []ValType{ret.valType()}
+	}
+	return ft
+}
+
+func (g *WasmGen) paramKinds(name string) []kind {
+	kinds := []kind{}
+	if fnType := g.fnTypes[name]; fnType != nil {
+		for _, p := range fnType.ParamTypes {
+			kinds = append(kinds, kindOf(p))
+		}
+	}
+	return kinds
+}
+
+func (g *WasmGen) retKindOf(name string) kind {
+	if fnType := g.fnTypes[name]; fnType != nil {
+		return kindOf(fnType.RetType)
+	}
+	return kindI64
+}
+
+func (g *WasmGen) varKind(name string) kind {
+	entry := g.symbolTable.Get(name)
+	if entry == nil {
+		return kindI64
+	}
+	return kindOf(entry.Type)
+}
+
+func (g *WasmGen) valKind(val tackygen.TackyVal) kind {
+	switch v := val.(type) {
+	case tackygen.Var:
+		return g.varKind(v.Name)
+	case tackygen.Constant:
+		switch v.Value.(type) {
+		case *mconstant.Int32:
+			return kindI32
+		case *mconstant.Bool:
+			return kindBool
+		case *mconstant.Double:
+			return kindF64
+		}
+		return kindI64
+	case tackygen.StringConstant:
+		return kindPtr
+	}
+	panic(fmt.Sprintf("unimplemented val: %T", val))
+}
+
+func (g *WasmGen) emit(op Op, args ...int64) {
+	g.body = append(g.body, Instr{Op: op, Args: args})
+	switch op {
+	case OpBlock, OpLoop, OpIf:
+		g.depth++
+	case OpEnd:
+		g.depth--
+	}
+}
+
+// genMalloc is a bump allocator, memory grows when the heap runs past it
+// and memory.grow failing traps.
+func (g *WasmGen) genMalloc() Func {
+	g.body = nil
+	g.depth = 0
+	const size, result = 0, 1
+	g.emit(OpGlobalGet, int64(g.heapIdx))
+	g.emit(OpLocalSet, result)
+	g.emit(OpLocalGet, result)
+	g.emit(OpLocalGet, size)
+	g.emit(OpI32WrapI64)
+	g.emit(OpI32Add)
+	g.emit(OpI32Const, 15)
+	g.emit(OpI32Add)
+	g.emit(OpI32Const, -16)
+	g.emit(OpI32And)
+	g.emit(OpGlobalSet, int64(g.heapIdx))
+	g.emit(OpGlobalGet, int64(g.heapIdx))
+	g.emit(OpMemorySize)
+	g.emit(OpI32Const, 16)
+	g.emit(OpI32Shl)
+	g.emit(OpI32GtU)
+	g.emit(OpIf, 0x40)
+	g.emit(OpGlobalGet, int64(g.heapIdx))
+	g.emit(OpMemorySize)
+	g.emit(OpI32Const, 16)
+	g.emit(OpI32Shl)
+	g.emit(OpI32Sub)
+	g.emit(OpI32Const, pageSize-1)
+	g.emit(OpI32Add)
+	g.emit(OpI32Const, 16)
+	g.emit(OpI32ShrU)
+	g.emit(OpMemoryGrow)
+	g.emit(OpI32Const, -1)
+	g.emit(OpI32Eq)
+	g.emit(OpIf, 0x40)
+	g.emit(OpUnreachable)
+	g.emit(OpEnd)
+	g.emit(OpEnd)
+	g.emit(OpLocalGet, result)
+	return Func{
+		Name:   "malloc",
+		Type:   FuncType{Params: []ValType{I64}, Results: []ValType{I32}},
+		Params: []string{"size"},
+		Locals: []Local{{Name: "result", Type: I32}},
+		Body:   g.body,
+	}
+}
+
+// genMain is the "main" export, the exit code as an i32 whatever үндсэн
+// returns. There is no command line, аргс only holds the program name, so
+// аргын_тоо is 1 as for a native program run without arguments.
+func (g *WasmGen) genMain() Func {
+	g.body = nil
+	if entry := g.symbolTable.Get("үндсэн"); entry != nil && len(entry.Type.(*mtypes.FnType).ParamTypes) == 1 {
+		g.emit(OpI32Const, int64(g.argv("program")))
+	}
+	g.emit(OpCall, int64(g.funcIdx["үндсэн"]))
+	switch g.retKindOf("үндсэн") {
+	case kindVoid:
+		g.emit(OpI32Const, 0)
+	case kindI64:
+		g.emit(OpI32WrapI64)
+	}
+	return Func{
+		Name:   "main",
+		Type:   FuncType{Results: []ValType{I32}},
+		Body:   g.body,
+		Export: "main",
+	}
+}
+
+// argv lays out {name, null} in the data, an element is 8 bytes like in
+// every other мөр array.
+func (g *WasmGen) argv(name string) int {
+	nameAddr := g.stringAddr(name)
+	addr := (g.dataEnd + 7) &^ 7
+	slots := make([]byte, 16)
+	binary.LittleEndian.PutUint32(slots, uint32(nameAddr))
+	g.module.Data = append(g.module.Data, Data{Offset: addr, Bytes: slots})
+	g.dataEnd = addr + len(slots)
+	return addr
+}
+
+func (g *WasmGen) genFn(fn tackygen.TackyFn) Func {
+	g.fn = fn
+	g.body = nil
+	g.depth = 0
+	g.locals = map[string]int{}
+	g.kinds = map[string]kind{}
+	g.retKind = g.retKindOf(fn.Name)
+
+	f := Func{Name: utfconvert.UtfConvert(fn.Name), Type: g.signature(fn.Name, fn.Params)}
+	names := map[string]bool{}
+	watName := func(name string) string {
+		n := utfconvert.UtfConvert(name)
+		for i := 1; names[n]; i++ {
+			n = fmt.Sprintf("%s.%d", utfconvert.UtfConvert(name), i)
+		}
+		names[n] = true
+		return n
+	}
+
+	paramKinds := g.paramKinds(fn.Name)
+	for i, param := range fn.Params {
+		v := param.(tackygen.Var)
+		g.locals[v.Name] = i
+		g.kinds[v.Name] = g.varKind(v.Name)
+		if i < len(paramKinds) {
+			g.kinds[v.Name] = paramKinds[i]
+		}
+		f.Params = append(f.Params, watName(v.Name))
+	}
+	g.pcLocal = len(fn.Params)
+	f.Locals = append(f.Locals, Local{Name: watName(".pc"), Type: I32})
+	addLocal := func(val tackygen.TackyVal) {
+		v, ok := val.(tackygen.Var)
+		if !ok {
+			return
+		}
+		if _, seen := g.locals[v.Name]; seen {
+			return
+		}
+		if _, global := g.globals[v.Name]; global {
+			return
+		}
+		k := g.varKind(v.Name)
+		if k == kindVoid {
+			return
+		}
+		g.locals[v.Name] = len(fn.Params) + len(f.Locals)
+		g.kinds[v.Name] = k
+		f.Locals = append(f.Locals, Local{Name: watName(v.Name), Type: k.valType()})
+	}
+	for _, instr := range fn.Instructions {
+		uses, def := tackygen.UsesAndDef(instr)
+		for _, use := range uses {
+			addLocal(use)
+		}
+		if def != nil {
+			addLocal(def)
+		}
+	}
+
+	// block 0 is the entry, every label starts the next one
+	g.blocks = map[string]int{}
+	g.nblocks = 1
+	for _, instr := range fn.Instructions {
+		if lbl, ok := instr.(tackygen.Label); ok {
+			g.blocks[lbl.Ident] = g.nblocks
+			g.nblocks++
+		}
+	}
+
+	g.emit(OpLoop, 0x40)
+	for i := 0; i < g.nblocks; i++ {
+		g.emit(OpBlock, 0x40)
+	}
+	table := []int64{}
+	for i := 0; i < g.nblocks; i++ {
+		table = append(table, int64(i))
+	}
+	g.emit(OpLocalGet, int64(g.pcLocal))
+	g.emit(OpBrTable, table...)
+	g.emit(OpEnd)
+	g.current = 0
+
+	for i := 0; i < len(fn.Instructions); i++ {
+		instr := fn.Instructions[i]
+		if lbl, ok := instr.(tackygen.Label); ok {
+			g.current = g.blocks[lbl.Ident]
+			g.emit(OpEnd)
+			g.body[len(g.body)-1].Comment = utfconvert.UtfConvert(lbl.Ident)
+			continue
+		}
+		if call, ok := g.tailCall(fn.Instructions, i); ok {
+			g.genTailCall(call)
+			i++
+			continue
+		}
+		g.genInstr(instr)
+	}
+	g.emit(OpEnd)
+	// falling off the end without a return
+	if len(f.Type.Results) > 0 {
+		g.emit(OpUnreachable)
+	}
+	f.Body = g.body
+	return f
+}
+
+// tailCall reports whether instrs[i] is a call whose result the next
+// instruction returns.
+func (g *WasmGen) tailCall(instrs []tackygen.Instruction, i int) (tackygen.FnCall, bool) {
+	call, ok := instrs[i].(tackygen.FnCall)
+	if !g.TailCalls || !ok || call.Dst == nil || i+1 >= len(instrs) || call.Name == "malloc" {
+		return call, false
+	}
+	// imports are left to return normally
+	if idx, ok := g.funcIdx[call.Name]; !ok || idx <= g.mallocFn {
+		return call, false
+	}
+	if g.retKindOf(call.Name) != g.retKind {
+		return call, false
+	}
+	ret, ok := instrs[i+1].(tackygen.Return)
+	if !ok {
+		return call, false
+	}
+	dst, isVar := call.Dst.(tackygen.Var)
+	val, isVarVal := ret.Value.(tackygen.Var)
+	return call, isVar && isVarVal && dst.Name == val.Name
+}
+
+func (g *WasmGen) genTailCall(call tackygen.FnCall) {
+	if call.Name != g.fn.Name {
+		g.pushArgs(call)
+		g.emit(OpReturnCall, int64(g.funcIdx[call.Name]))
+		return
+	}
+	// all arguments are read before any parameter is written
+	g.pushArgs(call)
+	for i := len(call.Args) - 1; i >= 0; i-- {
+		g.emit(OpLocalSet, int64(i))
+	}
+	g.jump(0)
+}
+
+// jump goes to block target, see WasmGen.
+func (g *WasmGen) jump(target int) {
+	if target > g.current {
+		// the code of the current block sits inside blocks current+1 and up
+		g.emit(OpBr, int64(g.depthOf(target)))
+		return
+	}
+	g.emit(OpI32Const, int64(target))
+	g.emit(OpLocalSet, int64(g.pcLocal))
+	g.emit(OpBr, int64(g.depthOf(g.nblocks)))
+}
+
+// depthOf is the br depth of the end of block target, or of the dispatch
+// loop for nblocks, from where the code is being emitted.
+func (g *WasmGen) depthOf(target int) int {
+	// depth counts the loop and the blocks still open around the current
+	// code, extra nesting from if adds to it
+	open := g.depth - 1 - (g.nblocks - 1 - g.current)
+	if target == g.nblocks {
+		return g.depth - 1
+	}
+	return open + target - g.current - 1
+}
+
+// push leaves val on the stack as k.
+func (g *WasmGen) push(val tackygen.TackyVal, k kind) {
+	switch v := val.(type) {
+	case tackygen.Var:
+		if idx, ok := g.globals[v.Name]; ok {
+			g.emit(OpGlobalGet, int64(idx))
+			g.coerce(g.varKind(v.Name), k)
+			return
+		}
+		g.emit(OpLocalGet, int64(g.locals[v.Name]))
+		g.coerce(g.kinds[v.Name], k)
+	case tackygen.Constant:
+		if k.valType() == I32 {
+			g.emit(OpI32Const, int64(int32(v.Value.GetValue())))
+		} else {
+			g.emit(constOp(k.valType()), v.Value.GetValue())
+		}
+	case tackygen.StringConstant:
+		g.emit(OpI32Const, int64(g.stringAddr(v.Value)))
+		g.coerce(kindPtr, k)
+	default:
+		panic(fmt.Sprintf("unimplemented val: %T", val))
+	}
+}
+
+// pop stores the top of the stack, of kind k, into dst.
+func (g *WasmGen) pop(dst tackygen.TackyVal, k kind) {
+	v := dst.(tackygen.Var)
+	if idx, ok := g.globals[v.Name]; ok {
+		g.coerce(k, g.varKind(v.Name))
+		g.emit(OpGlobalSet, int64(idx))
+		return
+	}
+	idx, ok := g.locals[v.Name]
+	if !ok {
+		g.emit(OpDrop)
+		return
+	}
+	g.coerce(k, g.kinds[v.Name])
+	g.emit(OpLocalSet, int64(idx))
+}
+
+func (g *WasmGen) coerce(from kind, to kind) {
+	if from.valType() == to.valType() {
+		return
+	}
+	switch {
+	case from == kindF64 || to == kindF64:
+		// the type checker casts with IntToDouble and DoubleToInt
+		panic(fmt.Sprintf("can't convert %s to %s", from.valType(), to.valType()))
+	case to.valType() == I32:
+		g.emit(OpI32WrapI64)
+	case from == kindPtr:
+		g.emit(OpI64ExtendI32U)
+	default:
+		g.emit(OpI64ExtendI32S)
+	}
+}
+
+func (g *WasmGen) stringAddr(s string) int {
+	if addr, ok := g.strings[s]; ok {
+		return addr
+	}
+	addr := g.dataEnd
+	g.strings[s] = addr
+	g.module.Data = append(g.module.Data, Data{Offset: addr, Bytes: append([]byte(s), 0)})
+	g.dataEnd += len(s) + 1
+	return addr
+}
+
+type binaryOps struct {
+	i32, i64 Op
+}
+
+var arithOps = map[tackygen.TackyBinaryOp]binaryOps{
+	tackygen.Add:    {OpI32Add, OpI64Add},
+	tackygen.Sub:    {OpI32Sub, OpI64Sub},
+	tackygen.Mul:    {OpI32Mul, OpI64Mul},
+	tackygen.Div:    {OpI32DivS, OpI64DivS},
+	tackygen.Modulo: {OpI32RemS, OpI64RemS},
+}
+
+var compareOps = map[tackygen.TackyBinaryOp]binaryOps{
+	tackygen.Equal:            {OpI32Eq, OpI64Eq},
+	tackygen.NotEqual:         {OpI32Ne, OpI64Ne},
+	tackygen.LessThan:         {OpI32LtS, OpI64LtS},
+	tackygen.LessThanEqual:    {OpI32LeS, OpI64LeS},
+	tackygen.GreaterThan:      {OpI32GtS, OpI64GtS},
+	tackygen.GreaterThanEqual: {OpI32GeS, OpI64GeS},
+}
+
+var doubleArithOps = map[tackygen.TackyBinaryOp]Op{
+	tackygen.Add: OpF64Add,
+	tackygen.Sub: OpF64Sub,
+	tackygen.Mul: OpF64Mul,
+	tackygen.Div: OpF64Div,
+}
+
+// doubleCompareOps are false when either side is a NaN, except for ne.
+var doubleCompareOps = map[tackygen.TackyBinaryOp]Op{
+	tackygen.Equal:            OpF64Eq,
+	tackygen.NotEqual:         OpF64Ne,
+	tackygen.LessThan:         OpF64Lt,
+	tackygen.LessThanEqual:    OpF64Le,
+	tackygen.GreaterThan:      OpF64Gt,
+	tackygen.GreaterThanEqual: OpF64Ge,
+}
+
+// arithKind is the integer kind arithmetic on k happens in, addresses are
+// computed in i64 as in the other backends.
+func arithKind(k kind) kind {
+	if k == kindPtr {
+		return kindI64
+	}
+	return k
+}
+
+func pick(ops binaryOps, k kind) Op {
+	if k.valType() == I32 {
+		return ops.i32
+	}
+	return ops.i64
+}
+
+func (g *WasmGen) genInstr(instr tackygen.Instruction) {
+	switch ir := instr.(type) {
+	case tackygen.SourceLine:
+	case tackygen.Copy:
+		k := g.valKind(ir.Dst)
+		g.push(ir.Src, k)
+		g.pop(ir.Dst, k)
+	case tackygen.Truncate:
+		g.push(ir.Src, kindI32)
+		g.pop(ir.Dst, kindI32)
+	case tackygen.SignExtend:
+		g.push(ir.Src, kindI32)
+		g.coerce(kindI32, kindI64)
+		g.pop(ir.Dst, kindI64)
+	case tackygen.IntToDouble:
+		k := arithKind(g.valKind(ir.Src))
+		g.push(ir.Src, k)
+		g.emit(pick(binaryOps{OpF64ConvertI32S, OpF64ConvertI64S}, k))
+		g.pop(ir.Dst, kindF64)
+	case tackygen.DoubleToInt:
+		// out of range and NaN trap, like a division by zero
+		k := arithKind(g.valKind(ir.Dst))
+		g.push(ir.Src, kindF64)
+		g.emit(pick(binaryOps{OpI32TruncF64S, OpI64TruncF64S}, k))
+		g.pop(ir.Dst, k)
+	case tackygen.Unary:
+		k := arithKind(g.valKind(ir.Dst))
+		switch {
+		case ir.Op == tackygen.Negate && k == kindF64:
+			g.push(ir.Src, k)
+			g.emit(OpF64Neg)
+		case ir.Op == tackygen.Negate:
+			if k.valType() == I32 {
+				g.emit(OpI32Const, 0)
+			} else {
+				g.emit(OpI64Const, 0)
+			}
+			g.push(ir.Src, k)
+			g.emit(pick(binaryOps{OpI32Sub, OpI64Sub}, k))
+		case ir.Op == tackygen.Complement:
+			g.push(ir.Src, k)
+			if k.valType() == I32 {
+				g.emit(OpI32Const, -1)
+			} else {
+				g.emit(OpI64Const, -1)
+			}
+			g.emit(pick(binaryOps{OpI32Xor, OpI64Xor}, k))
+		case ir.Op == tackygen.Not:
+			srcKind := arithKind(g.valKind(ir.Src))
+			g.push(ir.Src, srcKind)
+			g.emit(pick(binaryOps{OpI32Eqz, OpI64Eqz}, srcKind))
+			g.coerce(kindI32, k)
+		default:
+			panic(fmt.Sprintf("unimplemented unary op: %s", ir.Op))
+		}
+		g.pop(ir.Dst, k)
+	case tackygen.Binary:
+		k := arithKind(g.valKind(ir.Dst))
+		if g.valKind(ir.Src1) == kindF64 {
+			g.push(ir.Src1, kindF64)
+			g.push(ir.Src2, kindF64)
+			if op, ok := doubleArithOps[ir.Op]; ok {
+				g.emit(op)
+			} else if op, ok := doubleCompareOps[ir.Op]; ok {
+				g.emit(op)
+				g.coerce(kindI32, k)
+			} else {
+				panic(fmt.Sprintf("unimplemented double op: %s", ir.Op))
+			}
+		} else if ops, ok := arithOps[ir.Op]; ok {
+			g.push(ir.Src1, k)
+			g.push(ir.Src2, k)
+			g.emit(pick(ops, k))
+		} else if ops, ok := compareOps[ir.Op]; ok {
+			// compare in the wider of the two operand types
+			cmpKind := kindI32
+			if arithKind(g.valKind(ir.Src1)) == kindI64 || arithKind(g.valKind(ir.Src2)) == kindI64 {
+				cmpKind = kindI64
+			}
+			g.push(ir.Src1, cmpKind)
+			g.push(ir.Src2, cmpKind)
+			g.emit(pick(ops, cmpKind))
+			g.coerce(kindI32, k)
+		} else {
+			panic(fmt.Sprintf("unimplemented binary op: %s", ir.Op))
+		}
+		g.pop(ir.Dst, k)
+	case tackygen.Load:
+		k := g.valKind(ir.Dst)
+		g.push(ir.Src, kindPtr)
+		if k == kindBool {
+			g.emit(OpI32Load8U, 0, 0)
+		} else if k == kindF64 {
+			g.emit(OpF64Load, 3, 0)
+		} else if k.valType() == I32 {
+			g.emit(OpI32Load, 2, 0)
+		} else {
+			g.emit(OpI64Load, 3, 0)
+		}
+		g.pop(ir.Dst, k)
+	case tackygen.Store:
+		k := g.valKind(ir.Src)
+		g.push(ir.Dst, kindPtr)
+		g.push(ir.Src, k)
+		if k == kindBool {
+			g.emit(OpI32Store8, 0, 0)
+		} else if k == kindF64 {
+			g.emit(OpF64Store, 3, 0)
+		} else if k.valType() == I32 {
+			g.emit(OpI32Store, 2, 0)
+		} else {
+			g.emit(OpI64Store, 3, 0)
+		}
+	case tackygen.Jump:
+		g.jump(g.blocks[ir.Target])
+	case tackygen.JumpIfZero:
+		g.condJump(ir.Val, true, ir.Ident)
+	case tackygen.JumpIfNotZero:
+		g.condJump(ir.Val, false, ir.Ident)
+	case tackygen.JumpTable:
+		g.jumpTable(ir)
+	case tackygen.Return:
+		if g.retKind != kindVoid {
+			g.push(ir.Value, g.retKind)
+		}
+		g.emit(OpReturn)
+	case tackygen.FnCall:
+		g.genCall(ir)
+	default:
+		panic(fmt.Sprintf("unimplemented instruction: %T", instr))
+	}
+}
+
+func (g *WasmGen) condJump(val tackygen.TackyVal, zero bool, target string) {
+	k := arithKind(g.valKind(val))
+	g.push(val, k)
+	if zero {
+		g.emit(pick(binaryOps{OpI32Eqz, OpI64Eqz}, k))
+	} else if k == kindI64 {
+		g.emit(OpI64Const, 0)
+		g.emit(OpI64Ne)
+	}
+	g.emit(OpIf, 0x40)
+	g.jump(g.blocks[target])
+	g.emit(OpEnd)
+}
+
+// jumpTable opens a block per target and br_table leaves the one for the
+// index, the code after each block's end jumps to its target. Targets can
+// be before the table too, so they go through jump.
+func (g *WasmGen) jumpTable(table tackygen.JumpTable) {
+	for range table.Targets {
+		g.emit(OpBlock, 0x40)
+	}
+	depths := []int64{}
+	for i := range table.Targets {
+		depths = append(depths, int64(i))
+	}
+	g.push(table.Index, kindI32)
+	// the last depth is br_table's default, tackygen checked the range
+	g.emit(OpBrTable, depths...)
+	for _, target := range table.Targets {
+		g.emit(OpEnd)
+		g.jump(g.blocks[target])
+	}
+}
+
+func (g *WasmGen) pushArgs(call tackygen.FnCall) {
+	paramKinds := g.paramKinds(call.Name)
+	for i, arg := range call.Args {
+		k := g.valKind(arg)
+		switch {
+		case call.Name == "malloc":
+			k = kindI64
+		case i < len(paramKinds):
+			k = paramKinds[i]
+		}
+		g.push(arg, k)
+	}
+}
+
+func (g *WasmGen) genCall(call tackygen.FnCall) {
+	g.pushArgs(call)
+	retKind := g.retKindOf(call.Name)
+	if call.Name == "malloc" {
+		g.emit(OpCall, int64(g.mallocFn))
+		retKind = kindPtr
+	} else {
+		g.emit(OpCall, int64(g.funcIdx[call.Name]))
+	}
+	if retKind == kindVoid {
+		return
+	}
+	if call.Dst == nil {
+		g.emit(OpDrop)
+		return
+	}
+	g.pop(call.Dst, retKind)
+}
@@ -0,0 +1,166 @@
+package wasmgen
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-moon/mon_lang/parser"
+	semanticanalysis "github.com/your-moon/mon_lang/semantic_analysis"
+	"github.com/your-moon/mon_lang/symbols"
+	"github.com/your-moon/mon_lang/tackygen"
+	"github.com/your-moon/mon_lang/util/unique"
+)
+
+func genModule(t *testing.T, srcFile string, text bool) []byte {
+	t.Helper()
+	data, err := os.ReadFile(srcFile)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	source := append([]int32(string(data)), 0)
+
+	uniqueGen := unique.NewUniqueGen()
+	p := parser.NewParser(source)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	table := symbols.NewSymbolTable()
+	resolver := semanticanalysis.NewSemanticAnalyzer(source, uniqueGen, table, filepath.Dir(srcFile), "../stdlib")
+	resolved, symbolTable, err := resolver.Analyze(program)
+	if err != nil {
+		t.Fatalf("semantic analysis failed: %v", err)
+	}
+	tackyGen := tackygen.NewTackyGen(uniqueGen, table)
+	tackyProgram := tackyGen.EmitTacky(resolved)
+
+	var out bytes.Buffer
+	wasmGen := NewWasmGen(&out, symbolTable)
+	wasmGen.Text = text
+	if err := wasmGen.GenProgram(tackyProgram); err != nil {
+		t.Fatalf("wasm failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+// compileAndRun runs the module under node with testdata/run.mjs as the
+// host.
+func compileAndRun(t *testing.T, srcFile string, input string) string {
+	t.Helper()
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	wasmFile := filepath.Join(t.TempDir(), "out.wasm")
+	if err := os.WriteFile(wasmFile, genModule(t, srcFile, false), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(node, "testdata/run.mjs", wasmFile)
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		t.Fatalf("node failed: %v\n%s", err, exitErr.Stderr)
+	}
+	return string(output)
+}
+
+func TestControlFlow(t *testing.T) {
+	output := compileAndRun(t, "../test/features/control_flow.mn", "")
+	if output != "3 12 6 20 99\n" {
+		t.Errorf("expected %q, got %q", "3 12 6 20 99\n", output)
+	}
+}
+
+func TestTypeCoercion(t *testing.T) {
+	output := compileAndRun(t, "../test/features/types.mn", "")
+	if output != "300 30 42 100\n" {
+		t.Errorf("expected %q, got %q", "300 30 42 100\n", output)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	output := compileAndRun(t, "../test/features/tail_calls.mn", "")
+	if output != "50000005000000 21 20\n" {
+		t.Errorf("expected %q, got %q", "50000005000000 21 20\n", output)
+	}
+}
+
+func TestHeap(t *testing.T) {
+	output := compileAndRun(t, "../test/features/free.mn", "")
+	if output != "42\n" {
+		t.Errorf("expected %q, got %q", "42\n", output)
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	output := compileAndRun(t, "../test/examples/fibonacci.mn", "10\n")
+	if output != "5555" {
+		t.Errorf("expected %q, got %q", "5555", output)
+	}
+}
+
+func TestDoubles(t *testing.T) {
+	expected := "8.5 2.75 12.5664 -0.75 250.001 5e+09\n9 3 3.5\n7.5 тийм 1.5 0.333333 1.23457e+09\n"
+	output := compileAndRun(t, "../test/features/doubles.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	expected := "улаан ногоон цэнхэр улаан 1 20 тэнцүү\n2 2\n1,2,4\n"
+	output := compileAndRun(t, "../test/features/enums.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	expected := "? да мя лх пү ба амралт амралт ? \n123445 01239 дулаан\n43\n"
+	output := compileAndRun(t, "../test/features/switch.mn", "")
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+// TestArgs checks аргс holds the program name and аргын_тоо counts it, as
+// for a native program run without arguments.
+func TestArgs(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "args.mn")
+	src := "функц үндсэн(аргс: мөр[]) -> тоо {\n    хэвлэ(аргын_тоо());\n    мөр_хэвлэх(\" \");\n    мөр_хэвлэх(аргс[0]);\n    буц 0;\n}\n"
+	if err := os.WriteFile(srcFile, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := compileAndRun(t, srcFile, "")
+	if output != "1 program" {
+		t.Errorf("expected %q, got %q", "1 program", output)
+	}
+}
+
+func TestText(t *testing.T) {
+	wat := string(genModule(t, "../test/features/strings.mn", true))
+	for _, want := range []string{`(import "env" "mqr_khevlekh"`, `(export "main"`, "(data (i32.const 8)"} {
+		if !strings.Contains(wat, want) {
+			t.Errorf("missing %q in\n%s", want, wat)
+		}
+	}
+}
+
+func TestLEB128(t *testing.T) {
+	var buf bytes.Buffer
+	uleb(&buf, 624485)
+	if !bytes.Equal(buf.Bytes(), []byte{0xe5, 0x8e, 0x26}) {
+		t.Errorf("uleb: unexpected % x", buf.Bytes())
+	}
+	buf.Reset()
+	sleb(&buf, -123456)
+	if !bytes.Equal(buf.Bytes(), []byte{0xc0, 0xbb, 0x78}) {
+		t.Errorf("sleb: unexpected % x", buf.Bytes())
+	}
+}